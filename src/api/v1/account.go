@@ -0,0 +1,358 @@
+package v1
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/email"
+	"github.com/ImpactDevelopment/ImpactServer/src/middleware"
+	"github.com/ImpactDevelopment/ImpactServer/src/outbox"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/ImpactDevelopment/ImpactServer/src/util"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// accountDeletionGrace is how long the user has to change their mind after asking for their account to be deleted
+	accountDeletionGrace = 14 * 24 * time.Hour
+	// recentLogin is how recently a user without a password must have logged in to confirm it's really them
+	recentLogin = 10 * time.Minute
+)
+
+func init() {
+	util.DoRepeatedly(time.Hour, deleteDueAccounts)
+}
+
+// accountExport is everything we store about a user
+type accountExport struct {
+	ExportedAt string                        `json:"exported_at"`
+	Account    exportedAccount               `json:"account"`
+	Donations  []database.Donation           `json:"donations"`
+	Sessions   []database.Session            `json:"sessions"`
+	Passkeys   []database.WebAuthnCredential `json:"passkeys"`
+	TwoFactor  bool                          `json:"two_factor"`
+	CapeUpload *database.CapeUpload          `json:"cape_upload,omitempty"`
+}
+
+type exportedAccount struct {
+	ID            uuid.UUID             `json:"id"`
+	CreatedAt     int64                 `json:"created_at"`
+	Email         string                `json:"email,omitempty"`
+	EmailVerified bool                  `json:"email_verified"`
+	PendingEmail  string                `json:"pending_email,omitempty"`
+	Locale        string                `json:"locale,omitempty"`
+	MinecraftID   *uuid.UUID            `json:"minecraft_id,omitempty"`
+	DiscordID     string                `json:"discord_id,omitempty"`
+	HasPassword   bool                  `json:"has_password"`
+	LegacyEnabled bool                  `json:"legacy_enabled"`
+	Incognito     bool                  `json:"incognito"`
+	Roles         []exportedRole        `json:"roles"`
+	Customization *users.Customization  `json:"customization,omitempty"`
+	Cosmetics     *users.CosmeticChoice `json:"cosmetics,omitempty"`
+	DeleteAt      *int64                `json:"deletion_scheduled_at,omitempty"`
+}
+
+type exportedRole struct {
+	ID      string `json:"id"`
+	Expires string `json:"expires,omitempty"`
+}
+
+// API Handler GET /user/me/export?format=zip
+// Returns everything we store about the user as json, or as a zip with a json file for each section
+func getUserExport(c echo.Context) error {
+	user := middleware.GetUser(c)
+	export, err := exportAccount(user)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error exporting account").SetInternal(err)
+	}
+
+	filename := "impact-account-" + time.Now().UTC().Format("2006-01-02")
+	switch c.QueryParam("format") {
+	case "", "json":
+		c.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename="+filename+".json")
+		return c.JSONPretty(http.StatusOK, export, "  ")
+	case "zip":
+		data, err := zipExport(export)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "error zipping export").SetInternal(err)
+		}
+		c.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename="+filename+".zip")
+		return c.Blob(http.StatusOK, "application/zip", data)
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "format must be json or zip")
+	}
+}
+
+func exportAccount(user *users.User) (*accountExport, error) {
+	createdAt, err := database.GetUserCreatedAt(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	pendingEmail, err := database.GetPendingEmail(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	deleteAt, err := database.GetAccountDeletion(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	donations, err := database.GetUserDonations(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := database.GetUserSessions(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	passkeys, err := database.GetUserWebAuthnCredentials(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	twoFactor, err := database.HasTwoFactor(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	capeUpload, err := database.GetLatestCapeUpload(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]exportedRole, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		exported := exportedRole{ID: role.ID}
+		if role.Expires != nil {
+			exported.Expires = role.Expires.UTC().Format(time.RFC3339)
+		}
+		roles = append(roles, exported)
+	}
+
+	return &accountExport{
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Account: exportedAccount{
+			ID:            user.ID,
+			CreatedAt:     createdAt,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			PendingEmail:  pendingEmail,
+			Locale:        user.Locale,
+			MinecraftID:   user.MinecraftID,
+			DiscordID:     user.DiscordID,
+			HasPassword:   user.PasswordHash != "",
+			LegacyEnabled: user.LegacyEnabled,
+			Incognito:     user.Incognito,
+			Roles:         roles,
+			Customization: user.Customization,
+			Cosmetics:     user.Cosmetics,
+			DeleteAt:      deleteAt,
+		},
+		Donations:  donations,
+		Sessions:   sessions,
+		Passkeys:   passkeys,
+		TwoFactor:  twoFactor,
+		CapeUpload: capeUpload,
+	}, nil
+}
+
+// zipExport puts each top level field of the export in its own json file
+func zipExport(export *accountExport) ([]byte, error) {
+	data, err := json.Marshal(export)
+	if err != nil {
+		return nil, err
+	}
+	var sections map[string]json.RawMessage
+	err = json.Unmarshal(data, &sections)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	for _, name := range names {
+		var pretty bytes.Buffer
+		err = json.Indent(&pretty, sections[name], "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		writer, err := zipWriter.Create(name + ".json")
+		if err != nil {
+			return nil, err
+		}
+		_, err = writer.Write(pretty.Bytes())
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = zipWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// API Handler GET /user/me/donations
+// Lists the donations the user made while logged in, redeemed, or paid for using their email
+func getUserDonations(c echo.Context) error {
+	user := middleware.GetUser(c)
+	donations, err := database.GetUserDonations(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching donations").SetInternal(err)
+	}
+	return c.JSON(http.StatusOK, donations)
+}
+
+// confirmIdentity makes the user prove it's really them before doing something drastic.
+// They need their password if they have one, otherwise they must have logged in recently. Users with two factor need a code too.
+func confirmIdentity(c echo.Context, user *users.User, password string, code string) error {
+	if user.PasswordHash != "" {
+		if password == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "password is required")
+		}
+		err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusUnauthorized, "incorrect password")
+		}
+	} else {
+		sessions, err := database.GetUserSessions(user.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "error fetching sessions").SetInternal(err)
+		}
+		current := currentSessionID(c)
+		var recent bool
+		for _, session := range sessions {
+			if session.ID == current && time.Unix(session.CreatedAt, 0).After(time.Now().Add(-recentLogin)) {
+				recent = true
+			}
+		}
+		if !recent {
+			return echo.NewHTTPError(http.StatusUnauthorized, "log in again to confirm it's you")
+		}
+	}
+
+	twoFactor, err := database.HasTwoFactor(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching two factor status").SetInternal(err)
+	}
+	if twoFactor {
+		return verifyTwoFactorCode(c, code)
+	}
+	return nil
+}
+
+// API Handler DELETE /user/me
+// Schedules the account to be deleted once the grace period is over, and logs out every other device
+func deleteUser(c echo.Context) error {
+	user := middleware.GetUser(c)
+	var body struct {
+		Password string `json:"password" form:"password"`
+		Code     string `json:"code" form:"code"`
+	}
+	err := c.Bind(&body)
+	if err != nil {
+		return err
+	}
+	err = confirmIdentity(c, user, body.Password, body.Code)
+	if err != nil {
+		return err
+	}
+
+	deleteAt := time.Now().Add(accountDeletionGrace)
+	err = database.ScheduleAccountDeletion(user.ID, deleteAt)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error scheduling account deletion").SetInternal(err)
+	}
+	err = database.DeleteUserSessions(database.DB, user.ID, currentSessionID(c))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error logging out other sessions").SetInternal(err)
+	}
+
+	if user.Email != "" && user.EmailVerified {
+		link := util.GetServerURL()
+		link.Path = "/account.html"
+		err = sendEmail(user.Email, emailLocale(c, user), email.AccountDeletion, email.AccountDeletionData{
+			Date: deleteAt.UTC().Format("2006-01-02"),
+			URL:  link.String(),
+		})
+		if err != nil {
+			// It's scheduled either way
+			log.Println("Error sending account deletion email", err)
+		}
+	}
+
+	return c.JSON(http.StatusAccepted, struct {
+		Message  string `json:"message"`
+		DeleteAt int64  `json:"deletion_scheduled_at"`
+	}{"success", deleteAt.Unix()})
+}
+
+// API Handler DELETE /user/me/deletion
+// Cancels a scheduled account deletion
+func cancelUserDeletion(c echo.Context) error {
+	user := middleware.GetUser(c)
+	cancelled, err := database.CancelAccountDeletion(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error cancelling account deletion").SetInternal(err)
+	}
+	if !cancelled {
+		return echo.NewHTTPError(http.StatusNotFound, "account is not being deleted")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// deleteDueAccounts deletes every account whose grace period is over
+func deleteDueAccounts() {
+	ids, err := database.GetDueAccountDeletions()
+	if err != nil {
+		log.Println("Error fetching accounts to delete", err)
+		return
+	}
+	for _, id := range ids {
+		err = deleteAccount(id)
+		if err != nil {
+			log.Printf("Error deleting account %s: %s\n", id, err.Error())
+			continue
+		}
+		log.Println("Deleted account", id)
+	}
+}
+
+// deleteAccount deletes the user now, their discord roles are removed once it's committed
+func deleteAccount(userID uuid.UUID) error {
+	user := database.LookupUserByID(userID)
+
+	// Stop charging them before the subscriptions are forgotten
+	err := cancelSubscriptions(userID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = database.DeleteAccount(tx, userID)
+	if err != nil {
+		return err
+	}
+	if user != nil && user.DiscordID != "" {
+		err = outbox.Enqueue(tx, jobDiscordDonator, discordDonatorJob{DiscordID: user.DiscordID})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,52 @@
+package v1
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZipExport(t *testing.T) {
+	export := &accountExport{
+		ExportedAt: "2020-01-02T03:04:05Z",
+		Account: exportedAccount{
+			ID:    uuid.New(),
+			Email: "someone@example.com",
+			Roles: []exportedRole{{ID: "premium"}},
+		},
+		Donations: []database.Donation{{Currency: "usd", Roles: []string{"premium"}}},
+		Sessions:  []database.Session{},
+		Passkeys:  []database.WebAuthnCredential{},
+	}
+
+	data, err := zipExport(export)
+	require.NoError(t, err)
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	files := make(map[string][]byte)
+	for _, file := range reader.File {
+		r, err := file.Open()
+		require.NoError(t, err)
+		files[file.Name], err = ioutil.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+	}
+	assert.Len(t, files, 6, "cape_upload is omitted when empty")
+	for _, name := range []string{"account.json", "donations.json", "sessions.json", "passkeys.json", "two_factor.json", "exported_at.json"} {
+		assert.Contains(t, files, name)
+	}
+
+	var account exportedAccount
+	require.NoError(t, json.Unmarshal(files["account.json"], &account))
+	assert.Equal(t, export.Account.ID, account.ID)
+	assert.Equal(t, "someone@example.com", account.Email)
+	assert.Contains(t, string(files["donations.json"]), `"currency": "usd"`, "files should be indented")
+}
@@ -0,0 +1,78 @@
+package v1
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/middleware"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// API Handler GET /admin/apikeys
+func getAPIKeys(c echo.Context) error {
+	keys, err := database.GetAPIKeys()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching api keys").SetInternal(err)
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+// API Handler POST /admin/apikeys
+// The key itself is only ever included in this response
+func postAPIKey(c echo.Context) error {
+	var body struct {
+		Owner  string   `json:"owner"`
+		Scopes []string `json:"scopes"`
+	}
+	err := c.Bind(&body)
+	if err != nil {
+		return err
+	}
+	if body.Owner == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "owner is required")
+	}
+	if len(body.Scopes) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "at least one scope is required")
+	}
+	scopes := make([]string, 0, len(body.Scopes))
+	for _, scope := range body.Scopes {
+		if _, ok := middleware.APIKeyScopes[scope]; !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, "unknown scope "+scope)
+		}
+		if !containsString(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+
+	id, secret, hash, err := middleware.NewAPIKey()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error creating api key").SetInternal(err)
+	}
+	key, err := database.CreateAPIKey(id, body.Owner, hash, scopes, middleware.GetUser(c).ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error saving api key").SetInternal(err)
+	}
+	return c.JSON(http.StatusCreated, struct {
+		database.APIKey
+		Key string `json:"key"`
+	}{*key, secret})
+}
+
+// API Handler DELETE /admin/apikeys/:id
+func deleteAPIKey(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid api key id").SetInternal(err)
+	}
+	revoked, err := database.RevokeAPIKey(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error revoking api key").SetInternal(err)
+	}
+	if !revoked {
+		return echo.NewHTTPError(http.StatusNotFound, "api key not found")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
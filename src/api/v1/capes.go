@@ -0,0 +1,185 @@
+package v1
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/middleware"
+	"github.com/ImpactDevelopment/ImpactServer/src/s3proxy"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// capeUploadResponse is a cape upload along with a url the texture can be fetched from
+type capeUploadResponse struct {
+	database.CapeUpload
+	// Public url once approved, otherwise a short-lived preview url
+	URL string `json:"url,omitempty"`
+}
+
+// pendingCapeKey is where an upload is kept while it waits for review
+func pendingCapeKey(hash string) string {
+	return s3proxy.PendingPrefix + "capes/" + hash + ".png"
+}
+
+// publishedCapeKey is where an upload is copied to once approved
+func publishedCapeKey(hash string) string {
+	return "img/texture/capes/" + hash + ".png"
+}
+
+func makeCapeUploadResponse(upload database.CapeUpload) capeUploadResponse {
+	ret := capeUploadResponse{CapeUpload: upload}
+	if upload.Status == database.CapeUploadApproved {
+		ret.URL = s3proxy.FilesURL + publishedCapeKey(upload.Hash)
+	} else if preview, err := s3proxy.PresignGet(pendingCapeKey(upload.Hash), 15*time.Minute); err == nil {
+		ret.URL = preview
+	}
+	return ret
+}
+
+// API Handler POST /user/me/cape
+// Accepts either a raw image/png body or a multipart form with the png in the "cape" field
+func postCape(c echo.Context) error {
+	user := middleware.GetUser(c)
+	if user == nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "not logged in")
+	}
+	if !user.CanUploadCape() {
+		return echo.NewHTTPError(http.StatusForbidden, "your roles do not allow uploading a cape")
+	}
+
+	var body io.Reader
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), "image/png") {
+		body = c.Request().Body
+	} else {
+		file, err := c.FormFile("cape")
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "cape png is required").SetInternal(err)
+		}
+		src, err := file.Open()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "unable to read cape").SetInternal(err)
+		}
+		defer src.Close()
+		body = src
+	}
+
+	texture, err := users.ProcessCapeTexture(body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+
+	err = s3proxy.Upload(pendingCapeKey(texture.Hash), "image/png", texture.Data)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error storing cape").SetInternal(err)
+	}
+	upload, err := database.CreateCapeUpload(user.ID, texture.Hash, texture.Width, texture.Height)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error saving cape upload").SetInternal(err)
+	}
+
+	return c.JSON(http.StatusAccepted, makeCapeUploadResponse(*upload))
+}
+
+// API Handler GET /user/me/cape
+func getMyCapeUpload(c echo.Context) error {
+	user := middleware.GetUser(c)
+	if user == nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "not logged in")
+	}
+	upload, err := database.GetLatestCapeUpload(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching cape upload").SetInternal(err)
+	}
+	if upload == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "no cape uploaded")
+	}
+	return c.JSON(http.StatusOK, makeCapeUploadResponse(*upload))
+}
+
+// API Handler GET /admin/capes?status=pending
+func getCapeUploads(c echo.Context) error {
+	status := c.QueryParam("status")
+	switch status {
+	case "":
+		status = database.CapeUploadPending
+	case database.CapeUploadPending, database.CapeUploadApproved, database.CapeUploadRejected:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid status")
+	}
+
+	list, err := database.GetCapeUploads(status)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching cape uploads").SetInternal(err)
+	}
+	ret := make([]capeUploadResponse, 0, len(list))
+	for _, upload := range list {
+		ret = append(ret, makeCapeUploadResponse(upload))
+	}
+	return c.JSON(http.StatusOK, ret)
+}
+
+// API Handler POST /admin/capes/:id/approve
+func approveCapeUpload(c echo.Context) error {
+	upload, err := paramPendingCapeUpload(c)
+	if err != nil {
+		return err
+	}
+
+	// Publish the texture before pointing anyone's cape at it
+	key := publishedCapeKey(upload.Hash)
+	err = s3proxy.Copy(pendingCapeKey(upload.Hash), key)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error publishing cape").SetInternal(err)
+	}
+	// The customizations trigger notifies users_updated, so user info is refreshed automatically
+	err = database.ApproveCapeUpload(upload.ID, middleware.GetUser(c).ID, s3proxy.FilesURL+key)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error()).SetInternal(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// API Handler POST /admin/capes/:id/reject
+func rejectCapeUpload(c echo.Context) error {
+	var body struct {
+		Reason string `json:"reason" form:"reason" query:"reason"`
+	}
+	err := c.Bind(&body)
+	if err != nil {
+		return err
+	}
+	upload, err := paramPendingCapeUpload(c)
+	if err != nil {
+		return err
+	}
+
+	err = database.RejectCapeUpload(upload.ID, middleware.GetUser(c).ID, body.Reason)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error()).SetInternal(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// paramPendingCapeUpload looks up the upload matching the :id path param, which must still be pending review
+func paramPendingCapeUpload(c echo.Context) (*database.CapeUpload, error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid upload id").SetInternal(err)
+	}
+	upload, err := database.GetCapeUpload(id)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "error fetching cape upload").SetInternal(err)
+	}
+	if upload == nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "upload not found")
+	}
+	if upload.Status != database.CapeUploadPending {
+		return nil, echo.NewHTTPError(http.StatusConflict, "upload has already been "+upload.Status)
+	}
+	return upload, nil
+}
@@ -0,0 +1,95 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// API Handler GET /admin/customizations
+func getCustomizations(c echo.Context) error {
+	list, err := database.GetAllCustomizations()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching customizations").SetInternal(err)
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// API Handler GET /admin/customizations/:user
+func getCustomization(c echo.Context) error {
+	user, err := paramUser(c)
+	if err != nil {
+		return err
+	}
+	entry, err := database.GetCustomization(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching customization").SetInternal(err)
+	}
+	if entry == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "user has no customization")
+	}
+	return c.JSON(http.StatusOK, entry)
+}
+
+// API Handler PUT /admin/customizations/:user
+func putCustomization(c echo.Context) error {
+	user, err := paramUser(c)
+	if err != nil {
+		return err
+	}
+
+	var body users.Customization
+	err = c.Bind(&body)
+	if err != nil {
+		return err
+	}
+	if body.Info == nil && body.Edition == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "info or edition is required, use DELETE to remove a customization")
+	}
+	err = body.Validate()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+
+	// The customizations trigger notifies users_updated, so user info is refreshed automatically
+	err = database.SetCustomization(user.ID, body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error saving customization").SetInternal(err)
+	}
+	return getCustomization(c)
+}
+
+// API Handler DELETE /admin/customizations/:user
+func deleteCustomization(c echo.Context) error {
+	user, err := paramUser(c)
+	if err != nil {
+		return err
+	}
+	deleted, err := database.DeleteCustomization(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error deleting customization").SetInternal(err)
+	}
+	if !deleted {
+		return echo.NewHTTPError(http.StatusNotFound, "user has no customization")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// paramUser looks up the user matching the :user path param, which can be either a user id or a minecraft uuid
+func paramUser(c echo.Context) (*users.User, error) {
+	id, err := uuid.Parse(c.Param("user"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid user id").SetInternal(err)
+	}
+	user := database.LookupUserByID(id)
+	if user == nil {
+		user = database.LookupUserByMinecraftID(id)
+	}
+	if user == nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+	return user, nil
+}
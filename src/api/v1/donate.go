@@ -3,10 +3,19 @@ package v1
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"github.com/ImpactDevelopment/ImpactServer/src/currency"
 	"github.com/ImpactDevelopment/ImpactServer/src/database"
 	"github.com/ImpactDevelopment/ImpactServer/src/discord"
+	"github.com/ImpactDevelopment/ImpactServer/src/email"
+	"github.com/ImpactDevelopment/ImpactServer/src/middleware"
+	"github.com/ImpactDevelopment/ImpactServer/src/outbox"
+	"github.com/ImpactDevelopment/ImpactServer/src/payments"
+	"github.com/ImpactDevelopment/ImpactServer/src/paypal"
 	"github.com/ImpactDevelopment/ImpactServer/src/recaptcha"
 	"github.com/ImpactDevelopment/ImpactServer/src/stripe"
+	"github.com/ImpactDevelopment/ImpactServer/src/tiers"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
 	"github.com/ImpactDevelopment/ImpactServer/src/util"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -15,7 +24,7 @@ import (
 	"log"
 	"net"
 	"net/http"
-	"strconv"
+	"net/url"
 	"strings"
 	"sync"
 
@@ -28,7 +37,9 @@ type redeemRequest struct {
 }
 
 type redeemResponse struct {
-	Token string `json:"token" form:"token" query:"token"`
+	Token string `json:"token,omitempty" form:"token" query:"token"`
+	// Credited is true if the donation went straight to the donor's account instead of generating a token
+	Credited bool `json:"credited" form:"credited" query:"credited"`
 }
 
 type createRequest struct {
@@ -40,6 +51,8 @@ type createRequest struct {
 type createResponse struct {
 	*stripe.Payment
 	Premium bool `json:"premium" form:"premium" query:"premium"`
+	// Tier is the id of the donation tier the amount qualifies for, if any
+	Tier string `json:"tier,omitempty" form:"tier" query:"tier"`
 }
 
 type stripeInfoReqponse struct {
@@ -47,6 +60,9 @@ type stripeInfoReqponse struct {
 	PubKey          string                         `json:"stripe_public_key" form:"stripe_public_key" query:"stripe_public_key"`
 	DefaultCurrency string                         `json:"default_currency" form:"default_currency" query:"default_currency"`
 	Currencies      map[string]stripe.CurrencyInfo `json:"currencies" form:"currencies" query:"currencies"`
+	Tiers           []database.DonationTier        `json:"tiers" form:"tiers" query:"tiers"`
+	Intervals       []string                       `json:"subscription_intervals" form:"subscription_intervals" query:"subscription_intervals"`
+	PayPal          bool                           `json:"paypal_enabled" form:"paypal_enabled" query:"paypal_enabled"`
 }
 
 const defaultCurrency = "usd"
@@ -55,44 +71,29 @@ const defaultCurrency = "usd"
 var donationLock sync.Mutex
 
 func getStripeInfo(c echo.Context) error {
+	list, err := tiers.Get()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Error getting donation tiers").SetInternal(err)
+	}
 	return c.JSON(http.StatusOK, &stripeInfoReqponse{
 		Version:         upstreamstripe.APIVersion,
 		PubKey:          stripe.PublicKey,
 		DefaultCurrency: defaultCurrency,
-		Currencies:      stripe.GetCurrencyMap(),
+		Currencies:      stripe.GetCurrencyMap(list),
+		Tiers:           list,
+		Intervals:       stripe.SubscriptionIntervals(),
+		PayPal:          paypal.Default != nil,
 	})
 }
 
 func createStripePayment(c echo.Context) error {
-	var body createRequest
-	err := c.Bind(&body)
+	body, currency, user, err := bindCreateRequest(c)
 	if err != nil {
 		return err
 	}
-
-	// Default currency
-	if body.Currency == "" {
-		body.Currency = defaultCurrency
-	} else {
-		body.Currency = strings.ToLower(strings.TrimSpace(body.Currency))
-	}
-
-	// Validate currency
-	currency, err := stripe.GetCurrencyInfo(body.Currency)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
-	}
-
-	if body.Amount == 0 {
-		return echo.NewHTTPError(http.StatusBadRequest, "order amount is empty")
-	}
-
-	// Validate email
-	if body.Email == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "email is empty")
-	}
-	if !util.IsValidEmail(body.Email) {
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid email: "+body.Email)
+	var userID string
+	if user != nil {
+		userID = user.ID.String()
 	}
 
 	// Don't create the payment if the source address is blacklisted
@@ -109,7 +110,7 @@ func createStripePayment(c echo.Context) error {
 		return err
 	}
 
-	payment, err := stripe.CreatePayment(body.Amount, body.Currency, "Donation", body.Email)
+	payment, err := stripe.CreatePayment(body.Amount, body.Currency, "Donation", body.Email, emailLocale(c, user), userID)
 	if err != nil {
 		return err
 	}
@@ -120,9 +121,55 @@ func createStripePayment(c echo.Context) error {
 	return c.JSON(http.StatusOK, &createResponse{
 		Payment: payment,
 		Premium: payment.Amount >= currency.Amount,
+		Tier:    tierID(payment.Currency, payment.Amount),
 	})
 }
 
+// bindCreateRequest binds and validates a request to create a donation, with any provider.
+// user is the logged in user, if any, who the donation will be credited to.
+func bindCreateRequest(c echo.Context) (body createRequest, currency *stripe.CurrencyInfo, user *users.User, err error) {
+	err = c.Bind(&body)
+	if err != nil {
+		return
+	}
+
+	// Default currency
+	if body.Currency == "" {
+		body.Currency = defaultCurrency
+	} else {
+		body.Currency = strings.ToLower(strings.TrimSpace(body.Currency))
+	}
+
+	// Validate currency
+	currency, err = stripe.GetCurrencyInfo(body.Currency)
+	if err != nil {
+		err = echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+		return
+	}
+
+	if body.Amount == 0 {
+		err = echo.NewHTTPError(http.StatusBadRequest, "order amount is empty")
+		return
+	}
+
+	// Logged in donations are credited to the account, so they don't need an email to send the token to
+	user = middleware.GetUser(c)
+	if user != nil && body.Email == "" && user.EmailVerified {
+		body.Email = user.Email
+	}
+
+	// Validate email
+	if body.Email == "" && user == nil {
+		err = echo.NewHTTPError(http.StatusBadRequest, "email is empty")
+		return
+	}
+	if body.Email != "" && !util.IsValidEmail(body.Email) {
+		err = echo.NewHTTPError(http.StatusBadRequest, "invalid email: "+body.Email)
+		return
+	}
+	return
+}
+
 func redeemStripePayment(c echo.Context) error {
 	var body redeemRequest
 	err := c.Bind(&body)
@@ -146,62 +193,56 @@ func redeemStripePayment(c echo.Context) error {
 	if payment.PaymentIntent.Status != upstreamstripe.PaymentIntentStatusSucceeded {
 		return echo.NewHTTPError(http.StatusBadRequest, "Bad Payment Status: Payment "+body.ID+" is "+string(payment.PaymentIntent.Status)+", expected status "+string(upstreamstripe.PaymentIntentStatusSucceeded))
 	}
-	// Check payment is a valid currency
-	currency, err := stripe.GetCurrencyInfo(payment.Currency)
+	// Check payment is a valid currency, the threshold is converted from USD at today's exchange rate
+	info, err := stripe.GetCurrencyInfo(payment.Currency)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Bad Payment Currency: Payment "+body.ID+" is in "+payment.Currency+", which isn't supported")
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad Payment Currency: Payment "+body.ID+" is in "+payment.Currency+", which isn't supported").SetInternal(err)
 	}
 	// Check payment was enough for perks
-	if payment.PaymentIntent.Amount < currency.Amount {
-		return echo.NewHTTPError(http.StatusBadRequest, "Bad Payment Amount: Payment "+body.ID+" totals "+strconv.FormatInt(payment.Amount, 10)+", expected "+strconv.FormatInt(currency.Amount, 10)+" or more")
+	tier, err := matchTier(payment.Currency, payment.Amount)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Error matching payment "+body.ID+" to a donation tier").SetInternal(err)
+	}
+	if tier == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad Payment Amount: Payment "+body.ID+" totals "+currency.Format(payment.Currency, payment.Amount)+", expected "+currency.Format(payment.Currency, info.Amount)+" or more")
 	}
 
-	// Now that we are interacting with the DB we should lock
-	donationLock.Lock()
-
-	// Store the donation in the DB - or fetch it if it already exists
-	token, err := getOrCreateDonation(body.ID, payment.Email, payment.Currency, payment.Amount)
+	// The webhook may have beaten us to it, recordDonation only stores it once either way
+	token, _, credited, err := recordDonation(stripe.ToPayment(payment.PaymentIntent))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Error saving pending donation").SetInternal(err)
+		return err
 	}
 
-	// Log the donation to discord
-	go func() {
-		_ = editOrCreateDonationLog("Someone just donated and generated a token", payment.PaymentIntent, token)
-		donationLock.Unlock() // Done messing with donation logging
-	}()
-
+	// Donations made while logged in went straight to the account, so there's no token to show
+	if credited {
+		return c.JSON(http.StatusOK, &redeemResponse{Credited: true})
+	}
 	return c.JSON(http.StatusOK, &redeemResponse{
 		Token: token.String(),
 	})
 }
 
 func handleStripeWebhook(c echo.Context) error {
-	// Read body payload
-	const maxBodyBytes = int64(65536)
-	var payload []byte
-	var err error
-	if c.Request().Body != nil {
-		payload, err = ioutil.ReadAll(io.LimitReader(c.Request().Body, maxBodyBytes))
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "unable to read request body").SetInternal(err)
-		}
+	payload, err := readWebhookPayload(c)
+	if err != nil {
+		return err
 	}
 
 	// Get & validate webhook event
-	event, err := stripe.GetWebhookEvent(payload, c.Request().Header.Get("Stripe-Signature"))
+	parsed, err := stripe.Provider{}.ParseWebhook(c.Request().Header, payload)
 	if err != nil {
 		return err
 	}
+	event := parsed.Raw.(*stripe.WebhookEvent)
 
 	// Choose a handler for the webhook event
 	switch event.Type {
 	case "payment_intent.succeeded":
-		var paymentIntent upstreamstripe.PaymentIntent
-		if err := unmarshal(event, &paymentIntent); err != nil {
-			return err
+		// Subscription payments grant premium directly, they don't need a registration token, see syncSubscription
+		if parsed.Type != payments.EventSucceeded {
+			return c.NoContent(http.StatusOK)
 		}
-		return handlePaymentSucceeded(c, event, &paymentIntent)
+		return handlePaymentSucceeded(c, parsed.Payment)
 	case "charge.succeeded":
 		var charge upstreamstripe.Charge
 		if err := unmarshal(event, &charge); err != nil {
@@ -214,12 +255,24 @@ func handleStripeWebhook(c echo.Context) error {
 			return err
 		}
 		return handleChargeFailed(c, event, &charge)
+	case "customer.subscription.created", "customer.subscription.updated", "customer.subscription.deleted":
+		var subscription upstreamstripe.Subscription
+		if err := unmarshal(event, &subscription); err != nil {
+			return err
+		}
+		return handleSubscriptionEvent(c, event, &subscription)
+	case "invoice.paid", "invoice.payment_failed":
+		var invoice upstreamstripe.Invoice
+		if err := unmarshal(event, &invoice); err != nil {
+			return err
+		}
+		return handleInvoiceEvent(c, event, &invoice)
 	case "charge.refunded":
 		var refund upstreamstripe.Charge
 		if err := unmarshal(event, &refund); err != nil {
 			return err
 		}
-		return handleRefund(c, event, &refund)
+		return handleRefund(c, event, &refund, parsed.Payment)
 	// TODO: Handle failed refunds; charge.refund.updated with status:failed along with a failure_reason and failure_balance_transaction
 	//       https://stripe.com/docs/refunds#failed-refunds
 	//case "charge.refund.updated":
@@ -228,6 +281,19 @@ func handleStripeWebhook(c echo.Context) error {
 	}
 }
 
+// readWebhookPayload reads the raw body of a webhook request, which is needed to verify its signature
+func readWebhookPayload(c echo.Context) ([]byte, error) {
+	const maxBodyBytes = int64(65536)
+	if c.Request().Body == nil {
+		return nil, nil
+	}
+	payload, err := ioutil.ReadAll(io.LimitReader(c.Request().Body, maxBodyBytes))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "unable to read request body").SetInternal(err)
+	}
+	return payload, nil
+}
+
 func unmarshal(event *stripe.WebhookEvent, it interface{}) error {
 	err := json.Unmarshal(event.Data.Raw, it)
 	if err != nil {
@@ -236,25 +302,137 @@ func unmarshal(event *stripe.WebhookEvent, it interface{}) error {
 	return nil
 }
 
-func handlePaymentSucceeded(c echo.Context, event *stripe.WebhookEvent, payment *upstreamstripe.PaymentIntent) error {
+func handlePaymentSucceeded(c echo.Context, payment *payments.Payment) error {
+	token, _, credited, err := recordDonation(payment)
+	if err != nil {
+		return err
+	}
+
+	// Update the payment with the token and send the email receipt, credited donations don't need a token
+	if credited {
+		err = stripe.SendReceipt(payment, nil)
+	} else {
+		err = stripe.SendReceipt(payment, &token)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// recordDonation stores a successful payment from any provider. Donations made while logged in are credited straight
+// to the donor's account, everyone else is emailed a registration token.
+// Providers retry webhooks and donors retry captures, so it's safe to call more than once; created is only true the first time.
+func recordDonation(payment *payments.Payment) (token uuid.UUID, created bool, credited bool, err error) {
+	var user *users.User
+	if userID, err := uuid.Parse(payment.UserID); err == nil {
+		// If the account has been deleted since, fall back to a token
+		user = database.LookupUserByID(userID)
+	}
+	credited = user != nil
+
 	donationLock.Lock()
 	defer donationLock.Unlock()
 
+	tx, err := database.DB.Begin()
+	if err != nil {
+		err = echo.NewHTTPError(http.StatusInternalServerError, "Error starting database transaction").SetInternal(err)
+		return
+	}
+	defer tx.Rollback()
+
 	// Check the DB to see if a pending_donation already exists, create one if not
-	token, err := getOrCreateDonation(payment.ID, payment.Metadata["email"], payment.Currency, payment.Amount)
+	var donationID uuid.UUID
+	token, donationID, created, err = getOrCreateDonation(tx, payment, credited)
 	if err != nil {
-		return err
+		err = echo.NewHTTPError(http.StatusInternalServerError, "Error saving pending donation").SetInternal(err)
+		return
+	}
+	// Everything below was already queued the first time
+	if !created {
+		return
 	}
 
-	// Update the payment with the token and send the email receipt
-	err = stripe.SendReceipt(payment, &token)
+	message := "Someone just donated"
+	if credited {
+		err = database.RedeemDonation(tx, token, user.ID)
+		if err != nil {
+			err = echo.NewHTTPError(http.StatusInternalServerError, "Error crediting donation").SetInternal(err)
+			return
+		}
+		// Donations too small for a premium tier are still credited, but there's nothing to tell discord about
+		var premium bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM pending_donation_roles WHERE token=$1 AND role_id='premium')`, token).Scan(&premium)
+		if err != nil {
+			err = echo.NewHTTPError(http.StatusInternalServerError, "Error checking donation roles").SetInternal(err)
+			return
+		}
+		if premium {
+			message = "Someone just donated to their account"
+		}
+		if premium && user.DiscordID != "" {
+			err = outbox.Enqueue(tx, jobDiscordDonator, discordDonatorJob{DiscordID: user.DiscordID, Donator: true})
+			if err != nil {
+				err = echo.NewHTTPError(http.StatusInternalServerError, "Error queueing discord roles").SetInternal(err)
+				return
+			}
+		}
+	}
+
+	if payment.Email != "" {
+		err = outbox.Enqueue(tx, jobReceipt, receiptJob{
+			Email:      payment.Email,
+			Locale:     payment.Locale,
+			Currency:   payment.Currency,
+			Amount:     payment.Amount,
+			DonationID: donationID,
+			Credited:   credited,
+		})
+		if err != nil {
+			err = echo.NewHTTPError(http.StatusInternalServerError, "Error queueing receipt email").SetInternal(err)
+			return
+		}
+	}
+
+	err = outbox.Enqueue(tx, jobDonationLog, donationLogJob{
+		DonationID: donationID,
+		Message:    message,
+		Currency:   payment.Currency,
+		Amount:     payment.Amount,
+	})
 	if err != nil {
-		return err
+		err = echo.NewHTTPError(http.StatusInternalServerError, "Error queueing donation log").SetInternal(err)
+		return
 	}
 
-	_ = editOrCreateDonationLog("Someone just donated", payment, token)
+	err = tx.Commit()
+	if err != nil {
+		err = echo.NewHTTPError(http.StatusInternalServerError, "Error saving pending donation").SetInternal(err)
+	}
+	return
+}
 
-	return c.NoContent(http.StatusOK)
+// sendDonationCreditedEmail thanks the donor and tells them where to find their premium
+func sendDonationCreditedEmail(address string, locale string, currencyCode string, amount int64) error {
+	link := util.GetServerURL()
+	link.Path = "/account.html"
+	return sendEmail(address, email.Locale(locale, ""), email.DonationCredited, email.DonationCreditedData{
+		Amount: currency.Format(currencyCode, amount),
+		URL:    link.String(),
+	})
+}
+
+// sendReceiptEmail thanks the donor and tells them how to use their registration token
+func sendReceiptEmail(address string, locale string, currencyCode string, amount int64, token uuid.UUID) error {
+	link := util.GetServerURL()
+	link.Path = "/register.html"
+	link.RawQuery = url.Values{"token": {token.String()}}.Encode()
+	return sendEmail(address, email.Locale(locale, ""), email.Receipt, email.ReceiptData{
+		Amount: currency.Format(currencyCode, amount),
+		Token:  token.String(),
+		URL:    link.String(),
+	})
 }
 
 func handleChargeSucceeded(c echo.Context, event *stripe.WebhookEvent, charge *upstreamstripe.Charge) error {
@@ -271,7 +449,8 @@ func handleChargeSucceeded(c echo.Context, event *stripe.WebhookEvent, charge *u
 }
 
 func handleChargeFailed(c echo.Context, event *stripe.WebhookEvent, charge *upstreamstripe.Charge) error {
-	if charge.PaymentIntent != nil {
+	// Failed subscription renewals aren't made from the donate page, so there's no IP address to blame
+	if charge.PaymentIntent != nil && charge.Invoice == nil {
 		var ip string
 		err := database.DB.QueryRow("SELECT ip_address FROM payment_intents WHERE stripe_payment_id = $1", charge.PaymentIntent.ID).Scan(&ip)
 		if err != nil {
@@ -295,16 +474,16 @@ func handleChargeFailed(c echo.Context, event *stripe.WebhookEvent, charge *upst
 	return c.NoContent(http.StatusOK)
 }
 
-func handleRefund(c echo.Context, event *stripe.WebhookEvent, charge *upstreamstripe.Charge) error {
+func handleRefund(c echo.Context, event *stripe.WebhookEvent, charge *upstreamstripe.Charge, payment *payments.Payment) error {
 	// First things first, lets reverse any associated transfers (i.e. share distributions to connected accounts)
 	err := stripe.ReverseDistribution(charge)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "error reversing transfers for refunded charge "+charge.ID).SetInternal(err)
 	}
 
-	// Next, revoke any perks granted by this donation
-	if charge.PaymentIntent != nil {
-		err = revokeDonation(charge.PaymentIntent)
+	// Next, revoke any perks granted by this donation, subscription charges are handled by syncSubscription
+	if payment != nil {
+		err = revokeDonation(payment)
 		if err != nil {
 			return err
 		}
@@ -313,20 +492,67 @@ func handleRefund(c echo.Context, event *stripe.WebhookEvent, charge *upstreamst
 	return c.NoContent(http.StatusOK)
 }
 
-// Helper func to add a donation to pending_donations - or fetch the token if it already exists
-func getOrCreateDonation(paymentID string, email string, currency string, amount int64) (token uuid.UUID, err error) {
+// donationColumns are the pending_donations columns that each provider's payment id and payer email are stored in
+var donationColumns = map[string]struct{ id, email string }{
+	stripe.Name: {"stripe_payment_id", "stripe_payer_email"},
+	paypal.Name: {"paypal_order_id", "paypal_payer_email"},
+}
+
+// matchTier returns the donation tier the amount qualifies for, or nil if it's too small for any of them
+func matchTier(currencyCode string, amount int64) (*database.DonationTier, error) {
+	list, err := tiers.Get()
+	if err != nil {
+		return nil, err
+	}
+	return tiers.Match(list, currencyCode, amount)
+}
+
+// tierID returns the id of the donation tier the amount qualifies for, or an empty string if there isn't one
+func tierID(currencyCode string, amount int64) string {
+	tier, err := matchTier(currencyCode, amount)
+	if err != nil || tier == nil {
+		return ""
+	}
+	return tier.ID
+}
+
+// Helper func to add a donation to pending_donations - or fetch the token if it already exists.
+// The token grants the roles of the donation tier the payment qualifies for, if any.
+// created is true if the donation didn't already exist. Credited donations have already been used by the account they
+// were made from, the caller should redeem them if created is true. donationID refers to the donation without being
+// able to redeem it, e.g. in outbox jobs.
+func getOrCreateDonation(tx *sql.Tx, payment *payments.Payment, credited bool) (token uuid.UUID, donationID uuid.UUID, created bool, err error) {
+	columns, ok := donationColumns[payment.Provider]
+	if !ok {
+		err = fmt.Errorf("unknown payment provider %q", payment.Provider)
+		return
+	}
+	tier, err := matchTier(payment.Currency, payment.Amount)
+	if err != nil {
+		return
+	}
+	var matched sql.NullString
+	if tier != nil {
+		matched = sql.NullString{String: tier.ID, Valid: true}
+	}
+
 	// INSERT if no conflict or simply SELECT if already exists
-	err = database.DB.QueryRow(`
+	err = tx.QueryRow(fmt.Sprintf(`
 		WITH new_pending_donation AS (
-    		INSERT INTO pending_donations(stripe_payment_id, stripe_payer_email, currency, amount, premium)
-    		VALUES ($1, $2, $3, $4, TRUE)
-    		ON CONFLICT(stripe_payment_id) DO NOTHING
-    		RETURNING token
-		) SELECT COALESCE (
-		    (SELECT token FROM new_pending_donation),
-		    (SELECT token FROM pending_donations WHERE NOT used AND stripe_payment_id = $1)
-		)`,
-		paymentID, email, currency, amount).Scan(&token)
+    		INSERT INTO pending_donations(%[1]s, %[2]s, paypal_payer_id, currency, amount, credited, tier_id)
+    		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, $7)
+    		ON CONFLICT(%[1]s) DO NOTHING
+    		RETURNING token, donation_id, tier_id
+		), new_pending_donation_roles AS (
+    		INSERT INTO pending_donation_roles(token, role_id, duration)
+    		SELECT token, role_id, duration FROM new_pending_donation INNER JOIN donation_tier_roles USING (tier_id)
+		), existing_pending_donation AS (
+		    SELECT token, donation_id FROM pending_donations WHERE (credited OR NOT used) AND %[1]s = $1
+		) SELECT
+		    COALESCE ((SELECT token FROM new_pending_donation), (SELECT token FROM existing_pending_donation)),
+		    COALESCE ((SELECT donation_id FROM new_pending_donation), (SELECT donation_id FROM existing_pending_donation)),
+		    EXISTS (SELECT 1 FROM new_pending_donation)`, columns.id, columns.email),
+		payment.ID, payment.Email, payment.PayerID, payment.Currency, payment.Amount, credited, matched).Scan(&token, &donationID, &created)
 	if err != nil {
 		log.Println(err)
 	}
@@ -334,27 +560,61 @@ func getOrCreateDonation(paymentID string, email string, currency string, amount
 }
 
 // Helper func to edit the donation discord log - or create on if it doesn't exist
-func editOrCreateDonationLog(message string, payment *upstreamstripe.PaymentIntent, token uuid.UUID) error {
+func editOrCreateDonationLog(message string, currency string, amount int64, donationID uuid.UUID) error {
 	// Get logID if it exitst
 	var logID sql.NullString
-	database.DB.QueryRow(`SELECT log_msg_id FROM pending_donations WHERE token = $1`, token).Scan(&logID)
+	database.DB.QueryRow(`SELECT log_msg_id FROM pending_donations WHERE donation_id = $1`, donationID).Scan(&logID)
 
-	newLogID, err := discord.LogDonationEvent(logID.String, message, "", nil, payment.Currency, payment.Amount)
+	newLogID, err := discord.LogDonationEvent(logID.String, message, "", nil, currency, amount)
 	if !logID.Valid && err == nil {
-		database.DB.Exec(`UPDATE pending_donations SET log_msg_id = $2 WHERE token = $1`, token, newLogID)
+		database.DB.Exec(`UPDATE pending_donations SET log_msg_id = $2 WHERE donation_id = $1`, donationID, newLogID)
 	}
 	return err
 }
 
-// revokeDonation mark's the associated token as used, and deletes any user created with the token.
+// paymentProvider returns the provider with the given name, or nil if there isn't one or it isn't configured
+func paymentProvider(name string) payments.Provider {
+	switch name {
+	case stripe.Name:
+		return stripe.Provider{}
+	case paypal.Name:
+		if paypal.Default != nil {
+			return paypal.Default
+		}
+	}
+	return nil
+}
+
+// API Handler POST /admin/donations/:provider/:id/refund
+// Refunds the payment in full, the provider's webhook revokes the donation once the refund goes through
+func postRefund(c echo.Context) error {
+	provider := paymentProvider(c.Param("provider"))
+	if provider == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "unknown payment provider")
+	}
+	err := provider.RefundPayment(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadGateway, "error refunding payment").SetInternal(err)
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+// revokeDonation marks the associated token as used and takes back whatever it gave the account that redeemed it, see
+// database.UnredeemDonation. Accounts that were created with the token are deleted, like the donor had deleted it.
 // It also updates the discord log message accordingly
-func revokeDonation(payment *upstreamstripe.PaymentIntent) error {
+func revokeDonation(payment *payments.Payment) error {
+	columns, ok := donationColumns[payment.Provider]
+	if !ok {
+		return echo.NewHTTPError(http.StatusInternalServerError, "unknown payment provider "+payment.Provider)
+	}
+
 	donationLock.Lock()
 	defer donationLock.Unlock()
 
-	var token uuid.UUID
+	var token, donationID uuid.UUID
 	var user *uuid.UUID
-	err := database.DB.QueryRow(`SELECT token, used_by FROM pending_donations WHERE stripe_payment_id=$1`, payment.ID).Scan(&token, &user)
+	var createdUser, refunded bool
+	err := database.DB.QueryRow(`SELECT token, donation_id, used_by, created_user, refunded FROM pending_donations WHERE `+columns.id+`=$1`, payment.ID).Scan(&token, &donationID, &user, &createdUser, &refunded)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// No token has been generated with this payment, nothing to do
@@ -364,6 +624,20 @@ func revokeDonation(payment *upstreamstripe.PaymentIntent) error {
 			return echo.NewHTTPError(http.StatusInternalServerError, "sql error finding tokens associated with payment").SetInternal(err)
 		}
 	}
+	if refunded {
+		// The webhook is being retried
+		return nil
+	}
+
+	// The account wouldn't exist without the donation. This cancels any subscriptions and takes their discord roles too.
+	// It's done first so that a retry after an error doesn't skip it, used_by is cleared once the account is gone.
+	if user != nil && createdUser {
+		err = deleteAccount(*user)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "error deleting refunded user").SetInternal(err)
+		}
+		user = nil
+	}
 
 	// Make DB changes in a transaction
 	tx, err := database.DB.Begin()
@@ -372,30 +646,47 @@ func revokeDonation(payment *upstreamstripe.PaymentIntent) error {
 	}
 	defer tx.Rollback()
 
-	// TODO add a specific refunded field instead of just setting used=true
-	_, err = tx.Exec(`UPDATE pending_donations SET used = true WHERE token=$1`, token)
+	_, err = tx.Exec(`UPDATE pending_donations SET used = true, refunded = true WHERE token=$1`, token)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "sql error marking token as used").SetInternal(err)
 	}
 
 	if user != nil {
-		_, err = tx.Exec(`DELETE FROM users WHERE user_id=$1`, user)
+		// Whether it was credited or registered with, take back what it was given
+		err = database.UnredeemDonation(tx, token, *user)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "sql error revoking refunded roles").SetInternal(err)
+		}
+		// They might still have premium from somewhere else, if it's time-limited expireRoles takes care of discord when it runs out
+		var premium bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM user_roles WHERE user_id=$1 AND role_id='premium' AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW())))`, user).Scan(&premium)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "sql error deleting refunded user").SetInternal(err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "sql error checking remaining roles").SetInternal(err)
+		}
+		if u := database.LookupUserByID(*user); !premium && u != nil && u.DiscordID != "" {
+			err = outbox.Enqueue(tx, jobDiscordDonator, discordDonatorJob{DiscordID: u.DiscordID, Donator: false})
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "error queueing discord roles").SetInternal(err)
+			}
 		}
 	}
 
-	err = tx.Commit()
+	// log refund to discord
+	// TODO consider also DMing the devs or posting something somewhere like #staff-announcements or #senior-citizens?
+	err = outbox.Enqueue(tx, jobDonationLog, donationLogJob{
+		DonationID: donationID,
+		Message:    "This donation was refunded",
+		Currency:   payment.Currency,
+		Amount:     payment.Amount,
+	})
 	if err != nil {
-		log.Print(err.Error())
-		return echo.NewHTTPError(http.StatusInternalServerError, "sql error committing transaction").SetInternal(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "error queueing refund log").SetInternal(err)
 	}
 
-	// log refund to discord
-	// TODO consider also DMing the devs or posting something somewhere like #staff-announcements or #senior-citizens?
-	err = editOrCreateDonationLog("This donation was refunded", payment, token)
+	err = tx.Commit()
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "error logging refund to discord").SetInternal(err)
+		log.Print(err.Error())
+		return echo.NewHTTPError(http.StatusInternalServerError, "sql error committing transaction").SetInternal(err)
 	}
 
 	return nil
@@ -0,0 +1,202 @@
+package v1
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/email"
+	"github.com/ImpactDevelopment/ImpactServer/src/jwt"
+	"github.com/ImpactDevelopment/ImpactServer/src/middleware"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/ImpactDevelopment/ImpactServer/src/util"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// emailVerifyLifetime is how long a confirmation link works for
+	emailVerifyLifetime = 24 * time.Hour
+	// emailRevertLifetime is how long the old address can undo a change, long enough to notice after a holiday
+	emailRevertLifetime = 7 * 24 * time.Hour
+)
+
+// sendEmail renders the named email in locale and sends it
+func sendEmail(to string, locale string, name string, data interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	return email.Send(ctx, to, locale, name, data)
+}
+
+// emailLocale picks the locale to email user in, the request is used if they haven't chosen one. user can be nil.
+func emailLocale(c echo.Context, user *users.User) string {
+	var locale string
+	if user != nil {
+		locale = user.Locale
+	}
+	return email.Locale(locale, c.Request().Header.Get("Accept-Language"))
+}
+
+// emailTokenURL returns a link to the page on the website that uses the token
+func emailTokenURL(page string, token string) string {
+	link := util.GetServerURL()
+	link.Path = page
+	link.RawQuery = url.Values{"token": {token}}.Encode()
+	return link.String()
+}
+
+// createEmailToken stores a new email verification token, returning the token to put in the link
+func createEmailToken(userID uuid.UUID, kind string, email string, lifetime time.Duration) (string, error) {
+	token, hash, err := jwt.NewSecret()
+	if err != nil {
+		return "", err
+	}
+	err = database.CreateEmailVerification(hash, database.EmailVerification{
+		UserID:    userID,
+		Kind:      kind,
+		Email:     email,
+		ExpiresAt: time.Now().Add(lifetime).Unix(),
+	})
+	return token, err
+}
+
+// sendVerificationEmail asks the user to confirm they own address. If it isn't already their email, it will be once confirmed.
+func sendVerificationEmail(userID uuid.UUID, address string, locale string) error {
+	token, err := createEmailToken(userID, database.EmailVerify, address, emailVerifyLifetime)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create verification token").SetInternal(err)
+	}
+	err = sendEmail(address, locale, email.VerifyEmail, email.LinkData{URL: emailTokenURL("/verifyemail.html", token)})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to send verification email").SetInternal(err)
+	}
+	return nil
+}
+
+// sendRevertEmail tells the old address about a change, with a link to undo it
+func sendRevertEmail(userID uuid.UUID, oldEmail string, newEmail string, locale string) error {
+	token, err := createEmailToken(userID, database.EmailRevert, oldEmail, emailRevertLifetime)
+	if err != nil {
+		return err
+	}
+	return sendEmail(oldEmail, locale, email.EmailChanged, email.EmailChangedData{
+		Email: newEmail,
+		URL:   emailTokenURL("/revertemail.html", token),
+	})
+}
+
+// verifyEmail checks the address is valid, returning it without any surrounding whitespace.
+// Whether the user actually owns it is checked later, see sendVerificationEmail.
+func verifyEmail(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return "", nil
+	}
+	addr, err := mail.ParseAddress(address)
+	if err != nil || addr.Address != address {
+		// Reject display names and comments, we only want the address itself
+		return "", echo.NewHTTPError(http.StatusBadRequest, "invalid email address").SetInternal(err)
+	}
+	return address, nil
+}
+
+// API Handler POST /email/verify
+// Confirms an address using the token from sendVerificationEmail. If it was a change, the old address is told about it.
+func postVerifyEmail(c echo.Context) error {
+	verification, err := consumeEmailToken(c, database.EmailVerify)
+	if err != nil {
+		return err
+	}
+
+	previous, err := database.SetVerifiedEmail(verification.UserID, verification.Email, false)
+	if err == database.ErrEmailTaken {
+		return echo.NewHTTPError(http.StatusConflict, "email is in use by another account").SetInternal(err)
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update email").SetInternal(err)
+	}
+
+	if previous != "" && previous != verification.Email {
+		locale := emailLocale(c, database.LookupUserByID(verification.UserID))
+		err = sendRevertEmail(verification.UserID, previous, verification.Email, locale)
+		if err != nil {
+			// The change has already happened, so don't fail the request
+			log.Println("Error sending email change notification", err)
+		}
+	}
+	return c.JSON(http.StatusOK, struct {
+		Message string `json:"message"`
+		Email   string `json:"email"`
+	}{"success", verification.Email})
+}
+
+// API Handler POST /email/revert
+// Undoes an email change using the token from sendRevertEmail, logging out everywhere in case the account was stolen
+func postRevertEmail(c echo.Context) error {
+	verification, err := consumeEmailToken(c, database.EmailRevert)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.SetVerifiedEmail(verification.UserID, verification.Email, true)
+	if err == database.ErrEmailTaken {
+		return echo.NewHTTPError(http.StatusConflict, "email is in use by another account").SetInternal(err)
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update email").SetInternal(err)
+	}
+	return c.JSON(http.StatusOK, struct {
+		Message string `json:"message"`
+		Email   string `json:"email"`
+	}{"success", verification.Email})
+}
+
+// consumeEmailToken uses up the token in the request body, checking it is the expected kind
+func consumeEmailToken(c echo.Context, kind string) (*database.EmailVerification, error) {
+	var body struct {
+		Token string `json:"token" form:"token" query:"token"`
+	}
+	err := c.Bind(&body)
+	if err != nil {
+		return nil, err
+	}
+	if body.Token == "" {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "token is required")
+	}
+	verification, err := database.ConsumeEmailVerification(jwt.HashSecret(strings.TrimSpace(body.Token)))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "unable to check token").SetInternal(err)
+	}
+	if verification == nil || verification.Kind != kind {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "invalid or expired token")
+	}
+	return verification, nil
+}
+
+// API Handler POST /user/me/email/verify
+// Sends another confirmation email, for the pending change if there is one or otherwise the user's current address
+func resendVerifyEmail(c echo.Context) error {
+	user := middleware.GetUser(c)
+	address, err := database.GetPendingEmail(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "unable to fetch pending email").SetInternal(err)
+	}
+	if address == "" {
+		if user.Email == "" || user.EmailVerified {
+			return echo.NewHTTPError(http.StatusBadRequest, "no email address needs verifying")
+		}
+		address = user.Email
+	}
+	err = sendVerificationEmail(user.ID, address, emailLocale(c, user))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, struct {
+		Message string `json:"message"`
+	}{"success"})
+}
@@ -0,0 +1,33 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyEmail(t *testing.T) {
+	for input, expected := range map[string]string{
+		"someone@example.com":              "someone@example.com",
+		"  someone@example.com\n":          "someone@example.com",
+		"first.last+tag@sub.example.co.uk": "first.last+tag@sub.example.co.uk",
+		"":                                 "",
+	} {
+		email, err := verifyEmail(input)
+		if assert.NoError(t, err, input) {
+			assert.Equal(t, expected, email)
+		}
+	}
+
+	for _, input := range []string{
+		"not an email",
+		"@example.com",
+		"someone@",
+		"Someone <someone@example.com>",
+		"someone@example.com (comment)",
+		"a@example.com, b@example.com",
+	} {
+		_, err := verifyEmail(input)
+		assert.Error(t, err, input)
+	}
+}
@@ -0,0 +1,61 @@
+package v1
+
+import (
+	"log"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/discord"
+	"github.com/ImpactDevelopment/ImpactServer/src/email"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/ImpactDevelopment/ImpactServer/src/util"
+)
+
+func init() {
+	util.DoRepeatedly(time.Minute, expireRoles)
+}
+
+// expireRoles revokes any role grants that have lapsed.
+// Deleting from user_roles fires users_updated, so the minecraft user info is regenerated by checkDatabaseForUpdatedUsers.
+func expireRoles() {
+	expired, err := database.ExpireRoles()
+	if err != nil {
+		log.Println("Error expiring roles", err)
+		return
+	}
+
+	for _, grant := range expired {
+		log.Printf("Role %s expired for user %s\n", grant.RoleID, grant.UserID)
+		if grant.RoleID != "premium" {
+			continue
+		}
+
+		// Premium has run out, so they aren't a donator anymore
+		user := database.LookupUserByID(grant.UserID)
+		if user == nil || user.HasRoleWithID("premium") {
+			continue
+		}
+		if user.Email != "" && user.EmailVerified {
+			err = sendRoleExpiredEmail(user, grant.RoleID)
+			if err != nil {
+				log.Printf("Error emailing %s about their expired %s: %s\n", user.ID, grant.RoleID, err.Error())
+			}
+		}
+		if user.DiscordID != "" && discord.CheckServerMembership(user.DiscordID) {
+			err = discord.SetDonator(user.DiscordID, false)
+			if err != nil {
+				log.Printf("Error removing donator role from %s: %s\n", user.DiscordID, err.Error())
+			}
+		}
+	}
+}
+
+// sendRoleExpiredEmail lets the user know their role has run out, and where to get it back
+func sendRoleExpiredEmail(user *users.User, role string) error {
+	link := util.GetServerURL()
+	link.Path = "/donate.html"
+	return sendEmail(user.Email, email.Locale(user.Locale, ""), email.RoleExpired, email.RoleExpiredData{
+		Role: role,
+		URL:  link.String(),
+	})
+}
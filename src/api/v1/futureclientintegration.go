@@ -2,7 +2,6 @@ package v1
 
 import (
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/ImpactDevelopment/ImpactServer/src/database"
@@ -10,12 +9,7 @@ import (
 )
 
 func futureIntegrationMasonList(c echo.Context) error {
-	auth := c.QueryParam("auth") + "0"
-	if auth != os.Getenv("API_AUTH_SECRET") && auth != os.Getenv("FUTURE_AUTH_SECRET") {
-		return c.JSON(http.StatusForbidden, "auth wrong im sowwy")
-	}
-
-	rows, err := database.DB.Query("SELECT mc_uuid FROM users WHERE spawnmason")
+	rows, err := database.DB.Query("SELECT mc_uuid FROM users INNER JOIN user_roles USING (user_id) WHERE role_id = 'spawnmason' AND mc_uuid IS NOT NULL")
 	if err != nil {
 		return err
 	}
@@ -39,9 +33,5 @@ func futureIntegrationMasonList(c echo.Context) error {
 }
 
 func futureIntegrationOverallData(c echo.Context) error {
-	auth := c.QueryParam("auth") + "0"
-	if auth != os.Getenv("API_AUTH_SECRET") && auth != os.Getenv("FUTURE_AUTH_SECRET") {
-		return c.JSON(http.StatusForbidden, "auth wrong im sowwy")
-	}
 	return c.JSON(http.StatusOK, userDataNonHashed)
 }
@@ -1,26 +1,19 @@
 package v1
 
 import (
-	"log"
+	"database/sql"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 )
 
 func checkDonator(c echo.Context) error {
-	auth := c.QueryParam("auth") + "0"
-	if auth != os.Getenv("IMPACTBOT_AUTH_SECRET") {
-		return c.JSON(http.StatusForbidden, "auth wrong im sowwy")
-	}
-	var premium bool
-	err := database.DB.QueryRow("SELECT premium FROM users WHERE discord_id = $1", c.Param("discordid")).Scan(&premium)
-	if err != nil {
-		log.Println(err)
-	}
-	if premium {
+	user := database.LookupUserByDiscordID(c.Param("discordid"))
+	if user != nil && user.HasRoleWithID("premium") {
 		return c.String(http.StatusOK, "yes")
 	} else {
 		return c.String(http.StatusOK, "no")
@@ -29,32 +22,24 @@ func checkDonator(c echo.Context) error {
 
 func genkey(c echo.Context) error {
 	var body struct {
-		Auth  string   `json:"auth" form:"auth" query:"auth"`
 		Roles []string `json:"roles" form:"role" query:"role"`
+		// Days until the roles expire once redeemed, 0 means never
+		Days int64 `json:"days" form:"days" query:"days"`
 	}
 	err := c.Bind(&body)
 	if err != nil {
 		return err
 	}
-	if body.Auth+"0" != os.Getenv("IMPACTBOT_AUTH_SECRET") {
-		return c.JSON(http.StatusForbidden, "auth wrong im sowwy")
-	}
 
-	// Extract bools from role list
-	var premium, pepsi, spawnmason, staff bool
+	// Validate the role list
+	var roles []string
 	if len(body.Roles) > 0 {
 		var invalid []string
 		for _, role := range body.Roles {
-			switch strings.ToLower(strings.TrimSpace(role)) {
-			case "premium":
-				premium = true
-			case "pepsi":
-				pepsi = true
-			case "spawnmason":
-				spawnmason = true
-			case "staff":
-				staff = true
-			default:
+			id := strings.ToLower(strings.TrimSpace(role))
+			if r, ok := users.GetRole(id); ok && r.TokenGrantable {
+				roles = append(roles, r.ID)
+			} else {
 				invalid = append(invalid, role)
 			}
 		}
@@ -71,8 +56,33 @@ func genkey(c echo.Context) error {
 		}
 	}
 
+	if body.Days < 0 {
+		return c.String(http.StatusBadRequest, "Invalid number of days")
+	}
+	var duration sql.NullInt64
+	if body.Days > 0 {
+		duration = sql.NullInt64{
+			Int64: body.Days * 24 * 60 * 60,
+			Valid: true,
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	var token string
-	err = database.DB.QueryRow("INSERT INTO pending_donations(amount, premium, pepsi, spawnmason, staff) VALUES(0, $1, $2, $3, $4) RETURNING token", premium, pepsi, spawnmason, staff).Scan(&token)
+	err = tx.QueryRow("INSERT INTO pending_donations(amount) VALUES(0) RETURNING token").Scan(&token)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO pending_donation_roles(token, role_id, duration) SELECT $1, UNNEST($2::TEXT[]), $3 ON CONFLICT DO NOTHING", token, pq.StringArray(roles), duration)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
 	if err != nil {
 		return err
 	}
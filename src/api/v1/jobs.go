@@ -0,0 +1,161 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/discord"
+	"github.com/ImpactDevelopment/ImpactServer/src/minecraft"
+	"github.com/ImpactDevelopment/ImpactServer/src/outbox"
+	"github.com/google/uuid"
+)
+
+// Outbox job kinds
+const (
+	jobDonationLog    = "discord.donation_log"
+	jobRegistered     = "discord.registered"
+	jobReceipt        = "email.receipt"
+	jobDiscordDonator = "discord.set_donator"
+)
+
+func init() {
+	outbox.Register(jobDonationLog, runDonationLogJob, outbox.Options{})
+	outbox.Register(jobRegistered, runRegisteredJob, outbox.Options{})
+	outbox.Register(jobReceipt, runReceiptJob, outbox.Options{Redact: []string{"email"}})
+	outbox.Register(jobDiscordDonator, runDiscordDonatorJob, outbox.Options{})
+}
+
+// decodeJob unmarshals a job's payload, invalid payloads won't get any better so they are permanent errors
+func decodeJob(payload json.RawMessage, job interface{}) error {
+	err := json.Unmarshal(payload, job)
+	if err != nil {
+		return outbox.Permanent(err)
+	}
+	return nil
+}
+
+// donationLogJob edits the donation's discord log message, or posts one if it doesn't have one yet
+type donationLogJob struct {
+	// DonationID is the pending_donations.donation_id, not the token, so the payload can't be used to redeem it
+	DonationID uuid.UUID `json:"donation_id"`
+	Message    string    `json:"message"`
+	Currency   string    `json:"currency"`
+	Amount     int64     `json:"amount"`
+}
+
+func runDonationLogJob(ctx context.Context, payload json.RawMessage) error {
+	var job donationLogJob
+	err := decodeJob(payload, &job)
+	if err != nil {
+		return err
+	}
+	donationLock.Lock()
+	defer donationLock.Unlock()
+	return editOrCreateDonationLog(job.Message, job.Currency, job.Amount, job.DonationID)
+}
+
+// registeredJob gives a newly registered (or upgraded) user their discord roles and logs it
+type registeredJob struct {
+	LogID     string `json:"log_id,omitempty"`
+	DiscordID string `json:"discord_id,omitempty"`
+	// Joined is true if registering added the user to our server, see joinDiscord
+	Joined    bool               `json:"joined,omitempty"`
+	Minecraft *minecraft.Profile `json:"minecraft,omitempty"`
+	Currency  string             `json:"currency,omitempty"`
+	Amount    int64              `json:"amount,omitempty"`
+	Donated   bool               `json:"donated"`
+	Upgraded  bool               `json:"upgraded"`
+	// Premium is true if the redeemed token granted premium, only then does the user get the discord donator role
+	Premium bool `json:"premium,omitempty"`
+}
+
+func runRegisteredJob(ctx context.Context, payload json.RawMessage) error {
+	var job registeredJob
+	err := decodeJob(payload, &job)
+	if err != nil {
+		return err
+	}
+
+	if job.Premium && job.DiscordID != "" && discord.CheckServerMembership(job.DiscordID) {
+		err = discord.GiveDonator(job.DiscordID)
+		if err != nil {
+			return err
+		}
+	}
+
+	var msg strings.Builder
+	msg.WriteString("Someone just")
+	if job.Donated {
+		// TODO get this bit _from_ the previous log msg?
+		msg.WriteString(" donated")
+	}
+	if job.Joined {
+		if msg.String() != "Someone just" {
+			msg.WriteString(",")
+		}
+		msg.WriteString(" joined the server")
+	}
+	if msg.String() != "Someone just" {
+		msg.WriteString(" and")
+	}
+	if job.Upgraded {
+		msg.WriteString(" upgraded their")
+	} else {
+		msg.WriteString(" registered an")
+	}
+	msg.WriteString(" Impact Account")
+	_, err = discord.LogDonationEvent(job.LogID, msg.String(), job.DiscordID, job.Minecraft, job.Currency, job.Amount)
+	return err
+}
+
+// receiptJob emails a donor their registration token, or tells them it was added to their account if Credited
+type receiptJob struct {
+	Email    string `json:"email"`
+	Locale   string `json:"locale,omitempty"`
+	Currency string `json:"currency"`
+	Amount   int64  `json:"amount"`
+	// DonationID is the pending_donations.donation_id, the token is looked up when the email is sent so it's never in the payload
+	DonationID uuid.UUID `json:"donation_id"`
+	// Credited is true if the donation went straight to the donor's account, so there's no token to redeem
+	Credited bool `json:"credited,omitempty"`
+}
+
+func runReceiptJob(ctx context.Context, payload json.RawMessage) error {
+	var job receiptJob
+	err := decodeJob(payload, &job)
+	if err != nil {
+		return err
+	}
+	if job.Credited {
+		return sendDonationCreditedEmail(job.Email, job.Locale, job.Currency, job.Amount)
+	}
+	token, err := database.GetDonationToken(job.DonationID)
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return outbox.Permanent(fmt.Errorf("donation %s doesn't exist", job.DonationID))
+	}
+	return sendReceiptEmail(job.Email, job.Locale, job.Currency, job.Amount, *token)
+}
+
+// discordDonatorJob gives or takes the donator roles in our discord server, e.g. when a user links, unlinks or deletes their discord
+type discordDonatorJob struct {
+	DiscordID string `json:"discord_id"`
+	Donator   bool   `json:"donator"`
+}
+
+func runDiscordDonatorJob(ctx context.Context, payload json.RawMessage) error {
+	var job discordDonatorJob
+	err := decodeJob(payload, &job)
+	if err != nil {
+		return err
+	}
+	if !discord.CheckServerMembership(job.DiscordID) {
+		return nil
+	}
+	return discord.SetDonator(job.DiscordID, job.Donator)
+}
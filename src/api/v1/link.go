@@ -0,0 +1,321 @@
+package v1
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/jwt"
+	"github.com/ImpactDevelopment/ImpactServer/src/middleware"
+	"github.com/ImpactDevelopment/ImpactServer/src/minecraft"
+	"github.com/ImpactDevelopment/ImpactServer/src/outbox"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Login methods, see loginMethods
+const (
+	loginPassword  = "password"
+	loginDiscord   = "discord"
+	loginMinecraft = "minecraft"
+	loginPasskey   = "passkey"
+)
+
+// loginMethods returns the ways the user is able to log in
+func loginMethods(user *users.User, passkeys int) []string {
+	var methods []string
+	if user.Email != "" && user.PasswordHash != "" {
+		methods = append(methods, loginPassword)
+	}
+	if user.DiscordID != "" {
+		methods = append(methods, loginDiscord)
+	}
+	// Minecraft login is only for users with roles, see jwt.MinecraftLoginHandler
+	if user.MinecraftID != nil && len(user.Roles) > 0 {
+		methods = append(methods, loginMinecraft)
+	}
+	if passkeys > 0 {
+		methods = append(methods, loginPasskey)
+	}
+	return methods
+}
+
+// canRemoveLogin returns true if the user has some other way to log in without method
+func canRemoveLogin(user *users.User, passkeys int, method string) bool {
+	remaining := 0
+	for _, m := range loginMethods(user, passkeys) {
+		if m != method {
+			remaining++
+		}
+	}
+	// Removing one passkey still leaves the others
+	if method == loginPasskey && passkeys > 1 {
+		remaining++
+	}
+	return remaining > 0
+}
+
+// requireOtherLogin stops the user from removing their only way of logging in
+func requireOtherLogin(user *users.User, method string) error {
+	passkeys, err := database.GetUserWebAuthnCredentials(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching passkeys").SetInternal(err)
+	}
+	if !canRemoveLogin(user, len(passkeys), method) {
+		return echo.NewHTTPError(http.StatusConflict, "this is the only way to log in to your account, set a password or link something else first")
+	}
+	return nil
+}
+
+// linkMinecraft links the minecraft account to the user, it must not belong to anyone else
+func linkMinecraft(tx *sql.Tx, user *users.User, minecraftID uuid.UUID) error {
+	if user.MinecraftID != nil && *user.MinecraftID == minecraftID {
+		return nil
+	}
+	if other := database.LookupUserByMinecraftID(minecraftID); other != nil {
+		return echo.NewHTTPError(http.StatusConflict, "minecraft account belongs to another Impact account, log in to both and merge them instead")
+	}
+	err := database.SetMinecraftID(tx, user.ID, &minecraftID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error linking minecraft account").SetInternal(err)
+	}
+	return nil
+}
+
+func unlinkMinecraft(tx *sql.Tx, user *users.User) error {
+	if user.MinecraftID == nil {
+		return nil
+	}
+	err := requireOtherLogin(user, loginMinecraft)
+	if err != nil {
+		return err
+	}
+	err = database.SetMinecraftID(tx, user.ID, nil)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error unlinking minecraft account").SetInternal(err)
+	}
+	return nil
+}
+
+// linkDiscord links the discord account to the user, moving the donator roles from their previous discord if they had one
+func linkDiscord(tx *sql.Tx, user *users.User, discordID string) error {
+	if discordID == user.DiscordID {
+		return nil
+	}
+	if other := database.LookupUserByDiscordID(discordID); other != nil {
+		return echo.NewHTTPError(http.StatusConflict, "discord account belongs to another Impact account, log in to both and merge them instead")
+	}
+	err := database.SetDiscordID(tx, user.ID, discordID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error linking discord account").SetInternal(err)
+	}
+	if user.DiscordID != "" {
+		err = outbox.Enqueue(tx, jobDiscordDonator, discordDonatorJob{DiscordID: user.DiscordID, Donator: false})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+		}
+	}
+	if user.HasRoleWithID("premium") {
+		// TODO join guild? Or maybe include "not joined" in response so the client can know to show a "join" button?
+		err = outbox.Enqueue(tx, jobDiscordDonator, discordDonatorJob{DiscordID: discordID, Donator: true})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+		}
+	}
+	return nil
+}
+
+func unlinkDiscord(tx *sql.Tx, user *users.User) error {
+	if user.DiscordID == "" {
+		return nil
+	}
+	err := requireOtherLogin(user, loginDiscord)
+	if err != nil {
+		return err
+	}
+	err = database.SetDiscordID(tx, user.ID, "")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error unlinking discord account").SetInternal(err)
+	}
+	err = outbox.Enqueue(tx, jobDiscordDonator, discordDonatorJob{DiscordID: user.DiscordID, Donator: false})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+	return nil
+}
+
+// inTx runs fn in a transaction, committing it if fn succeeds
+func inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error starting database transaction").SetInternal(err)
+	}
+	defer tx.Rollback()
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error committing changes to the database").SetInternal(err)
+	}
+	return nil
+}
+
+// API Handler POST /user/me/link/minecraft
+// The client proves it owns the minecraft account the same way as jwt.MinecraftLoginHandler, by joining a server with the hash
+func postLinkMinecraft(c echo.Context) error {
+	user := middleware.GetUser(c)
+	var body struct {
+		Username string `json:"username" form:"username"`
+		Hash     string `json:"hash" form:"hash"`
+	}
+	err := c.Bind(&body)
+	if err != nil {
+		return err
+	}
+	if body.Username == "" || body.Hash == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "both username and hash must be provided")
+	}
+	profile, err := minecraft.HasJoinedServer(body.Username, body.Hash)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "failed authentication with mojang").SetInternal(err)
+	}
+	err = inTx(func(tx *sql.Tx) error {
+		return linkMinecraft(tx, user, profile.ID)
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, profile)
+}
+
+// API Handler DELETE /user/me/link/minecraft
+func deleteLinkMinecraft(c echo.Context) error {
+	user := middleware.GetUser(c)
+	if user.MinecraftID == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "no minecraft account linked")
+	}
+	err := inTx(func(tx *sql.Tx) error {
+		return unlinkMinecraft(tx, user)
+	})
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// API Handler POST /user/me/link/discord
+func postLinkDiscord(c echo.Context) error {
+	user := middleware.GetUser(c)
+	var body struct {
+		AccessToken string `json:"access_token" form:"access_token"`
+	}
+	err := c.Bind(&body)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(body.AccessToken) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "access_token is required")
+	}
+	discordID, err := getDiscordID(body.AccessToken)
+	if err != nil {
+		return err
+	}
+	err = inTx(func(tx *sql.Tx) error {
+		return linkDiscord(tx, user, discordID)
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, struct {
+		ID string `json:"id"`
+	}{discordID})
+}
+
+// API Handler DELETE /user/me/link/discord
+func deleteLinkDiscord(c echo.Context) error {
+	user := middleware.GetUser(c)
+	if user.DiscordID == "" {
+		return echo.NewHTTPError(http.StatusNotFound, "no discord account linked")
+	}
+	err := inTx(func(tx *sql.Tx) error {
+		return unlinkDiscord(tx, user)
+	})
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// API Handler POST /user/me/merge
+// Merges another account into this one, see database.MergeAccounts. The user proves they own the other account
+// with an access token for it, and confirms it's really them on this one, see confirmIdentity.
+func postMergeAccount(c echo.Context) error {
+	user := middleware.GetUser(c)
+	var body struct {
+		Token    string `json:"token" form:"token"`
+		Password string `json:"password" form:"password"`
+		Code     string `json:"code" form:"code"`
+	}
+	err := c.Bind(&body)
+	if err != nil {
+		return err
+	}
+	if body.Token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "token for the other account is required")
+	}
+	err = confirmIdentity(c, user, body.Password, body.Code)
+	if err != nil {
+		return err
+	}
+
+	other, claims, err := jwt.Verify(body.Token)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid token for the other account").SetInternal(err)
+	}
+	if other.ID == user.ID {
+		return echo.NewHTTPError(http.StatusBadRequest, "cannot merge an account with itself")
+	}
+	twoFactor, err := database.HasTwoFactor(other.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching two factor status").SetInternal(err)
+	}
+	if twoFactor && !claims.TwoFactor {
+		return echo.NewHTTPError(http.StatusUnauthorized, "the other account uses two factor, log in to it with your second factor")
+	}
+
+	// Each account can only have one of each, so the user has to choose which to keep
+	if user.MinecraftID != nil && other.MinecraftID != nil && *user.MinecraftID != *other.MinecraftID {
+		return echo.NewHTTPError(http.StatusConflict, "both accounts have a minecraft account linked, unlink one first")
+	}
+	if user.DiscordID != "" && other.DiscordID != "" && user.DiscordID != other.DiscordID {
+		return echo.NewHTTPError(http.StatusConflict, "both accounts have a discord account linked, unlink one first")
+	}
+
+	err = inTx(func(tx *sql.Tx) error {
+		err := database.MergeAccounts(tx, user.ID, other.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "error merging accounts").SetInternal(err)
+		}
+		discordID := user.DiscordID
+		if discordID == "" {
+			discordID = other.DiscordID
+		}
+		if discordID != "" && (user.HasRoleWithID("premium") || other.HasRoleWithID("premium")) {
+			err = outbox.Enqueue(tx, jobDiscordDonator, discordDonatorJob{DiscordID: discordID, Donator: true})
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, struct {
+		Message string `json:"message"`
+	}{"success"})
+}
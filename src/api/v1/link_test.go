@@ -0,0 +1,50 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginMethods(t *testing.T) {
+	minecraftID := uuid.New()
+
+	assert.Empty(t, loginMethods(&users.User{}, 0))
+	// An email without a password can't be used to log in
+	assert.Empty(t, loginMethods(&users.User{Email: "someone@example.com"}, 0))
+	// Neither can minecraft without any roles
+	assert.Empty(t, loginMethods(&users.User{MinecraftID: &minecraftID}, 0))
+
+	user := &users.User{
+		Email:        "someone@example.com",
+		PasswordHash: "hash",
+		DiscordID:    "1234",
+		MinecraftID:  &minecraftID,
+		Roles:        []users.Role{{ID: "premium"}},
+	}
+	assert.Equal(t, []string{loginPassword, loginDiscord, loginMinecraft, loginPasskey}, loginMethods(user, 2))
+}
+
+func TestCanRemoveLogin(t *testing.T) {
+	minecraftID := uuid.New()
+
+	discordOnly := &users.User{DiscordID: "1234"}
+	assert.False(t, canRemoveLogin(discordOnly, 0, loginDiscord))
+	assert.True(t, canRemoveLogin(discordOnly, 1, loginDiscord))
+
+	// Minecraft doesn't count as a login method without roles
+	unranked := &users.User{DiscordID: "1234", MinecraftID: &minecraftID}
+	assert.False(t, canRemoveLogin(unranked, 0, loginDiscord))
+	assert.True(t, canRemoveLogin(unranked, 0, loginMinecraft))
+
+	premium := &users.User{DiscordID: "1234", MinecraftID: &minecraftID, Roles: []users.Role{{ID: "premium"}}}
+	assert.True(t, canRemoveLogin(premium, 0, loginDiscord))
+	assert.True(t, canRemoveLogin(premium, 0, loginMinecraft))
+
+	// The last passkey can only go if there's something else
+	assert.False(t, canRemoveLogin(&users.User{}, 1, loginPasskey))
+	assert.True(t, canRemoveLogin(&users.User{}, 2, loginPasskey))
+	assert.True(t, canRemoveLogin(discordOnly, 1, loginPasskey))
+}
@@ -5,7 +5,8 @@ import (
 	"encoding/hex"
 	"log"
 	"net/http"
-	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/ImpactDevelopment/ImpactServer/src/database"
@@ -17,14 +18,43 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-var userData map[string]users.UserInfo
+var userData = new(userInfoState)
 var userDataNonHashed map[string]users.UserInfo
 
 var legacyRoles map[string]string
 
+// userInfoVersionHeader tells clients which version of the user info map they were sent, for use with ?since=
+const userInfoVersionHeader = "X-User-Info-Version"
+
 // API Handler /minecraft/user/info
 func getUserInfo(c echo.Context) error {
-	return c.JSON(http.StatusOK, userData)
+	snapshot := userData.snapshot()
+	if snapshot == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "user info not loaded yet")
+	}
+
+	c.Response().Header().Set("ETag", snapshot.etag)
+	c.Response().Header().Set(userInfoVersionHeader, strconv.FormatUint(snapshot.version, 10))
+	if etagMatches(c.Request().Header.Get("If-None-Match"), snapshot.etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, snapshot.json)
+}
+
+// API Handler /minecraft/user/info/changes?since=<version>
+// Returns the hashed uuids that have been added, changed or removed since the given version
+func getUserInfoChanges(c echo.Context) error {
+	since, err := strconv.ParseUint(c.QueryParam("since"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "since must be a version number").SetInternal(err)
+	}
+	delta, ok := userData.changesSince(since)
+	if !ok {
+		// Too old, or a state this dyno never saw. The client has to start again from the full map.
+		return echo.NewHTTPError(http.StatusGone, "unknown version, fetch /minecraft/user/info instead")
+	}
+	c.Response().Header().Set(userInfoVersionHeader, strconv.FormatUint(delta.Version, 10))
+	return c.JSON(http.StatusOK, delta)
 }
 
 // Legacy API handler /minecraft/user/:role/list
@@ -36,17 +66,54 @@ func getRoleMembers(c echo.Context) error {
 	return c.String(http.StatusOK, ret)
 }
 
+// mcUsers is every user, keyed by user id, kept up to date by database.UserChangeEvents
+var mcUsers = make(map[uuid.UUID]users.User)
+
 func init() {
-	usersList := database.GetAllUsers()
+	for _, user := range database.GetAllUsers() {
+		mcUsers[user.ID] = user
+	}
+	usersList := sortedMcUsers()
 	updatedData(usersList)
 	updatedLegacyRoles(usersList)
-	database.CallbackOnUsersTableUpdate(checkDatabaseForUpdatedUsers)
+	database.CallbackOnUsersTableUpdate(onUserChange)
+}
+
+// onUserChange reloads only the users that changed, unless everything needs reloading,
+// then rebuilds the user info and legacy lists once for the whole batch
+func onUserChange(events []database.UserChangeEvent) {
+	for _, event := range events {
+		if event.Op == database.UsersResync {
+			mcUsers = make(map[uuid.UUID]users.User)
+			for _, user := range database.GetAllUsers() {
+				mcUsers[user.ID] = user
+			}
+		} else if user := database.LookupUserByID(event.UserID); user != nil {
+			mcUsers[user.ID] = *user
+		} else {
+			delete(mcUsers, event.UserID)
+		}
+	}
+	checkForUpdatedUsers()
 }
 
-func checkDatabaseForUpdatedUsers() {
-	usersList := database.GetAllUsers()
+// sortedMcUsers returns mcUsers as a slice, sorted so that the legacy lists don't change order every time
+func sortedMcUsers() []users.User {
+	usersList := make([]users.User, 0, len(mcUsers))
+	for _, user := range mcUsers {
+		usersList = append(usersList, user)
+	}
+	sort.Slice(usersList, func(i, j int) bool {
+		return usersList[i].ID.String() < usersList[j].ID.String()
+	})
+	return usersList
+}
+
+func checkForUpdatedUsers() {
+	usersList := sortedMcUsers()
 	if updatedData(usersList) {
 		log.Println("MC UPDATE: Updated user info")
+		publishUserInfo()
 		cloudflare.PurgeURLs([]string{
 			"https://api.impactclient.net/v1/minecraft/user/info",
 		})
@@ -64,31 +131,45 @@ func checkDatabaseForUpdatedUsers() {
 
 func updatedData(usersList []users.User) bool {
 	newUserData, newUnhashed := generateMap(usersList)
-	// reflect.DeepEqual is slow, especially since this map is big
-	if userData == nil || !reflect.DeepEqual(newUserData, userData) {
-		userData = newUserData
+	updated, err := userData.update(newUserData)
+	if err != nil {
+		log.Println("MC UPDATE: Unable to update user info", err)
+		return false
+	}
+	if updated {
 		userDataNonHashed = newUnhashed
-		return true
 	}
-	return false
+	return updated
 }
 
 func updatedLegacyRoles(usersList []users.User) bool {
 	newLegacyRoles := generateLegacy(usersList)
-	// reflect.DeepEqual is slow, especially since this map is big
-	if legacyRoles == nil || !reflect.DeepEqual(newLegacyRoles, legacyRoles) {
+	if legacyRoles == nil || !equalStringMaps(newLegacyRoles, legacyRoles) {
 		legacyRoles = newLegacyRoles
 		return true
 	}
 	return false
 }
 
+func equalStringMaps(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, val := range a {
+		if other, ok := b[key]; !ok || other != val {
+			return false
+		}
+	}
+	return true
+}
+
 func generateLegacy(usersList []users.User) map[string]string {
 	m := make(map[string]string)
-	for role, roleVal := range users.Roles {
+	for _, roleVal := range users.GetRoles() {
 		if !roleVal.LegacyList {
 			continue
 		}
+		role := roleVal.ID
 		var list strings.Builder
 		for _, user := range usersList {
 			if !user.HasRoleWithID(role) {
@@ -37,6 +37,7 @@ func newMotd(newer string) {
 	if newer != motd {
 		log.Println("MOTD UPDATE from", motd, "to", newer)
 		motd = newer
+		publishMotd(newer)
 		cloudflare.PurgeURLs([]string{"https://api.impactclient.net/v1/motd"})
 	}
 }
@@ -0,0 +1,363 @@
+package v1
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/jwt"
+	"github.com/ImpactDevelopment/ImpactServer/src/middleware"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/labstack/echo/v4"
+)
+
+// oauthCodeLifetime is how long the client has to swap an authorization code for a token
+const oauthCodeLifetime = 10 * time.Minute
+
+type authorizeRequest struct {
+	ResponseType        string `json:"response_type" form:"response_type" query:"response_type"`
+	ClientID            string `json:"client_id" form:"client_id" query:"client_id"`
+	RedirectURI         string `json:"redirect_uri" form:"redirect_uri" query:"redirect_uri"`
+	Scope               string `json:"scope" form:"scope" query:"scope"`
+	State               string `json:"state" form:"state" query:"state"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge" query:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method" query:"code_challenge_method"`
+	// Approve is set by the consent screen, it is ignored by GET
+	Approve bool `json:"approve" form:"approve" query:"approve"`
+}
+
+// validate checks the request against the client's registration, returning the client and the requested scopes
+func (req authorizeRequest) validate() (*database.OAuthClient, []string, error) {
+	if req.ClientID == "" {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "client_id is required")
+	}
+	client, err := database.GetOAuthClient(req.ClientID)
+	if err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusInternalServerError, "error fetching client").SetInternal(err)
+	}
+	if client == nil {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "unknown client_id")
+	}
+	// Redirect uris must match exactly, otherwise codes could be sent anywhere
+	if !containsString(client.RedirectURIs, req.RedirectURI) {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "redirect_uri is not registered for this client")
+	}
+	if req.ResponseType != "code" {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "response_type must be code")
+	}
+	// PKCE is required for everyone, not just public clients
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "code_challenge is required, with code_challenge_method S256")
+	}
+	scopes, err := jwt.ParseScopes(req.Scope, client.Scopes)
+	if err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+	return client, scopes, nil
+}
+
+// redirect returns the client's redirect uri with params added
+func (req authorizeRequest) redirect(params url.Values) string {
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	redirect, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		// Can't happen, it was checked when the client was registered
+		return req.RedirectURI
+	}
+	query := redirect.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	redirect.RawQuery = query.Encode()
+	return redirect.String()
+}
+
+type scopeDescription struct {
+	Scope       string `json:"scope"`
+	Description string `json:"description"`
+}
+
+// API Handler GET /oauth/authorize
+// Validates the request and describes it, so the website can show a consent screen
+func getOAuthAuthorize(c echo.Context) error {
+	var req authorizeRequest
+	err := c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	client, scopes, err := req.validate()
+	if err != nil {
+		return err
+	}
+
+	descriptions := make([]scopeDescription, 0, len(scopes))
+	for _, scope := range scopes {
+		descriptions = append(descriptions, scopeDescription{scope, jwt.Scopes[scope]})
+	}
+	return c.JSON(http.StatusOK, struct {
+		ClientID    string             `json:"client_id"`
+		ClientName  string             `json:"client_name"`
+		Scopes      []scopeDescription `json:"scopes"`
+		RedirectURI string             `json:"redirect_uri"`
+	}{client.ID, client.Name, descriptions, req.RedirectURI})
+}
+
+// API Handler POST /oauth/authorize
+// Called by the consent screen once the user has approved or denied the request.
+// Responds with the url the user should be sent back to.
+func postOAuthAuthorize(c echo.Context) error {
+	user := middleware.GetUser(c)
+	if user == nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "not logged in")
+	}
+	var req authorizeRequest
+	err := c.Bind(&req)
+	if err != nil {
+		return err
+	}
+	client, scopes, err := req.validate()
+	if err != nil {
+		return err
+	}
+
+	var redirect string
+	if req.Approve {
+		code, hash, err := jwt.NewSecret()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "error creating authorization code").SetInternal(err)
+		}
+		err = database.CreateOAuthCode(hash, database.OAuthCode{
+			ClientID:      client.ID,
+			UserID:        user.ID,
+			RedirectURI:   req.RedirectURI,
+			Scopes:        scopes,
+			CodeChallenge: req.CodeChallenge,
+			ExpiresAt:     time.Now().Add(oauthCodeLifetime).Unix(),
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "error saving authorization code").SetInternal(err)
+		}
+		redirect = req.redirect(url.Values{"code": {code}})
+	} else {
+		redirect = req.redirect(url.Values{"error": {"access_denied"}})
+	}
+
+	return c.JSON(http.StatusOK, struct {
+		RedirectTo string `json:"redirect_to"`
+	}{redirect})
+}
+
+// oauthError responds in the format RFC 6749 section 5.2 expects
+func oauthError(c echo.Context, status int, code string, description string) error {
+	return c.JSON(status, struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description,omitempty"`
+	}{code, description})
+}
+
+// API Handler POST /oauth/token
+func postOAuthToken(c echo.Context) error {
+	var body struct {
+		GrantType    string `form:"grant_type"`
+		Code         string `form:"code"`
+		RedirectURI  string `form:"redirect_uri"`
+		CodeVerifier string `form:"code_verifier"`
+		Scope        string `form:"scope"`
+		ClientID     string `form:"client_id"`
+		ClientSecret string `form:"client_secret"`
+	}
+	err := c.Bind(&body)
+	if err != nil {
+		return oauthError(c, http.StatusBadRequest, "invalid_request", "unable to parse request")
+	}
+
+	// Clients can authenticate with either basic auth or form params
+	if id, secret, ok := c.Request().BasicAuth(); ok {
+		body.ClientID, body.ClientSecret = id, secret
+	}
+	client, err := database.GetOAuthClient(body.ClientID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching client").SetInternal(err)
+	}
+	if client == nil {
+		return oauthError(c, http.StatusUnauthorized, "invalid_client", "unknown client_id")
+	}
+	if client.Confidential() && subtle.ConstantTimeCompare([]byte(jwt.HashSecret(body.ClientSecret)), []byte(client.SecretHash)) != 1 {
+		return oauthError(c, http.StatusUnauthorized, "invalid_client", "incorrect client_secret")
+	}
+
+	var (
+		user   *users.User
+		scopes []string
+	)
+	switch body.GrantType {
+	case "authorization_code":
+		code, err := database.ConsumeOAuthCode(jwt.HashSecret(body.Code))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "error fetching authorization code").SetInternal(err)
+		}
+		if code == nil || code.ClientID != client.ID || code.RedirectURI != body.RedirectURI {
+			return oauthError(c, http.StatusBadRequest, "invalid_grant", "invalid authorization code")
+		}
+		if !jwt.VerifyPKCE(code.CodeChallenge, body.CodeVerifier) {
+			return oauthError(c, http.StatusBadRequest, "invalid_grant", "incorrect code_verifier")
+		}
+		user = database.LookupUserByID(code.UserID)
+		if user == nil {
+			return oauthError(c, http.StatusBadRequest, "invalid_grant", "user no longer exists")
+		}
+		scopes = code.Scopes
+
+	case "client_credentials":
+		// Public clients have no way to prove who they are
+		if !client.Confidential() {
+			return oauthError(c, http.StatusBadRequest, "unauthorized_client", "client_credentials requires a confidential client")
+		}
+		scopes, err = jwt.ParseClientScopes(body.Scope, client.Scopes)
+		if err != nil {
+			return oauthError(c, http.StatusBadRequest, "invalid_scope", err.Error())
+		}
+
+	default:
+		return oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or client_credentials")
+	}
+
+	token, expiresIn := jwt.CreateOAuthToken(client.ID, user, scopes)
+	if token == "" {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error creating jwt token")
+	}
+	return c.JSON(http.StatusOK, struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+		Scope       string `json:"scope"`
+	}{token, "Bearer", int64(expiresIn / time.Second), strings.Join(scopes, " ")})
+}
+
+// API Handler GET /oauth/userinfo
+// Describes the user an OAuth token acts on behalf of, limited to what the token's scopes allow
+func getOAuthUserInfo(c echo.Context) error {
+	claims := middleware.GetOAuthClaims(c)
+	user := middleware.GetOAuthUser(c)
+	if claims == nil || user == nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "oauth access token for a user is required")
+	}
+
+	var response struct {
+		Subject     string   `json:"sub"`
+		MinecraftID string   `json:"mcuuid,omitempty"`
+		DiscordID   string   `json:"discordid,omitempty"`
+		Roles       []string `json:"roles,omitempty"`
+	}
+	response.Subject = user.ID.String()
+	if claims.HasScope("profile:read") {
+		if user.MinecraftID != nil {
+			response.MinecraftID = user.MinecraftID.String()
+		}
+		response.DiscordID = user.DiscordID
+	}
+	if claims.HasScope("roles:read") {
+		response.Roles = user.RoleIDs(false)
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// API Handler GET /admin/oauth/clients
+func getOAuthClients(c echo.Context) error {
+	clients, err := database.GetOAuthClients()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching clients").SetInternal(err)
+	}
+	return c.JSON(http.StatusOK, clients)
+}
+
+// API Handler POST /admin/oauth/clients
+// The client secret is only ever included in this response
+func postOAuthClient(c echo.Context) error {
+	var body struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		// Confidential clients get a secret, public clients (e.g. apps) rely on PKCE alone
+		Confidential bool `json:"confidential"`
+	}
+	err := c.Bind(&body)
+	if err != nil {
+		return err
+	}
+	if body.Name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+	for _, uri := range body.RedirectURIs {
+		parsed, err := url.Parse(uri)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "redirect uris must be absolute, without a fragment: "+uri)
+		}
+	}
+	allScopes := make([]string, 0, len(jwt.Scopes)+len(jwt.ClientScopes))
+	for scope := range jwt.Scopes {
+		allScopes = append(allScopes, scope)
+	}
+	for scope := range jwt.ClientScopes {
+		allScopes = append(allScopes, scope)
+	}
+	for _, scope := range body.Scopes {
+		if !containsString(allScopes, scope) {
+			return echo.NewHTTPError(http.StatusBadRequest, "unknown scope "+scope)
+		}
+	}
+
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error creating client").SetInternal(err)
+	}
+	client := database.OAuthClient{
+		ID:           hex.EncodeToString(id),
+		Name:         body.Name,
+		RedirectURIs: body.RedirectURIs,
+		Scopes:       body.Scopes,
+	}
+	var secret string
+	if body.Confidential {
+		secret, client.SecretHash, err = jwt.NewSecret()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "error creating client").SetInternal(err)
+		}
+	}
+	if client.RedirectURIs == nil {
+		client.RedirectURIs = []string{}
+	}
+	if client.Scopes == nil {
+		client.Scopes = []string{}
+	}
+
+	err = database.CreateOAuthClient(client)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error saving client").SetInternal(err)
+	}
+	return c.JSON(http.StatusCreated, struct {
+		database.OAuthClient
+		Secret string `json:"client_secret,omitempty"`
+	}{client, secret})
+}
+
+// API Handler DELETE /admin/oauth/clients/:id
+// Also revokes every token issued to the client
+func deleteOAuthClient(c echo.Context) error {
+	deleted, err := database.DeleteOAuthClient(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error deleting client").SetInternal(err)
+	}
+	if !deleted {
+		return echo.NewHTTPError(http.StatusNotFound, "client not found")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,51 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/jwt"
+	"github.com/ImpactDevelopment/ImpactServer/src/middleware"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientCredentialsReachScopedRoutes(t *testing.T) {
+	// There's no database in tests, so pretend the partner's client is registered
+	previous := jwt.LookupOAuthClient
+	jwt.LookupOAuthClient = func(id string) (*database.OAuthClient, error) {
+		if id == "partner" {
+			return &database.OAuthClient{ID: id, SecretHash: "hash", Scopes: []string{"userinfo:read"}}, nil
+		}
+		return nil, nil
+	}
+	defer func() { jwt.LookupOAuthClient = previous }()
+
+	e := echo.New()
+	e.Use(middleware.Auth)
+	API(e.Group("/v1"))
+	get := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/v1/integration/futureclient/overalldata", nil)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	token, _ := jwt.CreateOAuthToken("partner", nil, []string{"userinfo:read"})
+	assert.Equal(t, http.StatusOK, get(token))
+
+	// Wrong scope
+	token, _ = jwt.CreateOAuthToken("partner", nil, []string{"mason:list"})
+	assert.Equal(t, http.StatusForbidden, get(token))
+
+	// Deleted client
+	token, _ = jwt.CreateOAuthToken("deleted", nil, []string{"userinfo:read"})
+	assert.Equal(t, http.StatusUnauthorized, get(token))
+
+	assert.Equal(t, http.StatusUnauthorized, get(""))
+}
@@ -0,0 +1,79 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/outbox"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// API Handler GET /admin/outbox?status=dead&limit=100
+// Lists the most recent outbox jobs, along with how many there are in each status. Payloads are redacted, see outbox.Redact
+func getOutboxJobs(c echo.Context) error {
+	status := c.QueryParam("status")
+	switch status {
+	case "", database.JobPending, database.JobRunning, database.JobDone, database.JobDead:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid status")
+	}
+	limit := 100
+	if param := c.QueryParam("limit"); param != "" {
+		var err error
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > 1000 {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be between 1 and 1000").SetInternal(err)
+		}
+	}
+
+	jobs, err := database.GetJobs(status, limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching jobs").SetInternal(err)
+	}
+	for i, job := range jobs {
+		jobs[i] = outbox.Redact(job)
+	}
+	counts, err := database.CountJobs()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error counting jobs").SetInternal(err)
+	}
+	return c.JSON(http.StatusOK, struct {
+		Counts map[string]int `json:"counts"`
+		Jobs   []database.Job `json:"jobs"`
+	}{counts, jobs})
+}
+
+// API Handler GET /admin/outbox/:id
+func getOutboxJob(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid job id").SetInternal(err)
+	}
+	job, err := database.GetJob(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching job").SetInternal(err)
+	}
+	if job == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "job not found")
+	}
+	return c.JSON(http.StatusOK, outbox.Redact(*job))
+}
+
+// API Handler POST /admin/outbox/:id/replay
+// Gives a dead job another full set of attempts
+func replayOutboxJob(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid job id").SetInternal(err)
+	}
+	replayed, err := database.ReplayJob(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error replaying job").SetInternal(err)
+	}
+	if !replayed {
+		return echo.NewHTTPError(http.StatusNotFound, "no dead job with that id")
+	}
+	return getOutboxJob(c)
+}
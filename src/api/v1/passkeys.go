@@ -0,0 +1,159 @@
+package v1
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/jwt"
+	"github.com/ImpactDevelopment/ImpactServer/src/middleware"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/ImpactDevelopment/ImpactServer/src/webauthn"
+	"github.com/labstack/echo/v4"
+)
+
+// maxPasskeyName is the longest name a user can give a passkey
+const maxPasskeyName = 64
+
+// passkey is how a credential is shown to its owner, the id is what they pass to deletePasskey
+type passkey struct {
+	ID string `json:"id"`
+	database.WebAuthnCredential
+}
+
+func newPasskey(credential database.WebAuthnCredential) passkey {
+	return passkey{
+		ID:                 base64.RawURLEncoding.EncodeToString(credential.ID),
+		WebAuthnCredential: credential,
+	}
+}
+
+// webAuthnUserName is what the user's authenticator will call their account
+func webAuthnUserName(user *users.User) string {
+	switch {
+	case user.Email != "":
+		return user.Email
+	case user.MinecraftID != nil:
+		return user.MinecraftID.String()
+	case user.DiscordID != "":
+		return user.DiscordID
+	}
+	return user.ID.String()
+}
+
+// API Handler POST /login/webauthn/register/options
+// Responds with the options to pass to navigator.credentials.create
+func postPasskeyOptions(c echo.Context) error {
+	user := middleware.GetUser(c)
+	existing, err := database.GetUserWebAuthnCredentials(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching passkeys").SetInternal(err)
+	}
+	exclude := make([][]byte, 0, len(existing))
+	for _, credential := range existing {
+		exclude = append(exclude, credential.ID)
+	}
+
+	challenge, err := jwt.NewWebAuthnChallenge(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error creating challenge").SetInternal(err)
+	}
+	name := webAuthnUserName(user)
+	return c.JSON(http.StatusOK, jwt.WebAuthn.CreationOptions(challenge, webauthn.User{
+		ID:          user.ID[:],
+		Name:        name,
+		DisplayName: name,
+	}, exclude))
+}
+
+// API Handler POST /login/webauthn/register
+// Takes the credential returned by navigator.credentials.create, along with a name for it
+func postPasskey(c echo.Context) error {
+	user := middleware.GetUser(c)
+	var body struct {
+		Name       string                        `json:"name"`
+		Credential webauthn.RegistrationResponse `json:"credential"`
+	}
+	err := c.Bind(&body)
+	if err != nil {
+		return err
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		body.Name = "Passkey"
+	}
+	if len(body.Name) > maxPasskeyName {
+		return echo.NewHTTPError(http.StatusBadRequest, "name is too long")
+	}
+	if body.Credential.Type != "public-key" {
+		return echo.NewHTTPError(http.StatusBadRequest, "a public-key credential must be provided")
+	}
+
+	clientData, err := webauthn.ParseClientData(body.Credential.Response.ClientDataJSON)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+	err = jwt.CheckWebAuthnChallenge(clientData, user.ID)
+	if err != nil {
+		return err
+	}
+	credential, err := jwt.WebAuthn.VerifyRegistration(clientData, body.Credential.Response.AttestationObject)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid passkey: "+err.Error()).SetInternal(err)
+	}
+
+	existing, err := database.GetWebAuthnCredential(credential.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching passkey").SetInternal(err)
+	}
+	if existing != nil {
+		return echo.NewHTTPError(http.StatusConflict, "passkey is already registered")
+	}
+	saved, err := database.CreateWebAuthnCredential(database.WebAuthnCredential{
+		ID:        credential.ID,
+		UserID:    user.ID,
+		Name:      body.Name,
+		PublicKey: credential.PublicKey,
+		Algorithm: credential.Algorithm,
+		SignCount: credential.SignCount,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error saving passkey").SetInternal(err)
+	}
+	return c.JSON(http.StatusCreated, newPasskey(*saved))
+}
+
+// API Handler GET /user/me/passkeys
+func getPasskeys(c echo.Context) error {
+	credentials, err := database.GetUserWebAuthnCredentials(middleware.GetUser(c).ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching passkeys").SetInternal(err)
+	}
+	ret := make([]passkey, 0, len(credentials))
+	for _, credential := range credentials {
+		ret = append(ret, newPasskey(credential))
+	}
+	return c.JSON(http.StatusOK, ret)
+}
+
+// API Handler DELETE /user/me/passkeys/:id
+func deletePasskey(c echo.Context) error {
+	id, err := base64.RawURLEncoding.DecodeString(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid passkey id").SetInternal(err)
+	}
+	user := middleware.GetUser(c)
+	err = requireOtherLogin(user, loginPasskey)
+	if err != nil {
+		return err
+	}
+	deleted, err := database.DeleteWebAuthnCredential(user.ID, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error deleting passkey").SetInternal(err)
+	}
+	if !deleted {
+		return echo.NewHTTPError(http.StatusNotFound, "passkey not found")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -1,11 +1,10 @@
 package v1
 
 import (
-	"context"
 	"database/sql"
 	"fmt"
 	"github.com/ImpactDevelopment/ImpactServer/src/database"
-	"github.com/ImpactDevelopment/ImpactServer/src/mailgun"
+	"github.com/ImpactDevelopment/ImpactServer/src/email"
 	"github.com/ImpactDevelopment/ImpactServer/src/middleware"
 	"github.com/ImpactDevelopment/ImpactServer/src/recaptcha"
 	"github.com/ImpactDevelopment/ImpactServer/src/util"
@@ -18,17 +17,6 @@ import (
 	"time"
 )
 
-const (
-	// Let's be real, I should be using text/template and html/template here instead of format strings
-	text = `Here's your password reset link: %s`
-	html = `<p>
-<a href="%s">Click here to reset your password</a> or copy the following link if that doesn't work:
-</p>
-<pre>
-%s
-</pre>`
-)
-
 func resetPassword(c echo.Context) error {
 	var body struct {
 		Email string `json:"email" form:"email" query:"email"`
@@ -50,6 +38,10 @@ func resetPassword(c echo.Context) error {
 	if user == nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "user not found")
 	}
+	if !user.EmailVerified {
+		// The address might belong to someone else, e.g. if it was mistyped, who could then take over the account
+		return echo.NewHTTPError(http.StatusBadRequest, "email address has not been verified")
+	}
 
 	token, err := genToken(user.ID)
 	if err != nil {
@@ -60,11 +52,7 @@ func resetPassword(c echo.Context) error {
 	resetURL.RawQuery = url.Values{"token": {token.String()}}.Encode()
 
 	// Send user an email, don't just give anyone a token lol
-	message := mailgun.MG.NewMessage("Impact <noreply@impactclient.net>", "Password reset", fmt.Sprintf(text, resetURL.String()), user.Email)
-	message.SetHtml(fmt.Sprintf(html, resetURL.String(), resetURL.String()))
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-	_, _, err = mailgun.MG.Send(ctx, message)
+	err = sendEmail(user.Email, emailLocale(c, user), email.PasswordReset, email.LinkData{URL: resetURL.String()})
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to send reset email")
 	}
@@ -150,5 +138,11 @@ func setPassword(userID uuid.UUID, password string) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Incorrect number of users affected: %d", rows))
 	}
 
+	// Log out everywhere, in case the password was changed because someone else knew it
+	err = database.DeleteUserSessions(database.DB, userID, uuid.Nil)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "unable to revoke sessions").SetInternal(err)
+	}
+
 	return nil
 }
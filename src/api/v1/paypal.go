@@ -0,0 +1,165 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/payments"
+	"github.com/ImpactDevelopment/ImpactServer/src/paypal"
+	"github.com/ImpactDevelopment/ImpactServer/src/recaptcha"
+	"github.com/ImpactDevelopment/ImpactServer/src/stripe"
+	"github.com/labstack/echo/v4"
+)
+
+type paypalOrderResponse struct {
+	*payments.Payment
+	Premium bool `json:"premium" form:"premium" query:"premium"`
+	// Tier is the id of the donation tier the amount qualifies for, if any
+	Tier string `json:"tier,omitempty" form:"tier" query:"tier"`
+}
+
+type paypalCaptureRequest struct {
+	ID    string `json:"order_id" form:"order_id" query:"order_id"`
+	Email string `json:"email" form:"email" query:"email"`
+}
+
+type paypalCaptureResponse struct {
+	paypalOrderResponse
+	// Token is only included the first time the order is captured, or if the donor knows the payment's email
+	Token string `json:"token,omitempty" form:"token" query:"token"`
+	// Credited is true if the donation went straight to the donor's account instead of generating a token
+	Credited bool `json:"credited" form:"credited" query:"credited"`
+}
+
+// requirePayPal returns an error if PayPal isn't configured
+func requirePayPal() error {
+	if paypal.Default == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "PayPal donations are disabled")
+	}
+	return nil
+}
+
+// API Handler POST /paypal/createorder
+// Creates a PayPal order, the client sends the donor to approve_url and they come back to the donate page to capture it
+func createPayPalOrder(c echo.Context) error {
+	err := requirePayPal()
+	if err != nil {
+		return err
+	}
+	body, currency, user, err := bindCreateRequest(c)
+	if err != nil {
+		return err
+	}
+	err = recaptcha.Verify(c)
+	if err != nil {
+		return err
+	}
+
+	order := payments.Order{
+		Amount:      body.Amount,
+		Currency:    body.Currency,
+		Description: "Donation",
+		Email:       body.Email,
+		Locale:      emailLocale(c, user),
+	}
+	if user != nil {
+		order.UserID = user.ID.String()
+	}
+	payment, err := paypal.Default.CreatePayment(order)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadGateway, "Error creating PayPal order").SetInternal(err)
+	}
+
+	return c.JSON(http.StatusOK, &paypalOrderResponse{
+		Payment: payment,
+		Premium: payment.Amount >= currency.Amount,
+		Tier:    tierID(payment.Currency, payment.Amount),
+	})
+}
+
+// API Handler POST /paypal/capture
+// Captures an order the donor has approved and records the donation
+func capturePayPalOrder(c echo.Context) error {
+	err := requirePayPal()
+	if err != nil {
+		return err
+	}
+	var body paypalCaptureRequest
+	err = c.Bind(&body)
+	if err != nil {
+		return err
+	}
+	if body.ID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "order_id is empty")
+	}
+
+	payment, err := paypal.Default.CapturePayment(body.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, "Error capturing order "+body.ID).SetInternal(err)
+	}
+	res := paypalCaptureResponse{
+		paypalOrderResponse: paypalOrderResponse{Payment: payment, Tier: tierID(payment.Currency, payment.Amount)},
+	}
+	if currency, err := stripe.GetCurrencyInfo(payment.Currency); err == nil {
+		res.Premium = payment.Amount >= currency.Amount
+	}
+
+	switch payment.Status {
+	case payments.StatusSucceeded:
+	case payments.StatusPending:
+		// e.g. an eCheck, the webhook records the donation once it clears
+		return c.JSON(http.StatusAccepted, &res)
+	default:
+		return echo.NewHTTPError(http.StatusPaymentRequired, "Bad Payment Status: Order "+body.ID+" is "+string(payment.Status))
+	}
+
+	token, created, credited, err := recordDonation(payment)
+	if err != nil {
+		return err
+	}
+	res.Credited = credited
+	// Anyone with the order id could capture it again, so only show the token to the donor
+	if !credited && (created || (body.Email != "" && body.Email == payment.Email)) {
+		res.Token = token.String()
+	}
+	return c.JSON(http.StatusOK, &res)
+}
+
+// API Handler POST /paypal/webhook
+func handlePayPalWebhook(c echo.Context) error {
+	err := requirePayPal()
+	if err != nil {
+		return err
+	}
+	payload, err := readWebhookPayload(c)
+	if err != nil {
+		return err
+	}
+
+	event, err := paypal.Default.ParseWebhook(c.Request().Header, payload)
+	if err == paypal.ErrInvalidSignature {
+		return echo.NewHTTPError(http.StatusBadRequest, "incorrect signature").SetInternal(err)
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Error verifying PayPal webhook").SetInternal(err)
+	}
+
+	switch event.Type {
+	case payments.EventApproved:
+		// The donor might have closed the page before coming back to capture it
+		payment, err := paypal.Default.CapturePayment(event.Payment.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Error capturing order "+event.Payment.ID).SetInternal(err)
+		}
+		if payment.Status == payments.StatusSucceeded {
+			_, _, _, err = recordDonation(payment)
+		}
+	case payments.EventSucceeded:
+		_, _, _, err = recordDonation(event.Payment)
+	case payments.EventRefunded:
+		err = revokeDonation(event.Payment)
+	}
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
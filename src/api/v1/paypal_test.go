@@ -0,0 +1,34 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/paypal"
+	"github.com/ImpactDevelopment/ImpactServer/src/stripe"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentProvider(t *testing.T) {
+	assert.Equal(t, stripe.Name, paymentProvider(stripe.Name).Name())
+	assert.Nil(t, paymentProvider("bitcoin"))
+
+	// There are no credentials in tests, so paypal is disabled
+	assert.Nil(t, paypal.Default)
+	assert.Nil(t, paymentProvider(paypal.Name))
+
+	for name := range donationColumns {
+		assert.Contains(t, []string{stripe.Name, paypal.Name}, name)
+	}
+}
+
+func TestPayPalDisabled(t *testing.T) {
+	e := getServer()
+	for _, path := range []string{"/v1/paypal/createorder", "/v1/paypal/capture", "/v1/paypal/webhook"} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code, path)
+	}
+}
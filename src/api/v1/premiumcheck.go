@@ -2,7 +2,6 @@ package v1
 
 import (
 	"net/http"
-	"os"
 
 	"github.com/ImpactDevelopment/ImpactServer/src/database"
 	"github.com/google/uuid"
@@ -10,9 +9,6 @@ import (
 )
 
 func premiumCheck(c echo.Context) error {
-	if c.QueryParam("auth")+"0" != os.Getenv("API_AUTH_SECRET") {
-		return c.JSON(http.StatusForbidden, "auth wrong im sowwy")
-	}
 	uuidStr := c.QueryParam("uuid")
 	minecraftID, err := uuid.Parse(uuidStr)
 	if err != nil {
@@ -14,6 +14,7 @@ import (
 
 	"github.com/ImpactDevelopment/ImpactServer/src/database"
 	"github.com/ImpactDevelopment/ImpactServer/src/discord"
+	"github.com/ImpactDevelopment/ImpactServer/src/outbox"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
@@ -38,20 +39,18 @@ func checkToken(c echo.Context) error {
 
 	var createdAt int64
 	var roles pq.StringArray
+	var durations pq.Int64Array
 	err = database.DB.QueryRow(`
 		SELECT
 			created_at,
-			STRING_TO_ARRAY(
-				CONCAT_WS(',',
-					CASE WHEN premium THEN 'premium' END,
-					CASE WHEN pepsi THEN 'pepsi' END,
-					CASE WHEN spawnmason THEN 'spawnmason' END,
-					CASE WHEN staff THEN 'staff' END
-				),
-				','
-			) AS roles
+			ARRAY(
+				SELECT role_id FROM pending_donation_roles WHERE pending_donation_roles.token = pending_donations.token ORDER BY role_id
+			) AS roles,
+			ARRAY(
+				SELECT COALESCE(duration, 0) FROM pending_donation_roles WHERE pending_donation_roles.token = pending_donations.token ORDER BY role_id
+			) AS durations
 		FROM pending_donations
-		WHERE token = $1 AND NOT used`, token).Scan(&createdAt, &roles)
+		WHERE token = $1 AND NOT used`, token).Scan(&createdAt, &roles, &durations)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return echo.NewHTTPError(http.StatusBadRequest, "invalid token").SetInternal(err)
@@ -59,12 +58,22 @@ func checkToken(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error()).SetInternal(err)
 	}
 
+	// Seconds each time-limited role will last once redeemed
+	var roleDurations = make(map[string]int64)
+	for i, role := range roles {
+		if i < len(durations) && durations[i] > 0 {
+			roleDurations[role] = durations[i]
+		}
+	}
+
 	return c.JSON(http.StatusOK, struct {
-		CreatedAt string   `json:"created_at"`
-		Roles     []string `json:"roles"`
+		CreatedAt string           `json:"created_at"`
+		Roles     []string         `json:"roles"`
+		Durations map[string]int64 `json:"durations,omitempty"`
 	}{
 		CreatedAt: time.Unix(createdAt, 0).UTC().Format(time.RFC3339),
 		Roles:     roles,
+		Durations: roleDurations,
 	})
 }
 
@@ -98,16 +107,13 @@ func registerWithToken(c echo.Context) error {
 
 	// Verify the registration token
 	var (
-		token      *uuid.UUID
-		createdAt  int64
-		currency   sql.NullString
-		amount     sql.NullInt64
-		used       bool
-		logID      sql.NullString
-		premium    bool
-		pepsi      bool
-		spawnmason bool
-		staff      bool
+		token     *uuid.UUID
+		createdAt int64
+		currency  sql.NullString
+		amount    sql.NullInt64
+		used      bool
+		logID     sql.NullString
+		roles     pq.StringArray
 	)
 	// token can be omitted if logged in
 	if body.Token != "" {
@@ -115,7 +121,12 @@ func registerWithToken(c echo.Context) error {
 		if err != nil {
 			return err
 		}
-		err = database.DB.QueryRow("SELECT created_at, currency, amount, used, log_msg_id, premium, pepsi, spawnmason, staff FROM pending_donations WHERE token = $1", token).Scan(&createdAt, &currency, &amount, &used, &logID, &premium, &pepsi, &spawnmason, &staff)
+		err = database.DB.QueryRow(`
+			SELECT
+				created_at, currency, amount, used, log_msg_id,
+				ARRAY(SELECT role_id FROM pending_donation_roles WHERE pending_donation_roles.token = pending_donations.token) AS roles
+			FROM pending_donations
+			WHERE token = $1`, token).Scan(&createdAt, &currency, &amount, &used, &logID, &roles)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, "invalid token")
 		}
@@ -169,8 +180,10 @@ func registerWithToken(c echo.Context) error {
 
 	// Find or create the user
 	var userID *uuid.UUID
+	var created bool
 	if user, err := findAccountFromIDs(email, discordID, minecraftProfile); err == nil && user == nil {
 		// no error, but user is nil, so create a new user
+		created = true
 		err = tx.QueryRow("INSERT INTO users(legacy) VALUES (false) RETURNING user_id").Scan(&userID)
 		if err != nil {
 			log.Print(err.Error())
@@ -190,16 +203,20 @@ func registerWithToken(c echo.Context) error {
 	}
 
 	// Grant roles based on token
-	_, err = tx.Exec(`UPDATE users
-							SET premium    = $2 OR premium,
-							    pepsi      = $3 OR pepsi,
-							    spawnmason = $4 OR spawnmason,
-							    staff      = $5 OR staff
-							WHERE user_id = $1`,
-		userID, premium, pepsi, spawnmason, staff)
-	if err != nil {
-		log.Print(err.Error())
-		return err
+	if token != nil {
+		err = database.RedeemDonation(tx, *token, *userID)
+		if err != nil {
+			log.Print(err.Error())
+			return err
+		}
+		// Refunding the donation deletes accounts it created, see revokeDonation
+		if created {
+			_, err = tx.Exec(`UPDATE pending_donations SET created_user = true WHERE token = $1`, *token)
+			if err != nil {
+				log.Print(err.Error())
+				return err
+			}
+		}
 	}
 	_, err = tx.Exec(`UPDATE users SET email=$2, password_hash=$3 WHERE user_id = $1`, userID, email, hashedPassword)
 	if err != nil {
@@ -221,13 +238,21 @@ func registerWithToken(c echo.Context) error {
 		}
 	}
 
-	// TODO should we just DELETE the token?
-	if token != nil {
-		_, err = tx.Exec("UPDATE pending_donations SET used = true, used_by = $1 WHERE token = $2", userID, token)
-		if err != nil {
-			log.Print(err.Error())
-			return err
-		}
+	// Discord roles and logging happen once this is committed
+	err = outbox.Enqueue(tx, jobRegistered, registeredJob{
+		LogID:     logID.String,
+		DiscordID: discordID,
+		Joined:    joinDiscord(body.DiscordToken, discordID),
+		Minecraft: minecraftProfile,
+		Currency:  currency.String,
+		Amount:    amount.Int64,
+		Donated:   containsString(roles, "premium") && logID.String != "",
+		Upgraded:  authedUser != nil,
+		Premium:   containsString(roles, "premium"),
+	})
+	if err != nil {
+		log.Print(err.Error())
+		return err
 	}
 
 	err = tx.Commit()
@@ -236,52 +261,21 @@ func registerWithToken(c echo.Context) error {
 		return err
 	}
 
-	go func() {
-		var isMember bool
-		if discordID != "" {
-			// TODO grant donator status based on token roles
-			if isMember = discord.CheckServerMembership(discordID); isMember {
-				err = discord.GiveDonator(discordID)
-			} else {
-				err = discord.JoinOurServer(body.DiscordToken, discordID, true)
-			}
-			if err != nil {
-				discord.LogDonationEvent(logID.String, "Error adding donator to discord: "+err.Error(), discordID, minecraftProfile, currency.String, amount.Int64)
-				return
-			}
-		}
-
-		var msg strings.Builder
-		msg.WriteString("Someone just")
-		if premium && logID.String != "" {
-			// TODO get this bit _from_ the previous log msg?
-			msg.WriteString(" donated")
-		}
-		if discordID != "" && !isMember {
-			if msg.String() != "Someone just" {
-				msg.WriteString(",")
-			}
-			msg.WriteString(" joined the server")
-		}
-		if msg.String() != "Someone just" {
-			msg.WriteString(" and")
-		}
-		if authedUser == nil {
-			msg.WriteString(" registered an")
-		} else {
-			msg.WriteString(" upgraded their")
-		}
-		msg.WriteString(" Impact Account")
-		_, _ = discord.LogDonationEvent(logID.String, msg.String(), discordID, minecraftProfile, currency.String, amount.Int64)
-	}()
-
 	// Get the user so we can log them in
 	user := database.LookupUserByID(*userID)
 	if user == nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "successfully registered, but can't find user")
 	}
 
-	return c.String(http.StatusOK, jwt.CreateUserJWT(user))
+	if !user.EmailVerified {
+		err = sendVerificationEmail(user.ID, user.Email, emailLocale(c, user))
+		if err != nil {
+			// They can ask for another one once logged in
+			log.Println("Error sending verification email", err)
+		}
+	}
+
+	return jwt.RespondWithToken(user, c)
 }
 
 func getToken(token string) (*uuid.UUID, error) {
@@ -292,8 +286,14 @@ func getToken(token string) (*uuid.UUID, error) {
 	return &tokenID, nil
 }
 
-func verifyEmail(email string) (string, error) {
-	return email, nil // TODO
+// containsRole returns true if the role id is in the list
+func containsString(list []string, str string) bool {
+	for _, it := range list {
+		if it == str {
+			return true
+		}
+	}
+	return false
 }
 
 func hashPassword(password string) (string, error) {
@@ -313,6 +313,21 @@ func getDiscordID(token string) (string, error) {
 	return discordID, err
 }
 
+// joinDiscord adds the user to our server using their oauth access token, returning true if they weren't already in it.
+// It's done straight away so that the token never has to be stored, the registeredJob gives them the donator role.
+func joinDiscord(accessToken string, discordID string) bool {
+	if accessToken == "" || discordID == "" || discord.CheckServerMembership(discordID) {
+		return false
+	}
+	err := discord.JoinOurServer(strings.TrimSpace(accessToken), discordID, false)
+	if err != nil {
+		// They can still join with an invite
+		log.Println("Error adding", discordID, "to our discord server", err)
+		return false
+	}
+	return true
+}
+
 func findAccountFromIDs(email string, discordID string, minecraft *minecraft.Profile) (*users.User, error) {
 	var (
 		emailUser     *users.User
@@ -366,9 +381,7 @@ func findAccountFromIDs(email string, discordID string, minecraft *minecraft.Pro
 		}
 		// If the user has a password (and they didn't also auth with the matching discord account) we should treat this as an attempt to hijack their account
 		// TODO should we also compare the provided password with the password hash?
-		// TODO should we provide an alternative method for existing (non-donator) users to donate?
-		//      e.g. if logged in, just associate donations with the logged in user?
-		//      or allow users to enter a token in their account dashboard?
+		// Existing users can donate while logged in instead, see recordDonation
 		if emailUser.PasswordHash != "" && discordUser == nil {
 			return nil, echo.NewHTTPError(http.StatusConflict, "email belongs to a user with a password set")
 		}
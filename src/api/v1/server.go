@@ -2,6 +2,7 @@ package v1
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/ImpactDevelopment/ImpactServer/src/jwt"
 
@@ -13,31 +14,94 @@ import (
 func API(api *echo.Group) {
 	// TODO API Doc
 
+	api.GET("/.well-known/jwks.json", jwt.JWKSHandler, middleware.CacheUntilPurge())
+	api.GET("/.well-known/openid-configuration", jwt.DiscoveryHandler, middleware.CacheUntilPurge())
 	api.GET("/thealtening/info", getTheAlteningInfo, middleware.CacheUntilPurge())
 	api.GET("/motd", getMotd, middleware.CacheUntilPurge())
+	api.GET("/stream", getStream, middleware.NoCache())
 	api.GET("/themes", getThemes, middleware.CacheUntilPurge())
 	api.GET("/minecraft/user/info", getUserInfo, middleware.CacheUntilPurge())
+	api.GET("/minecraft/user/info/changes", getUserInfoChanges, middleware.NoCache())
 	api.GET("/minecraft/user/:role/list", getRoleMembers, middleware.CacheUntilPurge())
 	api.GET("/dbtest", dbTest, middleware.NoCache())
 	api.GET("/user/me", getUser, middleware.NoCache(), middleware.RequireAuth)
 	api.PATCH("/user/me", patchUser, middleware.NoCache(), middleware.RequireAuth)
+	api.DELETE("/user/me", deleteUser, middleware.NoCache(), middleware.RequireAuth, middleware.Limit(time.Minute, 5))
+	api.DELETE("/user/me/deletion", cancelUserDeletion, middleware.NoCache(), middleware.RequireAuth)
+	api.GET("/user/me/export", getUserExport, middleware.NoCache(), middleware.RequireAuth, middleware.Limit(time.Hour, 5))
+	api.POST("/user/me/link/minecraft", postLinkMinecraft, middleware.NoCache(), middleware.RequireAuth, middleware.Limit(time.Minute, 5))
+	api.DELETE("/user/me/link/minecraft", deleteLinkMinecraft, middleware.NoCache(), middleware.RequireAuth)
+	api.POST("/user/me/link/discord", postLinkDiscord, middleware.NoCache(), middleware.RequireAuth, middleware.Limit(time.Minute, 5))
+	api.DELETE("/user/me/link/discord", deleteLinkDiscord, middleware.NoCache(), middleware.RequireAuth)
+	api.POST("/user/me/merge", postMergeAccount, middleware.NoCache(), middleware.RequireAuth, middleware.Limit(time.Minute, 5))
+	api.GET("/user/me/donations", getUserDonations, middleware.NoCache(), middleware.RequireAuth)
+	api.POST("/user/me/billing", postBillingPortal, middleware.NoCache(), middleware.RequireAuth, middleware.Limit(time.Minute, 5))
+	api.GET("/user/me/cape", getMyCapeUpload, middleware.NoCache(), middleware.RequireAuth)
+	api.POST("/user/me/cape", postCape, middleware.NoCache(), middleware.RequireAuth, middleware.Limit(10*time.Minute, 3))
+	api.GET("/user/me/sessions", getSessions, middleware.NoCache(), middleware.RequireAuth)
+	api.DELETE("/user/me/sessions", deleteSessions, middleware.NoCache(), middleware.RequireAuth)
+	api.DELETE("/user/me/sessions/:id", deleteSession, middleware.NoCache(), middleware.RequireAuth)
+	api.GET("/user/me/passkeys", getPasskeys, middleware.NoCache(), middleware.RequireAuth)
+	api.DELETE("/user/me/passkeys/:id", deletePasskey, middleware.NoCache(), middleware.RequireAuth)
+	api.GET("/user/me/2fa", getTwoFactor, middleware.NoCache(), middleware.RequireAuth)
+	api.DELETE("/user/me/2fa", deleteTwoFactor, middleware.NoCache(), middleware.RequireAuth, middleware.Limit(time.Minute, 5))
+	api.POST("/user/me/2fa/totp", postTOTP, middleware.NoCache(), middleware.RequireAuth)
+	api.POST("/user/me/2fa/totp/verify", verifyTOTP, middleware.NoCache(), middleware.RequireAuth, middleware.Limit(time.Minute, 5))
+	api.POST("/user/me/2fa/recovery", postRecoveryCodes, middleware.NoCache(), middleware.RequireAuth, middleware.Limit(time.Minute, 5))
+	api.POST("/user/me/email/verify", resendVerifyEmail, middleware.NoCache(), middleware.RequireAuth, middleware.Limit(10*time.Minute, 3))
+	api.POST("/email/verify", postVerifyEmail, middleware.NoCache())
+	api.POST("/email/revert", postRevertEmail, middleware.NoCache())
 	api.PUT("/password/me", putPassword, middleware.NoCache(), middleware.RequireAuth)
 	api.PUT("/password/:token", putPassword, middleware.NoCache())
 	api.Match([]string{http.MethodGet, http.MethodPost}, "/password/reset", resetPassword, middleware.NoCache()) // TODO ratelimit resets
 	api.Match([]string{http.MethodGet, http.MethodPost}, "/login/password", jwt.PasswordLoginHandler, middleware.NoCache())
 	api.Match([]string{http.MethodGet, http.MethodPost}, "/login/minecraft", jwt.MinecraftLoginHandler, middleware.NoCache())
 	api.Match([]string{http.MethodGet, http.MethodPost}, "/login/discord", jwt.DiscordLoginHandler, middleware.NoCache())
+	api.POST("/login/webauthn/options", jwt.WebAuthnOptionsHandler, middleware.NoCache(), middleware.Limit(time.Minute, 10))
+	api.POST("/login/webauthn", jwt.WebAuthnLoginHandler, middleware.NoCache())
+	api.POST("/login/webauthn/register/options", postPasskeyOptions, middleware.NoCache(), middleware.RequireAuth)
+	api.POST("/login/webauthn/register", postPasskey, middleware.NoCache(), middleware.RequireAuth)
+	api.POST("/login/2fa", jwt.TwoFactorLoginHandler, middleware.NoCache(), middleware.Limit(time.Minute, 5))
+	api.POST("/login/refresh", jwt.RefreshHandler, middleware.NoCache())
+	api.GET("/oauth/authorize", getOAuthAuthorize, middleware.NoCache())
+	api.POST("/oauth/authorize", postOAuthAuthorize, middleware.NoCache(), middleware.RequireAuth)
+	api.POST("/oauth/token", postOAuthToken, middleware.NoCache())
+	api.GET("/oauth/userinfo", getOAuthUserInfo, middleware.NoCache())
 	api.Any("/stripe/info", getStripeInfo, middleware.CacheUntilPurge())
 	api.Any("/stripe/webhook", handleStripeWebhook, middleware.NoCache())
 	api.Match([]string{http.MethodGet, http.MethodPost}, "/stripe/createpayment", createStripePayment, middleware.NoCache())
 	api.Match([]string{http.MethodGet, http.MethodPost}, "/stripe/redeem", redeemStripePayment, middleware.NoCache())
-	api.GET("/stripe/connect/login", getStripeLogin, middleware.NoCache(), middleware.RequireAuth)
+	api.POST("/stripe/subscribe", postSubscribe, middleware.NoCache(), middleware.RequireAuth, middleware.Limit(time.Minute, 5))
+	api.POST("/paypal/createorder", createPayPalOrder, middleware.NoCache())
+	api.POST("/paypal/capture", capturePayPalOrder, middleware.NoCache(), middleware.Limit(time.Minute, 10))
+	api.POST("/paypal/webhook", handlePayPalWebhook, middleware.NoCache())
+	api.GET("/stripe/connect/login", getStripeLogin, middleware.NoCache(), middleware.RequireTwoFactor)
 	api.Match([]string{http.MethodGet, http.MethodPost}, "/checktoken", checkToken, middleware.NoCache())
 	api.Match([]string{http.MethodGet, http.MethodPost}, "/register/token", registerWithToken, middleware.NoCache())
-	api.GET("/emailtest", emailTest, middleware.NoCache())
-	api.GET("/premiumcheck", premiumCheck, middleware.NoCache())
-	api.GET("/integration/futureclient/masonlist", futureIntegrationMasonList, middleware.NoCache())
-	api.GET("/integration/futureclient/overalldata", futureIntegrationOverallData, middleware.NoCache())
-	api.GET("/integration/impactbot/checkdonator/:discordid", checkDonator, middleware.NoCache())
-	api.GET("/integration/impactbot/genkey", genkey, middleware.NoCache())
+	api.GET("/emailtest", emailTest, middleware.NoCache(), middleware.RequireAPIKey("email:test"))
+	api.GET("/premiumcheck", premiumCheck, middleware.NoCache(), middleware.RequireAPIKeyOrScope("premium:check"))
+	api.GET("/integration/futureclient/masonlist", futureIntegrationMasonList, middleware.NoCache(), middleware.RequireAPIKeyOrScope("mason:list"))
+	api.GET("/integration/futureclient/overalldata", futureIntegrationOverallData, middleware.NoCache(), middleware.RequireAPIKeyOrScope("userinfo:read"))
+	api.GET("/integration/impactbot/checkdonator/:discordid", checkDonator, middleware.NoCache(), middleware.RequireAPIKeyOrScope("donator:check"))
+	api.GET("/integration/impactbot/genkey", genkey, middleware.NoCache(), middleware.RequireAPIKey("tokens:generate"))
+	api.GET("/admin/customizations", getCustomizations, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.GET("/admin/customizations/:user", getCustomization, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.PUT("/admin/customizations/:user", putCustomization, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.DELETE("/admin/customizations/:user", deleteCustomization, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.GET("/admin/oauth/clients", getOAuthClients, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.POST("/admin/oauth/clients", postOAuthClient, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.DELETE("/admin/oauth/clients/:id", deleteOAuthClient, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.GET("/admin/apikeys", getAPIKeys, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.POST("/admin/apikeys", postAPIKey, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.DELETE("/admin/apikeys/:id", deleteAPIKey, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.GET("/admin/outbox", getOutboxJobs, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.GET("/admin/outbox/:id", getOutboxJob, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.POST("/admin/outbox/:id/replay", replayOutboxJob, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.POST("/admin/donations/:provider/:id/refund", postRefund, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.GET("/admin/tiers", getDonationTiers, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.PUT("/admin/tiers/:id", putDonationTier, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.DELETE("/admin/tiers/:id", deleteDonationTier, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.GET("/admin/capes", getCapeUploads, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.POST("/admin/capes/:id/approve", approveCapeUpload, middleware.NoCache(), middleware.RequireRole("staff"))
+	api.POST("/admin/capes/:id/reject", rejectCapeUpload, middleware.NoCache(), middleware.RequireRole("staff"))
 }
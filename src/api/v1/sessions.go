@@ -0,0 +1,81 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/middleware"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// currentSessionID returns the id of the session used to authenticate, or uuid.Nil if the token predates sessions
+func currentSessionID(c echo.Context) uuid.UUID {
+	if claims := middleware.GetClaims(c); claims != nil && claims.SessionID != nil {
+		return *claims.SessionID
+	}
+	return uuid.Nil
+}
+
+// API Handler GET /user/me/sessions
+func getSessions(c echo.Context) error {
+	user := middleware.GetUser(c)
+	if user == nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "not logged in")
+	}
+
+	sessions, err := database.GetUserSessions(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching sessions").SetInternal(err)
+	}
+
+	type session struct {
+		database.Session
+		Current bool `json:"current"`
+	}
+	current := currentSessionID(c)
+	ret := make([]session, 0, len(sessions))
+	for _, it := range sessions {
+		ret = append(ret, session{
+			Session: it,
+			Current: it.ID == current,
+		})
+	}
+	return c.JSON(http.StatusOK, ret)
+}
+
+// API Handler DELETE /user/me/sessions
+// Logs out every other device
+func deleteSessions(c echo.Context) error {
+	user := middleware.GetUser(c)
+	if user == nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "not logged in")
+	}
+
+	err := database.DeleteUserSessions(database.DB, user.ID, currentSessionID(c))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error revoking sessions").SetInternal(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// API Handler DELETE /user/me/sessions/:id
+func deleteSession(c echo.Context) error {
+	user := middleware.GetUser(c)
+	if user == nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "not logged in")
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid session id").SetInternal(err)
+	}
+
+	deleted, err := database.DeleteSession(user.ID, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error revoking session").SetInternal(err)
+	}
+	if !deleted {
+		return echo.NewHTTPError(http.StatusNotFound, "session not found")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,205 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/util"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// streamHeartbeat must be less than heroku's 55 second idle timeout
+	streamHeartbeat = 25 * time.Second
+	// streamMaxPerIP is how many streams a single ip can have open at once
+	streamMaxPerIP = 4
+	// streamBuffer is how many events a subscriber can fall behind by before it is disconnected
+	streamBuffer = 32
+)
+
+// streamEvent is a single server-sent event
+type streamEvent struct {
+	// ID is sent as the event id, so the client can resume with Last-Event-ID. Empty to not send one.
+	ID   string
+	Name string
+	Data interface{}
+}
+
+// write sends the event in text/event-stream format
+func (e streamEvent) write(w http.ResponseWriter) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+	if e.ID != "" {
+		_, err = fmt.Fprintf(w, "id: %s\n", e.ID)
+		if err != nil {
+			return err
+		}
+	}
+	// json never contains raw newlines, so it always fits on one data line
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Name, data)
+	return err
+}
+
+// streamHub keeps track of connected streams and broadcasts events to them
+type streamHub struct {
+	lock        sync.Mutex
+	subscribers map[chan streamEvent]struct{}
+	perIP       map[string]int
+}
+
+var stream = streamHub{
+	subscribers: make(map[chan streamEvent]struct{}),
+	perIP:       make(map[string]int),
+}
+
+// subscribe registers a new subscriber for ip, returning nil if ip already has too many
+func (h *streamHub) subscribe(ip string) chan streamEvent {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.perIP[ip] >= streamMaxPerIP {
+		return nil
+	}
+	h.perIP[ip]++
+	events := make(chan streamEvent, streamBuffer)
+	h.subscribers[events] = struct{}{}
+	return events
+}
+
+// unsubscribe removes a subscriber added by subscribe
+func (h *streamHub) unsubscribe(ip string, events chan streamEvent) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.perIP[ip]--; h.perIP[ip] <= 0 {
+		delete(h.perIP, ip)
+	}
+	if _, ok := h.subscribers[events]; ok {
+		delete(h.subscribers, events)
+		close(events)
+	}
+}
+
+// publish sends the event to every subscriber without blocking.
+// Subscribers that have fallen too far behind are disconnected, they can resume from their last event id.
+func (h *streamHub) publish(event streamEvent) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for events := range h.subscribers {
+		select {
+		case events <- event:
+		default:
+			delete(h.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// publishUserInfo sends the latest user info delta to every subscriber
+func publishUserInfo() {
+	if delta, ok := userData.latest(); ok {
+		stream.publish(userInfoEvent(delta))
+	}
+}
+
+// publishMotd sends the motd to every subscriber
+func publishMotd(motd string) {
+	stream.publish(motdEvent(motd))
+}
+
+func userInfoEvent(delta userInfoDelta) streamEvent {
+	return streamEvent{
+		ID:   strconv.FormatUint(delta.Version, 10),
+		Name: "userinfo",
+		Data: delta,
+	}
+}
+
+func motdEvent(motd string) streamEvent {
+	return streamEvent{
+		Name: "motd",
+		Data: struct {
+			Motd string `json:"motd"`
+		}{motd},
+	}
+}
+
+// resyncEvent tells the client it can't be caught up, and must refetch /minecraft/user/info
+func resyncEvent(version uint64) streamEvent {
+	return streamEvent{
+		ID:   strconv.FormatUint(version, 10),
+		Name: "resync",
+		Data: struct {
+			Version uint64 `json:"version"`
+		}{version},
+	}
+}
+
+// API Handler /stream
+// Server-sent events stream of "userinfo" deltas, "motd" changes and "resync" requests.
+// Clients can resume from a user info version using either the Last-Event-ID header or ?since=
+// Versions come from the user info itself, so an event id from one dyno resumes on any other that has seen that version.
+func getStream(c echo.Context) error {
+	ip := util.RealIPBestGuess(c)
+	events := stream.subscribe(ip)
+	if events == nil {
+		return echo.NewHTTPError(http.StatusTooManyRequests, "too many streams open")
+	}
+	defer stream.unsubscribe(ip, events)
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	// Catch the client up before sending anything new. Anything published in the meantime is already queued in events.
+	initial := []streamEvent{motdEvent(motd)}
+	if snapshot := userData.snapshot(); snapshot != nil {
+		since := c.Request().Header.Get("Last-Event-ID")
+		if since == "" {
+			since = c.QueryParam("since")
+		}
+		if version, err := strconv.ParseUint(since, 10, 64); err != nil {
+			// New client, tell them which version they should have fetched
+			initial = append(initial, resyncEvent(snapshot.version))
+		} else if delta, ok := userData.changesSince(version); !ok {
+			initial = append(initial, resyncEvent(snapshot.version))
+		} else if !delta.empty() {
+			initial = append(initial, userInfoEvent(delta))
+		}
+	}
+	for _, event := range initial {
+		err := event.write(res)
+		if err != nil {
+			return nil
+		}
+	}
+	res.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				// We fell behind, the client should reconnect with Last-Event-ID
+				return nil
+			}
+			if event.write(res) != nil {
+				return nil
+			}
+		case <-heartbeat.C:
+			// Comments are ignored by clients, but keep the connection open
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+		case <-c.Request().Context().Done():
+			return nil
+		}
+		res.Flush()
+	}
+}
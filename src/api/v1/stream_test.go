@@ -0,0 +1,115 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamHubLimits(t *testing.T) {
+	hub := streamHub{
+		subscribers: make(map[chan streamEvent]struct{}),
+		perIP:       make(map[string]int),
+	}
+
+	var subs []chan streamEvent
+	for i := 0; i < streamMaxPerIP; i++ {
+		events := hub.subscribe("1.2.3.4")
+		if assert.NotNil(t, events) {
+			subs = append(subs, events)
+		}
+	}
+	assert.Nil(t, hub.subscribe("1.2.3.4"))
+	assert.NotNil(t, hub.subscribe("5.6.7.8"))
+
+	hub.unsubscribe("1.2.3.4", subs[0])
+	assert.NotNil(t, hub.subscribe("1.2.3.4"))
+
+	// Filling a subscriber's buffer disconnects it
+	for i := 0; i <= streamBuffer; i++ {
+		hub.publish(motdEvent("hello"))
+	}
+	_, ok := <-subs[1]
+	assert.True(t, ok)
+	for range subs[1] {
+	}
+	assert.NotContains(t, hub.subscribers, subs[1])
+	hub.unsubscribe("1.2.3.4", subs[1]) // must not panic now it's already closed
+}
+
+func TestGetStream(t *testing.T) {
+	state := new(userInfoState)
+	_, err := state.update(map[string]users.UserInfo{"a": {Cape: "1"}})
+	assert.NoError(t, err)
+	v1 := state.snapshot().version
+	_, err = state.update(map[string]users.UserInfo{"a": {Cape: "2"}})
+	assert.NoError(t, err)
+	v2 := state.snapshot().version
+
+	old := userData
+	userData = state
+	defer func() { userData = old }()
+
+	stream := func(lastEventID string) string {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		req := httptest.NewRequest(http.MethodGet, "/v1/stream", nil).WithContext(ctx)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		rec := httptest.NewRecorder()
+		getServer().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+		return rec.Body.String()
+	}
+
+	body := stream("")
+	assert.Contains(t, body, "event: motd\n")
+	assert.Contains(t, body, "event: resync\ndata: {\"version\":"+strconv.FormatUint(v2, 10)+"}\n")
+
+	body = stream(strconv.FormatUint(v1, 10))
+	assert.Contains(t, body, "id: "+strconv.FormatUint(v2, 10)+"\nevent: userinfo\n")
+	assert.Contains(t, body, `"changed":{"a":{"cape":"2"}}`)
+	assert.False(t, strings.Contains(body, "event: resync"))
+
+	body = stream(strconv.FormatUint(v2, 10))
+	assert.NotContains(t, body, "event: userinfo")
+	assert.NotContains(t, body, "event: resync")
+}
+
+func TestGetStreamResumeOtherDyno(t *testing.T) {
+	// The client was last sent v1 by another dyno, this one has its own history of the same changes
+	other := new(userInfoState)
+	_, err := other.update(map[string]users.UserInfo{"a": {Cape: "1"}})
+	assert.NoError(t, err)
+	v1 := other.snapshot().version
+
+	state := new(userInfoState)
+	_, err = state.update(map[string]users.UserInfo{"a": {Cape: "1"}})
+	assert.NoError(t, err)
+	_, err = state.update(map[string]users.UserInfo{"a": {Cape: "2"}})
+	assert.NoError(t, err)
+	v2 := state.snapshot().version
+
+	old := userData
+	userData = state
+	defer func() { userData = old }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/v1/stream?since="+strconv.FormatUint(v1, 10), nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	getServer().ServeHTTP(rec, req)
+	body := rec.Body.String()
+	assert.Contains(t, body, "id: "+strconv.FormatUint(v2, 10)+"\nevent: userinfo\n")
+	assert.Contains(t, body, `"changed":{"a":{"cape":"2"}}`)
+	assert.NotContains(t, body, "event: resync")
+}
@@ -0,0 +1,279 @@
+package v1
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/middleware"
+	"github.com/ImpactDevelopment/ImpactServer/src/outbox"
+	"github.com/ImpactDevelopment/ImpactServer/src/stripe"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/ImpactDevelopment/ImpactServer/src/util"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	upstreamstripe "github.com/stripe/stripe-go/v71"
+)
+
+// subscriptionGrace is how long premium lasts after the end of a paid period, so that it doesn't lapse while stripe renews it
+const subscriptionGrace = 3 * 24 * time.Hour
+
+// API Handler POST /stripe/subscribe
+// Starts a stripe checkout session for the user to subscribe to premium, the client redirects to it using stripe.js
+func postSubscribe(c echo.Context) error {
+	user := middleware.GetUser(c)
+	var body struct {
+		Interval string `json:"interval" form:"interval" query:"interval"`
+	}
+	err := c.Bind(&body)
+	if err != nil {
+		return err
+	}
+	if body.Interval == "" {
+		body.Interval = stripe.Monthly
+	}
+
+	subs, err := database.GetUserSubscriptions(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching subscriptions").SetInternal(err)
+	}
+	for _, sub := range subs {
+		if subscriptionIsLive(sub.Status) {
+			return echo.NewHTTPError(http.StatusConflict, "already subscribed, use the billing portal to change your subscription")
+		}
+	}
+
+	customerID, err := getOrCreateCustomer(user)
+	if err != nil {
+		return err
+	}
+
+	success := util.GetServerURL()
+	success.Path = "/account.html"
+	success.RawQuery = "subscribed=true"
+	cancel := util.GetServerURL()
+	cancel.Path = "/donate.html"
+	sessionID, err := stripe.CreateSubscriptionCheckout(customerID, user.ID.String(), body.Interval, emailLocale(c, user), success.String(), cancel.String())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "error creating checkout session").SetInternal(err)
+	}
+	return c.JSON(http.StatusOK, struct {
+		SessionID string `json:"session_id"`
+	}{sessionID})
+}
+
+// getOrCreateCustomer returns the user's stripe customer, creating it if they don't have one yet
+func getOrCreateCustomer(user *users.User) (string, error) {
+	customerID, err := database.GetStripeCustomer(user.ID)
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusInternalServerError, "error fetching stripe customer").SetInternal(err)
+	}
+	if customerID != "" {
+		return customerID, nil
+	}
+	customerID, err = stripe.CreateCustomer(user.ID.String(), user.Email)
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusInternalServerError, "error creating stripe customer").SetInternal(err)
+	}
+	err = database.SetStripeCustomer(user.ID, customerID)
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusInternalServerError, "error saving stripe customer").SetInternal(err)
+	}
+	return customerID, nil
+}
+
+// subscriptionIsLive returns true if the subscription hasn't ended, even if it's waiting on a payment
+func subscriptionIsLive(status string) bool {
+	switch upstreamstripe.SubscriptionStatus(status) {
+	case upstreamstripe.SubscriptionStatusActive, upstreamstripe.SubscriptionStatusTrialing, upstreamstripe.SubscriptionStatusPastDue, upstreamstripe.SubscriptionStatusIncomplete:
+		return true
+	default:
+		return false
+	}
+}
+
+// What syncSubscription does to the user's premium, see subscriptionPremium
+const (
+	premiumWait = iota
+	premiumGrant
+	premiumRevoke
+)
+
+// subscriptionPremium returns what should happen to the user's premium when the subscription has the given status.
+// past_due and incomplete subscriptions are waiting for a payment, anything we don't recognise is left alone too.
+func subscriptionPremium(status string) int {
+	switch upstreamstripe.SubscriptionStatus(status) {
+	case upstreamstripe.SubscriptionStatusActive, upstreamstripe.SubscriptionStatusTrialing:
+		return premiumGrant
+	case upstreamstripe.SubscriptionStatusCanceled, upstreamstripe.SubscriptionStatusUnpaid, upstreamstripe.SubscriptionStatusIncompleteExpired:
+		return premiumRevoke
+	default:
+		return premiumWait
+	}
+}
+
+// subscriptionPremiumUntil returns when premium paid for up until periodEnd runs out
+func subscriptionPremiumUntil(periodEnd int64) int64 {
+	return time.Unix(periodEnd, 0).Add(subscriptionGrace).Unix()
+}
+
+func handleSubscriptionEvent(c echo.Context, event *stripe.WebhookEvent, subscription *upstreamstripe.Subscription) error {
+	err := syncSubscription(subscription.ID)
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func handleInvoiceEvent(c echo.Context, event *stripe.WebhookEvent, invoice *upstreamstripe.Invoice) error {
+	// One-off donations don't have invoices, so this is only for subscriptions
+	if invoice.Subscription != nil {
+		err := syncSubscription(invoice.Subscription.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// syncSubscription fetches the subscription from stripe and updates our copy, granting or revoking premium as needed.
+// Premium lasts until the end of each paid period, it's taken back straight away if the subscription is cancelled or goes unpaid.
+func syncSubscription(id string) error {
+	subscription, err := stripe.GetSubscription(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching subscription").SetInternal(err)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error starting database transaction").SetInternal(err)
+	}
+	defer tx.Rollback()
+
+	existing, err := database.GetSubscription(tx, subscription.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching subscription").SetInternal(err)
+	}
+	record := database.Subscription{
+		ID:                subscription.ID,
+		Status:            string(subscription.Status),
+		Interval:          stripe.SubscriptionInterval(subscription),
+		CurrentPeriodEnd:  subscription.CurrentPeriodEnd,
+		CancelAtPeriodEnd: subscription.CancelAtPeriodEnd,
+	}
+	if existing != nil {
+		record.UserID = existing.UserID
+		record.PremiumUntil = existing.PremiumUntil
+	} else {
+		record.UserID, err = subscriptionOwner(subscription)
+		if err != nil {
+			return err
+		}
+	}
+	user := database.LookupUserByID(record.UserID)
+	if user == nil {
+		// Not started from an Impact account, or the account has since been deleted
+		log.Printf("Ignoring subscription %s, it doesn't belong to any user\n", subscription.ID)
+		return nil
+	}
+
+	err = database.SaveSubscription(tx, record)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error saving subscription").SetInternal(err)
+	}
+
+	switch subscriptionPremium(record.Status) {
+	case premiumGrant:
+		err = database.ExtendSubscriptionPremium(tx, record, subscriptionPremiumUntil(record.CurrentPeriodEnd))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "error granting premium").SetInternal(err)
+		}
+		if user.DiscordID != "" && !user.HasRoleWithID("premium") {
+			err = outbox.Enqueue(tx, jobDiscordDonator, discordDonatorJob{DiscordID: user.DiscordID, Donator: true})
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+			}
+		}
+	case premiumRevoke:
+		// expireRoles takes it from here, including the email and discord roles
+		err = database.RevokeSubscriptionPremium(tx, record)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "error revoking premium").SetInternal(err)
+		}
+	case premiumWait:
+		// Waiting for a payment, premium lasts until the grace period runs out
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error saving subscription").SetInternal(err)
+	}
+	return nil
+}
+
+// subscriptionOwner works out which user a subscription we haven't seen before belongs to
+func subscriptionOwner(subscription *upstreamstripe.Subscription) (uuid.UUID, error) {
+	if id, err := uuid.Parse(subscription.Metadata["user_id"]); err == nil {
+		return id, nil
+	}
+	if subscription.Customer == nil {
+		return uuid.Nil, nil
+	}
+	userID, err := database.LookupUserByStripeCustomer(subscription.Customer.ID)
+	if err != nil {
+		return uuid.Nil, echo.NewHTTPError(http.StatusInternalServerError, "error looking up stripe customer").SetInternal(err)
+	}
+	return userID, nil
+}
+
+// cancelSubscriptions cancels any of the user's subscriptions that haven't ended, so they stop being charged
+func cancelSubscriptions(userID uuid.UUID) error {
+	subs, err := database.GetUserSubscriptions(userID)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		if !subscriptionIsLive(sub.Status) {
+			continue
+		}
+		err = stripe.CancelSubscription(sub.ID)
+		// It might have been cancelled from the stripe dashboard before the webhook arrived
+		if stripeErr, ok := err.(*upstreamstripe.Error); ok && stripeErr.Code == upstreamstripe.ErrorCodeResourceMissing {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// API Handler POST /user/me/billing
+// Creates a stripe customer portal session for the user to manage their subscriptions, and responds with its url.
+// Sessions are short-lived, so this is only called when the user actually wants to go there.
+func postBillingPortal(c echo.Context) error {
+	user := middleware.GetUser(c)
+	url, err := billingPortalURL(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error creating billing portal session").SetInternal(err)
+	}
+	if url == "" {
+		return echo.NewHTTPError(http.StatusNotFound, "no subscriptions to manage")
+	}
+	return c.JSON(http.StatusOK, struct {
+		URL string `json:"url"`
+	}{url})
+}
+
+// billingPortalURL returns a link to the stripe customer portal for the user, or an empty string if they've never subscribed
+func billingPortalURL(userID uuid.UUID) (string, error) {
+	customerID, err := database.GetStripeCustomer(userID)
+	if err != nil || customerID == "" {
+		return "", err
+	}
+	returnURL := util.GetServerURL()
+	returnURL.Path = "/account.html"
+	return stripe.CreatePortalURL(customerID, returnURL.String())
+}
@@ -0,0 +1,35 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionIsLive(t *testing.T) {
+	for _, status := range []string{"active", "trialing", "past_due", "incomplete"} {
+		assert.True(t, subscriptionIsLive(status), status)
+	}
+	for _, status := range []string{"canceled", "unpaid", "incomplete_expired", ""} {
+		assert.False(t, subscriptionIsLive(status), status)
+	}
+}
+
+func TestSubscriptionPremium(t *testing.T) {
+	for _, status := range []string{"active", "trialing"} {
+		assert.Equal(t, premiumGrant, subscriptionPremium(status), status)
+	}
+	for _, status := range []string{"canceled", "unpaid", "incomplete_expired"} {
+		assert.Equal(t, premiumRevoke, subscriptionPremium(status), status)
+	}
+	for _, status := range []string{"past_due", "incomplete", "paused", ""} {
+		assert.Equal(t, premiumWait, subscriptionPremium(status), status)
+	}
+
+	// Every live subscription either keeps or waits for premium, and every dead one loses it
+	for _, status := range []string{"active", "trialing", "past_due", "incomplete", "canceled", "unpaid", "incomplete_expired"} {
+		assert.Equal(t, subscriptionIsLive(status), subscriptionPremium(status) != premiumRevoke, status)
+	}
+
+	assert.Equal(t, int64(1000000+3*24*60*60), subscriptionPremiumUntil(1000000))
+}
@@ -0,0 +1,118 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/cloudflare"
+	"github.com/ImpactDevelopment/ImpactServer/src/currency"
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/labstack/echo/v4"
+)
+
+var tierIDPattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// API Handler GET /admin/tiers
+func getDonationTiers(c echo.Context) error {
+	list, err := database.GetDonationTiers()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error getting donation tiers").SetInternal(err)
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// API Handler PUT /admin/tiers/:id
+// Creates or replaces the tier, donations that already qualified for it keep the roles they were given
+func putDonationTier(c echo.Context) error {
+	var body database.DonationTier
+	err := c.Bind(&body)
+	if err != nil {
+		return err
+	}
+	body.ID = c.Param("id")
+	err = validateTier(&body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+
+	err = database.SaveDonationTier(body)
+	if err == database.ErrTierAmountTaken {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error saving donation tier").SetInternal(err)
+	}
+	purgeStripeInfo()
+	return c.JSON(http.StatusOK, body)
+}
+
+// API Handler DELETE /admin/tiers/:id
+func deleteDonationTier(c echo.Context) error {
+	deleted, err := database.DeleteDonationTier(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error deleting donation tier").SetInternal(err)
+	}
+	if !deleted {
+		return echo.NewHTTPError(http.StatusNotFound, "donation tier not found")
+	}
+	purgeStripeInfo()
+	return c.NoContent(http.StatusNoContent)
+}
+
+// validateTier checks the tier can be saved, normalising its currency codes
+func validateTier(tier *database.DonationTier) error {
+	if !tierIDPattern.MatchString(tier.ID) {
+		return fmt.Errorf("tier id must be 1 to 32 lowercase letters, numbers, dashes or underscores")
+	}
+	if tier.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if tier.USDAmount <= 0 {
+		return fmt.Errorf("usd_amount must be positive")
+	}
+	if tier.Perks == nil {
+		tier.Perks = []string{}
+	}
+
+	amounts := make(map[string]int64, len(tier.Amounts))
+	for code, amount := range tier.Amounts {
+		c, ok := currency.Lookup(code)
+		if !ok {
+			return fmt.Errorf("unknown currency %q", code)
+		}
+		if amount <= 0 {
+			return fmt.Errorf("amount for %s must be positive", c.DisplayName())
+		}
+		amounts[c.Code] = amount
+	}
+	tier.Amounts = amounts
+
+	if len(tier.Roles) < 1 {
+		return fmt.Errorf("a tier must grant at least one role")
+	}
+	seen := make(map[string]bool)
+	for _, role := range tier.Roles {
+		r, ok := users.GetRole(role.RoleID)
+		if !ok {
+			return fmt.Errorf("unknown role %q", role.RoleID)
+		}
+		if !r.TokenGrantable {
+			return fmt.Errorf("role %q can't be granted by donations", role.RoleID)
+		}
+		if seen[role.RoleID] {
+			return fmt.Errorf("role %q is granted more than once", role.RoleID)
+		}
+		seen[role.RoleID] = true
+		if role.Duration != nil && *role.Duration <= 0 {
+			return fmt.Errorf("duration for role %q must be positive, or left out for forever", role.RoleID)
+		}
+	}
+	return nil
+}
+
+// purgeStripeInfo clears the cached /stripe/info so the donate page shows the new tiers
+func purgeStripeInfo() {
+	cloudflare.PurgeURLs([]string{"https://api.impactclient.net/v1/stripe/info"})
+}
@@ -0,0 +1,53 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTier(t *testing.T) {
+	previous := users.GetRoles()
+	users.SetRoles([]users.Role{
+		users.NewRole("premium", 4, false, true, nil, nil),
+		users.NewRole("staff", 3, false, false, nil, nil),
+	})
+	defer users.SetRoles(previous)
+
+	month := int64(30 * 24 * 60 * 60)
+	zero := int64(0)
+	valid := func() database.DonationTier {
+		return database.DonationTier{
+			ID:        "monthly",
+			Name:      "Monthly",
+			USDAmount: 300,
+			Amounts:   map[string]int64{"EUR": 300},
+			Roles:     []database.DonationTierRole{{RoleID: "premium", Duration: &month}},
+		}
+	}
+
+	tier := valid()
+	if assert.NoError(t, validateTier(&tier)) {
+		assert.Equal(t, map[string]int64{"eur": 300}, tier.Amounts)
+		assert.Equal(t, []string{}, tier.Perks)
+	}
+
+	for name, modify := range map[string]func(*database.DonationTier){
+		"bad id":           func(tier *database.DonationTier) { tier.ID = "Monthly Tier" },
+		"no name":          func(tier *database.DonationTier) { tier.Name = "" },
+		"no amount":        func(tier *database.DonationTier) { tier.USDAmount = 0 },
+		"unknown currency": func(tier *database.DonationTier) { tier.Amounts["xyz"] = 300 },
+		"negative amount":  func(tier *database.DonationTier) { tier.Amounts["eur"] = -1 },
+		"no roles":         func(tier *database.DonationTier) { tier.Roles = nil },
+		"unknown role":     func(tier *database.DonationTier) { tier.Roles[0].RoleID = "admin" },
+		"ungrantable role": func(tier *database.DonationTier) { tier.Roles[0].RoleID = "staff" },
+		"duplicate role":   func(tier *database.DonationTier) { tier.Roles = append(tier.Roles, tier.Roles[0]) },
+		"zero duration":    func(tier *database.DonationTier) { tier.Roles[0].Duration = &zero },
+	} {
+		tier := valid()
+		modify(&tier)
+		assert.Error(t, validateTier(&tier), name)
+	}
+}
@@ -0,0 +1,209 @@
+package v1
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/email"
+	"github.com/ImpactDevelopment/ImpactServer/src/jwt"
+	"github.com/ImpactDevelopment/ImpactServer/src/middleware"
+	"github.com/ImpactDevelopment/ImpactServer/src/totp"
+	"github.com/labstack/echo/v4"
+)
+
+// totpIssuer is shown in authenticator apps next to the user's email
+const totpIssuer = "Impact"
+
+type twoFactorCodeRequest struct {
+	// Code is either a TOTP code or a recovery code
+	Code string `json:"code" form:"code"`
+}
+
+// checkTwoFactorCode makes the user prove they still have their second factor before changing it
+func checkTwoFactorCode(c echo.Context) error {
+	var body twoFactorCodeRequest
+	err := c.Bind(&body)
+	if err != nil {
+		return err
+	}
+	return verifyTwoFactorCode(c, body.Code)
+}
+
+// verifyTwoFactorCode checks code is a valid TOTP or recovery code for the current user
+func verifyTwoFactorCode(c echo.Context, code string) error {
+	if code == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "code must be provided")
+	}
+	ok, err := jwt.CheckSecondFactor(middleware.GetUser(c).ID, code)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error checking code").SetInternal(err)
+	}
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "incorrect code")
+	}
+	return nil
+}
+
+// API Handler GET /user/me/2fa
+func getTwoFactor(c echo.Context) error {
+	user := middleware.GetUser(c)
+	secret, err := database.GetTOTP(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching two factor status").SetInternal(err)
+	}
+	recoveryCodes, err := database.CountRecoveryCodes(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching two factor status").SetInternal(err)
+	}
+	return c.JSON(http.StatusOK, struct {
+		Enabled       bool `json:"enabled"`
+		Pending       bool `json:"pending"`
+		Required      bool `json:"required"`
+		RecoveryCodes int  `json:"recovery_codes_remaining"`
+	}{
+		Enabled:       secret != nil && secret.Enabled(),
+		Pending:       secret != nil && !secret.Enabled(),
+		Required:      user.RequiresTwoFactor(),
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// API Handler POST /user/me/2fa/totp
+// Starts enrolling, the user then has to prove their authenticator app works with verifyTOTP
+func postTOTP(c echo.Context) error {
+	user := middleware.GetUser(c)
+	if !user.IsFullAccount() {
+		// Only password logins ask for a second factor
+		return echo.NewHTTPError(http.StatusBadRequest, "two factor authentication needs an email and password")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error generating secret").SetInternal(err)
+	}
+	started, err := database.StartTOTP(user.ID, secret)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error saving secret").SetInternal(err)
+	}
+	if !started {
+		return echo.NewHTTPError(http.StatusConflict, "two factor authentication is already enabled")
+	}
+
+	return c.JSON(http.StatusOK, struct {
+		Secret string `json:"secret"`
+		// URI is the otpauth:// uri to show as a QR code
+		URI string `json:"uri"`
+	}{secret, totp.URI(secret, totpIssuer, user.Email)})
+}
+
+// API Handler POST /user/me/2fa/totp/verify
+// Finishes enrolling, responding with the user's recovery codes. They are never shown again.
+func verifyTOTP(c echo.Context) error {
+	user := middleware.GetUser(c)
+	var body twoFactorCodeRequest
+	err := c.Bind(&body)
+	if err != nil {
+		return err
+	}
+
+	secret, err := database.GetTOTP(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching secret").SetInternal(err)
+	}
+	if secret == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "two factor authentication has not been started")
+	}
+	if secret.Enabled() {
+		return echo.NewHTTPError(http.StatusConflict, "two factor authentication is already enabled")
+	}
+	step, ok := totp.Validate(secret.Secret, body.Code, time.Now(), 0)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "incorrect code")
+	}
+
+	codes, hashes, err := jwt.NewRecoveryCodes()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error generating recovery codes").SetInternal(err)
+	}
+	enabled, err := database.EnableTOTP(user.ID, step, hashes)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error enabling two factor authentication").SetInternal(err)
+	}
+	if !enabled {
+		// Raced with another request
+		return echo.NewHTTPError(http.StatusConflict, "two factor authentication is already enabled")
+	}
+	notifyTwoFactorChange(c, email.TwoFactorEnabled)
+	return c.JSON(http.StatusOK, struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{codes})
+}
+
+// API Handler POST /user/me/2fa/recovery
+// Replaces the user's recovery codes, so long as they provide a current code
+func postRecoveryCodes(c echo.Context) error {
+	user := middleware.GetUser(c)
+	enabled, err := database.HasTwoFactor(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching two factor status").SetInternal(err)
+	}
+	if !enabled {
+		return echo.NewHTTPError(http.StatusBadRequest, "two factor authentication is not enabled")
+	}
+	err = checkTwoFactorCode(c)
+	if err != nil {
+		return err
+	}
+
+	codes, hashes, err := jwt.NewRecoveryCodes()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error generating recovery codes").SetInternal(err)
+	}
+	err = database.SetRecoveryCodes(user.ID, hashes)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error saving recovery codes").SetInternal(err)
+	}
+	return c.JSON(http.StatusOK, struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{codes})
+}
+
+// API Handler DELETE /user/me/2fa
+// Turns off two factor authentication, so long as the user provides a current code
+func deleteTwoFactor(c echo.Context) error {
+	user := middleware.GetUser(c)
+	enabled, err := database.HasTwoFactor(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching two factor status").SetInternal(err)
+	}
+	if enabled {
+		err = checkTwoFactorCode(c)
+		if err != nil {
+			return err
+		}
+	}
+	// Pending enrolments can just be thrown away
+	err = database.DisableTwoFactor(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error disabling two factor authentication").SetInternal(err)
+	}
+	if enabled {
+		notifyTwoFactorChange(c, email.TwoFactorDisabled)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// notifyTwoFactorChange emails the user about a change to their second factor, in case it wasn't them
+func notifyTwoFactorChange(c echo.Context, name string) {
+	user := middleware.GetUser(c)
+	if user.Email == "" || !user.EmailVerified {
+		return
+	}
+	err := sendEmail(user.Email, emailLocale(c, user), name, nil)
+	if err != nil {
+		// The change has already happened, so don't fail the request
+		log.Println("Error sending two factor notification", err)
+	}
+}
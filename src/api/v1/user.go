@@ -4,16 +4,16 @@ import (
 	"database/sql"
 	"github.com/ImpactDevelopment/ImpactServer/src/database"
 	"github.com/ImpactDevelopment/ImpactServer/src/discord"
+	"github.com/ImpactDevelopment/ImpactServer/src/email"
 	"github.com/ImpactDevelopment/ImpactServer/src/middleware"
 	"github.com/ImpactDevelopment/ImpactServer/src/minecraft"
 	"github.com/ImpactDevelopment/ImpactServer/src/users"
-	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/stripe/stripe-go/v71"
 	"github.com/stripe/stripe-go/v71/loginlink"
-	"log"
 	"net/http"
 	"strings"
+	"time"
 )
 
 func getUser(c echo.Context) error {
@@ -37,16 +37,26 @@ func getUser(c echo.Context) error {
 			// Be sure to update src/users/features.go:privateFeatures() if
 			// adding or removing role-exclusive features here (e.g. Editions)
 			response struct {
-				Email         string             `json:"email"`
-				Minecraft     *minecraft.Profile `json:"minecraft,omitempty"`
-				Discord       *discord.User      `json:"discord,omitempty"`
-				Edition       *users.Edition     `json:"edition,omitempty"`
-				Features      *users.Features    `json:"features,omitempty"`
-				LegacyEnabled bool               `json:"legacy_enabled"`
-				Incognito     bool               `json:"incognito"`
-				Roles         []users.Role       `json:"roles,omitempty"`
-				Info          *users.UserInfo    `json:"info,omitempty"`
-				HasStripe     bool               `json:"has_stripe_connect,omitempty"`
+				Email         string `json:"email"`
+				EmailVerified bool   `json:"email_verified"`
+				// PendingEmail is waiting to be confirmed before it replaces Email
+				PendingEmail  string                  `json:"pending_email,omitempty"`
+				Locale        string                  `json:"locale,omitempty"`
+				Minecraft     *minecraft.Profile      `json:"minecraft,omitempty"`
+				Discord       *discord.User           `json:"discord,omitempty"`
+				Edition       *users.Edition          `json:"edition,omitempty"`
+				Features      *users.Features         `json:"features,omitempty"`
+				LegacyEnabled bool                    `json:"legacy_enabled"`
+				Incognito     bool                    `json:"incognito"`
+				Roles         []users.Role            `json:"roles,omitempty"`
+				RoleExpiry    map[string]string       `json:"role_expiry,omitempty"`
+				Info          *users.UserInfo         `json:"info,omitempty"`
+				Cosmetics     *users.CosmeticChoice   `json:"cosmetics,omitempty"`
+				Catalog       *users.CosmeticsCatalog `json:"cosmetics_catalog,omitempty"`
+				HasStripe     bool                    `json:"has_stripe_connect,omitempty"`
+				Subscriptions []database.Subscription `json:"subscriptions,omitempty"`
+				// DeleteAt is when the account will be deleted, unless the user cancels it
+				DeleteAt *int64 `json:"deletion_scheduled_at,omitempty"`
 			}
 		)
 
@@ -100,8 +110,34 @@ func getUser(c echo.Context) error {
 			return discordResult.Error
 		}
 
+		pendingEmail, err := database.GetPendingEmail(user.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "error fetching pending email").SetInternal(err)
+		}
+
+		subscriptions, err := database.GetUserSubscriptions(user.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "error fetching subscriptions").SetInternal(err)
+		}
+
+		deleteAt, err := database.GetAccountDeletion(user.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "error fetching account deletion").SetInternal(err)
+		}
+
+		// Report when any time-limited roles expire
+		roleExpiry := make(map[string]string)
+		for _, role := range user.Roles {
+			if role.Expires != nil {
+				roleExpiry[role.ID] = role.Expires.Format(time.RFC3339)
+			}
+		}
+
 		return c.JSON(http.StatusOK, response{
 			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			PendingEmail:  pendingEmail,
+			Locale:        user.Locale,
 			Minecraft:     minecraftResult.Profile,
 			Discord:       discordResult.Discord,
 			Edition:       editionResult.Edition,
@@ -109,8 +145,13 @@ func getUser(c echo.Context) error {
 			LegacyEnabled: user.LegacyEnabled,
 			Incognito:     user.Incognito,
 			Roles:         user.Roles,
+			RoleExpiry:    roleExpiry,
 			Info:          user.UserInfo,
+			Cosmetics:     user.Cosmetics,
+			Catalog:       user.CosmeticsCatalog(),
 			HasStripe:     user.StripeID != "",
+			Subscriptions: subscriptions,
+			DeleteAt:      deleteAt,
 		})
 	} else {
 		return echo.NewHTTPError(http.StatusUnauthorized, "not authenticated")
@@ -128,6 +169,10 @@ func patchUser(c echo.Context) error {
 			Password      *string `json:"password"`
 			LegacyEnabled *bool   `json:"legacy_enabled"`
 			Incognito     *bool   `json:"incognito"`
+			// Locale for emails, empty to go back to guessing from Accept-Language
+			Locale *string `json:"locale"`
+			// Cosmetics replaces the user's chosen cosmetics, an empty object resets them to the role defaults
+			Cosmetics *users.CosmeticChoice `json:"cosmetics"`
 		}
 		err := c.Bind(&body)
 		if err != nil {
@@ -141,14 +186,18 @@ func patchUser(c echo.Context) error {
 		}
 		defer tx.Rollback()
 
+		// Email changes don't happen until the new address is confirmed, see postVerifyEmail
+		var newEmail string
 		if body.Email != nil && *body.Email != user.Email {
-			email, err := verifyEmail(*body.Email)
+			newEmail, err = verifyEmail(*body.Email)
 			if err != nil {
 				return err
 			}
-			_, err = tx.Exec(`UPDATE users SET email = $2 WHERE user_id = $1`, user.ID, email)
-			if err != nil {
-				return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+			if newEmail == "" {
+				return echo.NewHTTPError(http.StatusBadRequest, "email cannot be removed")
+			}
+			if other := database.LookupUserByEmail(newEmail); other != nil && other.ID != user.ID {
+				return echo.NewHTTPError(http.StatusConflict, "email is in use by another account")
 			}
 		}
 
@@ -161,73 +210,40 @@ func patchUser(c echo.Context) error {
 			if err != nil {
 				return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
 			}
+			// Log out every other device, but not this one
+			err = database.DeleteUserSessions(tx, user.ID, currentSessionID(c))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+			}
 		}
 
 		if body.DiscordToken != nil {
-			// Don't lookup id if the token is empty or falsy; instead set discord_id to NullString's default: NULL
-			var discordID sql.NullString
+			// An empty or falsy token unlinks discord
 			if token := strings.TrimSpace(strings.ToLower(*body.DiscordToken)); token != "" && token != "false" && token != "null" && token != "0" {
 				id, err := getDiscordID(strings.TrimSpace(*body.DiscordToken))
 				if err != nil {
 					return err
 				}
-				discordID = sql.NullString{
-					String: id,
-					Valid:  true,
-				}
-			}
-			if discordID.String != user.DiscordID {
-				// Revoke roles from current linked discord
-				if user.DiscordID != "" && discord.CheckServerMembership(user.DiscordID) {
-					err := discord.SetDonator(user.DiscordID, false)
-					if err != nil {
-						return echo.NewHTTPError(http.StatusInternalServerError, "Unable to remove roles from current Discord account").SetInternal(err)
-					}
-				}
-				// Update the database
-				_, err = tx.Exec(`UPDATE users SET discord_id = $2 WHERE user_id = $1`, user.ID, discordID)
+				err = linkDiscord(tx, user, id)
 				if err != nil {
-					return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+					return err
 				}
-				// Grant roles to the new discord user
-				if discordID.Valid && user.HasRoleWithID("premium") {
-					if discord.CheckServerMembership(discordID.String) {
-						err := discord.SetDonator(discordID.String, true)
-						if err != nil {
-							return echo.NewHTTPError(http.StatusInternalServerError, "Unable to grant roles to new Discord account").SetInternal(err)
-						}
-					} else {
-						// TODO join guild? Or maybe include "not joined" in response so the client can know to show a "join" button?
-					}
+			} else {
+				err = unlinkDiscord(tx, user)
+				if err != nil {
+					return err
 				}
 			}
 		}
 
 		if body.Minecraft != nil {
-			var minecraftID *uuid.UUID
+			// A name or uuid doesn't prove the user owns the account, see postLinkMinecraft
 			if *body.Minecraft != "" {
-				profile, err := minecraft.GetProfile(*body.Minecraft)
-				if err != nil {
-					return err
-				}
-				minecraftID = &profile.ID
+				return echo.NewHTTPError(http.StatusBadRequest, "minecraft accounts must be linked from the game using POST /user/me/link/minecraft")
 			}
-
-			var changed bool
-			if minecraftID == nil {
-				changed = user.MinecraftID != nil
-			} else if user.MinecraftID == nil {
-				changed = true
-			} else {
-				changed = minecraftID.String() != user.MinecraftID.String()
-			}
-
-			if changed {
-				_, err = tx.Exec(`UPDATE users SET mc_uuid = $2 WHERE user_id = $1`, user.ID, minecraftID)
-				if err != nil {
-					log.Println(err)
-					return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
-				}
+			err = unlinkMinecraft(tx, user)
+			if err != nil {
+				return err
 			}
 		}
 
@@ -246,12 +262,44 @@ func patchUser(c echo.Context) error {
 			}
 		}
 
+		if body.Locale != nil && *body.Locale != user.Locale {
+			var locale sql.NullString
+			if *body.Locale != "" {
+				if !email.SupportedLocale(*body.Locale) {
+					return echo.NewHTTPError(http.StatusBadRequest, "unsupported locale, expected one of "+strings.Join(email.Locales(), ", "))
+				}
+				locale = sql.NullString{String: *body.Locale, Valid: true}
+			}
+			_, err = tx.Exec(`UPDATE users SET locale = $2 WHERE user_id = $1`, user.ID, locale)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+			}
+		}
+
+		if body.Cosmetics != nil {
+			err = user.ValidateCosmeticChoice(*body.Cosmetics)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+			}
+			err = database.SetCosmeticChoice(tx, user.ID, *body.Cosmetics)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+			}
+		}
+
 		// Update the DB
 		err = tx.Commit()
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "error committing changes to the database").SetInternal(err)
 		}
 
+		if newEmail != "" {
+			err = sendVerificationEmail(user.ID, newEmail, emailLocale(c, user))
+			if err != nil {
+				return err
+			}
+		}
+
 		// update context and then defer to getUser
 		c.Set("user", database.LookupUserByID(user.ID))
 		return getUser(c)
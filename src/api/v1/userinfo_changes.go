@@ -0,0 +1,233 @@
+package v1
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+)
+
+// userInfoHistory is how many past versions of the user info map can be used with ?since=
+const userInfoHistory = 100
+
+// userInfoDelta describes how the hashed user info map changed between two versions
+type userInfoDelta struct {
+	// Version the delta starts from
+	from uint64
+	// Version the delta leads to
+	Version uint64                    `json:"version"`
+	Added   map[string]users.UserInfo `json:"added"`
+	Changed map[string]users.UserInfo `json:"changed"`
+	Removed []string                  `json:"removed"`
+}
+
+func newUserInfoDelta(version uint64) userInfoDelta {
+	return userInfoDelta{
+		Version: version,
+		Added:   make(map[string]users.UserInfo),
+		Changed: make(map[string]users.UserInfo),
+		Removed: make([]string, 0),
+	}
+}
+
+func (d userInfoDelta) empty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Removed) == 0
+}
+
+// userInfoSnapshot is one version of the hashed user info map. It must not be modified once created.
+type userInfoSnapshot struct {
+	version uint64
+	data    map[string]users.UserInfo
+	// data pre-encoded, since it is served far more often than it changes
+	json []byte
+	// strong etag of json, including quotes
+	etag string
+}
+
+// newUserInfoSnapshot encodes data, the snapshot's version and etag are both derived from the encoded bytes
+func newUserInfoSnapshot(data map[string]users.UserInfo) (*userInfoSnapshot, error) {
+	// encoding/json sorts map keys, so the same data always produces the same bytes and etag
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(encoded)
+	return &userInfoSnapshot{
+		version: userInfoVersion(sum),
+		data:    data,
+		json:    encoded,
+		etag:    `"` + hex.EncodeToString(sum[:16]) + `"`,
+	}, nil
+}
+
+// userInfoState is the current snapshot along with the deltas that led to it
+type userInfoState struct {
+	lock    sync.RWMutex
+	current *userInfoSnapshot
+	// deltas are oldest first, the last one leads to current
+	deltas []userInfoDelta
+}
+
+// userInfoVersion returns the version of the user info map with the given sha256 sum.
+// Versions come from the content rather than a counter or the time, so every dyno, before and after restarts,
+// gives the same data the same version and a version from a cached response means the same thing everywhere.
+// They only fit in 53 bits so that clients parsing the json as a double don't lose precision.
+func userInfoVersion(sum [sha256.Size]byte) uint64 {
+	return binary.BigEndian.Uint64(sum[:8]) >> 11
+}
+
+// update replaces the current snapshot if data differs from it, returning true if it did
+func (s *userInfoState) update(data map[string]users.UserInfo) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var delta userInfoDelta
+	if s.current != nil {
+		delta = diffUserInfo(s.current.data, data)
+		if delta.empty() {
+			return false, nil
+		}
+	}
+
+	snapshot, err := newUserInfoSnapshot(data)
+	if err != nil {
+		return false, err
+	}
+
+	if s.current != nil {
+		delta.from, delta.Version = s.current.version, snapshot.version
+		s.deltas = append(s.deltas, delta)
+		if len(s.deltas) > userInfoHistory {
+			s.deltas = s.deltas[len(s.deltas)-userInfoHistory:]
+		}
+	}
+	s.current = snapshot
+	return true, nil
+}
+
+// snapshot returns the current snapshot, or nil if there isn't one yet
+func (s *userInfoState) snapshot() *userInfoSnapshot {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.current
+}
+
+// latest returns the delta that led to the current snapshot, ok is false if there isn't one
+func (s *userInfoState) latest() (delta userInfoDelta, ok bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if len(s.deltas) == 0 {
+		return
+	}
+	return s.deltas[len(s.deltas)-1], true
+}
+
+// changesSince returns the changes from the given version to the current one.
+// ok is false if the version isn't one we know about, in which case the whole map should be refetched.
+func (s *userInfoState) changesSince(since uint64) (delta userInfoDelta, ok bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.current == nil {
+		return
+	}
+	if since == s.current.version {
+		return newUserInfoDelta(since), true
+	}
+	// since must be exactly the version some delta started from
+	for i, d := range s.deltas {
+		if d.from == since {
+			return mergeUserInfoDeltas(s.deltas[i:]), true
+		}
+	}
+	return
+}
+
+// diffUserInfo returns the changes needed to turn from into to
+func diffUserInfo(from, to map[string]users.UserInfo) userInfoDelta {
+	delta := newUserInfoDelta(0)
+	for key, info := range to {
+		if old, ok := from[key]; !ok {
+			delta.Added[key] = info
+		} else if old != info {
+			delta.Changed[key] = info
+		}
+	}
+	for key := range from {
+		if _, ok := to[key]; !ok {
+			delta.Removed = append(delta.Removed, key)
+		}
+	}
+	sort.Strings(delta.Removed)
+	return delta
+}
+
+// mergeUserInfoDeltas combines consecutive deltas, oldest first, into a single delta
+func mergeUserInfoDeltas(deltas []userInfoDelta) userInfoDelta {
+	type entry struct {
+		existedBefore bool
+		existsNow     bool
+		info          users.UserInfo
+	}
+	entries := make(map[string]*entry)
+	get := func(key string, existedBefore bool) *entry {
+		// The first delta to mention a key tells us whether it existed before any of them
+		e, ok := entries[key]
+		if !ok {
+			e = &entry{existedBefore: existedBefore}
+			entries[key] = e
+		}
+		return e
+	}
+
+	merged := newUserInfoDelta(0)
+	if len(deltas) > 0 {
+		merged.from = deltas[0].from
+	}
+	for _, d := range deltas {
+		merged.Version = d.Version
+		for key, info := range d.Added {
+			e := get(key, false)
+			e.existsNow, e.info = true, info
+		}
+		for key, info := range d.Changed {
+			e := get(key, true)
+			e.existsNow, e.info = true, info
+		}
+		for _, key := range d.Removed {
+			e := get(key, true)
+			e.existsNow, e.info = false, users.UserInfo{}
+		}
+	}
+
+	for key, e := range entries {
+		switch {
+		case e.existsNow && !e.existedBefore:
+			merged.Added[key] = e.info
+		case e.existsNow && e.existedBefore:
+			merged.Changed[key] = e.info
+		case !e.existsNow && e.existedBefore:
+			merged.Removed = append(merged.Removed, key)
+		}
+	}
+	sort.Strings(merged.Removed)
+	return merged
+}
+
+// etagMatches returns true if the If-None-Match header value matches etag
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// If-None-Match uses the weak comparison, so W/ can be ignored
+		candidate = strings.TrimPrefix(candidate, "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
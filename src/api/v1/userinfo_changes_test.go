@@ -0,0 +1,128 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffUserInfo(t *testing.T) {
+	from := map[string]users.UserInfo{
+		"kept":    {Cape: "a"},
+		"changed": {Cape: "a"},
+		"removed": {Cape: "a"},
+	}
+	to := map[string]users.UserInfo{
+		"kept":    {Cape: "a"},
+		"changed": {Cape: "b"},
+		"added":   {Icon: "c"},
+	}
+
+	delta := diffUserInfo(from, to)
+	assert.Equal(t, map[string]users.UserInfo{"added": {Icon: "c"}}, delta.Added)
+	assert.Equal(t, map[string]users.UserInfo{"changed": {Cape: "b"}}, delta.Changed)
+	assert.Equal(t, []string{"removed"}, delta.Removed)
+
+	assert.True(t, diffUserInfo(to, to).empty())
+}
+
+func TestUserInfoChangesSince(t *testing.T) {
+	var state userInfoState
+
+	_, ok := state.changesSince(0)
+	assert.False(t, ok)
+
+	updated, err := state.update(map[string]users.UserInfo{"a": {Cape: "1"}, "b": {Cape: "1"}})
+	assert.NoError(t, err)
+	assert.True(t, updated)
+	v1 := state.snapshot().version
+
+	// Nothing changed
+	updated, err = state.update(map[string]users.UserInfo{"a": {Cape: "1"}, "b": {Cape: "1"}})
+	assert.NoError(t, err)
+	assert.False(t, updated)
+	assert.Equal(t, v1, state.snapshot().version)
+
+	_, err = state.update(map[string]users.UserInfo{"a": {Cape: "2"}, "b": {Cape: "1"}, "c": {Cape: "1"}})
+	assert.NoError(t, err)
+	v2 := state.snapshot().version
+	assert.NotEqual(t, v1, v2)
+
+	_, err = state.update(map[string]users.UserInfo{"a": {Cape: "2"}, "c": {Cape: "3"}, "d": {Cape: "1"}})
+	assert.NoError(t, err)
+	v3 := state.snapshot().version
+
+	delta, ok := state.changesSince(v3)
+	if assert.True(t, ok) {
+		assert.True(t, delta.empty())
+		assert.Equal(t, v3, delta.Version)
+	}
+
+	delta, ok = state.changesSince(v2)
+	if assert.True(t, ok) {
+		assert.Equal(t, v3, delta.Version)
+		assert.Equal(t, map[string]users.UserInfo{"d": {Cape: "1"}}, delta.Added)
+		assert.Equal(t, map[string]users.UserInfo{"c": {Cape: "3"}}, delta.Changed)
+		assert.Equal(t, []string{"b"}, delta.Removed)
+	}
+
+	// c was added then changed, so it is still just added as far as v1 is concerned
+	delta, ok = state.changesSince(v1)
+	if assert.True(t, ok) {
+		assert.Equal(t, map[string]users.UserInfo{"c": {Cape: "3"}, "d": {Cape: "1"}}, delta.Added)
+		assert.Equal(t, map[string]users.UserInfo{"a": {Cape: "2"}}, delta.Changed)
+		assert.Equal(t, []string{"b"}, delta.Removed)
+	}
+
+	_, ok = state.changesSince(v1 - 1)
+	assert.False(t, ok)
+	_, ok = state.changesSince(v3 + 1)
+	assert.False(t, ok)
+}
+
+func TestUserInfoVersionShared(t *testing.T) {
+	// Two dynos, one of which only started after the first change
+	var first, second userInfoState
+	_, err := first.update(map[string]users.UserInfo{"a": {Cape: "1"}})
+	assert.NoError(t, err)
+	v1 := first.snapshot().version
+	_, err = first.update(map[string]users.UserInfo{"a": {Cape: "2"}})
+	assert.NoError(t, err)
+	_, err = second.update(map[string]users.UserInfo{"a": {Cape: "2"}})
+	assert.NoError(t, err)
+	v2 := first.snapshot().version
+	assert.Equal(t, v2, second.snapshot().version)
+
+	// A client that got v2 from either one can be caught up by the other
+	_, err = first.update(map[string]users.UserInfo{"a": {Cape: "3"}})
+	assert.NoError(t, err)
+	_, err = second.update(map[string]users.UserInfo{"a": {Cape: "3"}})
+	assert.NoError(t, err)
+	for _, state := range []*userInfoState{&first, &second} {
+		delta, ok := state.changesSince(v2)
+		if assert.True(t, ok) {
+			assert.Equal(t, map[string]users.UserInfo{"a": {Cape: "3"}}, delta.Changed)
+		}
+	}
+
+	// Only the first saw v1
+	_, ok := second.changesSince(v1)
+	assert.False(t, ok)
+}
+
+func TestUserInfoSnapshotETag(t *testing.T) {
+	a, err := newUserInfoSnapshot(map[string]users.UserInfo{"a": {Cape: "1"}, "b": {Icon: "2"}})
+	assert.NoError(t, err)
+	b, err := newUserInfoSnapshot(map[string]users.UserInfo{"b": {Icon: "2"}, "a": {Cape: "1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, a.etag, b.etag)
+	assert.Equal(t, a.version, b.version)
+	assert.True(t, a.version < 1<<53)
+
+	assert.True(t, etagMatches(a.etag, a.etag))
+	assert.True(t, etagMatches(`"other", W/`+a.etag, a.etag))
+	assert.True(t, etagMatches("*", a.etag))
+	assert.False(t, etagMatches(`"other"`, a.etag))
+	assert.False(t, etagMatches("", a.etag))
+}
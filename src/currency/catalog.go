@@ -0,0 +1,137 @@
+// Package currency describes the currencies donations can be made in and converts between them
+package currency
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Currency is a currency that donations can be made in
+type Currency struct {
+	// Code is the lowercase ISO 4217 code, the way stripe writes it
+	Code   string
+	Symbol string
+	// Decimals is how many digits the minor unit has, e.g. 2 for cents or 0 for yen. Amounts are always in the minor unit.
+	Decimals int
+}
+
+// DisplayName is shown in the currency picker, e.g. "$ USD"
+func (c Currency) DisplayName() string {
+	return c.Symbol + " " + strings.ToUpper(c.Code)
+}
+
+// Format formats an amount in the currency's minor unit for humans, e.g. $5.00 or ¥500
+func (c Currency) Format(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if c.Decimals == 0 {
+		return fmt.Sprintf("%s%s%d", sign, c.Symbol, amount)
+	}
+	unit := c.unit()
+	return fmt.Sprintf("%s%s%d.%0*d", sign, c.Symbol, amount/unit, c.Decimals, amount%unit)
+}
+
+// unit is how many of the minor unit are in one of the major unit, e.g. 100 cents to the dollar
+func (c Currency) unit() int64 {
+	unit := int64(1)
+	for i := 0; i < c.Decimals; i++ {
+		unit *= 10
+	}
+	return unit
+}
+
+// catalog is every currency we know how to handle, these are the ones stripe supports that have 0 or 2 decimals.
+// Stripe wants three-decimal currencies rounded to the nearest ten, so they're left out.
+var catalog = map[string]Currency{}
+
+func init() {
+	for _, c := range []Currency{
+		// Zero-decimal currencies
+		{"bif", "FBu", 0}, {"clp", "$", 0}, {"djf", "Fdj", 0}, {"gnf", "FG", 0}, {"jpy", "¥", 0}, {"kmf", "CF", 0},
+		{"krw", "₩", 0}, {"mga", "Ar", 0}, {"pyg", "₲", 0}, {"rwf", "FRw", 0}, {"ugx", "USh", 0}, {"vnd", "₫", 0},
+		{"vuv", "VT", 0}, {"xaf", "FCFA", 0}, {"xof", "CFA", 0}, {"xpf", "₣", 0},
+		// Two-decimal currencies
+		{"aed", "د.إ", 2}, {"all", "L", 2}, {"amd", "֏", 2}, {"ang", "ƒ", 2}, {"aud", "$", 2}, {"awg", "ƒ", 2},
+		{"azn", "₼", 2}, {"bam", "KM", 2}, {"bbd", "$", 2}, {"bdt", "৳", 2}, {"bgn", "лв", 2}, {"bmd", "$", 2},
+		{"bnd", "$", 2}, {"bsd", "$", 2}, {"bwp", "P", 2}, {"bzd", "$", 2}, {"cad", "$", 2}, {"chf", "CHF", 2},
+		{"cny", "¥", 2}, {"czk", "Kč", 2}, {"dkk", "kr", 2}, {"dop", "$", 2}, {"dzd", "دج", 2}, {"egp", "E£", 2},
+		{"etb", "Br", 2}, {"eur", "€", 2}, {"fjd", "$", 2}, {"gbp", "£", 2}, {"gel", "₾", 2}, {"gip", "£", 2},
+		{"gmd", "D", 2}, {"gyd", "$", 2}, {"hkd", "$", 2}, {"htg", "G", 2}, {"huf", "Ft", 2}, {"idr", "Rp", 2},
+		{"ils", "₪", 2}, {"inr", "₹", 2}, {"isk", "kr", 2}, {"jmd", "$", 2}, {"kes", "KSh", 2}, {"kgs", "с", 2},
+		{"khr", "៛", 2}, {"kyd", "$", 2}, {"kzt", "₸", 2}, {"lbp", "L£", 2}, {"lkr", "Rs", 2}, {"lrd", "$", 2},
+		{"lsl", "L", 2}, {"mad", "DH", 2}, {"mdl", "L", 2}, {"mkd", "ден", 2}, {"mnt", "₮", 2}, {"mop", "MOP$", 2},
+		{"mur", "₨", 2}, {"mvr", "Rf", 2}, {"mwk", "MK", 2}, {"mxn", "$", 2}, {"myr", "RM", 2}, {"mzn", "MT", 2},
+		{"nad", "$", 2}, {"ngn", "₦", 2}, {"nok", "kr", 2}, {"npr", "₨", 2}, {"nzd", "$", 2}, {"pen", "S/", 2},
+		{"pgk", "K", 2}, {"php", "₱", 2}, {"pkr", "₨", 2}, {"pln", "zł", 2}, {"qar", "QR", 2}, {"ron", "lei", 2},
+		{"rsd", "дин", 2}, {"sar", "SR", 2}, {"sbd", "$", 2}, {"scr", "₨", 2}, {"sek", "kr", 2}, {"sgd", "$", 2},
+		{"sll", "Le", 2}, {"srd", "$", 2}, {"szl", "E", 2}, {"thb", "฿", 2}, {"tjs", "SM", 2}, {"top", "T$", 2},
+		{"try", "₺", 2}, {"ttd", "$", 2}, {"twd", "NT$", 2}, {"tzs", "TSh", 2}, {"uah", "₴", 2}, {"usd", "$", 2},
+		{"uyu", "$", 2}, {"uzs", "soʻm", 2}, {"wst", "T", 2}, {"xcd", "$", 2}, {"yer", "﷼", 2}, {"zar", "R", 2},
+		{"zmw", "ZK", 2},
+	} {
+		catalog[c.Code] = c
+	}
+
+	// DONATION_CURRENCIES is a comma separated list of codes to accept, by default everything in the catalog is accepted
+	if env := strings.TrimSpace(os.Getenv("DONATION_CURRENCIES")); env != "" {
+		for _, code := range strings.Split(env, ",") {
+			code = strings.ToLower(strings.TrimSpace(code))
+			if _, ok := catalog[code]; ok {
+				enabled = append(enabled, code)
+			} else {
+				fmt.Println("WARNING: Unknown currency in DONATION_CURRENCIES:", code)
+			}
+		}
+	} else {
+		for code := range catalog {
+			enabled = append(enabled, code)
+		}
+	}
+	sort.Strings(enabled)
+}
+
+// enabled is the codes of the currencies donations can be made in, sorted
+var enabled []string
+
+// Lookup returns the currency with the given code, whether or not donations can be made in it
+func Lookup(code string) (Currency, bool) {
+	c, ok := catalog[strings.ToLower(code)]
+	return c, ok
+}
+
+// Get returns the currency with the given code if donations can be made in it
+func Get(code string) (*Currency, error) {
+	code = strings.ToLower(code)
+	for _, it := range enabled {
+		if it == code {
+			c := catalog[code]
+			return &c, nil
+		}
+	}
+	return nil, errors.New("invalid or unsupported currency \"" + code + "\"")
+}
+
+// Enabled returns the currencies donations can be made in, sorted by code
+func Enabled() []Currency {
+	ret := make([]Currency, 0, len(enabled))
+	for _, code := range enabled {
+		ret = append(ret, catalog[code])
+	}
+	return ret
+}
+
+// Format formats an amount in the minor unit of the currency with the given code, e.g. Format("usd", 500) is $5.00.
+// Unknown currencies are assumed to have 2 decimals.
+func Format(code string, amount int64) string {
+	c, ok := Lookup(code)
+	if !ok {
+		c = Currency{Code: code, Symbol: "¤", Decimals: 2}
+	}
+	return c.Format(amount)
+}
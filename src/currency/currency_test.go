@@ -0,0 +1,80 @@
+package currency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "$5.00", Format("usd", 500))
+	assert.Equal(t, "€0.05", Format("EUR", 5))
+	assert.Equal(t, "¥500", Format("jpy", 500))
+	assert.Equal(t, "₩6750", Format("krw", 6750))
+	assert.Equal(t, "-$1.50", Format("usd", -150))
+	assert.Equal(t, "¤12.34", Format("xyz", 1234))
+}
+
+func TestGet(t *testing.T) {
+	usd, err := Get("USD")
+	require.NoError(t, err)
+	assert.Equal(t, "$ USD", usd.DisplayName())
+	assert.Equal(t, 2, usd.Decimals)
+
+	_, err = Get("xyz")
+	assert.Error(t, err)
+
+	for _, c := range Enabled() {
+		assert.Contains(t, []int{0, 2}, c.Decimals, c.Code)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	usd, _ := Lookup("usd")
+	eur, _ := Lookup("eur")
+	jpy, _ := Lookup("jpy")
+
+	assert.Equal(t, int64(500), fromUSD(usd, 500, 1))
+	assert.Equal(t, int64(2500), fromUSD(usd, 2500, 1))
+	// Rounded up to a whole euro
+	assert.Equal(t, int64(500), fromUSD(eur, 500, 0.92))
+	assert.Equal(t, int64(600), fromUSD(eur, 500, 1.1))
+	assert.Equal(t, int64(749), fromUSD(jpy, 500, 149.8))
+	assert.Equal(t, int64(751), fromUSD(jpy, 500, 150.11))
+
+	assert.Equal(t, int64(500), toUSD(usd, 500, 1))
+	assert.Equal(t, int64(500), toUSD(eur, 460, 0.92))
+	assert.Equal(t, int64(501), toUSD(jpy, 750, 149.8))
+
+	amount, err := usd.FromUSD(5000)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5000), amount)
+}
+
+func TestFetchRates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/usd":
+			w.Write([]byte(`{"result":"success","base_code":"USD","rates":{"USD":1,"EUR":0.92,"JPY":149.8,"KWD":0.31,"XYZ":2,"GBP":0}}`))
+		case "/eur":
+			w.Write([]byte(`{"result":"success","base_code":"EUR","rates":{"EUR":1}}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	rates, err := fetchRates(server.URL + "/usd")
+	require.NoError(t, err)
+	// Currencies that aren't in the catalog, or have nonsense rates, are left out
+	assert.Equal(t, map[string]float64{"usd": 1, "eur": 0.92, "jpy": 149.8}, rates)
+
+	_, err = fetchRates(server.URL + "/eur")
+	assert.Error(t, err)
+	_, err = fetchRates(server.URL + "/error")
+	assert.Error(t, err)
+}
@@ -0,0 +1,155 @@
+package currency
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/util"
+)
+
+// ratesMaxAge is how long exchange rates are used before fetching new ones
+const ratesMaxAge = 24 * time.Hour
+
+// defaultRatesURL returns the day's rates against USD, it doesn't need an API key
+const defaultRatesURL = "https://open.er-api.com/v6/latest/USD"
+
+var ratesURL = defaultRatesURL
+
+var (
+	ratesLock sync.RWMutex
+	// rates is how much of each currency one US dollar buys, in its major unit
+	rates        = map[string]float64{"usd": 1}
+	ratesUpdated time.Time
+)
+
+func init() {
+	if env := os.Getenv("EXCHANGE_RATES_URL"); env != "" {
+		ratesURL = env
+	}
+
+	// Use yesterday's rates until we have today's
+	if saved, updated, err := database.GetExchangeRates(); err != nil {
+		log.Println("Error loading exchange rates:", err)
+	} else if len(saved) > 0 {
+		setRates(saved, updated)
+	}
+	go refreshRates()
+	util.DoRepeatedly(time.Hour, refreshRates)
+}
+
+// refreshRates fetches new exchange rates if ours are more than a day old, and saves them for other instances
+func refreshRates() {
+	ratesLock.RLock()
+	stale := time.Since(ratesUpdated) > ratesMaxAge
+	ratesLock.RUnlock()
+	if !stale {
+		return
+	}
+
+	// Another instance may have fetched them already
+	saved, updated, err := database.GetExchangeRates()
+	if err == nil && time.Since(updated) <= ratesMaxAge && len(saved) > 0 {
+		setRates(saved, updated)
+		return
+	}
+
+	fetched, err := fetchRates(ratesURL)
+	if err != nil {
+		log.Println("Error fetching exchange rates:", err)
+		return
+	}
+	err = database.SaveExchangeRates(fetched)
+	if err != nil {
+		log.Println("Error saving exchange rates:", err)
+	}
+	setRates(fetched, time.Now())
+}
+
+func setRates(newRates map[string]float64, updated time.Time) {
+	ratesLock.Lock()
+	defer ratesLock.Unlock()
+	rates = map[string]float64{"usd": 1}
+	for code, rate := range newRates {
+		rates[code] = rate
+	}
+	ratesUpdated = updated
+}
+
+// fetchRates fetches the day's rates for every currency in the catalog from an open.er-api.com style API
+func fetchRates(address string) (map[string]float64, error) {
+	req, err := util.GetRequest(address)
+	if err != nil {
+		return nil, err
+	}
+	res, err := req.Do()
+	if err != nil {
+		return nil, err
+	}
+	if !res.Ok() {
+		return nil, errors.New("exchange rates API responded with " + res.Status())
+	}
+	var body struct {
+		Result   string             `json:"result"`
+		BaseCode string             `json:"base_code"`
+		Rates    map[string]float64 `json:"rates"`
+	}
+	err = res.JSON(&body)
+	if err != nil {
+		return nil, err
+	}
+	if body.Result != "success" || !strings.EqualFold(body.BaseCode, "usd") {
+		return nil, fmt.Errorf("unexpected exchange rates response: result %q, base %q", body.Result, body.BaseCode)
+	}
+
+	ret := make(map[string]float64)
+	for code, rate := range body.Rates {
+		code = strings.ToLower(code)
+		if _, ok := catalog[code]; ok && rate > 0 {
+			ret[code] = rate
+		}
+	}
+	return ret, nil
+}
+
+// Rate returns how much of the currency one US dollar buys, in its major unit. ok is false if we don't know.
+func Rate(code string) (rate float64, ok bool) {
+	ratesLock.RLock()
+	defer ratesLock.RUnlock()
+	rate, ok = rates[strings.ToLower(code)]
+	return
+}
+
+// FromUSD converts a threshold in US cents to the currency's minor unit, or returns an error if there's no exchange rate for it
+func (c Currency) FromUSD(usd int64) (int64, error) {
+	rate, ok := Rate(c.Code)
+	if !ok {
+		return 0, errors.New("no exchange rate for " + strings.ToUpper(c.Code))
+	}
+	return fromUSD(c, usd, rate), nil
+}
+
+// fromUSD rounds up to a whole major unit so the amount looks sensible to donors
+func fromUSD(c Currency, usd int64, rate float64) int64 {
+	major := math.Ceil(float64(usd) / 100 * rate)
+	return int64(major) * c.unit()
+}
+
+// ToUSD converts an amount in the currency's minor unit to US cents, or returns an error if there's no exchange rate for it
+func (c Currency) ToUSD(amount int64) (int64, error) {
+	rate, ok := Rate(c.Code)
+	if !ok {
+		return 0, errors.New("no exchange rate for " + strings.ToUpper(c.Code))
+	}
+	return toUSD(c, amount, rate), nil
+}
+
+func toUSD(c Currency, amount int64, rate float64) int64 {
+	return int64(math.Round(float64(amount) / float64(c.unit()) / rate * 100))
+}
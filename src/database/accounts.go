@@ -0,0 +1,151 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Donation is a row in the pending_donations table, as shown to the user who made or redeemed it
+type Donation struct {
+	// Token is only set for donations the user redeemed, so it can't be used to find someone else's unredeemed token
+	Token           *uuid.UUID `json:"token,omitempty"`
+	CreatedAt       int64      `json:"created_at"`
+	Amount          *int64     `json:"amount,omitempty"`
+	Currency        string     `json:"currency,omitempty"`
+	StripePaymentID string     `json:"stripe_payment_id,omitempty"`
+	PaypalOrderID   string     `json:"paypal_order_id,omitempty"`
+	Email           string     `json:"email,omitempty"`
+	Used            bool       `json:"used"`
+	// Credited is true if the donation was made while logged in, rather than redeemed with a token
+	Credited bool     `json:"credited"`
+	Roles    []string `json:"roles"`
+}
+
+// GetUserDonations returns the donations the user redeemed, or paid for using their email once it's verified
+func GetUserDonations(userID uuid.UUID) ([]Donation, error) {
+	rows, err := DB.Query(`
+		SELECT
+			CASE WHEN used_by = $1 THEN token END, created_at, amount, currency, stripe_payment_id, paypal_order_id, COALESCE(stripe_payer_email, paypal_payer_email), used, credited,
+			ARRAY(SELECT role_id FROM pending_donation_roles WHERE pending_donation_roles.token = pending_donations.token ORDER BY role_id)
+		FROM pending_donations
+		WHERE used_by = $1 OR EXISTS (
+			SELECT 1 FROM users
+			WHERE user_id = $1 AND email_verified AND email IN (stripe_payer_email, paypal_payer_email)
+		)
+		ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	donations := make([]Donation, 0)
+	for rows.Next() {
+		var (
+			donation Donation
+			amount   sql.NullInt64
+			currency sql.NullString
+			stripeID sql.NullString
+			paypalID sql.NullString
+			payer    sql.NullString
+			roles    pq.StringArray
+		)
+		err = rows.Scan(&donation.Token, &donation.CreatedAt, &amount, &currency, &stripeID, &paypalID, &payer, &donation.Used, &donation.Credited, &roles)
+		if err != nil {
+			return nil, err
+		}
+		if amount.Valid {
+			donation.Amount = &amount.Int64
+		}
+		donation.Currency = currency.String
+		donation.StripePaymentID = stripeID.String
+		donation.PaypalOrderID = paypalID.String
+		donation.Email = payer.String
+		donation.Roles = roles
+		donations = append(donations, donation)
+	}
+	return donations, rows.Err()
+}
+
+// GetUserCreatedAt returns when the user was created, in unix seconds
+func GetUserCreatedAt(userID uuid.UUID) (createdAt int64, err error) {
+	err = DB.QueryRow(`SELECT created_at FROM users WHERE user_id = $1`, userID).Scan(&createdAt)
+	return
+}
+
+// ScheduleAccountDeletion marks the user's account to be deleted at deleteAt, replacing any existing schedule
+func ScheduleAccountDeletion(userID uuid.UUID, deleteAt time.Time) error {
+	_, err := DB.Exec(`
+		INSERT INTO account_deletions (user_id, delete_at) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET requested_at = EXCLUDED.requested_at, delete_at = EXCLUDED.delete_at`,
+		userID, deleteAt.Unix())
+	return err
+}
+
+// CancelAccountDeletion stops the user's account from being deleted, returning false if it wasn't going to be
+func CancelAccountDeletion(userID uuid.UUID) (bool, error) {
+	res, err := DB.Exec(`DELETE FROM account_deletions WHERE user_id = $1`, userID)
+	if err != nil {
+		return false, err
+	}
+	count, err := res.RowsAffected()
+	return count > 0, err
+}
+
+// GetAccountDeletion returns when the user's account will be deleted in unix seconds, or nil if it won't be
+func GetAccountDeletion(userID uuid.UUID) (*int64, error) {
+	var deleteAt int64
+	err := DB.QueryRow(`SELECT delete_at FROM account_deletions WHERE user_id = $1`, userID).Scan(&deleteAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &deleteAt, nil
+}
+
+// GetDueAccountDeletions returns the users whose grace period is over
+func GetDueAccountDeletions() ([]uuid.UUID, error) {
+	if DB == nil {
+		return nil, nil
+	}
+	rows, err := DB.Query(`SELECT user_id FROM account_deletions WHERE delete_at <= EXTRACT(EPOCH FROM NOW())`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// DeleteAccount deletes the user and everything that belongs to them. Their donations are kept for accounting,
+// but without anything that identifies the payer.
+func DeleteAccount(tx *sql.Tx, userID uuid.UUID) error {
+	_, err := tx.Exec(`
+		UPDATE pending_donations SET
+			stripe_payer_email = NULL,
+			paypal_payer_email = NULL,
+			paypal_payer_id = NULL,
+			anonymized_at = EXTRACT(EPOCH FROM NOW())::BIGINT
+		WHERE used_by = $1 OR EXISTS (
+			SELECT 1 FROM users
+			WHERE user_id = $1 AND email_verified AND email IN (stripe_payer_email, paypal_payer_email)
+		)`,
+		userID)
+	if err != nil {
+		return err
+	}
+	// Everything else either cascades or is set to NULL, see migration0016
+	_, err = tx.Exec(`DELETE FROM users WHERE user_id = $1`, userID)
+	return err
+}
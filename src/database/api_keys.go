@@ -0,0 +1,118 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// APIKey is a row in the api_keys table
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	Owner      string     `json:"owner"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  int64      `json:"created_at"`
+	CreatedBy  *uuid.UUID `json:"created_by,omitempty"`
+	LastUsedAt *int64     `json:"last_used_at,omitempty"`
+	RevokedAt  *int64     `json:"revoked_at,omitempty"`
+}
+
+// Revoked returns true if the key can no longer be used
+func (key APIKey) Revoked() bool {
+	return key.RevokedAt != nil
+}
+
+// HasScope returns true if the key was granted the scope
+func (key APIKey) HasScope(scope string) bool {
+	for _, it := range key.Scopes {
+		if it == scope {
+			return true
+		}
+	}
+	return false
+}
+
+const apiKeyColumns = `key_id, owner, key_hash, scopes, created_at, created_by, last_used_at, revoked_at`
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var (
+		key        APIKey
+		scopes     pq.StringArray
+		createdBy  NullUUID
+		lastUsedAt sql.NullInt64
+		revokedAt  sql.NullInt64
+	)
+	err := row.Scan(&key.ID, &key.Owner, &key.KeyHash, &scopes, &key.CreatedAt, &createdBy, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = scopes
+	if createdBy.Valid {
+		key.CreatedBy = &createdBy.UUID
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Int64
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Int64
+	}
+	return &key, nil
+}
+
+// CreateAPIKey stores a new API key, only the hash of its secret is kept
+func CreateAPIKey(id uuid.UUID, owner string, keyHash string, scopes []string, createdBy uuid.UUID) (*APIKey, error) {
+	return scanAPIKey(DB.QueryRow(`
+		INSERT INTO api_keys (key_id, owner, key_hash, scopes, created_by) VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+apiKeyColumns,
+		id, owner, keyHash, pq.StringArray(scopes), createdBy))
+}
+
+// GetAPIKeys returns every API key, including revoked ones
+func GetAPIKeys() ([]APIKey, error) {
+	rows, err := DB.Query(`SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *key)
+	}
+	return ret, rows.Err()
+}
+
+// GetAPIKey returns the key with the given id, or nil if there isn't one
+func GetAPIKey(id uuid.UUID) (*APIKey, error) {
+	key, err := scanAPIKey(DB.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return key, err
+}
+
+// TouchAPIKey records that the key was just used.
+// It's only written at most once a minute, since some integrations use their key a lot.
+func TouchAPIKey(id uuid.UUID) error {
+	_, err := DB.Exec(`
+		UPDATE api_keys SET last_used_at = EXTRACT(EPOCH FROM NOW())::BIGINT
+		WHERE key_id = $1 AND (last_used_at IS NULL OR last_used_at < EXTRACT(EPOCH FROM NOW())::BIGINT - 60)`, id)
+	return err
+}
+
+// RevokeAPIKey stops the key from being used, returning false if it didn't exist or was already revoked.
+// Revoked keys are kept so that staff can still see who had them.
+func RevokeAPIKey(id uuid.UUID) (bool, error) {
+	result, err := DB.Exec(`UPDATE api_keys SET revoked_at = EXTRACT(EPOCH FROM NOW())::BIGINT WHERE key_id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
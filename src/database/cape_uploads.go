@@ -0,0 +1,170 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Cape upload statuses, see the cape_uploads.status check constraint
+const (
+	CapeUploadPending  = "pending"
+	CapeUploadApproved = "approved"
+	CapeUploadRejected = "rejected"
+)
+
+// CapeUpload is a row in the cape_uploads table
+type CapeUpload struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	MinecraftID *uuid.UUID `json:"minecraft,omitempty"`
+	CreatedAt   int64      `json:"created_at"`
+	Hash        string     `json:"sha256"`
+	Width       int        `json:"width"`
+	Height      int        `json:"height"`
+	Status      string     `json:"status"`
+	ReviewedAt  *int64     `json:"reviewed_at,omitempty"`
+	ReviewedBy  *uuid.UUID `json:"reviewed_by,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+}
+
+const capeUploadColumns = `upload_id, user_id, mc_uuid, cape_uploads.created_at, sha256, width, height, status, reviewed_at, reviewed_by, reason`
+
+func scanCapeUpload(row rowScanner) (*CapeUpload, error) {
+	var (
+		upload     CapeUpload
+		minecraft  NullUUID
+		reviewedAt sql.NullInt64
+		reviewedBy NullUUID
+		reason     sql.NullString
+	)
+	err := row.Scan(&upload.ID, &upload.UserID, &minecraft, &upload.CreatedAt, &upload.Hash, &upload.Width, &upload.Height, &upload.Status, &reviewedAt, &reviewedBy, &reason)
+	if err != nil {
+		return nil, err
+	}
+	if minecraft.Valid {
+		upload.MinecraftID = &minecraft.UUID
+	}
+	if reviewedAt.Valid {
+		upload.ReviewedAt = &reviewedAt.Int64
+	}
+	if reviewedBy.Valid {
+		upload.ReviewedBy = &reviewedBy.UUID
+	}
+	upload.Reason = reason.String
+	return &upload, nil
+}
+
+// CreateCapeUpload adds an upload to the moderation queue, replacing any upload the user already has waiting
+func CreateCapeUpload(userID uuid.UUID, hash string, width, height int) (*CapeUpload, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM cape_uploads WHERE user_id = $1 AND status = $2`, userID, CapeUploadPending)
+	if err != nil {
+		return nil, err
+	}
+	var id uuid.UUID
+	err = tx.QueryRow(`INSERT INTO cape_uploads (user_id, sha256, width, height) VALUES ($1, $2, $3, $4) RETURNING upload_id`, userID, hash, width, height).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	upload, err := scanCapeUpload(tx.QueryRow(`SELECT `+capeUploadColumns+` FROM cape_uploads INNER JOIN users USING (user_id) WHERE upload_id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+	return upload, tx.Commit()
+}
+
+// GetCapeUploads returns every upload with the given status, oldest first
+func GetCapeUploads(status string) ([]CapeUpload, error) {
+	rows, err := DB.Query(`SELECT `+capeUploadColumns+` FROM cape_uploads INNER JOIN users USING (user_id) WHERE status = $1 ORDER BY cape_uploads.created_at`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]CapeUpload, 0)
+	for rows.Next() {
+		upload, err := scanCapeUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *upload)
+	}
+	return ret, rows.Err()
+}
+
+// GetCapeUpload returns the upload with the given id, or nil if there isn't one
+func GetCapeUpload(id uuid.UUID) (*CapeUpload, error) {
+	upload, err := scanCapeUpload(DB.QueryRow(`SELECT `+capeUploadColumns+` FROM cape_uploads INNER JOIN users USING (user_id) WHERE upload_id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return upload, err
+}
+
+// GetLatestCapeUpload returns the user's most recent upload, or nil if they've never uploaded one
+func GetLatestCapeUpload(userID uuid.UUID) (*CapeUpload, error) {
+	upload, err := scanCapeUpload(DB.QueryRow(`SELECT `+capeUploadColumns+` FROM cape_uploads INNER JOIN users USING (user_id) WHERE user_id = $1 ORDER BY cape_uploads.created_at DESC LIMIT 1`, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return upload, err
+}
+
+// ApproveCapeUpload marks a pending upload as approved and sets capeURL as the uploader's cape.
+// The file must already have been published at capeURL.
+func ApproveCapeUpload(id uuid.UUID, reviewer uuid.UUID, capeURL string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID, err := reviewCapeUpload(tx, id, reviewer, CapeUploadApproved, "")
+	if err != nil {
+		return err
+	}
+	// Only the cape is touched, any other customization the user has is kept
+	_, err = tx.Exec(`
+		INSERT INTO customizations (user_id, cape) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET
+			updated_at = EXTRACT(EPOCH FROM NOW())::BIGINT,
+			cape = EXCLUDED.cape`, userID, capeURL)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RejectCapeUpload marks a pending upload as rejected
+func RejectCapeUpload(id uuid.UUID, reviewer uuid.UUID, reason string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = reviewCapeUpload(tx, id, reviewer, CapeUploadRejected, reason)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// reviewCapeUpload sets the status of a pending upload, returning the uploader's id
+func reviewCapeUpload(tx *sql.Tx, id uuid.UUID, reviewer uuid.UUID, status string, reason string) (userID uuid.UUID, err error) {
+	err = tx.QueryRow(`
+		UPDATE cape_uploads SET status = $2, reviewed_at = EXTRACT(EPOCH FROM NOW())::BIGINT, reviewed_by = $3, reason = $4
+		WHERE upload_id = $1 AND status = $5
+		RETURNING user_id`, id, status, reviewer, nullString(reason), CapeUploadPending).Scan(&userID)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("upload %s is not pending review", id)
+	}
+	return
+}
@@ -14,6 +14,10 @@ var DB *sql.DB
 func init() {
 	url := os.Getenv("DATABASE_URL")
 	if url == "" {
+		if isMigrateCommand() {
+			fmt.Println("Cannot migrate, no database url specified!")
+			os.Exit(1)
+		}
 		fmt.Println("WARNING: No database url specified, not connecting to postgres!")
 		return
 	}
@@ -31,7 +35,18 @@ func init() {
 		panic(err)
 	}
 	log.Println("Postgres pinged")
+
+	// `migrate` mode runs the requested command then exits, before the rest of the server starts up
+	if isMigrateCommand() {
+		err = runMigrateCommand(os.Args[2:])
+		if err != nil {
+			fmt.Println("Migration error:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	initialSetup()
-	log.Println("Postgres schema created")
+	log.Println("Postgres schema migrated")
 	setupListener(url)
 }
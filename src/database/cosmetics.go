@@ -0,0 +1,52 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/google/uuid"
+)
+
+// cosmeticColumns are the columns of user_cosmetics included in users_view
+type cosmeticColumns struct {
+	cape        sql.NullString
+	icon        sql.NullString
+	textColor   sql.NullString
+	bgColor     sql.NullString
+	borderColor sql.NullString
+}
+
+// makeChoice converts the columns into a users.CosmeticChoice, or nil if they are all NULL
+func (c *cosmeticColumns) makeChoice() *users.CosmeticChoice {
+	if !c.cape.Valid && !c.icon.Valid && !c.textColor.Valid && !c.bgColor.Valid && !c.borderColor.Valid {
+		return nil
+	}
+	return &users.CosmeticChoice{
+		Cape:            c.cape.String,
+		Icon:            c.icon.String,
+		TextColor:       c.textColor.String,
+		BackgroundColor: c.bgColor.String,
+		BorderColor:     c.borderColor.String,
+	}
+}
+
+// SetCosmeticChoice saves the user's chosen cosmetics, an empty choice removes them.
+// It does not check the user is entitled to the choice, see users.User.ValidateCosmeticChoice
+func SetCosmeticChoice(tx *sql.Tx, userID uuid.UUID, choice users.CosmeticChoice) error {
+	if choice == (users.CosmeticChoice{}) {
+		_, err := tx.Exec(`DELETE FROM user_cosmetics WHERE user_id = $1`, userID)
+		return err
+	}
+	_, err := tx.Exec(`
+		INSERT INTO user_cosmetics (user_id, cape, icon, text_color, bg_color, border_color)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE SET
+			updated_at = EXTRACT(EPOCH FROM NOW())::BIGINT,
+			cape = EXCLUDED.cape,
+			icon = EXCLUDED.icon,
+			text_color = EXCLUDED.text_color,
+			bg_color = EXCLUDED.bg_color,
+			border_color = EXCLUDED.border_color`,
+		userID, nullString(choice.Cape), nullString(choice.Icon), nullString(choice.TextColor), nullString(choice.BackgroundColor), nullString(choice.BorderColor))
+	return err
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/google/uuid"
+)
+
+// customizationColumns are the cosmetic columns shared by the customizations table and users_view
+type customizationColumns struct {
+	icon             sql.NullString
+	cape             sql.NullString
+	textColor        sql.NullString
+	bgColor          sql.NullString
+	borderColor      sql.NullString
+	editionIcon      sql.NullString
+	editionText      sql.NullString
+	editionTextColor sql.NullString
+}
+
+// makeCustomization converts the columns into a users.Customization, or nil if they are all NULL
+func (c *customizationColumns) makeCustomization() *users.Customization {
+	var ret users.Customization
+	if c.icon.Valid || c.cape.Valid || c.textColor.Valid || c.bgColor.Valid || c.borderColor.Valid {
+		ret.Info = &users.UserInfo{
+			Icon:            c.icon.String,
+			Cape:            c.cape.String,
+			TextColor:       c.textColor.String,
+			BackgroundColor: c.bgColor.String,
+			BorderColor:     c.borderColor.String,
+		}
+	}
+	if c.editionIcon.Valid || c.editionText.Valid || c.editionTextColor.Valid {
+		ret.Edition = &users.Edition{
+			Icon:      c.editionIcon.String,
+			Text:      c.editionText.String,
+			TextColor: c.editionTextColor.String,
+		}
+	}
+	if ret.Info == nil && ret.Edition == nil {
+		return nil
+	}
+	return &ret
+}
+
+// nullString converts an empty string to NULL
+func nullString(str string) sql.NullString {
+	return sql.NullString{
+		String: str,
+		Valid:  str != "",
+	}
+}
+
+// CustomizationEntry is a row in the customizations table
+type CustomizationEntry struct {
+	UserID      uuid.UUID  `json:"user_id"`
+	MinecraftID *uuid.UUID `json:"minecraft,omitempty"`
+	UpdatedAt   int64      `json:"updated_at"`
+	users.Customization
+}
+
+// GetAllCustomizations returns every user's customization
+func GetAllCustomizations() ([]CustomizationEntry, error) {
+	rows, err := DB.Query(`
+		SELECT user_id, mc_uuid, customizations.updated_at, icon, cape, text_color, bg_color, border_color, edition_icon, edition_text, edition_text_color
+		FROM customizations INNER JOIN users USING (user_id)
+		ORDER BY customizations.updated_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]CustomizationEntry, 0)
+	for rows.Next() {
+		entry, err := scanCustomization(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *entry)
+	}
+	return ret, rows.Err()
+}
+
+// GetCustomization returns the user's customization, or nil if they don't have one
+func GetCustomization(userID uuid.UUID) (*CustomizationEntry, error) {
+	entry, err := scanCustomization(DB.QueryRow(`
+		SELECT user_id, mc_uuid, customizations.updated_at, icon, cape, text_color, bg_color, border_color, edition_icon, edition_text, edition_text_color
+		FROM customizations INNER JOIN users USING (user_id)
+		WHERE user_id = $1`, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return entry, err
+}
+
+func scanCustomization(row rowScanner) (*CustomizationEntry, error) {
+	var (
+		entry     CustomizationEntry
+		minecraft NullUUID
+		c         customizationColumns
+	)
+	err := row.Scan(&entry.UserID, &minecraft, &entry.UpdatedAt, &c.icon, &c.cape, &c.textColor, &c.bgColor, &c.borderColor, &c.editionIcon, &c.editionText, &c.editionTextColor)
+	if err != nil {
+		return nil, err
+	}
+	if minecraft.Valid {
+		entry.MinecraftID = &minecraft.UUID
+	}
+	if custom := c.makeCustomization(); custom != nil {
+		entry.Customization = *custom
+	}
+	return &entry, nil
+}
+
+// SetCustomization creates or replaces the user's customization
+func SetCustomization(userID uuid.UUID, custom users.Customization) error {
+	var (
+		info    users.UserInfo
+		edition users.Edition
+	)
+	if custom.Info != nil {
+		info = *custom.Info
+	}
+	if custom.Edition != nil {
+		edition = *custom.Edition
+	}
+	_, err := DB.Exec(`
+		INSERT INTO customizations (user_id, icon, cape, text_color, bg_color, border_color, edition_icon, edition_text, edition_text_color)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (user_id) DO UPDATE SET
+			updated_at = EXTRACT(EPOCH FROM NOW())::BIGINT,
+			icon = EXCLUDED.icon,
+			cape = EXCLUDED.cape,
+			text_color = EXCLUDED.text_color,
+			bg_color = EXCLUDED.bg_color,
+			border_color = EXCLUDED.border_color,
+			edition_icon = EXCLUDED.edition_icon,
+			edition_text = EXCLUDED.edition_text,
+			edition_text_color = EXCLUDED.edition_text_color`,
+		userID,
+		nullString(info.Icon), nullString(info.Cape), nullString(info.TextColor), nullString(info.BackgroundColor), nullString(info.BorderColor),
+		nullString(edition.Icon), nullString(edition.Text), nullString(edition.TextColor))
+	return err
+}
+
+// DeleteCustomization removes the user's customization, returning false if they didn't have one
+func DeleteCustomization(userID uuid.UUID) (bool, error) {
+	result, err := DB.Exec(`DELETE FROM customizations WHERE user_id = $1`, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
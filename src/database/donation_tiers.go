@@ -0,0 +1,162 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// ErrTierAmountTaken is returned when saving a tier with the same usd_amount as another tier
+var ErrTierAmountTaken = errors.New("another tier has the same usd_amount")
+
+// DonationTier is a row in the donation_tiers table, along with its amounts and roles
+type DonationTier struct {
+	ID    string   `json:"tier_id"`
+	Name  string   `json:"name"`
+	Perks []string `json:"perks"`
+	// USDAmount is the minimum donation in US cents
+	USDAmount int64 `json:"usd_amount"`
+	// Amounts are minimum donations in specific currencies, in their minor unit, used instead of converting USDAmount
+	Amounts map[string]int64   `json:"amounts"`
+	Roles   []DonationTierRole `json:"roles"`
+}
+
+// DonationTierRole is a role granted by a donation tier
+type DonationTierRole struct {
+	RoleID string `json:"role_id"`
+	// Duration is how many seconds the role lasts once redeemed, nil means forever
+	Duration *int64 `json:"duration,omitempty"`
+}
+
+// GetDonationTiers returns every donation tier, cheapest first
+func GetDonationTiers() ([]DonationTier, error) {
+	rows, err := DB.Query(`SELECT tier_id, name, perks, usd_amount FROM donation_tiers ORDER BY usd_amount`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]DonationTier, 0)
+	index := make(map[string]int)
+	for rows.Next() {
+		var (
+			tier  DonationTier
+			perks pq.StringArray
+		)
+		err = rows.Scan(&tier.ID, &tier.Name, &perks, &tier.USDAmount)
+		if err != nil {
+			return nil, err
+		}
+		tier.Perks = perks
+		tier.Amounts = make(map[string]int64)
+		tier.Roles = make([]DonationTierRole, 0)
+		index[tier.ID] = len(ret)
+		ret = append(ret, tier)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	amounts, err := DB.Query(`SELECT tier_id, currency, amount FROM donation_tier_amounts`)
+	if err != nil {
+		return nil, err
+	}
+	defer amounts.Close()
+	for amounts.Next() {
+		var (
+			tierID, currency string
+			amount           int64
+		)
+		err = amounts.Scan(&tierID, &currency, &amount)
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := index[tierID]; ok {
+			ret[i].Amounts[currency] = amount
+		}
+	}
+	err = amounts.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := DB.Query(`SELECT tier_id, role_id, duration FROM donation_tier_roles ORDER BY role_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer roles.Close()
+	for roles.Next() {
+		var (
+			tierID   string
+			role     DonationTierRole
+			duration sql.NullInt64
+		)
+		err = roles.Scan(&tierID, &role.RoleID, &duration)
+		if err != nil {
+			return nil, err
+		}
+		if duration.Valid {
+			role.Duration = &duration.Int64
+		}
+		if i, ok := index[tierID]; ok {
+			ret[i].Roles = append(ret[i].Roles, role)
+		}
+	}
+	return ret, roles.Err()
+}
+
+// SaveDonationTier creates the tier, or replaces it if one with the same id exists
+func SaveDonationTier(tier DonationTier) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO donation_tiers (tier_id, name, perks, usd_amount) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tier_id) DO UPDATE SET name = EXCLUDED.name, perks = EXCLUDED.perks, usd_amount = EXCLUDED.usd_amount`,
+		tier.ID, tier.Name, pq.StringArray(tier.Perks), tier.USDAmount)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // unique_violation
+		return ErrTierAmountTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM donation_tier_amounts WHERE tier_id = $1`, tier.ID)
+	if err != nil {
+		return err
+	}
+	for currency, amount := range tier.Amounts {
+		_, err = tx.Exec(`INSERT INTO donation_tier_amounts (tier_id, currency, amount) VALUES ($1, $2, $3)`, tier.ID, currency, amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM donation_tier_roles WHERE tier_id = $1`, tier.ID)
+	if err != nil {
+		return err
+	}
+	for _, role := range tier.Roles {
+		_, err = tx.Exec(`INSERT INTO donation_tier_roles (tier_id, role_id, duration) VALUES ($1, $2, $3)`, tier.ID, role.RoleID, role.Duration)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteDonationTier deletes the tier, returning false if it didn't exist.
+// Donations that already qualified for it keep the roles they were given.
+func DeleteDonationTier(id string) (bool, error) {
+	res, err := DB.Exec(`DELETE FROM donation_tiers WHERE tier_id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// RedeemDonation marks the donation as used by the user and grants them its roles.
+// Time-limited roles stack on top of any time remaining, but a permanent grant always wins.
+// What the user had before is recorded against the donation's roles, see UnredeemDonation.
+func RedeemDonation(tx *sql.Tx, token uuid.UUID, userID uuid.UUID) error {
+	_, err := tx.Exec(`
+		UPDATE pending_donation_roles SET
+			granted = NOT EXISTS (
+				SELECT 1 FROM user_roles
+				WHERE user_id = $1 AND role_id = pending_donation_roles.role_id
+					AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW()))
+			),
+			previous_expires_at = (
+				SELECT expires_at FROM user_roles
+				WHERE user_id = $1 AND role_id = pending_donation_roles.role_id
+			)
+		WHERE token = $2`,
+		userID, token)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO user_roles (user_id, role_id, expires_at)
+		SELECT $1, role_id, EXTRACT(EPOCH FROM NOW())::BIGINT + duration FROM pending_donation_roles WHERE token = $2
+		ON CONFLICT (user_id, role_id) DO UPDATE SET expires_at = CASE
+			WHEN user_roles.expires_at IS NULL OR EXCLUDED.expires_at IS NULL THEN NULL
+			ELSE GREATEST(user_roles.expires_at, EXTRACT(EPOCH FROM NOW())::BIGINT) + EXCLUDED.expires_at - EXTRACT(EPOCH FROM NOW())::BIGINT
+		END`,
+		userID, token)
+	if err != nil {
+		return err
+	}
+	// TODO should we just DELETE the token?
+	_, err = tx.Exec(`UPDATE pending_donations SET used = true, used_by = $1 WHERE token = $2`, userID, token)
+	return err
+}
+
+// UnredeemDonation takes back the roles a donation credited to the user. Time-limited roles lose the time the donation
+// added, so anything stacked on top from elsewhere is kept; ExpireRoles removes them if nothing is left. Roles the
+// donation gave forever go back to what the user had when they redeemed it: removed if the donation granted them,
+// back to their old expiry if it made a time-limited role permanent, and left alone if the user already had it forever.
+func UnredeemDonation(tx *sql.Tx, token uuid.UUID, userID uuid.UUID) error {
+	_, err := tx.Exec(`
+		UPDATE user_roles SET expires_at = user_roles.expires_at - pending_donation_roles.duration
+		FROM pending_donation_roles
+		WHERE pending_donation_roles.token = $2 AND pending_donation_roles.role_id = user_roles.role_id
+			AND user_roles.user_id = $1 AND user_roles.expires_at IS NOT NULL AND pending_donation_roles.duration IS NOT NULL`,
+		userID, token)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE user_roles SET expires_at = pending_donation_roles.previous_expires_at
+		FROM pending_donation_roles
+		WHERE pending_donation_roles.token = $2 AND pending_donation_roles.role_id = user_roles.role_id
+			AND user_roles.user_id = $1 AND pending_donation_roles.duration IS NULL
+			AND NOT pending_donation_roles.granted AND pending_donation_roles.previous_expires_at IS NOT NULL`,
+		userID, token)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM user_roles
+		USING pending_donation_roles
+		WHERE pending_donation_roles.token = $2 AND pending_donation_roles.role_id = user_roles.role_id
+			AND user_roles.user_id = $1 AND pending_donation_roles.duration IS NULL AND pending_donation_roles.granted`,
+		userID, token)
+	return err
+}
+
+// GetDonationToken returns the token of the donation with the given donation_id, or nil if there isn't one
+func GetDonationToken(donationID uuid.UUID) (*uuid.UUID, error) {
+	var token uuid.UUID
+	err := DB.QueryRow(`SELECT token FROM pending_donations WHERE donation_id = $1`, donationID).Scan(&token)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
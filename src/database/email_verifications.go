@@ -0,0 +1,121 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Kinds of email verification token
+const (
+	// EmailVerify confirms the user owns an address, which becomes their email if it wasn't already
+	EmailVerify = "verify"
+	// EmailRevert is sent to the old address after a change, undoing it in case the account was stolen
+	EmailRevert = "revert"
+)
+
+// ErrEmailTaken means another account already uses the address
+var ErrEmailTaken = errors.New("email is already in use")
+
+// EmailVerification is a row in the email_verifications table
+type EmailVerification struct {
+	UserID    uuid.UUID
+	Kind      string
+	Email     string
+	ExpiresAt int64
+}
+
+// CreateEmailVerification stores a token, only its hash is kept.
+// Users can only have one address waiting to be verified, so creating a new EmailVerify token replaces the old one.
+func CreateEmailVerification(tokenHash string, verification EmailVerification) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM email_verifications WHERE user_id = $1 AND (expires_at < EXTRACT(EPOCH FROM NOW()) OR kind = $2)`, verification.UserID, verification.Kind)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO email_verifications (token_hash, user_id, kind, email, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		tokenHash, verification.UserID, verification.Kind, verification.Email, verification.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ConsumeEmailVerification deletes and returns the token, so that it can only be used once.
+// Returns nil if the token doesn't exist or has expired.
+func ConsumeEmailVerification(tokenHash string) (*EmailVerification, error) {
+	var verification EmailVerification
+	err := DB.QueryRow(`DELETE FROM email_verifications WHERE token_hash = $1 RETURNING user_id, kind, email, expires_at`, tokenHash).
+		Scan(&verification.UserID, &verification.Kind, &verification.Email, &verification.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > verification.ExpiresAt {
+		return nil, nil
+	}
+	return &verification, nil
+}
+
+// GetPendingEmail returns the address the user is waiting to verify, or "" if there isn't one
+func GetPendingEmail(userID uuid.UUID) (email string, err error) {
+	err = DB.QueryRow(`
+		SELECT email FROM email_verifications
+		WHERE user_id = $1 AND kind = $2 AND expires_at > EXTRACT(EPOCH FROM NOW())
+		ORDER BY created_at DESC LIMIT 1`, userID, EmailVerify).Scan(&email)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return
+}
+
+// SetVerifiedEmail sets the user's email and marks it as verified, returning their previous address.
+// If revoke is true all of the user's sessions and tokens are revoked too, e.g. when reverting a change made by someone who stole the account.
+func SetVerifiedEmail(userID uuid.UUID, email string, revoke bool) (previous string, err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var old sql.NullString
+	err = tx.QueryRow(`SELECT email FROM users WHERE user_id = $1 FOR UPDATE`, userID).Scan(&old)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`UPDATE users SET email = $2, email_verified = TRUE WHERE user_id = $1`, userID, email)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // unique_violation
+		return "", ErrEmailTaken
+	}
+	if err != nil {
+		return "", err
+	}
+	if revoke {
+		// Start again from a clean slate, whoever made the changes being reverted shouldn't be able to do anything else
+		_, err = tx.Exec(`DELETE FROM email_verifications WHERE user_id = $1`, userID)
+		if err != nil {
+			return "", err
+		}
+		err = DeleteUserSessions(tx, userID, uuid.Nil)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		// Any other pending change is stale now
+		_, err = tx.Exec(`DELETE FROM email_verifications WHERE user_id = $1 AND kind = $2`, userID, EmailVerify)
+		if err != nil {
+			return "", err
+		}
+	}
+	return old.String, tx.Commit()
+}
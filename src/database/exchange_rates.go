@@ -0,0 +1,59 @@
+package database
+
+import (
+	"time"
+)
+
+// GetExchangeRates returns the saved exchange rates, keyed by currency, and when the oldest of them was fetched.
+// It returns nothing if there's no database.
+func GetExchangeRates() (map[string]float64, time.Time, error) {
+	if DB == nil {
+		return nil, time.Time{}, nil
+	}
+	rows, err := DB.Query(`SELECT currency, per_usd, updated_at FROM exchange_rates`)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer rows.Close()
+	rates := make(map[string]float64)
+	var oldest int64
+	for rows.Next() {
+		var (
+			currency  string
+			rate      float64
+			updatedAt int64
+		)
+		err = rows.Scan(&currency, &rate, &updatedAt)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		rates[currency] = rate
+		if oldest == 0 || updatedAt < oldest {
+			oldest = updatedAt
+		}
+	}
+	return rates, time.Unix(oldest, 0), rows.Err()
+}
+
+// SaveExchangeRates replaces the saved exchange rates. It does nothing if there's no database.
+func SaveExchangeRates(rates map[string]float64) error {
+	if DB == nil {
+		return nil
+	}
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`DELETE FROM exchange_rates`)
+	if err != nil {
+		return err
+	}
+	for currency, rate := range rates {
+		_, err = tx.Exec(`INSERT INTO exchange_rates (currency, per_usd) VALUES ($1, $2)`, currency, rate)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// SetMinecraftID links the minecraft account to the user, or unlinks it if minecraftID is nil
+func SetMinecraftID(db execer, userID uuid.UUID, minecraftID *uuid.UUID) error {
+	_, err := db.Exec(`UPDATE users SET mc_uuid = $2 WHERE user_id = $1`, userID, minecraftID)
+	return err
+}
+
+// SetDiscordID links the discord account to the user, or unlinks it if discordID is empty
+func SetDiscordID(db execer, userID uuid.UUID, discordID string) error {
+	_, err := db.Exec(`UPDATE users SET discord_id = $2 WHERE user_id = $1`, userID, sql.NullString{String: discordID, Valid: discordID != ""})
+	return err
+}
+
+// MergeAccounts moves everything worth keeping from one user to another, then deletes it.
+// Roles are combined, keeping whichever grant lasts longest. Donations, subscriptions and passkeys are moved over,
+// as are the minecraft, discord and email identities if into doesn't already have its own.
+func MergeAccounts(tx *sql.Tx, into uuid.UUID, from uuid.UUID) error {
+	_, err := tx.Exec(`
+		INSERT INTO user_roles (user_id, role_id, created_at, expires_at)
+		SELECT $1, role_id, created_at, expires_at FROM user_roles WHERE user_id = $2
+		ON CONFLICT (user_id, role_id) DO UPDATE SET expires_at = CASE
+			WHEN user_roles.expires_at IS NULL OR EXCLUDED.expires_at IS NULL THEN NULL
+			ELSE GREATEST(user_roles.expires_at, EXCLUDED.expires_at)
+		END`, into, from)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE pending_donations SET used_by = $1 WHERE used_by = $2`, into, from)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE webauthn_credentials SET user_id = $1 WHERE user_id = $2`, into, from)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE subscriptions SET user_id = $1 WHERE user_id = $2`, into, from)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE stripe_customers SET user_id = $1 WHERE user_id = $2 AND NOT EXISTS (SELECT 1 FROM stripe_customers WHERE user_id = $1)`, into, from)
+	if err != nil {
+		return err
+	}
+
+	var (
+		email         sql.NullString
+		passwordHash  sql.NullString
+		emailVerified bool
+		minecraftID   NullUUID
+		discordID     sql.NullString
+	)
+	err = tx.QueryRow(`SELECT email, password_hash, email_verified, mc_uuid, discord_id FROM users WHERE user_id = $1 FOR UPDATE`, from).
+		Scan(&email, &passwordHash, &emailVerified, &minecraftID, &discordID)
+	if err != nil {
+		return err
+	}
+	// Delete first so the identities are free to be moved, everything else cascades, see migration0016
+	_, err = tx.Exec(`DELETE FROM users WHERE user_id = $1`, from)
+	if err != nil {
+		return err
+	}
+	// The password only comes along with the email it logs in with
+	_, err = tx.Exec(`
+		UPDATE users SET
+			mc_uuid = COALESCE(mc_uuid, $2),
+			discord_id = COALESCE(discord_id, $3),
+			password_hash = CASE WHEN email IS NULL THEN $5 ELSE password_hash END,
+			email_verified = CASE WHEN email IS NULL THEN $6 ELSE email_verified END,
+			email = COALESCE(email, $4)
+		WHERE user_id = $1`,
+		into, minecraftID, discordID, email, passwordHash, emailVerified)
+	return err
+}
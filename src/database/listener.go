@@ -1,30 +1,105 @@
 package database
 
 import (
+	"encoding/json"
 	"log"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/lib/pq"
 )
 
-var callbacks = make([]func(), 0)
+// UserChangeOp is the kind of change described by a UserChangeEvent
+type UserChangeOp string
+
+const (
+	UserInserted UserChangeOp = "INSERT"
+	UserUpdated  UserChangeOp = "UPDATE"
+	UserDeleted  UserChangeOp = "DELETE"
+	// UsersResync means any number of users may have changed, so everything should be reloaded.
+	// This is sent when a role changes, when the listener reconnects (we may have missed notifications),
+	// when lots of users change at once, and periodically as a failsafe.
+	UsersResync UserChangeOp = "RESYNC"
+)
+
+// UserChangeEvent is sent to callbacks when something in users_view changes.
+// Op is the change to the row in Table, so e.g. granting a role is an INSERT into user_roles,
+// which is an update as far as the user is concerned. Look the user up again to find out what they look like now.
+type UserChangeEvent struct {
+	Op UserChangeOp `json:"op"`
+	// Table that was changed, empty for UsersResync
+	Table string `json:"table"`
+	// UserID of the changed user, uuid.Nil for UsersResync
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// maxBatchedChanges is how many individual users can change at once before we give up and resync instead
+const maxBatchedChanges = 100
+
+var callbacks = make([]func([]UserChangeEvent), 0)
 
 // this is just paranoia. this is only modified in init and only used after init, but might as well be safe and mutex it :)
 var callbacksLock sync.Mutex
 
-func CallbackOnUsersTableUpdate(callback func()) {
+// CallbackOnUsersTableUpdate registers a callback to be run whenever users_view changes.
+// Each call gets every change in a batch of notifications, at most one per user, or a single UsersResync event.
+// Callbacks are run one at a time, on the listener's goroutine.
+func CallbackOnUsersTableUpdate(callback func([]UserChangeEvent)) {
 	callbacksLock.Lock()
 	defer callbacksLock.Unlock()
 	callbacks = append(callbacks, callback)
 }
 
-func fireCallbacks() {
+func fireCallbacks(events []UserChangeEvent) {
 	callbacksLock.Lock()
 	defer callbacksLock.Unlock()
 	for _, callback := range callbacks {
-		callback()
+		callback(events)
+	}
+}
+
+// parseNotification converts a users_updated notification into an event.
+// Empty or unrecognised payloads (e.g. from the roles trigger) are treated as a resync.
+func parseNotification(notification *pq.Notification) UserChangeEvent {
+	resync := UserChangeEvent{Op: UsersResync}
+	if notification == nil || notification.Extra == "" {
+		return resync
+	}
+	var event UserChangeEvent
+	err := json.Unmarshal([]byte(notification.Extra), &event)
+	if err != nil || event.UserID == uuid.Nil {
+		log.Println("WARNING: Unable to parse users_updated payload", notification.Extra, err)
+		return resync
+	}
+	return event
+}
+
+// dispatch fires callbacks once for a batch of events
+func dispatch(events []UserChangeEvent) {
+	batch := batchEvents(events)
+	if len(batch) == 1 && batch[0].Op == UsersResync {
+		refreshRoles() // roles may have changed, so refresh them before any callbacks use them
+	}
+	fireCallbacks(batch)
+}
+
+// batchEvents deduplicates changes to the same user, or replaces the whole batch with a single UsersResync
+// if one was requested or too many users changed
+func batchEvents(events []UserChangeEvent) []UserChangeEvent {
+	changed := make(map[uuid.UUID]bool)
+	batch := make([]UserChangeEvent, 0, len(events))
+	for _, event := range events {
+		if event.Op == UsersResync || len(changed) >= maxBatchedChanges {
+			return []UserChangeEvent{{Op: UsersResync}}
+		}
+		if changed[event.UserID] {
+			continue
+		}
+		changed[event.UserID] = true
+		batch = append(batch, event)
 	}
+	return batch
 }
 
 func setupListener(url string) {
@@ -44,16 +119,28 @@ func setupListener(url string) {
 	go func() {
 		for {
 			select {
-			case <-listener.Notify:
-				log.Println("Postgres trigger 'users_updated' got pinged!")
-				fireCallbacks()
+			case notification := <-listener.Notify:
+				// pq sends a nil notification after reconnecting, since we may have missed some. parseNotification treats that as a resync.
+				events := []UserChangeEvent{parseNotification(notification)}
+				// A single statement can change lots of rows, so grab everything else that's already waiting
+			drain:
+				for {
+					select {
+					case notification := <-listener.Notify:
+						events = append(events, parseNotification(notification))
+					default:
+						break drain
+					}
+				}
+				log.Println("Postgres trigger 'users_updated' got pinged", len(events), "times!")
+				dispatch(events)
 
 			// ping the listener every 30 mins even if no notify
 			// this is the suggested pattern, given that sometimes connections can drop
 			// source: https://github.com/lib/pq/blob/master/example/listen/doc.go
 			case <-time.After(30 * time.Minute):
 				go listener.Ping()
-				fireCallbacks() // failsafe
+				dispatch([]UserChangeEvent{{Op: UsersResync}}) // failsafe
 			}
 		}
 	}()
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNotification(t *testing.T) {
+	resync := UserChangeEvent{Op: UsersResync}
+
+	// Reconnects, the roles trigger and anything we don't understand all mean resync
+	assert.Equal(t, resync, parseNotification(nil))
+	assert.Equal(t, resync, parseNotification(&pq.Notification{Channel: "users_updated"}))
+	assert.Equal(t, resync, parseNotification(&pq.Notification{Channel: "users_updated", Extra: "garbage"}))
+	assert.Equal(t, resync, parseNotification(&pq.Notification{Channel: "users_updated", Extra: `{"op": "UPDATE", "table": "users", "user_id": null}`}))
+
+	id := uuid.New()
+	assert.Equal(t, UserChangeEvent{Op: UserInserted, Table: "user_roles", UserID: id}, parseNotification(&pq.Notification{
+		Channel: "users_updated",
+		Extra:   `{"op" : "INSERT", "table" : "user_roles", "user_id" : "` + id.String() + `"}`,
+	}))
+}
+
+func TestBatchEvents(t *testing.T) {
+	resync := []UserChangeEvent{{Op: UsersResync}}
+	a, b := uuid.New(), uuid.New()
+
+	// Each user is only reloaded once per batch
+	assert.Equal(t, []UserChangeEvent{
+		{Op: UserUpdated, Table: "users", UserID: a},
+		{Op: UserInserted, Table: "user_roles", UserID: b},
+	}, batchEvents([]UserChangeEvent{
+		{Op: UserUpdated, Table: "users", UserID: a},
+		{Op: UserInserted, Table: "user_roles", UserID: b},
+		{Op: UserDeleted, Table: "user_roles", UserID: a},
+	}))
+
+	assert.Equal(t, resync, batchEvents([]UserChangeEvent{{Op: UserUpdated, UserID: a}, {Op: UsersResync}}))
+
+	lots := make([]UserChangeEvent, 0, maxBatchedChanges+1)
+	for i := 0; i <= maxBatchedChanges; i++ {
+		lots = append(lots, UserChangeEvent{Op: UserInserted, Table: "user_roles", UserID: uuid.New()})
+	}
+	assert.Equal(t, resync, batchEvents(lots))
+	assert.Len(t, batchEvents(lots[:maxBatchedChanges]), maxBatchedChanges)
+}
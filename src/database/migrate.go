@@ -0,0 +1,265 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// migrationLockID is the key passed to pg_advisory_lock while migrating.
+// It is arbitrary, it just has to be the same for every dyno.
+const migrationLockID = 7355608
+
+// migration is a single, numbered schema change.
+// Once a migration has been applied to production its up script must never be edited,
+// add a new migration instead. The checksum is used to detect accidental edits.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// migrations is the ordered list of every migration.
+// Each migration lives in its own migration_XXXX_name.go file.
+var migrations = []migration{
+	migration0001,
+	migration0002,
+	migration0003,
+	migration0004,
+	migration0005,
+	migration0006,
+	migration0007,
+	migration0008,
+	migration0009,
+	migration0010,
+	migration0011,
+	migration0012,
+	migration0013,
+	migration0014,
+	migration0015,
+	migration0016,
+	migration0017,
+	migration0018,
+	migration0019,
+	migration0020,
+	migration0021,
+	migration0022,
+	migration0023,
+	migration0024,
+	migration0025,
+	migration0026,
+	migration0027,
+}
+
+// checksum returns a hex sha256 of the up script
+func (m migration) checksum() string {
+	sum := sha256.Sum256([]byte(m.up))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.version, m.name)
+}
+
+// appliedMigration is a row in the schema_migrations table
+type appliedMigration struct {
+	version   int
+	name      string
+	checksum  string
+	appliedAt int64
+}
+
+// MigrationStatus describes whether a known migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	// Modified is true if the migration was applied with a different checksum to the one we have now
+	Modified bool
+}
+
+// sortedMigrations returns a sorted copy of migrations, panicking if any versions are duplicated
+func sortedMigrations() []migration {
+	sorted := append(migrations[:0:0], migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].version < sorted[j].version
+	})
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].version == sorted[i-1].version {
+			panic(fmt.Sprintf("duplicate migration version %d", sorted[i].version))
+		}
+	}
+	return sorted
+}
+
+// withMigrationLock runs f on a dedicated connection while holding the migration advisory lock.
+// Advisory locks belong to the session, so everything has to happen on the same connection.
+func withMigrationLock(f func(conn *sql.Conn) error) error {
+	if DB == nil {
+		return fmt.Errorf("database not connected")
+	}
+
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Blocks until any other dyno has finished migrating
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT -- unix seconds
+		);
+	`)
+	if err != nil {
+		log.Println("Unable to create schema_migrations table")
+		return err
+	}
+
+	return f(conn)
+}
+
+// getApplied returns all applied migrations, keyed by version
+func getApplied(conn *sql.Conn) (map[int]appliedMigration, error) {
+	rows, err := conn.QueryContext(context.Background(), `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var m appliedMigration
+		err = rows.Scan(&m.version, &m.name, &m.checksum, &m.appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[m.version] = m
+	}
+	return applied, rows.Err()
+}
+
+// runMigration runs a single script inside a transaction, recording or removing the schema_migrations row
+func runMigration(conn *sql.Conn, m migration, up bool) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if up {
+		_, err = tx.ExecContext(ctx, m.up)
+		if err != nil {
+			return fmt.Errorf("migration %s failed: %w", m, err)
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`, m.version, m.name, m.checksum())
+	} else {
+		_, err = tx.ExecContext(ctx, m.down)
+		if err != nil {
+			return fmt.Errorf("rollback of migration %s failed: %w", m, err)
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MigrateUp applies every migration that hasn't been applied yet, in order.
+// It refuses to run if an applied migration has been modified since it was applied.
+func MigrateUp() error {
+	return withMigrationLock(func(conn *sql.Conn) error {
+		applied, err := getApplied(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range sortedMigrations() {
+			if a, ok := applied[m.version]; ok {
+				if a.checksum != m.checksum() {
+					return fmt.Errorf("migration %s has been modified since it was applied", m)
+				}
+				continue
+			}
+
+			log.Println("Applying migration", m)
+			err = runMigration(conn, m, true)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateDown rolls back the most recently applied migrations, up to steps migrations
+func MigrateDown(steps int) error {
+	return withMigrationLock(func(conn *sql.Conn) error {
+		applied, err := getApplied(conn)
+		if err != nil {
+			return err
+		}
+
+		sorted := sortedMigrations()
+		for i := len(sorted) - 1; i >= 0 && steps > 0; i-- {
+			m := sorted[i]
+			if _, ok := applied[m.version]; !ok {
+				continue
+			}
+
+			log.Println("Rolling back migration", m)
+			err = runMigration(conn, m, false)
+			if err != nil {
+				return err
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// GetMigrationStatus lists every known migration and whether it has been applied
+func GetMigrationStatus() (status []MigrationStatus, err error) {
+	err = withMigrationLock(func(conn *sql.Conn) error {
+		applied, err := getApplied(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range sortedMigrations() {
+			s := MigrationStatus{
+				Version: m.version,
+				Name:    m.name,
+			}
+			if a, ok := applied[m.version]; ok {
+				appliedAt := time.Unix(a.appliedAt, 0).UTC()
+				s.Applied = true
+				s.AppliedAt = &appliedAt
+				s.Modified = a.checksum != m.checksum()
+			}
+			status = append(status, s)
+		}
+		return nil
+	})
+	return
+}
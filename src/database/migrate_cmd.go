@@ -0,0 +1,53 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// isMigrateCommand returns true if the server binary was started as `<binary> migrate ...`
+func isMigrateCommand() bool {
+	return len(os.Args) > 1 && os.Args[1] == "migrate"
+}
+
+// runMigrateCommand implements `<binary> migrate up|down [steps]|status`.
+// It is run from init so that it happens before any other package tries to use the database.
+func runMigrateCommand(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: migrate up|down [steps]|status")
+	}
+
+	switch args[0] {
+	case "up":
+		return MigrateUp()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		return MigrateDown(steps)
+	case "status":
+		status, err := GetMigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				state += " (MODIFIED)"
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+}
@@ -0,0 +1,25 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrationsAreOrdered(t *testing.T) {
+	sorted := sortedMigrations()
+	for i, m := range sorted {
+		// Versions should start at 1 and have no gaps
+		assert.Equal(t, i+1, m.version, "unexpected version for migration %s", m)
+		assert.NotEmpty(t, m.name, "migration %d has no name", m.version)
+		assert.NotEmpty(t, m.up, "migration %s has no up script", m)
+		assert.NotEmpty(t, m.down, "migration %s has no down script", m)
+	}
+}
+
+func TestMigrationChecksum(t *testing.T) {
+	m := migration{version: 1, name: "test", up: "SELECT 1;"}
+	assert.Equal(t, m.checksum(), migration{up: "SELECT 1;"}.checksum())
+	assert.NotEqual(t, m.checksum(), migration{up: "SELECT 2;"}.checksum())
+	assert.Equal(t, "0001_test", m.String())
+}
@@ -0,0 +1,174 @@
+package database
+
+// migration0002 moves roles out of boolean columns and into the roles, user_roles and pending_donation_roles tables
+var migration0002 = migration{
+	version: 2,
+	name:    "roles",
+	up: `
+		CREATE TABLE roles (
+			role_id TEXT PRIMARY KEY,
+			rank INTEGER NOT NULL, -- lower is better
+			legacy_list BOOL NOT NULL DEFAULT FALSE, -- is there a legacy list of pure UUIDs that old clients rely on?
+			token_grantable BOOL NOT NULL DEFAULT TRUE, -- can this role be granted by a registration token?
+
+			-- Default cosmetics for users with this role, NULL means no default
+			icon TEXT,
+			cape TEXT,
+			text_color TEXT,
+			bg_color TEXT,
+			border_color TEXT,
+			edition_icon TEXT,
+			edition_text TEXT,
+			edition_text_color TEXT
+		);
+
+		INSERT INTO roles (role_id, rank, legacy_list, token_grantable, icon, cape, text_color, bg_color, border_color, edition_icon, edition_text, edition_text_color) VALUES
+			('spawnmason', 0, FALSE, TRUE,
+				'https://files.impactclient.net/img/texture/spawnmason128.png',
+				'https://files.impactclient.net/img/texture/spawnmason_cape_elytra.png',
+				'GOLD', '#90404040', 'RED',
+				NULL, NULL, NULL),
+			-- #004B93 is the official logo blue, #005CB4 is the official "background" blue, #0063a7 is also used, #C9002B is the official logo red
+			('pepsi', 1, TRUE, TRUE,
+				'https://files.impactclient.net/img/texture/pepsi_v2_128.png',
+				'https://files.impactclient.net/img/texture/pepsi_cape_elytra.png',
+				'BLUE', '#50FFFFFF', '#FFC9002B',
+				'https://files.impactclient.net/img/texture/pepsi_v2_128.png', 'Pepsi', '#FFC9002B'),
+			('developer', 2, TRUE, FALSE,
+				NULL,
+				'https://files.impactclient.net/img/texture/developer_cape_elytra.png',
+				NULL, NULL, NULL,
+				NULL, NULL, NULL),
+			('staff', 3, TRUE, TRUE,
+				NULL,
+				'https://files.impactclient.net/img/texture/staff_cape_elytra.png',
+				NULL, NULL, NULL,
+				NULL, 'Staff', '#FF7734EB'),
+			('premium', 4, TRUE, TRUE,
+				NULL,
+				'https://files.impactclient.net/img/texture/premium_cape_elytra.png',
+				NULL, NULL, NULL,
+				NULL, 'Premium', 'GOLD');
+
+		CREATE TABLE user_roles (
+			user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			role_id TEXT NOT NULL REFERENCES roles(role_id),
+			created_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT, -- unix seconds
+			PRIMARY KEY (user_id, role_id)
+		);
+
+		INSERT INTO user_roles (user_id, role_id) SELECT user_id, 'premium' FROM users WHERE premium;
+		INSERT INTO user_roles (user_id, role_id) SELECT user_id, 'pepsi' FROM users WHERE pepsi;
+		INSERT INTO user_roles (user_id, role_id) SELECT user_id, 'spawnmason' FROM users WHERE spawnmason;
+		INSERT INTO user_roles (user_id, role_id) SELECT user_id, 'staff' FROM users WHERE staff;
+		INSERT INTO user_roles (user_id, role_id) SELECT user_id, 'developer' FROM users WHERE developer;
+
+		-- Roles to be granted when a token is redeemed
+		CREATE TABLE pending_donation_roles (
+			token UUID NOT NULL REFERENCES pending_donations(token) ON DELETE CASCADE,
+			role_id TEXT NOT NULL REFERENCES roles(role_id),
+			PRIMARY KEY (token, role_id)
+		);
+
+		INSERT INTO pending_donation_roles (token, role_id) SELECT token, 'premium' FROM pending_donations WHERE premium;
+		INSERT INTO pending_donation_roles (token, role_id) SELECT token, 'pepsi' FROM pending_donations WHERE pepsi;
+		INSERT INTO pending_donation_roles (token, role_id) SELECT token, 'spawnmason' FROM pending_donations WHERE spawnmason;
+		INSERT INTO pending_donation_roles (token, role_id) SELECT token, 'staff' FROM pending_donations WHERE staff;
+
+		DROP VIEW users_view;
+
+		ALTER TABLE users
+			DROP COLUMN premium,
+			DROP COLUMN pepsi,
+			DROP COLUMN spawnmason,
+			DROP COLUMN staff,
+			DROP COLUMN developer;
+
+		ALTER TABLE pending_donations
+			DROP COLUMN premium,
+			DROP COLUMN pepsi,
+			DROP COLUMN spawnmason,
+			DROP COLUMN staff;
+
+		CREATE VIEW users_view AS SELECT
+			user_id,
+			email,
+			mc_uuid,
+			discord_id,
+			password_hash,
+			stripe_connect,
+			cape_enabled, --TODO invert this to "incognito"
+			legacy_enabled,
+			legacy,
+			ARRAY(
+				SELECT role_id FROM user_roles WHERE user_roles.user_id = users.user_id ORDER BY role_id
+			) AS roles
+			FROM users;
+
+		-- Granting or revoking a role, or changing a role's cosmetics, changes user info too
+		CREATE TRIGGER user_roles_update_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON user_roles
+		FOR EACH STATEMENT
+		EXECUTE PROCEDURE notify_users_updated();
+
+		CREATE TRIGGER roles_update_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON roles
+		FOR EACH STATEMENT
+		EXECUTE PROCEDURE notify_users_updated();
+	`,
+	down: `
+		DROP VIEW users_view;
+
+		ALTER TABLE users
+			ADD COLUMN premium BOOL NOT NULL DEFAULT FALSE,
+			ADD COLUMN pepsi BOOL NOT NULL DEFAULT FALSE,
+			ADD COLUMN spawnmason BOOL NOT NULL DEFAULT FALSE,
+			ADD COLUMN staff BOOL NOT NULL DEFAULT FALSE,
+			ADD COLUMN developer BOOL NOT NULL DEFAULT FALSE;
+
+		UPDATE users SET
+			premium = EXISTS(SELECT 1 FROM user_roles r WHERE r.user_id = users.user_id AND r.role_id = 'premium'),
+			pepsi = EXISTS(SELECT 1 FROM user_roles r WHERE r.user_id = users.user_id AND r.role_id = 'pepsi'),
+			spawnmason = EXISTS(SELECT 1 FROM user_roles r WHERE r.user_id = users.user_id AND r.role_id = 'spawnmason'),
+			staff = EXISTS(SELECT 1 FROM user_roles r WHERE r.user_id = users.user_id AND r.role_id = 'staff'),
+			developer = EXISTS(SELECT 1 FROM user_roles r WHERE r.user_id = users.user_id AND r.role_id = 'developer');
+
+		ALTER TABLE pending_donations
+			ADD COLUMN premium BOOL NOT NULL DEFAULT FALSE,
+			ADD COLUMN pepsi BOOL NOT NULL DEFAULT FALSE,
+			ADD COLUMN spawnmason BOOL NOT NULL DEFAULT FALSE,
+			ADD COLUMN staff BOOL NOT NULL DEFAULT FALSE;
+
+		UPDATE pending_donations SET
+			premium = EXISTS(SELECT 1 FROM pending_donation_roles r WHERE r.token = pending_donations.token AND r.role_id = 'premium'),
+			pepsi = EXISTS(SELECT 1 FROM pending_donation_roles r WHERE r.token = pending_donations.token AND r.role_id = 'pepsi'),
+			spawnmason = EXISTS(SELECT 1 FROM pending_donation_roles r WHERE r.token = pending_donations.token AND r.role_id = 'spawnmason'),
+			staff = EXISTS(SELECT 1 FROM pending_donation_roles r WHERE r.token = pending_donations.token AND r.role_id = 'staff');
+
+		DROP TABLE pending_donation_roles;
+		DROP TABLE user_roles;
+		DROP TABLE roles;
+
+		CREATE VIEW users_view AS SELECT
+			user_id,
+			email,
+			mc_uuid,
+			discord_id,
+			password_hash,
+			stripe_connect,
+			cape_enabled, --TODO invert this to "incognito"
+			legacy_enabled,
+			legacy,
+			STRING_TO_ARRAY(
+				CONCAT_WS(',',
+					CASE WHEN premium THEN 'premium' END,
+					CASE WHEN pepsi THEN 'pepsi' END,
+					CASE WHEN spawnmason THEN 'spawnmason' END,
+					CASE WHEN staff THEN 'staff' END,
+					CASE WHEN developer THEN 'developer' END
+				),
+				','
+			) AS roles
+			FROM users;
+	`,
+}
@@ -0,0 +1,59 @@
+package database
+
+// migration0003 allows role grants to expire
+var migration0003 = migration{
+	version: 3,
+	name:    "role_expiry",
+	up: `
+		ALTER TABLE user_roles ADD COLUMN expires_at BIGINT; -- unix seconds, NULL means the role never expires
+
+		ALTER TABLE pending_donation_roles ADD COLUMN duration BIGINT; -- seconds the role lasts once redeemed, NULL means forever
+
+		DROP VIEW users_view;
+
+		-- Expired roles are hidden even before the expirer gets around to deleting them
+		-- role_expiry is in the same order as roles, 0 means never
+		CREATE VIEW users_view AS SELECT
+			user_id,
+			email,
+			mc_uuid,
+			discord_id,
+			password_hash,
+			stripe_connect,
+			cape_enabled, --TODO invert this to "incognito"
+			legacy_enabled,
+			legacy,
+			ARRAY(
+				SELECT role_id FROM user_roles
+				WHERE user_roles.user_id = users.user_id AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW()))
+				ORDER BY role_id
+			) AS roles,
+			ARRAY(
+				SELECT COALESCE(expires_at, 0) FROM user_roles
+				WHERE user_roles.user_id = users.user_id AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW()))
+				ORDER BY role_id
+			) AS role_expiry
+			FROM users;
+	`,
+	down: `
+		DROP VIEW users_view;
+
+		CREATE VIEW users_view AS SELECT
+			user_id,
+			email,
+			mc_uuid,
+			discord_id,
+			password_hash,
+			stripe_connect,
+			cape_enabled, --TODO invert this to "incognito"
+			legacy_enabled,
+			legacy,
+			ARRAY(
+				SELECT role_id FROM user_roles WHERE user_roles.user_id = users.user_id ORDER BY role_id
+			) AS roles
+			FROM users;
+
+		ALTER TABLE pending_donation_roles DROP COLUMN duration;
+		ALTER TABLE user_roles DROP COLUMN expires_at;
+	`,
+}
@@ -0,0 +1,107 @@
+package database
+
+// migration0004 replaces the hardcoded users.specialCases map with the customizations table
+var migration0004 = migration{
+	version: 4,
+	name:    "customizations",
+	up: `
+		CREATE TABLE customizations (
+			user_id UUID PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+			updated_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT, -- unix seconds
+
+			-- Cosmetics that override the user's role defaults, NULL means no override
+			icon TEXT,
+			cape TEXT,
+			text_color TEXT,
+			bg_color TEXT,
+			border_color TEXT,
+			edition_icon TEXT,
+			edition_text TEXT,
+			edition_text_color TEXT
+		);
+
+		-- Everyone who was in users.specialCases
+		INSERT INTO customizations (user_id, text_color, icon, cape, edition_icon)
+		SELECT user_id, special.text_color, special.icon, special.cape, special.edition_icon
+		FROM users INNER JOIN (VALUES
+			-- catgorl
+			('2c3174fc-0c6b-4cfb-bb2b-0069bf7294d1'::UUID, 'LIGHT_PURPLE', NULL::TEXT, NULL::TEXT, NULL::TEXT),
+			-- leijurv
+			('51dcd870-d33b-40e9-9fc1-aecdcff96081'::UUID, 'RED', 'https://files.impactclient.net/img/texture/speckles128.png', NULL, 'https://files.impactclient.net/img/texture/speckles128.png'),
+			-- liejurv since leijurv is disabled
+			('7b9c005b-011e-42de-bfb4-c0003f5c3a77'::UUID, 'RED', 'https://files.impactclient.net/img/texture/speckles128.png', NULL, 'https://files.impactclient.net/img/texture/speckles128.png'),
+			-- triibu popstonia
+			('8e563236-c7f5-4c82-aa27-c95bf3f4c322'::UUID, NULL, 'https://files.impactclient.net/img/texture/popstonia.png', NULL, NULL),
+			-- popstonia (rebane)
+			('342fc44b-1fd1-4272-a4c3-a98a2df98abc'::UUID, NULL, 'https://files.impactclient.net/img/texture/popstonia.png', NULL, NULL),
+			-- HermeticLock
+			('e97ff4c0-48bf-4c98-be34-248fdde2ffd3'::UUID, 'RED', 'https://i.imgur.com/aKt1g4H.jpg', 'https://i.imgur.com/bvhC1Xk.png', 'https://i.imgur.com/aKt1g4H.jpg'),
+			-- peanut
+			('9d913c0a-3d57-4ce9-8b7d-689973312856'::UUID, 'ORANGE', NULL, NULL, NULL)
+		) AS special (mc_uuid, text_color, icon, cape, edition_icon) USING (mc_uuid);
+
+		DROP VIEW users_view;
+
+		CREATE VIEW users_view AS SELECT
+			user_id,
+			email,
+			mc_uuid,
+			discord_id,
+			password_hash,
+			stripe_connect,
+			cape_enabled, --TODO invert this to "incognito"
+			legacy_enabled,
+			legacy,
+			ARRAY(
+				SELECT role_id FROM user_roles
+				WHERE user_roles.user_id = users.user_id AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW()))
+				ORDER BY role_id
+			) AS roles,
+			ARRAY(
+				SELECT COALESCE(expires_at, 0) FROM user_roles
+				WHERE user_roles.user_id = users.user_id AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW()))
+				ORDER BY role_id
+			) AS role_expiry,
+			customizations.icon AS custom_icon,
+			customizations.cape AS custom_cape,
+			customizations.text_color AS custom_text_color,
+			customizations.bg_color AS custom_bg_color,
+			customizations.border_color AS custom_border_color,
+			customizations.edition_icon AS custom_edition_icon,
+			customizations.edition_text AS custom_edition_text,
+			customizations.edition_text_color AS custom_edition_text_color
+			FROM users LEFT OUTER JOIN customizations USING (user_id);
+
+		CREATE TRIGGER customizations_update_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON customizations
+		FOR EACH STATEMENT
+		EXECUTE PROCEDURE notify_users_updated();
+	`,
+	down: `
+		DROP VIEW users_view;
+
+		CREATE VIEW users_view AS SELECT
+			user_id,
+			email,
+			mc_uuid,
+			discord_id,
+			password_hash,
+			stripe_connect,
+			cape_enabled, --TODO invert this to "incognito"
+			legacy_enabled,
+			legacy,
+			ARRAY(
+				SELECT role_id FROM user_roles
+				WHERE user_roles.user_id = users.user_id AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW()))
+				ORDER BY role_id
+			) AS roles,
+			ARRAY(
+				SELECT COALESCE(expires_at, 0) FROM user_roles
+				WHERE user_roles.user_id = users.user_id AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW()))
+				ORDER BY role_id
+			) AS role_expiry
+			FROM users;
+
+		DROP TABLE customizations;
+	`,
+}
@@ -0,0 +1,98 @@
+package database
+
+// migration0005 stores the cosmetics users have chosen for themselves
+var migration0005 = migration{
+	version: 5,
+	name:    "user_cosmetics",
+	up: `
+		CREATE TABLE user_cosmetics (
+			user_id UUID PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+			updated_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT, -- unix seconds
+
+			cape TEXT, -- catalog id, see users.capes
+			icon TEXT, -- catalog id, see users.icons
+			text_color TEXT,
+			bg_color TEXT,
+			border_color TEXT
+		);
+
+		DROP VIEW users_view;
+
+		CREATE VIEW users_view AS SELECT
+			user_id,
+			email,
+			mc_uuid,
+			discord_id,
+			password_hash,
+			stripe_connect,
+			cape_enabled, --TODO invert this to "incognito"
+			legacy_enabled,
+			legacy,
+			ARRAY(
+				SELECT role_id FROM user_roles
+				WHERE user_roles.user_id = users.user_id AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW()))
+				ORDER BY role_id
+			) AS roles,
+			ARRAY(
+				SELECT COALESCE(expires_at, 0) FROM user_roles
+				WHERE user_roles.user_id = users.user_id AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW()))
+				ORDER BY role_id
+			) AS role_expiry,
+			customizations.icon AS custom_icon,
+			customizations.cape AS custom_cape,
+			customizations.text_color AS custom_text_color,
+			customizations.bg_color AS custom_bg_color,
+			customizations.border_color AS custom_border_color,
+			customizations.edition_icon AS custom_edition_icon,
+			customizations.edition_text AS custom_edition_text,
+			customizations.edition_text_color AS custom_edition_text_color,
+			user_cosmetics.cape AS chosen_cape,
+			user_cosmetics.icon AS chosen_icon,
+			user_cosmetics.text_color AS chosen_text_color,
+			user_cosmetics.bg_color AS chosen_bg_color,
+			user_cosmetics.border_color AS chosen_border_color
+			FROM users
+			LEFT OUTER JOIN customizations USING (user_id)
+			LEFT OUTER JOIN user_cosmetics USING (user_id);
+
+		CREATE TRIGGER user_cosmetics_update_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON user_cosmetics
+		FOR EACH STATEMENT
+		EXECUTE PROCEDURE notify_users_updated();
+	`,
+	down: `
+		DROP VIEW users_view;
+
+		CREATE VIEW users_view AS SELECT
+			user_id,
+			email,
+			mc_uuid,
+			discord_id,
+			password_hash,
+			stripe_connect,
+			cape_enabled, --TODO invert this to "incognito"
+			legacy_enabled,
+			legacy,
+			ARRAY(
+				SELECT role_id FROM user_roles
+				WHERE user_roles.user_id = users.user_id AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW()))
+				ORDER BY role_id
+			) AS roles,
+			ARRAY(
+				SELECT COALESCE(expires_at, 0) FROM user_roles
+				WHERE user_roles.user_id = users.user_id AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW()))
+				ORDER BY role_id
+			) AS role_expiry,
+			customizations.icon AS custom_icon,
+			customizations.cape AS custom_cape,
+			customizations.text_color AS custom_text_color,
+			customizations.bg_color AS custom_bg_color,
+			customizations.border_color AS custom_border_color,
+			customizations.edition_icon AS custom_edition_icon,
+			customizations.edition_text AS custom_edition_text,
+			customizations.edition_text_color AS custom_edition_text_color
+			FROM users LEFT OUTER JOIN customizations USING (user_id);
+
+		DROP TABLE user_cosmetics;
+	`,
+}
@@ -0,0 +1,29 @@
+package database
+
+// migration0006 adds the moderation queue for user uploaded capes
+var migration0006 = migration{
+	version: 6,
+	name:    "cape_uploads",
+	up: `
+		CREATE TABLE cape_uploads (
+			upload_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			created_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT, -- unix seconds
+			sha256 TEXT NOT NULL, -- hex hash of the re-encoded png, also used as the file name
+			width INTEGER NOT NULL,
+			height INTEGER NOT NULL,
+
+			status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+			reviewed_at BIGINT, -- unix seconds
+			reviewed_by UUID REFERENCES users(user_id) ON DELETE SET NULL,
+			reason TEXT -- why it was rejected, shown to the uploader
+		);
+
+		-- Each user can only have one upload waiting for review
+		CREATE UNIQUE INDEX cape_uploads_one_pending ON cape_uploads(user_id) WHERE status = 'pending';
+		CREATE INDEX cape_uploads_status ON cape_uploads(status, created_at);
+	`,
+	down: `
+		DROP TABLE cape_uploads;
+	`,
+}
@@ -0,0 +1,78 @@
+package database
+
+// migration0007 replaces the statement level users_updated triggers with row level ones that say which user changed.
+// roles still uses a statement level trigger, since changing a role can affect any number of users.
+var migration0007 = migration{
+	version: 7,
+	name:    "row_notifications",
+	up: `
+		-- Payload is {"op": "INSERT|UPDATE|DELETE", "table": "...", "user_id": "..."}, see database.UserChangeEvent
+		CREATE FUNCTION notify_user_changed()
+		  RETURNS trigger AS $$
+		DECLARE
+		  changed UUID;
+		BEGIN
+		  IF TG_OP = 'DELETE' THEN
+		    changed := OLD.user_id;
+		  ELSE
+		    changed := NEW.user_id;
+		  END IF;
+		  PERFORM pg_notify('users_updated', json_build_object('op', TG_OP, 'table', TG_TABLE_NAME, 'user_id', changed)::TEXT);
+		  RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER users_update_trigger ON users;
+		DROP TRIGGER user_roles_update_trigger ON user_roles;
+		DROP TRIGGER customizations_update_trigger ON customizations;
+		DROP TRIGGER user_cosmetics_update_trigger ON user_cosmetics;
+
+		CREATE TRIGGER users_update_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON users
+		FOR EACH ROW
+		EXECUTE PROCEDURE notify_user_changed();
+
+		CREATE TRIGGER user_roles_update_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON user_roles
+		FOR EACH ROW
+		EXECUTE PROCEDURE notify_user_changed();
+
+		CREATE TRIGGER customizations_update_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON customizations
+		FOR EACH ROW
+		EXECUTE PROCEDURE notify_user_changed();
+
+		CREATE TRIGGER user_cosmetics_update_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON user_cosmetics
+		FOR EACH ROW
+		EXECUTE PROCEDURE notify_user_changed();
+	`,
+	down: `
+		DROP TRIGGER users_update_trigger ON users;
+		DROP TRIGGER user_roles_update_trigger ON user_roles;
+		DROP TRIGGER customizations_update_trigger ON customizations;
+		DROP TRIGGER user_cosmetics_update_trigger ON user_cosmetics;
+
+		DROP FUNCTION notify_user_changed();
+
+		CREATE TRIGGER users_update_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON users
+		FOR EACH STATEMENT
+		EXECUTE PROCEDURE notify_users_updated();
+
+		CREATE TRIGGER user_roles_update_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON user_roles
+		FOR EACH STATEMENT
+		EXECUTE PROCEDURE notify_users_updated();
+
+		CREATE TRIGGER customizations_update_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON customizations
+		FOR EACH STATEMENT
+		EXECUTE PROCEDURE notify_users_updated();
+
+		CREATE TRIGGER user_cosmetics_update_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON user_cosmetics
+		FOR EACH STATEMENT
+		EXECUTE PROCEDURE notify_users_updated();
+	`,
+}
@@ -0,0 +1,27 @@
+package database
+
+// migration0008 adds server side sessions, so that logins can be refreshed, listed and revoked
+var migration0008 = migration{
+	version: 8,
+	name:    "sessions",
+	up: `
+		CREATE TABLE sessions (
+			session_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			created_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT, -- unix seconds
+			last_used_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT, -- unix seconds, updated when refreshed
+			expires_at BIGINT NOT NULL, -- unix seconds, after this neither the refresh token nor any access token for this session are valid
+
+			refresh_hash TEXT NOT NULL, -- hex sha256 of the current refresh token's secret
+			previous_hash TEXT, -- hex sha256 of the last refresh token's secret, seeing it again means a refresh token was stolen
+
+			user_agent TEXT,
+			ip_address TEXT
+		);
+
+		CREATE INDEX sessions_user_id ON sessions(user_id);
+	`,
+	down: `
+		DROP TABLE sessions;
+	`,
+}
@@ -0,0 +1,31 @@
+package database
+
+// migration0009 adds OAuth2 client applications and authorization codes
+var migration0009 = migration{
+	version: 9,
+	name:    "oauth",
+	up: `
+		CREATE TABLE oauth_clients (
+			client_id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			secret_hash TEXT, -- hex sha256 of the client secret, NULL for public clients (e.g. apps that can't keep a secret)
+			redirect_uris TEXT[] NOT NULL DEFAULT '{}', -- exact match only
+			scopes TEXT[] NOT NULL DEFAULT '{}', -- the most the client is allowed to ask for
+			created_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT -- unix seconds
+		);
+
+		CREATE TABLE oauth_codes (
+			code_hash TEXT PRIMARY KEY, -- hex sha256 of the code
+			client_id TEXT NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			redirect_uri TEXT NOT NULL,
+			scopes TEXT[] NOT NULL,
+			code_challenge TEXT NOT NULL, -- PKCE S256 challenge
+			expires_at BIGINT NOT NULL -- unix seconds
+		);
+	`,
+	down: `
+		DROP TABLE oauth_codes;
+		DROP TABLE oauth_clients;
+	`,
+}
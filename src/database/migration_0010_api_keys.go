@@ -0,0 +1,22 @@
+package database
+
+// migration0010 adds scoped API keys for integrations, replacing the shared secrets in query strings
+var migration0010 = migration{
+	version: 10,
+	name:    "api_keys",
+	up: `
+		CREATE TABLE api_keys (
+			key_id UUID PRIMARY KEY,
+			owner TEXT NOT NULL, -- who the key was issued to, e.g. "ImpactBot"
+			key_hash TEXT NOT NULL, -- hex sha256 of the secret part of the key
+			scopes TEXT[] NOT NULL DEFAULT '{}',
+			created_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT, -- unix seconds
+			created_by UUID REFERENCES users(user_id) ON DELETE SET NULL,
+			last_used_at BIGINT, -- unix seconds, NULL if never used
+			revoked_at BIGINT -- unix seconds, NULL if still valid
+		);
+	`,
+	down: `
+		DROP TABLE api_keys;
+	`,
+}
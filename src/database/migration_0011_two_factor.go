@@ -0,0 +1,31 @@
+package database
+
+// migration0011 adds TOTP two factor authentication, recovery codes, and records whether each session used it
+var migration0011 = migration{
+	version: 11,
+	name:    "two_factor",
+	up: `
+		CREATE TABLE user_totp (
+			user_id UUID PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+			secret TEXT NOT NULL, -- base32, can't be hashed since we need it to generate codes
+			created_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT, -- unix seconds
+			enabled_at BIGINT, -- unix seconds, NULL until the user has proven they can generate codes
+			last_used_step BIGINT NOT NULL DEFAULT 0 -- the last time step a code was accepted for, so codes can't be reused
+		);
+
+		CREATE TABLE user_recovery_codes (
+			user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			code_hash TEXT NOT NULL, -- hex sha256 of the normalised code
+			PRIMARY KEY (user_id, code_hash)
+		);
+
+		ALTER TABLE sessions
+			ADD COLUMN two_factor BOOL NOT NULL DEFAULT FALSE; -- whether the session was started with a second factor
+	`,
+	down: `
+		ALTER TABLE sessions
+			DROP COLUMN two_factor;
+		DROP TABLE user_recovery_codes;
+		DROP TABLE user_totp;
+	`,
+}
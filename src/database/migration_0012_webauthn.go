@@ -0,0 +1,31 @@
+package database
+
+// migration0012 adds WebAuthn credentials (passkeys) and the challenges used to register and log in with them
+var migration0012 = migration{
+	version: 12,
+	name:    "webauthn",
+	up: `
+		CREATE TABLE webauthn_credentials (
+			credential_id BYTEA PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			name TEXT NOT NULL, -- chosen by the user, so they can tell their passkeys apart
+			public_key BYTEA NOT NULL, -- PKIX
+			algorithm INTEGER NOT NULL, -- COSE algorithm identifier
+			sign_count BIGINT NOT NULL DEFAULT 0,
+			created_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT, -- unix seconds
+			last_used_at BIGINT -- unix seconds, NULL if never used
+		);
+
+		CREATE INDEX webauthn_credentials_user_id ON webauthn_credentials(user_id);
+
+		CREATE TABLE webauthn_challenges (
+			challenge_hash TEXT PRIMARY KEY, -- hex sha256 of the challenge
+			user_id UUID REFERENCES users(user_id) ON DELETE CASCADE, -- who is registering a credential, NULL when logging in
+			expires_at BIGINT NOT NULL -- unix seconds
+		);
+	`,
+	down: `
+		DROP TABLE webauthn_challenges;
+		DROP TABLE webauthn_credentials;
+	`,
+}
@@ -0,0 +1,110 @@
+package database
+
+// migration0013 adds email verification, and tokens for confirming or reverting email changes
+var migration0013 = migration{
+	version: 13,
+	name:    "email_verification",
+	up: `
+		ALTER TABLE users
+			ADD COLUMN email_verified BOOL NOT NULL DEFAULT FALSE;
+
+		-- Existing addresses have been receiving password resets all along, so they're as verified as they're going to get
+		UPDATE users SET email_verified = TRUE WHERE email IS NOT NULL;
+
+		CREATE TABLE email_verifications (
+			token_hash TEXT PRIMARY KEY, -- hex sha256 of the token
+			user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			kind TEXT NOT NULL CHECK (kind IN ('verify', 'revert')),
+			email TEXT NOT NULL, -- verify: the address being confirmed, revert: the address to go back to
+			created_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT, -- unix seconds
+			expires_at BIGINT NOT NULL -- unix seconds
+		);
+
+		CREATE INDEX email_verifications_user_id ON email_verifications(user_id);
+
+		DROP VIEW users_view;
+
+		CREATE VIEW users_view AS SELECT
+			user_id,
+			email,
+			email_verified,
+			mc_uuid,
+			discord_id,
+			password_hash,
+			stripe_connect,
+			cape_enabled, --TODO invert this to "incognito"
+			legacy_enabled,
+			legacy,
+			ARRAY(
+				SELECT role_id FROM user_roles
+				WHERE user_roles.user_id = users.user_id AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW()))
+				ORDER BY role_id
+			) AS roles,
+			ARRAY(
+				SELECT COALESCE(expires_at, 0) FROM user_roles
+				WHERE user_roles.user_id = users.user_id AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW()))
+				ORDER BY role_id
+			) AS role_expiry,
+			customizations.icon AS custom_icon,
+			customizations.cape AS custom_cape,
+			customizations.text_color AS custom_text_color,
+			customizations.bg_color AS custom_bg_color,
+			customizations.border_color AS custom_border_color,
+			customizations.edition_icon AS custom_edition_icon,
+			customizations.edition_text AS custom_edition_text,
+			customizations.edition_text_color AS custom_edition_text_color,
+			user_cosmetics.cape AS chosen_cape,
+			user_cosmetics.icon AS chosen_icon,
+			user_cosmetics.text_color AS chosen_text_color,
+			user_cosmetics.bg_color AS chosen_bg_color,
+			user_cosmetics.border_color AS chosen_border_color
+			FROM users
+			LEFT OUTER JOIN customizations USING (user_id)
+			LEFT OUTER JOIN user_cosmetics USING (user_id);
+	`,
+	down: `
+		DROP VIEW users_view;
+
+		CREATE VIEW users_view AS SELECT
+			user_id,
+			email,
+			mc_uuid,
+			discord_id,
+			password_hash,
+			stripe_connect,
+			cape_enabled, --TODO invert this to "incognito"
+			legacy_enabled,
+			legacy,
+			ARRAY(
+				SELECT role_id FROM user_roles
+				WHERE user_roles.user_id = users.user_id AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW()))
+				ORDER BY role_id
+			) AS roles,
+			ARRAY(
+				SELECT COALESCE(expires_at, 0) FROM user_roles
+				WHERE user_roles.user_id = users.user_id AND (expires_at IS NULL OR expires_at > EXTRACT(EPOCH FROM NOW()))
+				ORDER BY role_id
+			) AS role_expiry,
+			customizations.icon AS custom_icon,
+			customizations.cape AS custom_cape,
+			customizations.text_color AS custom_text_color,
+			customizations.bg_color AS custom_bg_color,
+			customizations.border_color AS custom_border_color,
+			customizations.edition_icon AS custom_edition_icon,
+			customizations.edition_text AS custom_edition_text,
+			customizations.edition_text_color AS custom_edition_text_color,
+			user_cosmetics.cape AS chosen_cape,
+			user_cosmetics.icon AS chosen_icon,
+			user_cosmetics.text_color AS chosen_text_color,
+			user_cosmetics.bg_color AS chosen_bg_color,
+			user_cosmetics.border_color AS chosen_border_color
+			FROM users
+			LEFT OUTER JOIN customizations USING (user_id)
+			LEFT OUTER JOIN user_cosmetics USING (user_id);
+
+		DROP TABLE email_verifications;
+
+		ALTER TABLE users
+			DROP COLUMN email_verified;
+	`,
+}
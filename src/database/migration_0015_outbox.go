@@ -0,0 +1,28 @@
+package database
+
+// migration0015 adds the outbox, for side effects that have to happen once a transaction commits
+var migration0015 = migration{
+	version: 15,
+	name:    "outbox",
+	up: `
+		CREATE TABLE outbox_jobs (
+			job_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			kind TEXT NOT NULL, -- which handler runs the job, e.g. "discord.donation_log"
+			payload JSONB NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'done', 'dead')),
+			attempts INT NOT NULL DEFAULT 0,
+			max_attempts INT NOT NULL,
+			run_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT, -- unix seconds, when the job should next be tried
+			locked_until BIGINT, -- unix seconds, a running job whose worker died can be picked up again after this
+			last_error TEXT,
+			created_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT, -- unix seconds
+			finished_at BIGINT -- unix seconds, when the job succeeded or was given up on
+		);
+
+		CREATE INDEX outbox_jobs_due ON outbox_jobs(run_at) WHERE status IN ('pending', 'running');
+		CREATE INDEX outbox_jobs_status ON outbox_jobs(status, created_at);
+	`,
+	down: `
+		DROP TABLE outbox_jobs;
+	`,
+}
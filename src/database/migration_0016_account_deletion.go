@@ -0,0 +1,38 @@
+package database
+
+// migration0016 lets users delete their account. Foreign keys that would stop a user being deleted now
+// cascade or go NULL, and donations are kept for accounting but can have their personal details removed.
+var migration0016 = migration{
+	version: 16,
+	name:    "account_deletion",
+	up: `
+		ALTER TABLE password_resets
+			DROP CONSTRAINT IF EXISTS password_resets_user_id_fkey,
+			ADD CONSTRAINT password_resets_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE;
+
+		ALTER TABLE pending_donations
+			DROP CONSTRAINT IF EXISTS pending_donations_used_by_fkey,
+			ADD CONSTRAINT pending_donations_used_by_fkey FOREIGN KEY (used_by) REFERENCES users(user_id) ON DELETE SET NULL,
+			ADD COLUMN anonymized_at BIGINT; -- unix seconds, when the payer's details were removed because their account was deleted
+
+		CREATE TABLE account_deletions (
+			user_id UUID PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+			requested_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT, -- unix seconds
+			delete_at BIGINT NOT NULL -- unix seconds, the user can cancel until then
+		);
+
+		CREATE INDEX account_deletions_delete_at ON account_deletions(delete_at);
+	`,
+	down: `
+		DROP TABLE account_deletions;
+
+		ALTER TABLE pending_donations
+			DROP COLUMN anonymized_at,
+			DROP CONSTRAINT pending_donations_used_by_fkey,
+			ADD CONSTRAINT pending_donations_used_by_fkey FOREIGN KEY (used_by) REFERENCES users(user_id);
+
+		ALTER TABLE password_resets
+			DROP CONSTRAINT password_resets_user_id_fkey,
+			ADD CONSTRAINT password_resets_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(user_id);
+	`,
+}
@@ -0,0 +1,32 @@
+package database
+
+// migration0017 adds recurring premium subscriptions, paid through stripe billing
+var migration0017 = migration{
+	version: 17,
+	name:    "subscriptions",
+	up: `
+		CREATE TABLE stripe_customers (
+			user_id UUID PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+			stripe_customer_id TEXT NOT NULL UNIQUE,
+			created_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT -- unix seconds
+		);
+
+		CREATE TABLE subscriptions (
+			stripe_subscription_id TEXT PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			status TEXT NOT NULL, -- as reported by stripe, e.g. active, past_due or canceled
+			billing_interval TEXT NOT NULL CHECK (billing_interval IN ('month', 'year')),
+			current_period_end BIGINT NOT NULL, -- unix seconds
+			cancel_at_period_end BOOL NOT NULL DEFAULT FALSE,
+			premium_until BIGINT, -- unix seconds, how far the subscription has extended the user's premium
+			created_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT, -- unix seconds
+			updated_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT -- unix seconds
+		);
+
+		CREATE INDEX subscriptions_user_id ON subscriptions(user_id);
+	`,
+	down: `
+		DROP TABLE subscriptions;
+		DROP TABLE stripe_customers;
+	`,
+}
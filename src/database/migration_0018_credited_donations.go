@@ -0,0 +1,13 @@
+package database
+
+// migration0018 marks donations that were made while logged in, they go straight to the account instead of through a token
+var migration0018 = migration{
+	version: 18,
+	name:    "credited_donations",
+	up: `
+		ALTER TABLE pending_donations ADD COLUMN credited BOOL NOT NULL DEFAULT FALSE;
+	`,
+	down: `
+		ALTER TABLE pending_donations DROP COLUMN credited;
+	`,
+}
@@ -0,0 +1,19 @@
+package database
+
+// migration0019 caches the day's exchange rates, so every instance converts premium thresholds the same way
+var migration0019 = migration{
+	version: 19,
+	name:    "exchange_rates",
+	up: `
+		CREATE TABLE exchange_rates (
+			-- Lowercase ISO 4217 code, like stripe uses
+			currency   TEXT PRIMARY KEY,
+			-- How much of the currency one US dollar buys, in its major unit
+			per_usd    DOUBLE PRECISION NOT NULL CHECK (per_usd > 0),
+			updated_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT
+		);
+	`,
+	down: `
+		DROP TABLE exchange_rates;
+	`,
+}
@@ -0,0 +1,47 @@
+package database
+
+// migration0020 replaces the single premium threshold with a table of donation tiers, each granting its own roles
+var migration0020 = migration{
+	version: 20,
+	name:    "donation_tiers",
+	up: `
+		CREATE TABLE donation_tiers (
+			tier_id    TEXT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			-- Shown on the donate page, e.g. 'Custom cape'
+			perks      TEXT[] NOT NULL DEFAULT '{}',
+			-- The minimum donation in US cents, other currencies are converted at the day's exchange rate
+			usd_amount BIGINT NOT NULL UNIQUE CHECK (usd_amount > 0),
+			created_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM NOW())::BIGINT
+		);
+
+		-- Thresholds for specific currencies, in their minor unit, used instead of converting usd_amount
+		CREATE TABLE donation_tier_amounts (
+			tier_id  TEXT NOT NULL REFERENCES donation_tiers(tier_id) ON DELETE CASCADE,
+			currency TEXT NOT NULL,
+			amount   BIGINT NOT NULL CHECK (amount > 0),
+			PRIMARY KEY (tier_id, currency)
+		);
+
+		CREATE TABLE donation_tier_roles (
+			tier_id  TEXT NOT NULL REFERENCES donation_tiers(tier_id) ON DELETE CASCADE,
+			role_id  TEXT NOT NULL REFERENCES roles(role_id) ON DELETE CASCADE,
+			-- Seconds the role lasts once the donation is redeemed, NULL means forever
+			duration BIGINT CHECK (duration > 0),
+			PRIMARY KEY (tier_id, role_id)
+		);
+
+		-- Every donation so far was for premium, forever
+		INSERT INTO donation_tiers (tier_id, name, perks, usd_amount) VALUES ('premium', 'Premium', '{"Nightly builds", "In-game perks", "Custom cape upload"}', 500);
+		INSERT INTO donation_tier_roles (tier_id, role_id) VALUES ('premium', 'premium');
+
+		-- The tier the donation qualified for, NULL if it was below every tier
+		ALTER TABLE pending_donations ADD COLUMN tier_id TEXT REFERENCES donation_tiers(tier_id) ON DELETE SET NULL;
+	`,
+	down: `
+		ALTER TABLE pending_donations DROP COLUMN tier_id;
+		DROP TABLE donation_tier_roles;
+		DROP TABLE donation_tier_amounts;
+		DROP TABLE donation_tiers;
+	`,
+}
@@ -0,0 +1,14 @@
+package database
+
+// migration0021 moves the roles entitled to custom nametag colors out of the code, so new roles can be given the perk
+var migration0021 = migration{
+	version: 21,
+	name:    "role_nametag_perk",
+	up: `
+		ALTER TABLE roles ADD COLUMN custom_nametag BOOLEAN NOT NULL DEFAULT FALSE;
+		UPDATE roles SET custom_nametag = TRUE WHERE role_id IN ('premium', 'pepsi', 'spawnmason', 'staff', 'developer');
+	`,
+	down: `
+		ALTER TABLE roles DROP COLUMN custom_nametag;
+	`,
+}
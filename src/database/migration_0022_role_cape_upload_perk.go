@@ -0,0 +1,14 @@
+package database
+
+// migration0022 moves the roles entitled to upload their own cape out of the code, so new roles can be given the perk
+var migration0022 = migration{
+	version: 22,
+	name:    "role_cape_upload_perk",
+	up: `
+		ALTER TABLE roles ADD COLUMN cape_upload BOOLEAN NOT NULL DEFAULT FALSE;
+		UPDATE roles SET cape_upload = TRUE WHERE role_id IN ('premium', 'pepsi', 'spawnmason', 'staff', 'developer');
+	`,
+	down: `
+		ALTER TABLE roles DROP COLUMN cape_upload;
+	`,
+}
@@ -0,0 +1,20 @@
+package database
+
+// migration0023 gives donations an id that can be passed around without being redeemable, and scrubs the outbox jobs
+// that were queued with a registration token or a discord access token in their payload
+var migration0023 = migration{
+	version: 23,
+	name:    "outbox_secrets",
+	up: `
+		ALTER TABLE pending_donations ADD COLUMN donation_id UUID NOT NULL UNIQUE DEFAULT gen_random_uuid();
+
+		UPDATE outbox_jobs SET payload = (outbox_jobs.payload - 'token') || jsonb_build_object('donation_id', pending_donations.donation_id)
+		FROM pending_donations
+		WHERE outbox_jobs.kind IN ('discord.donation_log', 'email.receipt') AND outbox_jobs.payload->>'token' = pending_donations.token::TEXT;
+		UPDATE outbox_jobs SET payload = payload - 'token' WHERE kind IN ('discord.donation_log', 'email.receipt');
+		UPDATE outbox_jobs SET payload = payload - 'discord_token' WHERE kind = 'discord.registered';
+	`,
+	down: `
+		ALTER TABLE pending_donations DROP COLUMN donation_id;
+	`,
+}
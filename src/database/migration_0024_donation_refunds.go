@@ -0,0 +1,19 @@
+package database
+
+// migration0024 remembers which donations created the account that redeemed them, so that refunding one only deletes
+// accounts that wouldn't exist without it, and which donations have been refunded, so that providers retrying the
+// refund webhook don't take the roles back twice. Older donations can't be told apart, so their accounts are kept.
+var migration0024 = migration{
+	version: 24,
+	name:    "donation_refunds",
+	up: `
+		ALTER TABLE pending_donations
+			ADD COLUMN created_user BOOL NOT NULL DEFAULT FALSE,
+			ADD COLUMN refunded BOOL NOT NULL DEFAULT FALSE;
+	`,
+	down: `
+		ALTER TABLE pending_donations
+			DROP COLUMN created_user,
+			DROP COLUMN refunded;
+	`,
+}
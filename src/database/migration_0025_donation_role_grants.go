@@ -0,0 +1,19 @@
+package database
+
+// migration0025 remembers what each of a donation's roles looked like for the user before they redeemed it, so that
+// refunding a donation that gave a role forever puts back what the user had rather than deleting the role outright.
+// Donations redeemed before this can't be told apart, so refunding them leaves their permanent roles alone.
+var migration0025 = migration{
+	version: 25,
+	name:    "donation_role_grants",
+	up: `
+		ALTER TABLE pending_donation_roles
+			ADD COLUMN granted BOOL NOT NULL DEFAULT FALSE,
+			ADD COLUMN previous_expires_at BIGINT;
+	`,
+	down: `
+		ALTER TABLE pending_donation_roles
+			DROP COLUMN granted,
+			DROP COLUMN previous_expires_at;
+	`,
+}
@@ -0,0 +1,15 @@
+package database
+
+// migration0026 deletes installer analytics and github download count jobs, which are no longer sent through the
+// outbox. Nothing would run them any more, and their payloads include the downloader's ip and user agent.
+var migration0026 = migration{
+	version: 26,
+	name:    "drop_installer_jobs",
+	up: `
+		DELETE FROM outbox_jobs WHERE kind IN ('installer.analytics', 'installer.github_download');
+	`,
+	down: `
+		-- The jobs were only fire-and-forget pings, there's nothing worth putting back
+		SELECT 1;
+	`,
+}
@@ -0,0 +1,38 @@
+package database
+
+// migration0027 moves which roles can choose each catalog cape and icon out of the code, so new roles can be given them
+var migration0027 = migration{
+	version: 27,
+	name:    "role_cosmetics",
+	up: `
+		CREATE TABLE role_cosmetics (
+			role_id TEXT NOT NULL REFERENCES roles(role_id) ON DELETE CASCADE,
+			kind TEXT NOT NULL CHECK (kind IN ('cape', 'icon')),
+			cosmetic_id TEXT NOT NULL, -- catalog id, see users.capes and users.icons
+			PRIMARY KEY (role_id, kind, cosmetic_id)
+		);
+
+		INSERT INTO role_cosmetics (role_id, kind, cosmetic_id)
+		SELECT role_id, kind, cosmetic_id FROM (VALUES
+			('premium', 'cape', 'premium'),
+			('staff', 'cape', 'premium'),
+			('developer', 'cape', 'premium'),
+			('staff', 'cape', 'staff'),
+			('developer', 'cape', 'developer'),
+			('pepsi', 'cape', 'pepsi'),
+			('spawnmason', 'cape', 'spawnmason'),
+			('pepsi', 'icon', 'pepsi'),
+			('spawnmason', 'icon', 'spawnmason')
+		) AS entitlements (role_id, kind, cosmetic_id)
+		WHERE EXISTS (SELECT 1 FROM roles WHERE roles.role_id = entitlements.role_id);
+
+		-- Roles are reloaded on any statement level notification, see database.UsersResync
+		CREATE TRIGGER role_cosmetics_update_trigger
+		AFTER INSERT OR UPDATE OR DELETE ON role_cosmetics
+		FOR EACH STATEMENT
+		EXECUTE PROCEDURE notify_users_updated();
+	`,
+	down: `
+		DROP TABLE role_cosmetics;
+	`,
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// OAuthClient is a row in the oauth_clients table
+type OAuthClient struct {
+	ID           string   `json:"client_id"`
+	Name         string   `json:"name"`
+	SecretHash   string   `json:"-"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	CreatedAt    int64    `json:"created_at"`
+}
+
+// Confidential returns true if the client has a secret, i.e. it is a server rather than an app
+func (client OAuthClient) Confidential() bool {
+	return client.SecretHash != ""
+}
+
+// OAuthCode is a row in the oauth_codes table
+type OAuthCode struct {
+	ClientID      string
+	UserID        uuid.UUID
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     int64
+}
+
+func scanOAuthClient(row rowScanner) (*OAuthClient, error) {
+	var (
+		client       OAuthClient
+		secretHash   sql.NullString
+		redirectURIs pq.StringArray
+		scopes       pq.StringArray
+	)
+	err := row.Scan(&client.ID, &client.Name, &secretHash, &redirectURIs, &scopes, &client.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	client.SecretHash = secretHash.String
+	client.RedirectURIs = redirectURIs
+	client.Scopes = scopes
+	return &client, nil
+}
+
+// CreateOAuthClient registers a new client application
+func CreateOAuthClient(client OAuthClient) error {
+	_, err := DB.Exec(`INSERT INTO oauth_clients (client_id, name, secret_hash, redirect_uris, scopes) VALUES ($1, $2, $3, $4, $5)`,
+		client.ID, client.Name, nullString(client.SecretHash), pq.StringArray(client.RedirectURIs), pq.StringArray(client.Scopes))
+	return err
+}
+
+// GetOAuthClients returns every registered client application
+func GetOAuthClients() ([]OAuthClient, error) {
+	rows, err := DB.Query(`SELECT client_id, name, secret_hash, redirect_uris, scopes, created_at FROM oauth_clients ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]OAuthClient, 0)
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *client)
+	}
+	return ret, rows.Err()
+}
+
+// GetOAuthClient returns the client with the given id, or nil if there isn't one
+func GetOAuthClient(id string) (*OAuthClient, error) {
+	client, err := scanOAuthClient(DB.QueryRow(`SELECT client_id, name, secret_hash, redirect_uris, scopes, created_at FROM oauth_clients WHERE client_id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return client, err
+}
+
+// DeleteOAuthClient removes a client application, returning false if it didn't exist
+func DeleteOAuthClient(id string) (bool, error) {
+	result, err := DB.Exec(`DELETE FROM oauth_clients WHERE client_id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// CreateOAuthCode stores an authorization code, only its hash is kept
+func CreateOAuthCode(codeHash string, code OAuthCode) error {
+	_, err := DB.Exec(`
+		INSERT INTO oauth_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		codeHash, code.ClientID, code.UserID, code.RedirectURI, pq.StringArray(code.Scopes), code.CodeChallenge, code.ExpiresAt)
+	return err
+}
+
+// ConsumeOAuthCode deletes and returns the authorization code, so that it can only be used once.
+// Returns nil if the code doesn't exist or has expired.
+func ConsumeOAuthCode(codeHash string) (*OAuthCode, error) {
+	var (
+		code   OAuthCode
+		scopes pq.StringArray
+	)
+	err := DB.QueryRow(`
+		DELETE FROM oauth_codes WHERE code_hash = $1
+		RETURNING client_id, user_id, redirect_uri, scopes, code_challenge, expires_at`, codeHash).
+		Scan(&code.ClientID, &code.UserID, &code.RedirectURI, &scopes, &code.CodeChallenge, &code.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > code.ExpiresAt {
+		return nil, nil
+	}
+	code.Scopes = scopes
+	return &code, nil
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Outbox job statuses, see the outbox_jobs.status check constraint
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	// JobDead jobs ran out of attempts, they stay until someone replays them or they're too old to be worth replaying
+	JobDead = "dead"
+)
+
+// Job is a row in the outbox_jobs table
+type Job struct {
+	ID          uuid.UUID       `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       int64           `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   int64           `json:"created_at"`
+	FinishedAt  *int64          `json:"finished_at,omitempty"`
+}
+
+const jobColumns = `job_id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at, finished_at`
+
+func scanJob(row rowScanner) (*Job, error) {
+	var (
+		job        Job
+		payload    []byte
+		lastError  sql.NullString
+		finishedAt sql.NullInt64
+	)
+	err := row.Scan(&job.ID, &job.Kind, &payload, &job.Status, &job.Attempts, &job.MaxAttempts, &job.RunAt, &lastError, &job.CreatedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+	job.Payload = payload
+	job.LastError = lastError.String
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Int64
+	}
+	return &job, nil
+}
+
+// EnqueueJob adds a job to the outbox. Pass the transaction making the change the job is about,
+// so that the job only exists if the change is committed.
+func EnqueueJob(tx execer, kind string, payload interface{}, maxAttempts int) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO outbox_jobs (kind, payload, max_attempts) VALUES ($1, $2, $3)`, kind, data, maxAttempts)
+	return err
+}
+
+// ClaimJob marks the next due job as running, returning nil if there isn't one.
+// If the job isn't finished within lease, another worker may claim it again.
+func ClaimJob(lease time.Duration) (*Job, error) {
+	now := time.Now().Unix()
+	job, err := scanJob(DB.QueryRow(`
+		UPDATE outbox_jobs SET status = $1, attempts = attempts + 1, locked_until = $3
+		WHERE job_id = (
+			SELECT job_id FROM outbox_jobs
+			WHERE (status = $4 OR status = $1) AND COALESCE(locked_until, run_at) <= $2
+			ORDER BY run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns,
+		JobRunning, now, now+int64(lease/time.Second), JobPending))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// CompleteJob marks a job as done
+func CompleteJob(id uuid.UUID) error {
+	_, err := DB.Exec(`UPDATE outbox_jobs SET status = $2, locked_until = NULL, last_error = NULL, finished_at = EXTRACT(EPOCH FROM NOW())::BIGINT WHERE job_id = $1`, id, JobDone)
+	return err
+}
+
+// RetryJob records why a job failed and puts it back in the queue to be tried again at runAt
+func RetryJob(id uuid.UUID, reason string, runAt time.Time) error {
+	_, err := DB.Exec(`UPDATE outbox_jobs SET status = $2, locked_until = NULL, last_error = $3, run_at = $4 WHERE job_id = $1`, id, JobPending, reason, runAt.Unix())
+	return err
+}
+
+// KillJob records why a job failed and gives up on it
+func KillJob(id uuid.UUID, reason string) error {
+	_, err := DB.Exec(`UPDATE outbox_jobs SET status = $2, locked_until = NULL, last_error = $3, finished_at = EXTRACT(EPOCH FROM NOW())::BIGINT WHERE job_id = $1`, id, JobDead, reason)
+	return err
+}
+
+// ReplayJob gives a dead job a fresh set of attempts, starting now. Returns false if the job isn't dead.
+func ReplayJob(id uuid.UUID) (bool, error) {
+	res, err := DB.Exec(`UPDATE outbox_jobs SET status = $2, attempts = 0, run_at = EXTRACT(EPOCH FROM NOW())::BIGINT, finished_at = NULL WHERE job_id = $1 AND status = $3`, id, JobPending, JobDead)
+	if err != nil {
+		return false, err
+	}
+	count, err := res.RowsAffected()
+	return count > 0, err
+}
+
+// DeleteFinishedJobs removes successful jobs that finished before the given time. Dead jobs are kept for inspection.
+func DeleteFinishedJobs(before time.Time) error {
+	_, err := DB.Exec(`DELETE FROM outbox_jobs WHERE status = $1 AND finished_at < $2`, JobDone, before.Unix())
+	return err
+}
+
+// DeleteDeadJobs removes dead jobs that died before the given time
+func DeleteDeadJobs(before time.Time) error {
+	_, err := DB.Exec(`DELETE FROM outbox_jobs WHERE status = $1 AND finished_at < $2`, JobDead, before.Unix())
+	return err
+}
+
+// GetJob returns the job, or nil if it doesn't exist
+func GetJob(id uuid.UUID) (*Job, error) {
+	job, err := scanJob(DB.QueryRow(`SELECT `+jobColumns+` FROM outbox_jobs WHERE job_id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// GetJobs returns the most recent jobs with the given status, or of any status if it's empty
+func GetJobs(status string, limit int) ([]Job, error) {
+	rows, err := DB.Query(`SELECT `+jobColumns+` FROM outbox_jobs WHERE $1 = '' OR status = $1 ORDER BY created_at DESC LIMIT $2`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := make([]Job, 0)
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// CountJobs returns how many jobs there are with each status
+func CountJobs() (map[string]int, error) {
+	rows, err := DB.Query(`SELECT status, COUNT(*) FROM outbox_jobs GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := map[string]int{JobPending: 0, JobRunning: 0, JobDone: 0, JobDead: 0}
+	for rows.Next() {
+		var (
+			status string
+			count  int
+		)
+		err = rows.Scan(&status, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+	return counts, rows.Err()
+}
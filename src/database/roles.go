@@ -0,0 +1,111 @@
+package database
+
+import (
+	"log"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// roleRow is a row in the roles table
+type roleRow struct {
+	id             string
+	rank           int
+	legacyList     bool
+	tokenGrantable bool
+	customNametag  bool
+	capeUpload     bool
+	capes          pq.StringArray
+	icons          pq.StringArray
+	defaults       customizationColumns
+}
+
+func (role *roleRow) scan(row rowScanner) error {
+	d := &role.defaults
+	return row.Scan(&role.id, &role.rank, &role.legacyList, &role.tokenGrantable, &role.customNametag, &role.capeUpload, &role.capes, &role.icons, &d.icon, &d.cape, &d.textColor, &d.bgColor, &d.borderColor, &d.editionIcon, &d.editionText, &d.editionTextColor)
+}
+
+// makeRole converts a roleRow into a users.Role
+func (role *roleRow) makeRole() users.Role {
+	var defaults users.Customization
+	if c := role.defaults.makeCustomization(); c != nil {
+		defaults = *c
+	}
+	ret := users.NewRole(role.id, role.rank, role.legacyList, role.tokenGrantable, defaults.Info, defaults.Edition)
+	ret.CustomNametag = role.customNametag
+	ret.CapeUpload = role.capeUpload
+	ret.Capes = role.capes
+	ret.Icons = role.icons
+	return ret
+}
+
+// loadRoles reads the roles table and replaces the known roles in the users package
+func loadRoles() error {
+	rows, err := DB.Query(`
+		SELECT
+			role_id, rank, legacy_list, token_grantable, custom_nametag, cape_upload,
+			ARRAY(SELECT cosmetic_id FROM role_cosmetics WHERE role_cosmetics.role_id = roles.role_id AND kind = 'cape' ORDER BY cosmetic_id),
+			ARRAY(SELECT cosmetic_id FROM role_cosmetics WHERE role_cosmetics.role_id = roles.role_id AND kind = 'icon' ORDER BY cosmetic_id),
+			icon, cape, text_color, bg_color, border_color, edition_icon, edition_text, edition_text_color
+		FROM roles`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var roles []users.Role
+	for rows.Next() {
+		var r roleRow
+		err = r.scan(rows)
+		if err != nil {
+			return err
+		}
+		roles = append(roles, r.makeRole())
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	users.SetRoles(roles)
+	return nil
+}
+
+// refreshRoles reloads the roles, logging any errors instead of returning them
+func refreshRoles() {
+	err := loadRoles()
+	if err != nil {
+		log.Println("Unable to load roles", err)
+	}
+}
+
+// ExpiredRole is a role grant that has been revoked because it expired
+type ExpiredRole struct {
+	UserID uuid.UUID
+	RoleID string
+}
+
+// ExpireRoles deletes any role grants that have expired and returns them
+func ExpireRoles() ([]ExpiredRole, error) {
+	if DB == nil {
+		return nil, nil
+	}
+
+	rows, err := DB.Query(`DELETE FROM user_roles WHERE expires_at <= EXTRACT(EPOCH FROM NOW()) RETURNING user_id, role_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expired []ExpiredRole
+	for rows.Next() {
+		var e ExpiredRole
+		err = rows.Scan(&e.UserID, &e.RoleID)
+		if err != nil {
+			return nil, err
+		}
+		expired = append(expired, e)
+	}
+	return expired, rows.Err()
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrSessionNotFound means the session doesn't exist, has expired, or the refresh token is wrong
+var ErrSessionNotFound = errors.New("session not found")
+
+// ErrRefreshTokenReused means an old refresh token was used again. The session is revoked when this happens,
+// since either the client or an attacker is holding a stolen token.
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+// Session is a row in the sessions table
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserID     uuid.UUID `json:"-"`
+	CreatedAt  int64     `json:"created_at"`
+	LastUsedAt int64     `json:"last_used_at"`
+	ExpiresAt  int64     `json:"expires_at"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+	// TwoFactor is true if the session was started using a second factor
+	TwoFactor bool `json:"two_factor"`
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+const sessionColumns = `session_id, user_id, created_at, last_used_at, expires_at, user_agent, ip_address, two_factor`
+
+func scanSession(row rowScanner) (*Session, error) {
+	var (
+		session   Session
+		userAgent sql.NullString
+		ipAddress sql.NullString
+	)
+	err := row.Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &userAgent, &ipAddress, &session.TwoFactor)
+	if err != nil {
+		return nil, err
+	}
+	session.UserAgent = userAgent.String
+	session.IPAddress = ipAddress.String
+	return &session, nil
+}
+
+// CreateSession starts a new session for the user, also cleaning up any of their sessions that have expired
+func CreateSession(userID uuid.UUID, refreshHash string, expiresAt time.Time, userAgent string, ipAddress string, twoFactor bool) (*Session, error) {
+	_, err := DB.Exec(`DELETE FROM sessions WHERE user_id = $1 AND expires_at < EXTRACT(EPOCH FROM NOW())`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanSession(DB.QueryRow(`
+		INSERT INTO sessions (user_id, refresh_hash, expires_at, user_agent, ip_address, two_factor) VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+sessionColumns,
+		userID, refreshHash, expiresAt.Unix(), nullString(userAgent), nullString(ipAddress), twoFactor))
+}
+
+// RotateSession replaces the session's refresh token, so long as refreshHash matches the current one
+func RotateSession(sessionID uuid.UUID, refreshHash string, newHash string, expiresAt time.Time, userAgent string, ipAddress string) (*Session, error) {
+	session, err := scanSession(DB.QueryRow(`
+		UPDATE sessions SET
+			refresh_hash = $3,
+			previous_hash = refresh_hash,
+			expires_at = $4,
+			last_used_at = EXTRACT(EPOCH FROM NOW())::BIGINT,
+			user_agent = $5,
+			ip_address = $6
+		WHERE session_id = $1 AND refresh_hash = $2 AND expires_at > EXTRACT(EPOCH FROM NOW())
+		RETURNING `+sessionColumns,
+		sessionID, refreshHash, newHash, expiresAt.Unix(), nullString(userAgent), nullString(ipAddress)))
+	if err != sql.ErrNoRows {
+		return session, err
+	}
+
+	// Either the session is gone, or this is an old refresh token being replayed
+	result, err := DB.Exec(`DELETE FROM sessions WHERE session_id = $1 AND previous_hash = $2`, sessionID, refreshHash)
+	if err != nil {
+		return nil, err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows > 0 {
+		return nil, ErrRefreshTokenReused
+	}
+	return nil, ErrSessionNotFound
+}
+
+// IsSessionActive returns true if the session exists, belongs to the user and hasn't expired
+func IsSessionActive(sessionID uuid.UUID, userID uuid.UUID) (active bool, err error) {
+	err = DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM sessions WHERE session_id = $1 AND user_id = $2 AND expires_at > EXTRACT(EPOCH FROM NOW()))`, sessionID, userID).Scan(&active)
+	return
+}
+
+// GetUserSessions returns the user's active sessions, most recently used first
+func GetUserSessions(userID uuid.UUID) ([]Session, error) {
+	rows, err := DB.Query(`SELECT `+sessionColumns+` FROM sessions WHERE user_id = $1 AND expires_at > EXTRACT(EPOCH FROM NOW()) ORDER BY last_used_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]Session, 0)
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *session)
+	}
+	return ret, rows.Err()
+}
+
+// DeleteSession revokes one of the user's sessions, returning false if they didn't have it
+func DeleteSession(userID uuid.UUID, sessionID uuid.UUID) (bool, error) {
+	result, err := DB.Exec(`DELETE FROM sessions WHERE user_id = $1 AND session_id = $2`, userID, sessionID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// DeleteUserSessions revokes all of the user's sessions, except for keep if it isn't uuid.Nil.
+// db can be either DB or a transaction.
+func DeleteUserSessions(db execer, userID uuid.UUID, keep uuid.UUID) error {
+	_, err := db.Exec(`DELETE FROM sessions WHERE user_id = $1 AND session_id <> $2`, userID, keep)
+	return err
+}
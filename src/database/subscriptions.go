@@ -0,0 +1,201 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Subscription is a recurring premium subscription, mirrored from stripe
+type Subscription struct {
+	ID                string    `json:"id"`
+	UserID            uuid.UUID `json:"-"`
+	Status            string    `json:"status"`
+	Interval          string    `json:"interval"`
+	CurrentPeriodEnd  int64     `json:"current_period_end"`
+	CancelAtPeriodEnd bool      `json:"cancel_at_period_end"`
+	// PremiumUntil is how far the subscription has extended the user's premium, nil if it never has
+	PremiumUntil *int64 `json:"-"`
+}
+
+const subscriptionColumns = `stripe_subscription_id, user_id, status, billing_interval, current_period_end, cancel_at_period_end, premium_until`
+
+func scanSubscription(row rowScanner) (*Subscription, error) {
+	var (
+		sub          Subscription
+		premiumUntil sql.NullInt64
+	)
+	err := row.Scan(&sub.ID, &sub.UserID, &sub.Status, &sub.Interval, &sub.CurrentPeriodEnd, &sub.CancelAtPeriodEnd, &premiumUntil)
+	if err != nil {
+		return nil, err
+	}
+	if premiumUntil.Valid {
+		sub.PremiumUntil = &premiumUntil.Int64
+	}
+	return &sub, nil
+}
+
+// GetStripeCustomer returns the user's stripe customer id, or an empty string if they don't have one yet
+func GetStripeCustomer(userID uuid.UUID) (customerID string, err error) {
+	err = DB.QueryRow(`SELECT stripe_customer_id FROM stripe_customers WHERE user_id = $1`, userID).Scan(&customerID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return
+}
+
+// SetStripeCustomer remembers which stripe customer belongs to the user
+func SetStripeCustomer(userID uuid.UUID, customerID string) error {
+	_, err := DB.Exec(`
+		INSERT INTO stripe_customers (user_id, stripe_customer_id) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET stripe_customer_id = EXCLUDED.stripe_customer_id`, userID, customerID)
+	return err
+}
+
+// LookupUserByStripeCustomer returns the id of the user the stripe customer belongs to, or uuid.Nil if there isn't one
+func LookupUserByStripeCustomer(customerID string) (userID uuid.UUID, err error) {
+	err = DB.QueryRow(`SELECT user_id FROM stripe_customers WHERE stripe_customer_id = $1`, customerID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, nil
+	}
+	return
+}
+
+// GetSubscription returns the subscription, or nil if we haven't seen it before. The row is locked until tx is done.
+func GetSubscription(tx *sql.Tx, id string) (*Subscription, error) {
+	sub, err := scanSubscription(tx.QueryRow(`SELECT `+subscriptionColumns+` FROM subscriptions WHERE stripe_subscription_id = $1 FOR UPDATE`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sub, err
+}
+
+// GetUserSubscriptions returns the user's subscriptions, newest first
+func GetUserSubscriptions(userID uuid.UUID) ([]Subscription, error) {
+	rows, err := DB.Query(`SELECT `+subscriptionColumns+` FROM subscriptions WHERE user_id = $1 ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := make([]Subscription, 0)
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *sub)
+	}
+	return ret, rows.Err()
+}
+
+// SaveSubscription creates or updates the subscription, PremiumUntil is left alone
+func SaveSubscription(db execer, sub Subscription) error {
+	_, err := db.Exec(`
+		INSERT INTO subscriptions (stripe_subscription_id, user_id, status, billing_interval, current_period_end, cancel_at_period_end)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (stripe_subscription_id) DO UPDATE SET
+			status = EXCLUDED.status,
+			billing_interval = EXCLUDED.billing_interval,
+			current_period_end = EXCLUDED.current_period_end,
+			cancel_at_period_end = EXCLUDED.cancel_at_period_end,
+			updated_at = EXTRACT(EPOCH FROM NOW())::BIGINT`,
+		sub.ID, sub.UserID, sub.Status, sub.Interval, sub.CurrentPeriodEnd, sub.CancelAtPeriodEnd)
+	return err
+}
+
+// ExtendSubscriptionPremium grants premium until the given time. Like a donation, the extra time stacks on top of
+// any premium the user already has, but a permanent grant always wins.
+func ExtendSubscriptionPremium(tx *sql.Tx, sub Subscription, until int64) error {
+	if sub.PremiumUntil != nil && *sub.PremiumUntil >= until {
+		return nil
+	}
+	has, expires, err := lockPremium(tx, sub.UserID)
+	if err != nil {
+		return err
+	}
+	if expires, ok := extendedExpiry(has, expires, sub.PremiumUntil, until, time.Now().Unix()); ok {
+		_, err = tx.Exec(`
+			INSERT INTO user_roles (user_id, role_id, expires_at) VALUES ($1, 'premium', $2)
+			ON CONFLICT (user_id, role_id) DO UPDATE SET expires_at = EXCLUDED.expires_at`, sub.UserID, expires)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`UPDATE subscriptions SET premium_until = $2 WHERE stripe_subscription_id = $1`, sub.ID, until)
+	return err
+}
+
+// RevokeSubscriptionPremium takes back whatever premium time the subscription granted that hasn't been used yet.
+// Premium the user got some other way is left alone, the role is removed by ExpireRoles if nothing is left.
+func RevokeSubscriptionPremium(tx *sql.Tx, sub Subscription) error {
+	if sub.PremiumUntil == nil {
+		return nil
+	}
+	has, expires, err := lockPremium(tx, sub.UserID)
+	if err != nil {
+		return err
+	}
+	if has && expires != nil {
+		_, err = tx.Exec(`UPDATE user_roles SET expires_at = $2 WHERE user_id = $1 AND role_id = 'premium'`,
+			sub.UserID, revokedExpiry(*expires, *sub.PremiumUntil, time.Now().Unix()))
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`UPDATE subscriptions SET premium_until = NULL WHERE stripe_subscription_id = $1`, sub.ID)
+	return err
+}
+
+// lockPremium returns whether the user has premium and when it expires, nil meaning never. The row is locked until tx is done.
+func lockPremium(tx *sql.Tx, userID uuid.UUID) (has bool, expires *int64, err error) {
+	var expiresAt sql.NullInt64
+	err = tx.QueryRow(`SELECT expires_at FROM user_roles WHERE user_id = $1 AND role_id = 'premium' FOR UPDATE`, userID).Scan(&expiresAt)
+	if err == sql.ErrNoRows {
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	if expiresAt.Valid {
+		expires = &expiresAt.Int64
+	}
+	return true, expires, nil
+}
+
+// extendedExpiry works out when premium should expire once a subscription that had extended it until premiumUntil (nil
+// if it never has) pays up until the given time. has and expires describe the user's premium now. Only the time the
+// subscription hasn't already granted is added, on top of whatever is left. ok is false if nothing needs to change.
+func extendedExpiry(has bool, expires *int64, premiumUntil *int64, until int64, now int64) (newExpires *int64, ok bool) {
+	from := now
+	if premiumUntil != nil && *premiumUntil > from {
+		from = *premiumUntil
+	}
+	extra := until - from
+	if extra <= 0 {
+		return nil, false
+	}
+	if !has {
+		ret := now + extra
+		return &ret, true
+	}
+	if expires == nil {
+		// Permanent premium can't be extended
+		return nil, false
+	}
+	ret := *expires
+	if ret < now {
+		ret = now
+	}
+	ret += extra
+	return &ret, true
+}
+
+// revokedExpiry works out when time-limited premium should expire once a subscription that had extended it until
+// premiumUntil is taken back, only the part of the subscription's time that hasn't been used yet is removed
+func revokedExpiry(expires int64, premiumUntil int64, now int64) int64 {
+	if unused := premiumUntil - now; unused > 0 {
+		return expires - unused
+	}
+	return expires
+}
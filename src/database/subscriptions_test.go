@@ -0,0 +1,69 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionPremiumTimeLimited(t *testing.T) {
+	const (
+		now   = int64(1000000)
+		month = int64(30 * 24 * 60 * 60)
+	)
+	// The user already has a month of premium from a donation
+	donated := now + month
+
+	// The first payment stacks a month on top of it
+	expires, ok := extendedExpiry(true, &donated, nil, now+month, now)
+	require.True(t, ok)
+	assert.Equal(t, now+2*month, *expires)
+	premiumUntil := now + month
+
+	// Webhooks are retried, paying up until the same time again changes nothing
+	_, ok = extendedExpiry(true, expires, &premiumUntil, premiumUntil, now)
+	assert.False(t, ok)
+
+	// Renewing half way through only adds the new month
+	later := now + month/2
+	expires, ok = extendedExpiry(true, expires, &premiumUntil, now+2*month, later)
+	require.True(t, ok)
+	assert.Equal(t, now+3*month, *expires)
+	premiumUntil = now + 2*month
+
+	// Cancelling takes back the unused part of what the subscription granted, leaving the donation alone
+	assert.Equal(t, now+month+month/2, revokedExpiry(*expires, premiumUntil, later))
+	// Once the subscription's time has been used up there's nothing left to take back
+	assert.Equal(t, *expires, revokedExpiry(*expires, premiumUntil, premiumUntil+1))
+}
+
+func TestSubscriptionPremiumExpired(t *testing.T) {
+	const now = int64(1000000)
+
+	// New premium starts now
+	expires, ok := extendedExpiry(false, nil, nil, now+100, now)
+	require.True(t, ok)
+	assert.Equal(t, now+100, *expires)
+
+	// Premium that has already run out isn't stacked on
+	old := now - 50
+	expires, ok = extendedExpiry(true, &old, nil, now+100, now)
+	require.True(t, ok)
+	assert.Equal(t, now+100, *expires)
+
+	// A period that has already ended grants nothing
+	_, ok = extendedExpiry(false, nil, nil, now-1, now)
+	assert.False(t, ok)
+}
+
+func TestSubscriptionPremiumPermanent(t *testing.T) {
+	const now = int64(1000000)
+
+	// Permanent premium is left as it is, whatever the subscription does
+	_, ok := extendedExpiry(true, nil, nil, now+100, now)
+	assert.False(t, ok)
+	premiumUntil := now + 100
+	_, ok = extendedExpiry(true, nil, &premiumUntil, now+200, now)
+	assert.False(t, ok)
+}
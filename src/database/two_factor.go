@@ -0,0 +1,157 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// TOTP is a row in the user_totp table
+type TOTP struct {
+	UserID       uuid.UUID
+	Secret       string
+	CreatedAt    int64
+	EnabledAt    *int64 // nil while enrolment is pending
+	LastUsedStep int64
+}
+
+// Enabled returns true once the user has verified a code, until then the secret can't be used to log in
+func (t TOTP) Enabled() bool {
+	return t.EnabledAt != nil
+}
+
+// GetTOTP returns the user's TOTP secret, or nil if they haven't started enrolling
+func GetTOTP(userID uuid.UUID) (*TOTP, error) {
+	var (
+		totp      TOTP
+		enabledAt sql.NullInt64
+	)
+	err := DB.QueryRow(`SELECT user_id, secret, created_at, enabled_at, last_used_step FROM user_totp WHERE user_id = $1`, userID).
+		Scan(&totp.UserID, &totp.Secret, &totp.CreatedAt, &enabledAt, &totp.LastUsedStep)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt.Valid {
+		totp.EnabledAt = &enabledAt.Int64
+	}
+	return &totp, nil
+}
+
+// HasTwoFactor returns true if the user has finished enrolling in two factor authentication
+func HasTwoFactor(userID uuid.UUID) (enabled bool, err error) {
+	err = DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL)`, userID).Scan(&enabled)
+	return
+}
+
+// StartTOTP stores a new pending TOTP secret for the user, replacing any previous pending one.
+// Returns false if the user already has two factor enabled.
+func StartTOTP(userID uuid.UUID, secret string) (bool, error) {
+	result, err := DB.Exec(`
+		INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = EXCLUDED.created_at, last_used_step = 0
+		WHERE user_totp.enabled_at IS NULL`, userID, secret)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// EnableTOTP finishes enrolment once the user has entered a valid code for step, and replaces their recovery codes.
+// Returns false if there was no pending secret.
+func EnableTOTP(userID uuid.UUID, step int64, recoveryHashes []string) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE user_totp SET enabled_at = EXTRACT(EPOCH FROM NOW())::BIGINT, last_used_step = $2
+		WHERE user_id = $1 AND enabled_at IS NULL`, userID, step)
+	if err != nil {
+		return false, err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return false, err
+	}
+	err = setRecoveryCodes(tx, userID, recoveryHashes)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// UseTOTPStep marks a code for step as used, returning false if it (or a later one) already was.
+// Doing this atomically means the same code can't be used twice, even by concurrent requests.
+func UseTOTPStep(userID uuid.UUID, step int64) (bool, error) {
+	result, err := DB.Exec(`UPDATE user_totp SET last_used_step = $2 WHERE user_id = $1 AND enabled_at IS NOT NULL AND last_used_step < $2`, userID, step)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// DisableTwoFactor removes the user's TOTP secret and recovery codes
+func DisableTwoFactor(userID uuid.UUID) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetRecoveryCodes replaces all of the user's recovery codes
+func SetRecoveryCodes(userID uuid.UUID, hashes []string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = setRecoveryCodes(tx, userID, hashes)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setRecoveryCodes(tx *sql.Tx, userID uuid.UUID, hashes []string) error {
+	_, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO user_recovery_codes (user_id, code_hash) SELECT $1, UNNEST($2::TEXT[]) ON CONFLICT DO NOTHING`, userID, pq.StringArray(hashes))
+	return err
+}
+
+// UseRecoveryCode deletes the recovery code, returning false if the user didn't have it
+func UseRecoveryCode(userID uuid.UUID, hash string) (bool, error) {
+	result, err := DB.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1 AND code_hash = $2`, userID, hash)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has left
+func CountRecoveryCodes(userID uuid.UUID) (count int, err error) {
+	err = DB.QueryRow(`SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1`, userID).Scan(&count)
+	return
+}
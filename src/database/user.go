@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/lib/pq"
+	"time"
 
 	"github.com/ImpactDevelopment/ImpactServer/src/users"
 	"github.com/google/uuid"
@@ -12,6 +13,8 @@ import (
 type userRow struct {
 	id            uuid.UUID
 	email         sql.NullString
+	emailVerified bool
+	locale        sql.NullString
 	minecraft     NullUUID
 	discord       sql.NullString
 	passwdHash    sql.NullString
@@ -20,6 +23,9 @@ type userRow struct {
 	capeEnabled   bool
 	legacy        bool
 	roleList      pq.StringArray
+	roleExpiry    pq.Int64Array
+	custom        customizationColumns
+	chosen        cosmeticColumns
 }
 
 // rowScanner is implemented by sql.Row and sql.Rows
@@ -30,20 +36,28 @@ type rowScanner interface {
 // scanUsersView takes a sql.Row or sql.Rows and scans it into the user.
 // It is assumed the row is has the same column order as `users_view`
 func (user *userRow) scanUsersView(row rowScanner) error {
-	return row.Scan(&user.id, &user.email, &user.minecraft, &user.discord, &user.passwdHash, &user.stripe, &user.capeEnabled, &user.legacyEnabled, &user.legacy, &user.roleList)
+	return row.Scan(&user.id, &user.email, &user.emailVerified, &user.locale, &user.minecraft, &user.discord, &user.passwdHash, &user.stripe, &user.capeEnabled, &user.legacyEnabled, &user.legacy, &user.roleList, &user.roleExpiry,
+		&user.custom.icon, &user.custom.cape, &user.custom.textColor, &user.custom.bgColor, &user.custom.borderColor, &user.custom.editionIcon, &user.custom.editionText, &user.custom.editionTextColor,
+		&user.chosen.cape, &user.chosen.icon, &user.chosen.textColor, &user.chosen.bgColor, &user.chosen.borderColor)
 }
 
 // makeUser converts a userRow into a users.User
 func (user *userRow) makeUser() users.User {
 	ret := users.User{
+		EmailVerified: user.emailVerified,
 		LegacyEnabled: user.legacyEnabled,
 		Incognito:     !user.capeEnabled,
 		Legacy:        user.legacy,
 		Roles:         user.roles(),
+		Customization: user.custom.makeCustomization(),
+		Cosmetics:     user.chosen.makeChoice(),
 	}
 	if user.email.Valid {
 		ret.Email = user.email.String
 	}
+	if user.locale.Valid {
+		ret.Locale = user.locale.String
+	}
 	if user.minecraft.Valid {
 		ret.MinecraftID = &user.minecraft.UUID
 	}
@@ -63,8 +77,13 @@ func (user *userRow) makeUser() users.User {
 
 func (user userRow) roles() []users.Role {
 	var roles []users.Role
-	for _, roleID := range user.roleList {
-		if role, ok := users.Roles[roleID]; ok {
+	for i, roleID := range user.roleList {
+		if role, ok := users.GetRole(roleID); ok {
+			// role_expiry is in the same order as roles, 0 means never
+			if i < len(user.roleExpiry) && user.roleExpiry[i] > 0 {
+				expires := time.Unix(user.roleExpiry[i], 0).UTC()
+				role.Expires = &expires
+			}
 			roles = append(roles, role)
 		} else {
 			fmt.Printf("User %s has unknown role %s\n", user.id, roleID)
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebAuthnCredential is a row in the webauthn_credentials table
+type WebAuthnCredential struct {
+	ID         []byte    `json:"-"`
+	UserID     uuid.UUID `json:"-"`
+	Name       string    `json:"name"`
+	PublicKey  []byte    `json:"-"`
+	Algorithm  int64     `json:"-"`
+	SignCount  uint32    `json:"-"`
+	CreatedAt  int64     `json:"created_at"`
+	LastUsedAt *int64    `json:"last_used_at,omitempty"`
+}
+
+const webAuthnCredentialColumns = `credential_id, user_id, name, public_key, algorithm, sign_count, created_at, last_used_at`
+
+func scanWebAuthnCredential(row rowScanner) (*WebAuthnCredential, error) {
+	var (
+		credential WebAuthnCredential
+		signCount  int64
+		lastUsedAt sql.NullInt64
+	)
+	err := row.Scan(&credential.ID, &credential.UserID, &credential.Name, &credential.PublicKey, &credential.Algorithm, &signCount, &credential.CreatedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	credential.SignCount = uint32(signCount)
+	if lastUsedAt.Valid {
+		credential.LastUsedAt = &lastUsedAt.Int64
+	}
+	return &credential, nil
+}
+
+// CreateWebAuthnCredential stores a newly registered credential
+func CreateWebAuthnCredential(credential WebAuthnCredential) (*WebAuthnCredential, error) {
+	return scanWebAuthnCredential(DB.QueryRow(`
+		INSERT INTO webauthn_credentials (credential_id, user_id, name, public_key, algorithm, sign_count) VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+webAuthnCredentialColumns,
+		credential.ID, credential.UserID, credential.Name, credential.PublicKey, credential.Algorithm, int64(credential.SignCount)))
+}
+
+// GetWebAuthnCredential returns the credential with the given id, or nil if there isn't one
+func GetWebAuthnCredential(id []byte) (*WebAuthnCredential, error) {
+	credential, err := scanWebAuthnCredential(DB.QueryRow(`SELECT `+webAuthnCredentialColumns+` FROM webauthn_credentials WHERE credential_id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return credential, err
+}
+
+// GetUserWebAuthnCredentials returns all of the user's credentials, oldest first
+func GetUserWebAuthnCredentials(userID uuid.UUID) ([]WebAuthnCredential, error) {
+	rows, err := DB.Query(`SELECT `+webAuthnCredentialColumns+` FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]WebAuthnCredential, 0)
+	for rows.Next() {
+		credential, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *credential)
+	}
+	return ret, rows.Err()
+}
+
+// UseWebAuthnCredential records a successful login with the credential.
+// Returns false if the sign count was updated by a concurrent login in the meantime, which means the assertion was replayed or cloned.
+func UseWebAuthnCredential(id []byte, previousSignCount uint32, signCount uint32) (bool, error) {
+	result, err := DB.Exec(`
+		UPDATE webauthn_credentials SET sign_count = $3, last_used_at = EXTRACT(EPOCH FROM NOW())::BIGINT
+		WHERE credential_id = $1 AND sign_count = $2`, id, int64(previousSignCount), int64(signCount))
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// DeleteWebAuthnCredential removes one of the user's credentials, returning false if they didn't have it
+func DeleteWebAuthnCredential(userID uuid.UUID, id []byte) (bool, error) {
+	result, err := DB.Exec(`DELETE FROM webauthn_credentials WHERE user_id = $1 AND credential_id = $2`, userID, id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// CreateWebAuthnChallenge stores a challenge, only its hash is kept.
+// userID is who is registering a credential, or uuid.Nil for a login challenge.
+func CreateWebAuthnChallenge(challengeHash string, userID uuid.UUID, expiresAt time.Time) error {
+	_, err := DB.Exec(`DELETE FROM webauthn_challenges WHERE expires_at < EXTRACT(EPOCH FROM NOW())`)
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec(`INSERT INTO webauthn_challenges (challenge_hash, user_id, expires_at) VALUES ($1, $2, $3)`,
+		challengeHash, NullUUID{UUID: userID, Valid: userID != uuid.Nil}, expiresAt.Unix())
+	return err
+}
+
+// ConsumeWebAuthnChallenge deletes the challenge so that it can only be used once, returning who it was issued to.
+// ok is false if the challenge doesn't exist or has expired, userID is uuid.Nil for login challenges.
+func ConsumeWebAuthnChallenge(challengeHash string) (userID uuid.UUID, ok bool, err error) {
+	var (
+		user      NullUUID
+		expiresAt int64
+	)
+	err = DB.QueryRow(`DELETE FROM webauthn_challenges WHERE challenge_hash = $1 RETURNING user_id, expires_at`, challengeHash).Scan(&user, &expiresAt)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, false, nil
+	}
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	if time.Now().Unix() > expiresAt {
+		return uuid.Nil, false, nil
+	}
+	return user.UUID, true, nil
+}
@@ -0,0 +1,99 @@
+package email
+
+var de = catalog{
+	Footer: "Du erhältst diese E-Mail wegen deines Impact-Kontos. Wenn du Fragen hast, frag uns auf Discord.",
+	Templates: map[string]source{
+		PasswordReset: {
+			Subject: "Passwort zurücksetzen",
+			Text:    `Hier ist dein Link zum Zurücksetzen des Passworts: {{.URL}}`,
+			HTML: `<p>
+<a href="{{.URL}}">Klicke hier, um dein Passwort zurückzusetzen</a>, oder kopiere den folgenden Link, falls das nicht funktioniert:
+</p>
+<pre>
+{{.URL}}
+</pre>`,
+		},
+		VerifyEmail: {
+			Subject: "Bestätige deine E-Mail-Adresse",
+			Text: `Bestätige, dass dies deine E-Mail-Adresse ist, indem du folgenden Link besuchst: {{.URL}}
+
+Wenn du das nicht angefordert hast, kannst du diese E-Mail ignorieren.`,
+			HTML: `<p>
+<a href="{{.URL}}">Klicke hier, um deine E-Mail-Adresse zu bestätigen</a>, oder kopiere den folgenden Link, falls das nicht funktioniert:
+</p>
+<pre>
+{{.URL}}
+</pre>
+<p>Wenn du das nicht angefordert hast, kannst du diese E-Mail ignorieren.</p>`,
+		},
+		EmailChanged: {
+			Subject: "Deine E-Mail-Adresse wurde geändert",
+			Text: `Die E-Mail-Adresse deines Impact-Kontos wurde zu {{.Email}} geändert.
+
+Wenn du das nicht warst, mache die Änderung rückgängig und melde dich überall ab, indem du folgenden Link besuchst: {{.URL}}`,
+			HTML: `<p>Die E-Mail-Adresse deines Impact-Kontos wurde zu <b>{{.Email}}</b> geändert.</p>
+<p>
+Wenn du das nicht warst, <a href="{{.URL}}">klicke hier, um die Änderung rückgängig zu machen</a> und dich überall abzumelden, oder kopiere den folgenden Link, falls das nicht funktioniert:
+</p>
+<pre>
+{{.URL}}
+</pre>`,
+		},
+		Receipt: {
+			Subject: "Danke, dass du Impact unterstützt",
+			Text: `Vielen Dank für deine Spende von {{.Amount}}!
+
+Dein Registrierungstoken ist {{.Token}}
+
+Damit kannst du ein Impact-Konto erstellen oder Premium zu einem bestehenden Konto hinzufügen: {{.URL}}`,
+			HTML: `<p>Vielen Dank für deine Spende von <b>{{.Amount}}</b>!</p>
+<p>Dein Registrierungstoken ist</p>
+<pre>
+{{.Token}}
+</pre>
+<p>
+<a href="{{.URL}}">Klicke hier, um dein Impact-Konto zu erstellen</a> oder Premium zu einem bestehenden Konto hinzuzufügen.
+</p>`,
+		},
+		DonationCredited: {
+			Subject: "Danke, dass du Impact unterstützt",
+			Text: `Vielen Dank für deine Spende von {{.Amount}}!
+
+Premium wurde zu deinem Impact-Konto hinzugefügt: {{.URL}}`,
+			HTML: `<p>Vielen Dank für deine Spende von <b>{{.Amount}}</b>!</p>
+<p>Premium wurde zu deinem Impact-Konto hinzugefügt, <a href="{{.URL}}">klicke hier, um es anzusehen</a>.</p>`,
+		},
+		RoleExpired: {
+			Subject: "Dein {{.Role}} ist abgelaufen",
+			Text: `Dein {{.Role}} auf deinem Impact-Konto ist abgelaufen.
+
+Du kannst es jederzeit erneuern: {{.URL}}`,
+			HTML: `<p>Dein {{.Role}} auf deinem Impact-Konto ist abgelaufen.</p>
+<p><a href="{{.URL}}">Klicke hier, um es zu erneuern</a>.</p>`,
+		},
+		TwoFactorEnabled: {
+			Subject: "Zwei-Faktor-Authentifizierung aktiviert",
+			Text: `Die Zwei-Faktor-Authentifizierung wurde für dein Impact-Konto aktiviert.
+
+Wenn du das nicht warst, setze dein Passwort zurück und kontaktiere uns sofort.`,
+			HTML: `<p>Die Zwei-Faktor-Authentifizierung wurde für dein Impact-Konto aktiviert.</p>
+<p>Wenn du das nicht warst, setze dein Passwort zurück und kontaktiere uns sofort.</p>`,
+		},
+		TwoFactorDisabled: {
+			Subject: "Zwei-Faktor-Authentifizierung deaktiviert",
+			Text: `Die Zwei-Faktor-Authentifizierung wurde für dein Impact-Konto deaktiviert.
+
+Wenn du das nicht warst, setze dein Passwort zurück und kontaktiere uns sofort.`,
+			HTML: `<p>Die Zwei-Faktor-Authentifizierung wurde für dein Impact-Konto deaktiviert.</p>
+<p>Wenn du das nicht warst, setze dein Passwort zurück und kontaktiere uns sofort.</p>`,
+		},
+		AccountDeletion: {
+			Subject: "Dein Konto wird gelöscht",
+			Text: `Dein Impact-Konto wird am {{.Date}} endgültig gelöscht.
+
+Wenn du es dir vorher anders überlegst, melde dich an und brich die Löschung ab: {{.URL}}`,
+			HTML: `<p>Dein Impact-Konto wird am <b>{{.Date}}</b> endgültig gelöscht.</p>
+<p>Wenn du es dir vorher anders überlegst, <a href="{{.URL}}">melde dich an und brich die Löschung ab</a>.</p>`,
+		},
+	},
+}
@@ -0,0 +1,214 @@
+// Package email renders and sends transactional emails.
+//
+// Each email is a named template, translated into each supported locale and rendered
+// through html/template and text/template inside a shared layout.
+package email
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// Template names
+const (
+	PasswordReset     = "password_reset"
+	VerifyEmail       = "verify_email"
+	EmailChanged      = "email_changed"
+	Receipt           = "receipt"
+	DonationCredited  = "donation_credited"
+	RoleExpired       = "role_expired"
+	TwoFactorEnabled  = "two_factor_enabled"
+	TwoFactorDisabled = "two_factor_disabled"
+	AccountDeletion   = "account_deletion"
+	Test              = "test"
+)
+
+// LinkData is the data for emails that are just a link, e.g. PasswordReset and VerifyEmail
+type LinkData struct {
+	URL string
+}
+
+// EmailChangedData is the data for EmailChanged, URL undoes the change
+type EmailChangedData struct {
+	Email string
+	URL   string
+}
+
+// ReceiptData is the data for Receipt, URL is where Token can be redeemed
+type ReceiptData struct {
+	Amount string
+	Token  string
+	URL    string
+}
+
+// DonationCreditedData is the data for DonationCredited, URL is the account the donation was added to
+type DonationCreditedData struct {
+	Amount string
+	URL    string
+}
+
+// RoleExpiredData is the data for RoleExpired, URL is where the role can be renewed
+type RoleExpiredData struct {
+	Role string
+	URL  string
+}
+
+// AccountDeletionData is the data for AccountDeletion, URL is where the deletion can be cancelled before Date
+type AccountDeletionData struct {
+	Date string
+	URL  string
+}
+
+// source is the untranslated source of a single email
+type source struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// catalog is every email in a single locale
+type catalog struct {
+	// Footer goes at the bottom of every email
+	Footer    string
+	Templates map[string]source
+}
+
+const layoutHTML = `<!DOCTYPE html>
+<html lang="{{.Locale}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Subject}}</title>
+</head>
+<body style="font-family: sans-serif">
+<table width="100%" border="0" cellspacing="0" cellpadding="0">
+    <tr>
+        <td align="center">
+            <img src="https://impactdevelopment.github.io/Resources/textures/Icon_256.png" width="64" height="64" alt="Impact"/>
+        </td>
+    </tr>
+</table>
+{{template "content" .Data}}
+<hr/>
+<p style="color: #888; font-size: small">{{.Footer}}</p>
+</body>
+</html>
+`
+
+const layoutText = `{{template "content" .Data}}
+
+--
+{{.Footer}}
+`
+
+// layoutData is what the layouts are executed with, the content templates only get Data
+type layoutData struct {
+	Locale  string
+	Subject string
+	Footer  string
+	Data    interface{}
+}
+
+// compiled is a parsed email
+type compiled struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// compiledTemplates is keyed by locale then template name
+var compiledTemplates = compileAll()
+
+func compileAll() map[string]map[string]compiled {
+	result := make(map[string]map[string]compiled)
+	for locale, cat := range locales {
+		result[locale] = make(map[string]compiled)
+		for name, src := range cat.Templates {
+			tmpl, err := compile(src)
+			if err != nil {
+				panic(fmt.Sprintf("email template %s/%s: %s", locale, name, err.Error()))
+			}
+			result[locale][name] = tmpl
+		}
+	}
+	return result
+}
+
+func compile(src source) (tmpl compiled, err error) {
+	tmpl.subject, err = texttemplate.New("subject").Option("missingkey=error").Parse(src.Subject)
+	if err != nil {
+		return
+	}
+	tmpl.text, err = texttemplate.New("layout").Option("missingkey=error").Parse(layoutText)
+	if err != nil {
+		return
+	}
+	_, err = tmpl.text.New("content").Parse(src.Text)
+	if err != nil {
+		return
+	}
+	tmpl.html, err = htmltemplate.New("layout").Option("missingkey=error").Parse(layoutHTML)
+	if err != nil {
+		return
+	}
+	_, err = tmpl.html.New("content").Parse(src.HTML)
+	return
+}
+
+// Render renders the named email in locale, falling back to DefaultLocale if it hasn't been translated.
+// The returned message has no recipient.
+func Render(locale string, name string, data interface{}) (*Message, error) {
+	if !SupportedLocale(locale) {
+		locale = DefaultLocale
+	}
+	tmpl, ok := compiledTemplates[locale][name]
+	if !ok {
+		locale = DefaultLocale
+		tmpl, ok = compiledTemplates[locale][name]
+		if !ok {
+			return nil, fmt.Errorf("unknown email template %s", name)
+		}
+	}
+
+	var subject, text, html bytes.Buffer
+	err := tmpl.subject.Execute(&subject, data)
+	if err != nil {
+		return nil, err
+	}
+	layout := layoutData{
+		Locale:  locale,
+		Subject: subject.String(),
+		Footer:  locales[locale].Footer,
+		Data:    data,
+	}
+	err = tmpl.text.Execute(&text, layout)
+	if err != nil {
+		return nil, err
+	}
+	err = tmpl.html.Execute(&html, layout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		From:    From,
+		Subject: layout.Subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// DefaultTransport is used by Send, it is picked by EMAIL_TRANSPORT
+var DefaultTransport = transportFromEnv()
+
+// Send renders the named email in locale and sends it to `to` using DefaultTransport
+func Send(ctx context.Context, to string, locale string, name string, data interface{}) error {
+	message, err := Render(locale, name, data)
+	if err != nil {
+		return err
+	}
+	message.To = to
+	return DefaultTransport.Send(ctx, message)
+}
@@ -0,0 +1,108 @@
+package email
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sampleData has data for every template
+var sampleData = map[string]interface{}{
+	PasswordReset:     LinkData{URL: "https://impactclient.net/forgotpassword.html?token=abc"},
+	VerifyEmail:       LinkData{URL: "https://impactclient.net/verifyemail.html?token=abc"},
+	EmailChanged:      EmailChangedData{Email: "new@example.com", URL: "https://impactclient.net/revertemail.html?token=abc"},
+	Receipt:           ReceiptData{Amount: "$5.00", Token: "token", URL: "https://impactclient.net/register.html?token=token"},
+	DonationCredited:  DonationCreditedData{Amount: "$5.00", URL: "https://impactclient.net/account.html"},
+	RoleExpired:       RoleExpiredData{Role: "premium", URL: "https://impactclient.net/#donate"},
+	TwoFactorEnabled:  nil,
+	TwoFactorDisabled: nil,
+	AccountDeletion:   AccountDeletionData{Date: "2 January 2006", URL: "https://impactclient.net/account.html"},
+	Test:              nil,
+}
+
+func TestEveryTemplateRenders(t *testing.T) {
+	assert.Len(t, en.Templates, len(sampleData), "every template needs sample data")
+	for _, locale := range Locales() {
+		for name := range locales[locale].Templates {
+			_, ok := en.Templates[name]
+			assert.True(t, ok, "%s/%s has no %s version to fall back to", locale, name, DefaultLocale)
+		}
+		for name, data := range sampleData {
+			message, err := Render(locale, name, data)
+			require.NoError(t, err, "%s/%s", locale, name)
+			assert.NotEmpty(t, message.Subject, "%s/%s", locale, name)
+			assert.NotEmpty(t, message.Text, "%s/%s", locale, name)
+			assert.Contains(t, message.HTML, "<html lang=", "%s/%s", locale, name)
+			if link, ok := data.(LinkData); ok {
+				assert.Contains(t, message.Text, link.URL, "%s/%s", locale, name)
+			}
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	message, err := Render("de", EmailChanged, EmailChangedData{Email: "<b>@example.com", URL: "https://example.com/?a=1&b=2"})
+	require.NoError(t, err)
+	assert.Equal(t, From, message.From)
+	assert.Equal(t, "Deine E-Mail-Adresse wurde geändert", message.Subject)
+	assert.Contains(t, message.Text, "<b>@example.com")
+	assert.Contains(t, message.Text, de.Footer)
+	assert.Contains(t, message.HTML, "&lt;b&gt;@example.com", "html should be escaped")
+	assert.Contains(t, message.HTML, `href="https://example.com/?a=1&amp;b=2"`)
+	assert.Contains(t, message.HTML, `lang="de"`)
+
+	// Not translated
+	message, err = Render("de", Test, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Test email", message.Subject)
+	assert.Contains(t, message.HTML, `lang="en"`)
+
+	// Unsupported locale
+	message, err = Render("xx", PasswordReset, LinkData{URL: "https://example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "Password reset", message.Subject)
+
+	_, err = Render("en", "nope", nil)
+	assert.Error(t, err)
+
+	_, err = Render("en", PasswordReset, nil)
+	assert.Error(t, err, "missing data should be an error, not an empty link")
+}
+
+func TestLocale(t *testing.T) {
+	assert.Equal(t, "en", Locale("", ""))
+	assert.Equal(t, "de", Locale("de", "en-US"))
+	assert.Equal(t, "de", Locale("", "de-AT,de;q=0.9,en;q=0.8"))
+	assert.Equal(t, "de", Locale("", "fr-FR, de;q=0.5, en;q=0.4"))
+	assert.Equal(t, "en", Locale("", "de;q=0.5, en"))
+	assert.Equal(t, "en", Locale("", "de;q=0, fr"))
+	assert.Equal(t, "de", Locale("xx", "DE_de"))
+	assert.Equal(t, "en", Locale("", "*"))
+}
+
+func TestFileTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "email")
+	require.NoError(t, err)
+	transport := FileTransport{Dir: filepath.Join(dir, "out")}
+
+	message, err := Render("en", VerifyEmail, LinkData{URL: "https://example.com/verify"})
+	require.NoError(t, err)
+	message.To = "someone@example.com"
+	require.NoError(t, transport.Send(context.Background(), message))
+
+	files, err := ioutil.ReadDir(transport.Dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.True(t, strings.HasSuffix(files[0].Name(), "someone@example.com.eml"))
+	data, err := ioutil.ReadFile(filepath.Join(transport.Dir, files[0].Name()))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "To: someone@example.com\r\n")
+	assert.Contains(t, string(data), "Subject: Confirm your email address\r\n")
+	assert.Contains(t, string(data), "multipart/alternative")
+	assert.Contains(t, string(data), "https://example.com/verify")
+}
@@ -0,0 +1,104 @@
+package email
+
+var en = catalog{
+	Footer: "You received this email because of your Impact Account. If you have any questions, ask us on Discord.",
+	Templates: map[string]source{
+		PasswordReset: {
+			Subject: "Password reset",
+			Text:    `Here's your password reset link: {{.URL}}`,
+			HTML: `<p>
+<a href="{{.URL}}">Click here to reset your password</a> or copy the following link if that doesn't work:
+</p>
+<pre>
+{{.URL}}
+</pre>`,
+		},
+		VerifyEmail: {
+			Subject: "Confirm your email address",
+			Text: `Confirm this is your email address by visiting: {{.URL}}
+
+If you didn't ask for this, you can ignore this email.`,
+			HTML: `<p>
+<a href="{{.URL}}">Click here to confirm your email address</a> or copy the following link if that doesn't work:
+</p>
+<pre>
+{{.URL}}
+</pre>
+<p>If you didn't ask for this, you can ignore this email.</p>`,
+		},
+		EmailChanged: {
+			Subject: "Your email address was changed",
+			Text: `The email address on your Impact Account was changed to {{.Email}}.
+
+If this wasn't you, undo the change and log out everywhere by visiting: {{.URL}}`,
+			HTML: `<p>The email address on your Impact Account was changed to <b>{{.Email}}</b>.</p>
+<p>
+If this wasn't you, <a href="{{.URL}}">click here to undo the change</a> and log out everywhere, or copy the following link if that doesn't work:
+</p>
+<pre>
+{{.URL}}
+</pre>`,
+		},
+		Receipt: {
+			Subject: "Thank you for supporting Impact",
+			Text: `Thank you for your donation of {{.Amount}}!
+
+Your registration token is {{.Token}}
+
+Use it to create your Impact Account, or to add premium to an existing one, by visiting: {{.URL}}`,
+			HTML: `<p>Thank you for your donation of <b>{{.Amount}}</b>!</p>
+<p>Your registration token is</p>
+<pre>
+{{.Token}}
+</pre>
+<p>
+<a href="{{.URL}}">Click here to create your Impact Account</a>, or to add premium to an existing one.
+</p>`,
+		},
+		DonationCredited: {
+			Subject: "Thank you for supporting Impact",
+			Text: `Thank you for your donation of {{.Amount}}!
+
+Premium has been added to your Impact Account, you can see it at: {{.URL}}`,
+			HTML: `<p>Thank you for your donation of <b>{{.Amount}}</b>!</p>
+<p>Premium has been added to your Impact Account, <a href="{{.URL}}">click here to see it</a>.</p>`,
+		},
+		RoleExpired: {
+			Subject: "Your {{.Role}} has expired",
+			Text: `Your {{.Role}} on your Impact Account has expired.
+
+You can renew it at any time by visiting: {{.URL}}`,
+			HTML: `<p>Your {{.Role}} on your Impact Account has expired.</p>
+<p><a href="{{.URL}}">Click here to renew it</a> at any time.</p>`,
+		},
+		TwoFactorEnabled: {
+			Subject: "Two factor authentication enabled",
+			Text: `Two factor authentication was enabled on your Impact Account.
+
+If this wasn't you, reset your password and contact us straight away.`,
+			HTML: `<p>Two factor authentication was enabled on your Impact Account.</p>
+<p>If this wasn't you, reset your password and contact us straight away.</p>`,
+		},
+		TwoFactorDisabled: {
+			Subject: "Two factor authentication disabled",
+			Text: `Two factor authentication was disabled on your Impact Account.
+
+If this wasn't you, reset your password and contact us straight away.`,
+			HTML: `<p>Two factor authentication was disabled on your Impact Account.</p>
+<p>If this wasn't you, reset your password and contact us straight away.</p>`,
+		},
+		AccountDeletion: {
+			Subject: "Your account will be deleted",
+			Text: `Your Impact Account will be permanently deleted on {{.Date}}.
+
+If you change your mind before then, log in and cancel the deletion: {{.URL}}`,
+			HTML: `<p>Your Impact Account will be permanently deleted on <b>{{.Date}}</b>.</p>
+<p>If you change your mind before then, <a href="{{.URL}}">log in and cancel the deletion</a>.</p>`,
+		},
+		Test: {
+			Subject: "Test email",
+			Text:    `If you can read this, email is working.`,
+			HTML:    `<p>If you can read this, <b>email is working</b>.</p>`,
+		},
+	},
+}
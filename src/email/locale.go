@@ -0,0 +1,86 @@
+package email
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale has every template, other locales fall back to it
+const DefaultLocale = "en"
+
+var locales = map[string]catalog{
+	"en": en,
+	"de": de,
+}
+
+// Locales returns every supported locale, sorted
+func Locales() []string {
+	list := make([]string, 0, len(locales))
+	for locale := range locales {
+		list = append(list, locale)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// SupportedLocale returns true if there are translations for locale
+func SupportedLocale(locale string) bool {
+	_, ok := locales[locale]
+	return ok
+}
+
+// Locale picks the locale to send an email in. The user's own choice wins, otherwise the best match for
+// the Accept-Language header is used. Either can be empty, and DefaultLocale is returned if nothing matches.
+func Locale(userLocale string, acceptLanguage string) string {
+	if SupportedLocale(userLocale) {
+		return userLocale
+	}
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		if SupportedLocale(tag) {
+			return tag
+		}
+		// Try the language on its own, e.g. de-AT -> de
+		if i := strings.IndexByte(tag, '-'); i > 0 && SupportedLocale(tag[:i]) {
+			return tag[:i]
+		}
+	}
+	return DefaultLocale
+}
+
+// parseAcceptLanguage returns the lowercase language tags in the header, most preferred first
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(params[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		tags = append(tags, weighted{strings.Replace(tag, "_", "-", -1), q})
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+	result := make([]string, len(tags))
+	for i, tag := range tags {
+		result[i] = tag.tag
+	}
+	return result
+}
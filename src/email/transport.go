@@ -0,0 +1,115 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/mailgun"
+)
+
+// Transport delivers rendered messages
+type Transport interface {
+	Send(ctx context.Context, message *Message) error
+}
+
+// MailgunTransport sends email through mailgun.MG, this is what production uses
+type MailgunTransport struct{}
+
+// Send implements Transport
+func (MailgunTransport) Send(ctx context.Context, message *Message) error {
+	msg := mailgun.MG.NewMessage(message.From, message.Subject, message.Text, message.To)
+	msg.SetHtml(message.HTML)
+	_, _, err := mailgun.MG.Send(ctx, msg)
+	return err
+}
+
+// FileTransport writes each message to an .eml file in Dir instead of sending it, for local testing without network
+type FileTransport struct {
+	Dir string
+}
+
+var fileCounter uint64
+
+// Send implements Transport
+func (t FileTransport) Send(ctx context.Context, message *Message) error {
+	data, err := message.Bytes()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(t.Dir, 0755)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%d-%s.eml", time.Now().UnixNano(), atomic.AddUint64(&fileCounter, 1), sanitiseFilename(message.To))
+	path := filepath.Join(t.Dir, name)
+	err = ioutil.WriteFile(path, data, 0644)
+	if err == nil {
+		log.Println("EMAIL: Wrote email to", path)
+	}
+	return err
+}
+
+func sanitiseFilename(str string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '@' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, str)
+}
+
+// SMTPTransport sends email to an SMTP server without authentication, e.g. a local MailHog
+type SMTPTransport struct {
+	// Addr is host:port
+	Addr string
+}
+
+// Send implements Transport
+func (t SMTPTransport) Send(ctx context.Context, message *Message) error {
+	data, err := message.Bytes()
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(t.Addr, nil, "noreply@impactclient.net", []string{message.To}, data)
+}
+
+// transportFromEnv picks a transport based on EMAIL_TRANSPORT, which can be "mailgun", "file" or "smtp".
+// If it isn't set, mailgun is used when configured and otherwise emails are written to files.
+func transportFromEnv() Transport {
+	kind := os.Getenv("EMAIL_TRANSPORT")
+	if kind == "" {
+		if os.Getenv("MAILGUN_API_KEY") != "" {
+			kind = "mailgun"
+		} else {
+			kind = "file"
+		}
+	}
+
+	switch kind {
+	case "mailgun":
+		return MailgunTransport{}
+	case "smtp":
+		addr := os.Getenv("EMAIL_SMTP_ADDR")
+		if addr == "" {
+			addr = "localhost:1025"
+		}
+		log.Println("EMAIL: Sending email to SMTP server", addr)
+		return SMTPTransport{Addr: addr}
+	case "file":
+		dir := os.Getenv("EMAIL_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "impact-email")
+		}
+		log.Println("EMAIL: Writing email to", dir)
+		return FileTransport{Dir: dir}
+	}
+	panic("unknown EMAIL_TRANSPORT " + kind)
+}
@@ -32,5 +32,5 @@ func DiscordLoginHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, "no user found")
 	}
 
-	return respondWithToken(user, c)
+	return RespondWithToken(user, c)
 }
@@ -1,10 +1,9 @@
 package jwt
 
 import (
-	"crypto/rsa"
 	"fmt"
 	"net/http"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/ImpactDevelopment/ImpactServer/src/database"
@@ -17,12 +16,26 @@ import (
 	"github.com/gbrlsnchs/jwt/v3"
 )
 
-type impactUserJWT struct {
+const (
+	// accessTokenLifetime is how long access tokens last when the client is also given a refresh token
+	accessTokenLifetime = 15 * time.Minute
+	// legacyTokenLifetime is how long access tokens last for clients that can't refresh, i.e. those that don't accept json
+	legacyTokenLifetime = 24 * time.Hour
+	// refreshTokenLifetime is how long a session lasts without being refreshed
+	refreshTokenLifetime = 30 * 24 * time.Hour
+)
+
+// UserClaims are the claims in a user's access token
+type UserClaims struct {
 	jwt.Payload
 	Roles       []string   `json:"roles"`
 	Legacy      bool       `json:"legacy"`
 	MinecraftID *uuid.UUID `json:"mcuuid,omitempty"`
 	DiscordID   string     `json:"discordid,omitempty"`
+	// SessionID is the session the token belongs to, revoking the session revokes the token
+	SessionID *uuid.UUID `json:"sid,omitempty"`
+	// TwoFactor is true if the session was started using a second factor
+	TwoFactor bool `json:"mfa,omitempty"`
 }
 type donationJWT struct {
 	jwt.Payload
@@ -30,112 +43,156 @@ type donationJWT struct {
 	Amount  int    `json:"amount"`
 }
 
-var rs512 jwt.Algorithm
+// keys are used to sign and verify tokens, see loadKeys
+var keys keySet
 
 var jwtIssuerURL string
 
 func init() {
-	var key *rsa.PrivateKey
-
-	if env := os.Getenv("JWT_KEY"); env != "" {
-		var err error
-		key, err = util.StrToRsa(env)
-		if err != nil {
-			fmt.Println("WARNING: Unable to load JWT_KEY from the environment", err)
-		}
-	}
-
 	addr := util.GetServerURL()
 	jwtIssuerURL = addr.Scheme + "://api." + addr.Host + "/v1"
 	fmt.Println("JWT Issuer URL is", jwtIssuerURL)
 
-	if key == nil {
-		fmt.Println("WARNING: JWT_KEY not specified, generating a temporary one")
-		key = util.GenerateRsa()
-		fmt.Println("Printing private key since this is temporary")
-		fmt.Println("Private key is", util.RsaToStr(key))
-	}
-
-	fmt.Println("Public key is", util.RsaPubToStr(&key.PublicKey))
-
-	// rs512 can be used to sign and verify tokens, e.g. jtw.Sign(payload []byte, rs512 Algorithm)
-	rs512 = jwt.NewRS512(jwt.RSAPrivateKey(key), jwt.RSAPublicKey(&key.PublicKey))
+	keys = loadKeys()
 }
 
-func Verify(token string) (*users.User, error) {
+// Verify checks the token is valid and its session hasn't been revoked, returning the user and the token's claims
+func Verify(token string) (*users.User, *UserClaims, error) {
 	var (
 		now = time.Now()
 
-		// Validate "iss", "iat" and "exp" claims
+		// Validate "iss", "iat", "exp" and "aud" claims
 		issValidator = jwt.IssuerValidator(jwtIssuerURL)
 		iatValidator = jwt.IssuedAtValidator(now)
 		expValidator = jwt.ExpirationTimeValidator(now)
+		audValidator = jwt.AudienceValidator(jwt.Audience{"impact_account"}) // OAuth tokens can't be used as first party tokens
 
 		// Use jwt.ValidatePayload to build a jwt.VerifyOption.
 		// Validators are run in the order informed.
-		userPayload impactUserJWT
-		validator   = jwt.ValidatePayload(&userPayload.Payload, issValidator, iatValidator, expValidator)
+		userPayload UserClaims
+		validator   = jwt.ValidatePayload(&userPayload.Payload, issValidator, iatValidator, expValidator, audValidator)
 	)
 
 	// Verify the token is signed with our key and is valid
 	// populate userPayload with the token's fields
-	_, err := jwt.Verify([]byte(token), rs512, &userPayload, validator)
+	_, err := jwt.Verify([]byte(token), keys.resolver(), &userPayload, jwt.ValidateHeader, validator)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// The subject should be the user's id
 	id, err := uuid.Parse(userPayload.Subject)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	// Tokens issued before sessions existed don't have one, they expire on their own within legacyTokenLifetime
+	if sid := userPayload.SessionID; sid != nil {
+		active, err := database.IsSessionActive(*sid, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !active {
+			return nil, nil, fmt.Errorf("session %s has been revoked", sid.String())
+		}
 	}
 
 	user := database.LookupUserByID(id)
 	if user == nil {
-		return nil, fmt.Errorf("unable to find user with id %s", id.String())
+		return nil, nil, fmt.Errorf("unable to find user with id %s", id.String())
 	}
 
-	return user, nil
+	return user, &userPayload, nil
 }
 
-// CreateUserJWT returns a jwt token for the user with the subject (if not empty).
+// createUserJWT returns an access token for the user's session, valid for lifetime.
 // The client can then use this to verify that the user has authenticated
 // with a valid Impact server by checking the signature and issuer.
 // If the client chooses, it could cache the token and reuse it until its
 // expiration time.
-func CreateUserJWT(user *users.User) string {
+func createUserJWT(user *users.User, session *database.Session, lifetime time.Duration) string {
 	now := time.Now()
 
-	return createJWT(impactUserJWT{
+	return createJWT(UserClaims{
 		Payload: jwt.Payload{
 			Issuer:         jwtIssuerURL,
 			Subject:        user.ID.String(),
 			Audience:       jwt.Audience{"impact_client", "impact_account"},
-			ExpirationTime: jwt.NumericDate(now.Add(24 * time.Hour)),
+			ExpirationTime: jwt.NumericDate(now.Add(lifetime)),
 			IssuedAt:       jwt.NumericDate(now),
+			JWTID:          uuid.New().String(),
 		},
 		MinecraftID: user.MinecraftID,
 		DiscordID:   user.DiscordID,
 		Roles:       user.RoleIDs(true), // 4.8.3
 		Legacy:      user.Legacy,
+		SessionID:   &session.ID,
+		TwoFactor:   session.TwoFactor,
 	})
 }
 
 func createJWT(payload interface{}) string {
-	token, err := jwt.Sign(payload, rs512)
+	signer := keys.signer()
+	token, err := jwt.Sign(payload, signer.alg, jwt.KeyID(signer.id))
 	if err != nil {
 		return ""
 	}
 	return string(token)
 }
 
-// respondWithToken responds to a http request with the token or returns a HTTPError
-func respondWithToken(user *users.User, c echo.Context) error {
-	token := CreateUserJWT(user)
+// tokenResponse is sent to clients that accept json
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // seconds
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// RespondWithToken starts a new session for the user and responds to a http request with its tokens, or returns a HTTPError.
+// Clients that accept json get a short lived access token and a refresh token,
+// anything else gets a plain text access token that lasts as long as the session.
+func RespondWithToken(user *users.User, c echo.Context) error {
+	return respondWithToken(user, false, c)
+}
+
+// respondWithToken is RespondWithToken, recording whether the user logged in with a second factor
+func respondWithToken(user *users.User, twoFactor bool, c echo.Context) error {
+	wantsJSON := strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON)
+
+	lifetime := legacyTokenLifetime
+	if wantsJSON {
+		lifetime = refreshTokenLifetime
+	}
+
+	secret, hash, err := NewSecret()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error creating session").SetInternal(err)
+	}
+	session, err := database.CreateSession(user.ID, hash, time.Now().Add(lifetime), c.Request().UserAgent(), util.RealIPBestGuess(c), twoFactor)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error creating session").SetInternal(err)
+	}
+
+	if !wantsJSON {
+		token := createUserJWT(user, session, legacyTokenLifetime)
+		if token == "" {
+			return echo.NewHTTPError(http.StatusInternalServerError, "error creating jwt token")
+		}
+		return c.String(http.StatusOK, token)
+	}
+
+	return respondWithTokenJSON(user, session, formatRefreshToken(session.ID, secret), c)
+}
+
+func respondWithTokenJSON(user *users.User, session *database.Session, refreshToken string, c echo.Context) error {
+	token := createUserJWT(user, session, accessTokenLifetime)
 	if token == "" {
 		return echo.NewHTTPError(http.StatusInternalServerError, "error creating jwt token")
 	}
-
-	// TODO respect Accept header
-	return c.String(http.StatusOK, token)
+	return c.JSON(http.StatusOK, tokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTokenLifetime / time.Second),
+		RefreshToken: refreshToken,
+	})
 }
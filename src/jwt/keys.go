@@ -0,0 +1,216 @@
+package jwt
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/util"
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/labstack/echo/v4"
+)
+
+// signingKey is an RSA key along with its key id
+type signingKey struct {
+	id  string
+	key *rsa.PrivateKey
+	alg *jwt.RSASHA
+}
+
+func newSigningKey(key *rsa.PrivateKey) signingKey {
+	return signingKey{
+		id:  thumbprint(&key.PublicKey),
+		key: key,
+		alg: jwt.NewRS512(jwt.RSAPrivateKey(key), jwt.RSAPublicKey(&key.PublicKey)),
+	}
+}
+
+// keySet holds every key we accept tokens from. The first key is used to sign new tokens,
+// the rest are retiring keys that are kept around until the tokens they signed have expired.
+type keySet []signingKey
+
+// loadKeys reads keys from JWT_KEYS, a comma separated list of base64 PKCS1 private keys with the signing key first.
+// JWT_KEY is still supported for a single key. If neither is set, a temporary key is generated.
+func loadKeys() keySet {
+	env := os.Getenv("JWT_KEYS")
+	if env == "" {
+		env = os.Getenv("JWT_KEY")
+	}
+
+	var keys keySet
+	for _, str := range strings.Split(env, ",") {
+		if str = strings.TrimSpace(str); str == "" {
+			continue
+		}
+		key, err := util.StrToRsa(str)
+		if err != nil {
+			fmt.Println("WARNING: Unable to load a JWT key from the environment", err)
+			continue
+		}
+		keys = append(keys, newSigningKey(key))
+	}
+
+	if len(keys) == 0 {
+		fmt.Println("WARNING: JWT_KEYS not specified, generating a temporary key. Tokens won't survive a restart.")
+		keys = append(keys, newSigningKey(util.GenerateRsa()))
+	}
+
+	for i, key := range keys {
+		if i == 0 {
+			fmt.Println("Signing JWTs with key", key.id)
+		} else {
+			fmt.Println("Accepting JWTs from retiring key", key.id)
+		}
+	}
+	return keys
+}
+
+// signer returns the key new tokens should be signed with
+func (keys keySet) signer() signingKey {
+	return keys[0]
+}
+
+// find returns the key with the given id
+func (keys keySet) find(id string) *signingKey {
+	for i := range keys {
+		if keys[i].id == id {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+// resolver returns a jwt.Algorithm that verifies with whichever key the token's kid header asks for.
+// A new one is needed for each token, since resolving stores the key.
+func (keys keySet) resolver() *keyResolver {
+	return &keyResolver{keys: keys, RSASHA: keys.signer().alg}
+}
+
+type keyResolver struct {
+	*jwt.RSASHA
+	keys keySet
+	// anyKey is set for tokens without a kid, see Verify
+	anyKey bool
+}
+
+// Resolve implements jwt.Resolver
+func (r *keyResolver) Resolve(header jwt.Header) error {
+	if header.KeyID == "" {
+		// Tokens from before key ids were added don't have one, they could be from any key we still accept
+		r.anyKey = true
+		return nil
+	}
+	key := r.keys.find(header.KeyID)
+	if key == nil {
+		return fmt.Errorf("unknown key id %q", header.KeyID)
+	}
+	r.RSASHA = key.alg
+	return nil
+}
+
+// Verify implements jwt.Algorithm, trying each key in order for tokens that didn't say which key signed them
+func (r *keyResolver) Verify(headerPayload, sig []byte) (err error) {
+	if !r.anyKey {
+		return r.RSASHA.Verify(headerPayload, sig)
+	}
+	for _, key := range r.keys {
+		err = key.alg.Verify(headerPayload, sig)
+		if err == nil {
+			r.RSASHA = key.alg
+			return nil
+		}
+	}
+	return err
+}
+
+// thumbprint returns the RFC 7638 JWK thumbprint of the key, which we use as its key id
+func thumbprint(key *rsa.PublicKey) string {
+	// Members must be in lexicographic order with no whitespace
+	data := fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, encodeBigInt(big.NewInt(int64(key.E))), encodeBigInt(key.N))
+	sum := sha256.Sum256([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func encodeBigInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+// jwk is a public key in JSON Web Key format
+type jwk struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Modulus   string `json:"n"`
+	Exponent  string `json:"e"`
+}
+
+// jwkSet is the JSON Web Key Set served at /.well-known/jwks.json
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+func (keys keySet) jwks() jwkSet {
+	ret := make([]jwk, 0, len(keys))
+	for _, key := range keys {
+		ret = append(ret, jwk{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: key.alg.Name(),
+			KeyID:     key.id,
+			Modulus:   encodeBigInt(key.key.N),
+			Exponent:  encodeBigInt(big.NewInt(int64(key.key.E))),
+		})
+	}
+	return jwkSet{ret}
+}
+
+// JWKSHandler serves the public keys tokens can be verified with
+func JWKSHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, keys.jwks())
+}
+
+// DiscoveryHandler serves an OpenID Connect style discovery document for the issuer
+func DiscoveryHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, discoveryDocument())
+}
+
+func discoveryDocument() map[string]interface{} {
+	// The api only describes authorization requests, the user approves them on the website's consent page
+	authorize := util.GetServerURL()
+	authorize.Path = "/authorize.html"
+
+	return map[string]interface{}{
+		"issuer":                                jwtIssuerURL,
+		"jwks_uri":                              jwtIssuerURL + "/.well-known/jwks.json",
+		"authorization_endpoint":                authorize.String(),
+		"token_endpoint":                        jwtIssuerURL + "/oauth/token",
+		"userinfo_endpoint":                     jwtIssuerURL + "/oauth/userinfo",
+		"scopes_supported":                      scopesSupported(),
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "client_credentials"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{keys.signer().alg.Name()},
+		"claims_supported":                      []string{"iss", "sub", "aud", "exp", "iat", "jti", "sid", "roles", "legacy", "mcuuid", "discordid"},
+	}
+}
+
+func scopesSupported() []string {
+	ret := make([]string, 0, len(Scopes)+len(ClientScopes))
+	for scope := range Scopes {
+		ret = append(ret, scope)
+	}
+	for scope := range ClientScopes {
+		ret = append(ret, scope)
+	}
+	sort.Strings(ret)
+	return ret
+}
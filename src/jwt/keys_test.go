@@ -0,0 +1,71 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThumbprint(t *testing.T) {
+	// Example from RFC 7638 section 3.1
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	assert.NoError(t, err)
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint(key))
+}
+
+func TestKeyRotation(t *testing.T) {
+	generate := func() signingKey {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newSigningKey(key)
+	}
+	oldKey, newKey := generate(), generate()
+
+	sign := func(keys keySet, withKeyID bool) []byte {
+		var opts []jwt.SignOption
+		if withKeyID {
+			opts = append(opts, jwt.KeyID(keys.signer().id))
+		}
+		token, err := jwt.Sign(jwt.Payload{Subject: "test"}, keys.signer().alg, opts...)
+		assert.NoError(t, err)
+		return token
+	}
+	verify := func(keys keySet, token []byte) error {
+		var payload jwt.Payload
+		_, err := jwt.Verify(token, keys.resolver(), &payload, jwt.ValidateHeader)
+		return err
+	}
+
+	before := keySet{oldKey}
+	during := keySet{newKey, oldKey}
+	after := keySet{newKey}
+
+	oldToken := sign(before, true)
+	assert.NoError(t, verify(during, oldToken), "retiring key should still be accepted")
+	assert.Error(t, verify(after, oldToken), "retired key should not be accepted")
+
+	newToken := sign(during, true)
+	assert.NoError(t, verify(after, newToken))
+	assert.Error(t, verify(before, newToken))
+
+	// Tokens from before key ids existed are checked against every key we still accept
+	assert.NoError(t, verify(before, sign(before, false)))
+	assert.NoError(t, verify(during, sign(before, false)), "retiring key should still be accepted without a kid")
+	assert.NoError(t, verify(during, sign(during, false)))
+	assert.Error(t, verify(after, sign(before, false)), "retired key should not be accepted without a kid")
+
+	jwks := during.jwks()
+	if assert.Len(t, jwks.Keys, 2) {
+		assert.Equal(t, newKey.id, jwks.Keys[0].KeyID)
+		assert.Equal(t, "RS512", jwks.Keys[0].Algorithm)
+		assert.Equal(t, "AQAB", jwks.Keys[0].Exponent)
+	}
+}
@@ -28,5 +28,5 @@ func MinecraftLoginHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, "no premium user found")
 	}
 
-	return respondWithToken(user, c)
+	return RespondWithToken(user, c)
 }
@@ -0,0 +1,184 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/google/uuid"
+)
+
+// oauthAudience is the audience of every OAuth access token.
+// First party tokens use "impact_account" instead, so neither can be used in place of the other.
+const oauthAudience = "impact_api"
+
+// oauthTokenLifetime is how long OAuth access tokens last, there are no refresh tokens so clients must reauthorize after this
+const oauthTokenLifetime = time.Hour
+
+// Scopes lists every OAuth scope along with a description to show the user when asking for consent
+var Scopes = map[string]string{
+	"profile:read": "See your linked Minecraft and Discord accounts",
+	"roles:read":   "See your roles, such as whether you have premium",
+}
+
+// ClientScopes are only granted to clients themselves with client_credentials, since they aren't about any one user.
+// They let server to server partners use the same integration endpoints as API keys.
+var ClientScopes = map[string]string{
+	"premium:check": "Look up a minecraft player's roles",
+	"mason:list":    "List the minecraft uuids of spawnmasons",
+	"userinfo:read": "Read the user info map without hashed uuids",
+	"donator:check": "Check whether a discord user has premium",
+}
+
+// LookupOAuthClient finds the client a token was issued to, it's a variable so tests can run without a database
+var LookupOAuthClient = database.GetOAuthClient
+
+// OAuthClaims are the claims in an OAuth access token
+type OAuthClaims struct {
+	jwt.Payload
+	// Scope is a space separated list of granted scopes
+	Scope    string `json:"scope"`
+	ClientID string `json:"client_id"`
+}
+
+// HasScope returns true if the token was granted the scope
+func (claims OAuthClaims) HasScope(scope string) bool {
+	for _, it := range strings.Fields(claims.Scope) {
+		if it == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsClientCredentials returns true if the token was issued to the client itself, rather than on behalf of a user
+func (claims OAuthClaims) IsClientCredentials() bool {
+	return claims.Subject == claims.ClientID
+}
+
+// ParseScopes splits a space separated scope string, checking every scope exists and is allowed.
+// The result is sorted and deduplicated.
+func ParseScopes(scope string, allowed []string) ([]string, error) {
+	return parseScopes(scope, allowed, Scopes)
+}
+
+// ParseClientScopes is ParseScopes for client_credentials grants, which can also be granted ClientScopes
+func ParseClientScopes(scope string, allowed []string) ([]string, error) {
+	return parseScopes(scope, allowed, Scopes, ClientScopes)
+}
+
+func parseScopes(scope string, allowed []string, known ...map[string]string) ([]string, error) {
+	seen := make(map[string]bool)
+	ret := make([]string, 0)
+	for _, it := range strings.Fields(scope) {
+		if seen[it] {
+			continue
+		}
+		seen[it] = true
+		if !isKnownScope(it, known) {
+			return nil, fmt.Errorf("unknown scope %q", it)
+		}
+		if !contains(allowed, it) {
+			return nil, fmt.Errorf("scope %q is not allowed for this client", it)
+		}
+		ret = append(ret, it)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func isKnownScope(scope string, known []map[string]string) bool {
+	for _, scopes := range known {
+		if _, ok := scopes[scope]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyPKCE checks the code verifier matches an S256 code challenge
+func VerifyPKCE(challenge string, verifier string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// CreateOAuthToken returns an access token for the client, acting on behalf of user.
+// If user is nil the token is for the client itself (the client credentials grant).
+func CreateOAuthToken(clientID string, user *users.User, scopes []string) (token string, expiresIn time.Duration) {
+	now := time.Now()
+	subject := clientID
+	if user != nil {
+		subject = user.ID.String()
+	}
+
+	return createJWT(OAuthClaims{
+		Payload: jwt.Payload{
+			Issuer:         jwtIssuerURL,
+			Subject:        subject,
+			Audience:       jwt.Audience{oauthAudience},
+			ExpirationTime: jwt.NumericDate(now.Add(oauthTokenLifetime)),
+			IssuedAt:       jwt.NumericDate(now),
+			JWTID:          uuid.New().String(),
+		},
+		Scope:    strings.Join(scopes, " "),
+		ClientID: clientID,
+	}), oauthTokenLifetime
+}
+
+// VerifyOAuth checks the OAuth access token is valid, returning its claims and the user it acts on behalf of.
+// The user is nil for client credentials tokens.
+func VerifyOAuth(token string) (*users.User, *OAuthClaims, error) {
+	var (
+		now    = time.Now()
+		claims OAuthClaims
+	)
+	_, err := jwt.Verify([]byte(token), keys.resolver(), &claims, jwt.ValidateHeader, jwt.ValidatePayload(&claims.Payload,
+		jwt.IssuerValidator(jwtIssuerURL),
+		jwt.IssuedAtValidator(now),
+		jwt.ExpirationTimeValidator(now),
+		jwt.AudienceValidator(jwt.Audience{oauthAudience}),
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Deleting the client revokes all of its tokens
+	client, err := LookupOAuthClient(claims.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if client == nil {
+		return nil, nil, fmt.Errorf("oauth client %s no longer exists", claims.ClientID)
+	}
+
+	if claims.IsClientCredentials() {
+		return nil, &claims, nil
+	}
+
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, nil, err
+	}
+	user := database.LookupUserByID(id)
+	if user == nil {
+		return nil, nil, fmt.Errorf("unable to find user with id %s", id.String())
+	}
+	return user, &claims, nil
+}
+
+func contains(list []string, str string) bool {
+	for _, it := range list {
+		if it == str {
+			return true
+		}
+	}
+	return false
+}
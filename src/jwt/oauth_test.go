@@ -0,0 +1,74 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScopes(t *testing.T) {
+	allowed := []string{"profile:read", "roles:read"}
+
+	scopes, err := ParseScopes("roles:read profile:read  roles:read", allowed)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"profile:read", "roles:read"}, scopes)
+	}
+
+	scopes, err = ParseScopes("", allowed)
+	if assert.NoError(t, err) {
+		assert.Empty(t, scopes)
+	}
+
+	_, err = ParseScopes("profile:read", []string{"roles:read"})
+	assert.Error(t, err)
+	_, err = ParseScopes("everything", allowed)
+	assert.Error(t, err)
+
+	// Client scopes can't be consented to by users, only granted to the client itself
+	_, err = ParseScopes("mason:list", []string{"mason:list"})
+	assert.Error(t, err)
+	scopes, err = ParseClientScopes("mason:list roles:read", []string{"mason:list", "roles:read"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"mason:list", "roles:read"}, scopes)
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	// Example from RFC 7636 appendix B
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	assert.True(t, VerifyPKCE(challenge, "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+	assert.False(t, VerifyPKCE(challenge, "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXl"))
+	assert.False(t, VerifyPKCE(challenge, ""))
+}
+
+func TestOAuthClaims(t *testing.T) {
+	claims := OAuthClaims{Scope: "profile:read roles:read", ClientID: "abc"}
+	claims.Subject = "abc"
+	assert.True(t, claims.HasScope("roles:read"))
+	assert.False(t, claims.HasScope("roles"))
+	assert.True(t, claims.IsClientCredentials())
+
+	claims.Subject = uuid.New().String()
+	assert.False(t, claims.IsClientCredentials())
+}
+
+func TestTokenAudiencesAreSeparate(t *testing.T) {
+	user := &users.User{ID: uuid.New()}
+
+	// An OAuth token must not be accepted as a first party token
+	oauthToken, expiresIn := CreateOAuthToken("abc", user, []string{"profile:read"})
+	assert.NotEmpty(t, oauthToken)
+	assert.Equal(t, time.Hour, expiresIn)
+	_, _, err := Verify(oauthToken)
+	assert.Error(t, err)
+
+	// And vice versa
+	userToken := createUserJWT(user, &database.Session{ID: uuid.New()}, time.Minute)
+	assert.NotEmpty(t, userToken)
+	_, _, err = VerifyOAuth(userToken)
+	assert.Error(t, err)
+}
@@ -34,5 +34,14 @@ func PasswordLoginHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, "incorrect password")
 	}
 
-	return respondWithToken(user, c)
+	// Users with two factor enabled get a challenge to complete with TwoFactorLoginHandler instead
+	twoFactor, err := database.HasTwoFactor(user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error checking two factor authentication").SetInternal(err)
+	}
+	if twoFactor {
+		return respondWithChallenge(user, c)
+	}
+
+	return RespondWithToken(user, c)
 }
@@ -0,0 +1,95 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/util"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Refresh tokens look like "<session id>.<secret>". Only a hash of the secret is stored.
+
+// NewSecret returns a random url safe secret and its hash, e.g. for refresh tokens or OAuth client secrets
+func NewSecret() (secret string, hash string, err error) {
+	buf := make([]byte, 32)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return
+	}
+	secret = base64.RawURLEncoding.EncodeToString(buf)
+	hash = HashSecret(secret)
+	return
+}
+
+// HashSecret returns the hex sha256 of a high entropy secret. Passwords should use bcrypt instead.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func formatRefreshToken(sessionID uuid.UUID, secret string) string {
+	return sessionID.String() + "." + secret
+}
+
+// parseRefreshToken splits a refresh token into its session id and the hash of its secret
+func parseRefreshToken(token string) (sessionID uuid.UUID, hash string, err error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		err = errors.New("malformed refresh token")
+		return
+	}
+	sessionID, err = uuid.Parse(parts[0])
+	if err != nil {
+		return
+	}
+	hash = HashSecret(parts[1])
+	return
+}
+
+// RefreshHandler swaps a refresh token for a new access token and a new refresh token.
+// Each refresh token can only be used once, using one twice revokes the session.
+func RefreshHandler(c echo.Context) error {
+	var body struct {
+		RefreshToken string `json:"refresh_token" form:"refresh_token" query:"refresh_token"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+	if body.RefreshToken == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "refresh_token must be provided")
+	}
+
+	sessionID, hash, err := parseRefreshToken(strings.TrimSpace(body.RefreshToken))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid refresh token").SetInternal(err)
+	}
+	secret, newHash, err := NewSecret()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error refreshing session").SetInternal(err)
+	}
+
+	session, err := database.RotateSession(sessionID, hash, newHash, time.Now().Add(refreshTokenLifetime), c.Request().UserAgent(), util.RealIPBestGuess(c))
+	switch err {
+	case nil:
+	case database.ErrSessionNotFound, database.ErrRefreshTokenReused:
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error()).SetInternal(err)
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "error refreshing session").SetInternal(err)
+	}
+
+	user := database.LookupUserByID(session.UserID)
+	if user == nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "no user found")
+	}
+
+	return respondWithTokenJSON(user, session, formatRefreshToken(session.ID, secret), c)
+}
@@ -0,0 +1,30 @@
+package jwt
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshToken(t *testing.T) {
+	secret, hash, err := NewSecret()
+	assert.NoError(t, err)
+	assert.NotContains(t, secret, ".")
+
+	id := uuid.New()
+	parsedID, parsedHash, err := parseRefreshToken(formatRefreshToken(id, secret))
+	if assert.NoError(t, err) {
+		assert.Equal(t, id, parsedID)
+		assert.Equal(t, hash, parsedHash)
+	}
+
+	other, _, err := NewSecret()
+	assert.NoError(t, err)
+	assert.NotEqual(t, secret, other)
+
+	for _, token := range []string{"", secret, id.String(), id.String() + ".", "not-a-uuid." + secret} {
+		_, _, err = parseRefreshToken(token)
+		assert.Error(t, err, token)
+	}
+}
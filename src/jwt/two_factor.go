@@ -0,0 +1,160 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/totp"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// challengeLifetime is how long the user has to enter their code after entering their password
+	challengeLifetime = 5 * time.Minute
+	// challengeAudience stops challenge tokens being used as anything else
+	challengeAudience = "impact_2fa"
+
+	recoveryCodeCount    = 10
+	recoveryCodeLength   = 10
+	recoveryCodeAlphabet = "abcdefghijklmnopqrstuvwxyz234567" // 32 characters, so bytes map to them without bias
+)
+
+// challengeResponse is sent instead of a token when the user needs to enter their second factor
+type challengeResponse struct {
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int64  `json:"expires_in"` // seconds
+}
+
+// createChallengeJWT returns a token proving the user got their password right, to be swapped for a real token along with their code
+func createChallengeJWT(user *users.User) string {
+	now := time.Now()
+	return createJWT(jwt.Payload{
+		Issuer:         jwtIssuerURL,
+		Subject:        user.ID.String(),
+		Audience:       jwt.Audience{challengeAudience},
+		ExpirationTime: jwt.NumericDate(now.Add(challengeLifetime)),
+		IssuedAt:       jwt.NumericDate(now),
+		JWTID:          uuid.New().String(),
+	})
+}
+
+// verifyChallengeJWT checks a token from createChallengeJWT, returning the user id it was issued for
+func verifyChallengeJWT(token string) (uuid.UUID, error) {
+	var (
+		now     = time.Now()
+		payload jwt.Payload
+
+		validator = jwt.ValidatePayload(&payload,
+			jwt.IssuerValidator(jwtIssuerURL),
+			jwt.IssuedAtValidator(now),
+			jwt.ExpirationTimeValidator(now),
+			jwt.AudienceValidator(jwt.Audience{challengeAudience}))
+	)
+	_, err := jwt.Verify([]byte(token), keys.resolver(), &payload, jwt.ValidateHeader, validator)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(payload.Subject)
+}
+
+// respondWithChallenge tells the client to ask the user for their second factor, then call TwoFactorLoginHandler.
+// Clients that only understand plain text tokens would think the challenge was a token, so they get a session that
+// doesn't count as two factor instead. That's enough to use the client, but not privileged endpoints, see middleware.RequireTwoFactor.
+func respondWithChallenge(user *users.User, c echo.Context) error {
+	if !strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON) {
+		return respondWithToken(user, false, c)
+	}
+	token := createChallengeJWT(user)
+	if token == "" {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error creating jwt token")
+	}
+	return c.JSON(http.StatusOK, challengeResponse{
+		ChallengeToken: token,
+		ExpiresIn:      int64(challengeLifetime / time.Second),
+	})
+}
+
+// NewRecoveryCodes returns a new set of one time recovery codes, along with their hashes to store
+func NewRecoveryCodes() (codes []string, hashes []string, err error) {
+	buf := make([]byte, recoveryCodeCount*recoveryCodeLength)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return
+	}
+	for i := 0; i < recoveryCodeCount; i++ {
+		var code strings.Builder
+		for j, b := range buf[i*recoveryCodeLength : (i+1)*recoveryCodeLength] {
+			if j == recoveryCodeLength/2 {
+				code.WriteByte('-')
+			}
+			code.WriteByte(recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+		}
+		codes = append(codes, code.String())
+		hashes = append(hashes, hashRecoveryCode(code.String()))
+	}
+	return
+}
+
+// hashRecoveryCode hashes a recovery code, ignoring case, spaces and dashes since people will type them out by hand
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return HashSecret(code)
+}
+
+// CheckSecondFactor checks either a TOTP code or a recovery code, using it up so that it can't be used again
+func CheckSecondFactor(userID uuid.UUID, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) != totp.Digits {
+		return database.UseRecoveryCode(userID, hashRecoveryCode(code))
+	}
+
+	secret, err := database.GetTOTP(userID)
+	if err != nil || secret == nil || !secret.Enabled() {
+		return false, err
+	}
+	step, ok := totp.Validate(secret.Secret, code, time.Now(), secret.LastUsedStep)
+	if !ok {
+		return false, nil
+	}
+	return database.UseTOTPStep(userID, step)
+}
+
+// TwoFactorLoginHandler swaps the challenge token from a password login, along with a TOTP or recovery code, for a real token
+func TwoFactorLoginHandler(c echo.Context) error {
+	var body struct {
+		ChallengeToken string `json:"challenge_token" form:"challenge_token"`
+		Code           string `json:"code" form:"code"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+	if body.ChallengeToken == "" || body.Code == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "challenge_token and code must both be provided")
+	}
+
+	userID, err := verifyChallengeJWT(body.ChallengeToken)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid challenge token").SetInternal(err)
+	}
+	user := database.LookupUserByID(userID)
+	if user == nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "no user found")
+	}
+
+	ok, err := CheckSecondFactor(user.ID, body.Code)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error checking code").SetInternal(err)
+	}
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "incorrect code")
+	}
+
+	return respondWithToken(user, true, c)
+}
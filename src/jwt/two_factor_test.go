@@ -0,0 +1,65 @@
+package jwt
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	require.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+	assert.Len(t, hashes, recoveryCodeCount)
+
+	format := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		assert.Regexp(t, format, code)
+		assert.False(t, seen[code], "duplicate code %s", code)
+		seen[code] = true
+		assert.Equal(t, hashes[i], hashRecoveryCode(code))
+	}
+
+	// People type these in however they like
+	code := codes[0]
+	assert.Equal(t, hashes[0], hashRecoveryCode(strings.ToUpper(code)))
+	assert.Equal(t, hashes[0], hashRecoveryCode(strings.Replace(code, "-", "", 1)))
+	assert.Equal(t, hashes[0], hashRecoveryCode(strings.Replace(code, "-", " ", 1)))
+}
+
+func TestChallengeJWT(t *testing.T) {
+	user := &users.User{ID: uuid.New()}
+
+	token := createChallengeJWT(user)
+	id, err := verifyChallengeJWT(token)
+	if assert.NoError(t, err) {
+		assert.Equal(t, user.ID, id)
+	}
+
+	// Challenges can't be used as access tokens, and access tokens can't skip the challenge
+	_, _, err = Verify(token)
+	assert.Error(t, err)
+	_, err = verifyChallengeJWT(createUserJWT(user, &database.Session{ID: uuid.New()}, time.Minute))
+	assert.Error(t, err)
+
+	// Expired challenges are rejected
+	now := time.Now()
+	expired := createJWT(jwt.Payload{
+		Issuer:         jwtIssuerURL,
+		Subject:        user.ID.String(),
+		Audience:       jwt.Audience{challengeAudience},
+		ExpirationTime: jwt.NumericDate(now.Add(-time.Minute)),
+		IssuedAt:       jwt.NumericDate(now.Add(-challengeLifetime)),
+	})
+	_, err = verifyChallengeJWT(expired)
+	assert.Error(t, err)
+}
@@ -0,0 +1,124 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/util"
+	"github.com/ImpactDevelopment/ImpactServer/src/webauthn"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// webAuthnChallengeLifetime is how long the user has to use their authenticator, matching webauthn.Timeout
+const webAuthnChallengeLifetime = webauthn.Timeout * time.Millisecond
+
+// WebAuthn is the relying party passkeys are registered with. Credentials are scoped to the server's domain and all its subdomains.
+var WebAuthn webauthn.RelyingParty
+
+func init() {
+	WebAuthn = webauthn.RelyingParty{
+		ID:   util.GetServerURL().Hostname(),
+		Name: "Impact",
+	}
+}
+
+func hashWebAuthnChallenge(challenge []byte) string {
+	return HashSecret(base64.RawURLEncoding.EncodeToString(challenge))
+}
+
+// NewWebAuthnChallenge returns a new single use challenge, for registering a credential for userID or for logging in if it's uuid.Nil
+func NewWebAuthnChallenge(userID uuid.UUID) ([]byte, error) {
+	challenge := make([]byte, 32)
+	_, err := rand.Read(challenge)
+	if err != nil {
+		return nil, err
+	}
+	err = database.CreateWebAuthnChallenge(hashWebAuthnChallenge(challenge), userID, time.Now().Add(webAuthnChallengeLifetime))
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// CheckWebAuthnChallenge uses up the challenge the client signed, making sure it was issued to userID (uuid.Nil when logging in)
+func CheckWebAuthnChallenge(clientData *webauthn.ClientData, userID uuid.UUID) error {
+	issuedTo, ok, err := database.ConsumeWebAuthnChallenge(hashWebAuthnChallenge(clientData.Challenge))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error checking challenge").SetInternal(err)
+	}
+	if !ok || issuedTo != userID {
+		return echo.NewHTTPError(http.StatusUnauthorized, "unknown or expired challenge")
+	}
+	return nil
+}
+
+// WebAuthnOptionsHandler starts a passkey login, responding with the options to pass to navigator.credentials.get
+func WebAuthnOptionsHandler(c echo.Context) error {
+	challenge, err := NewWebAuthnChallenge(uuid.Nil)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error creating challenge").SetInternal(err)
+	}
+	return c.JSON(http.StatusOK, WebAuthn.RequestOptions(challenge))
+}
+
+// WebAuthnLoginHandler finishes a passkey login, responding with the same tokens as any other login.
+// Passkeys that verified the user (e.g. with a PIN or fingerprint) count as two factor authentication.
+func WebAuthnLoginHandler(c echo.Context) error {
+	var body webauthn.AssertionResponse
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+	if len(body.RawID) == 0 || body.Type != "public-key" {
+		return echo.NewHTTPError(http.StatusBadRequest, "a public-key credential must be provided")
+	}
+
+	clientData, err := webauthn.ParseClientData(body.Response.ClientDataJSON)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+	err = CheckWebAuthnChallenge(clientData, uuid.Nil)
+	if err != nil {
+		return err
+	}
+
+	credential, err := database.GetWebAuthnCredential(body.RawID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error fetching passkey").SetInternal(err)
+	}
+	if credential == nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "unknown passkey")
+	}
+	// Discoverable credentials tell us who they belong to, which had better match
+	if len(body.Response.UserHandle) > 0 && !bytes.Equal(body.Response.UserHandle, credential.UserID[:]) {
+		return echo.NewHTTPError(http.StatusUnauthorized, "passkey belongs to a different user")
+	}
+
+	assertion, err := WebAuthn.VerifyAssertion(webauthn.Credential{
+		ID:        credential.ID,
+		PublicKey: credential.PublicKey,
+		Algorithm: credential.Algorithm,
+		SignCount: credential.SignCount,
+	}, clientData, body.Response.AuthenticatorData, body.Response.Signature)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid passkey").SetInternal(err)
+	}
+	used, err := database.UseWebAuthnCredential(credential.ID, credential.SignCount, assertion.SignCount)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "error updating passkey").SetInternal(err)
+	}
+	if !used {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid passkey").SetInternal(errors.New("sign count changed concurrently"))
+	}
+
+	user := database.LookupUserByID(credential.UserID)
+	if user == nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "no user found")
+	}
+	return respondWithToken(user, assertion.UserVerified, c)
+}
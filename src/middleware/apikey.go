@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/jwt"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const apiKeyCtxKey = "api_key"
+
+var authAPIKeyRegx = regexp.MustCompile(`^ApiKey\s+(\S+)`)
+
+// apiKeyOnlyScopes are too powerful to give to OAuth clients, so only API keys can be granted them
+var apiKeyOnlyScopes = map[string]string{
+	"tokens:generate": "Generate registration tokens that grant roles",
+	"email:test":      "Send test emails",
+	"files:alternate": "Download files from the alternate bucket",
+}
+
+// APIKeyScopes lists every scope an API key can be granted, along with a description for staff.
+// That's everything jwt.ClientScopes has, so partners can use either, plus apiKeyOnlyScopes.
+var APIKeyScopes = func() map[string]string {
+	scopes := make(map[string]string, len(jwt.ClientScopes)+len(apiKeyOnlyScopes))
+	for scope, description := range jwt.ClientScopes {
+		scopes[scope] = description
+	}
+	for scope, description := range apiKeyOnlyScopes {
+		scopes[scope] = description
+	}
+	return scopes
+}()
+
+// API keys look like "<key id>.<secret>". Only a hash of the secret is stored.
+
+// NewAPIKey generates a new API key, returning its id, the key to give to its owner, and the hash to store
+func NewAPIKey() (id uuid.UUID, key string, hash string, err error) {
+	secret, hash, err := jwt.NewSecret()
+	if err != nil {
+		return
+	}
+	id = uuid.New()
+	key = id.String() + "." + secret
+	return
+}
+
+// parseAPIKey splits an API key into its id and the hash of its secret
+func parseAPIKey(key string) (id uuid.UUID, hash string, err error) {
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		err = errors.New("malformed api key")
+		return
+	}
+	id, err = uuid.Parse(parts[0])
+	if err != nil {
+		return
+	}
+	hash = jwt.HashSecret(parts[1])
+	return
+}
+
+// GetAPIKey returns the API key used to authenticate, presumably by the RequireAPIKey middleware.
+// Otherwise it returns nil.
+func GetAPIKey(c echo.Context) (key *database.APIKey) {
+	key, _ = c.Get(apiKeyCtxKey).(*database.APIKey)
+	return
+}
+
+// RequireAPIKeyOrScope returns a middleware that accepts either an API key with the given scope (see RequireAPIKey),
+// or an OAuth access token that was granted it (see RequireScope), e.g. a partner using client_credentials.
+func RequireAPIKeyOrScope(scope string) echo.MiddlewareFunc {
+	if _, ok := jwt.ClientScopes[scope]; !ok {
+		panic("unknown oauth client scope " + scope)
+	}
+	requireAPIKey := RequireAPIKey(scope)
+	requireScope := RequireScope(scope)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withAPIKey := requireAPIKey(next)
+		withScope := requireScope(next)
+		return func(c echo.Context) error {
+			if authAPIKeyRegx.MatchString(c.Request().Header.Get(echo.HeaderAuthorization)) {
+				return withAPIKey(c)
+			}
+			return withScope(c)
+		}
+	}
+}
+
+// RequireAPIKey returns a middleware that requires an API key with the given scope,
+// sent as "Authorization: ApiKey <key>" so that it doesn't end up in access logs.
+// For a missing or invalid key, it sends “401 - Unauthorized”. For a key without the scope, “403 - Forbidden”.
+func RequireAPIKey(scope string) echo.MiddlewareFunc {
+	if _, ok := APIKeyScopes[scope]; !ok {
+		panic("unknown api key scope " + scope)
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			m := authAPIKeyRegx.FindStringSubmatch(c.Request().Header.Get(echo.HeaderAuthorization))
+			if len(m) != 2 || m[1] == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "api key is required")
+			}
+			id, hash, err := parseAPIKey(m[1])
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid api key").SetInternal(err)
+			}
+			key, err := database.GetAPIKey(id)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "error checking api key").SetInternal(err)
+			}
+			if key == nil || key.Revoked() || subtle.ConstantTimeCompare([]byte(hash), []byte(key.KeyHash)) != 1 {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid api key")
+			}
+			if !key.HasScope(scope) {
+				return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("api key does not have scope %s", scope))
+			}
+
+			err = database.TouchAPIKey(key.ID)
+			if err != nil {
+				// Not worth failing the request over
+				log.Println("Error updating api key last used", err)
+			}
+			c.Set(apiKeyCtxKey, key)
+			return next(c)
+		}
+	}
+}
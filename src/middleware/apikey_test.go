@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyFormat(t *testing.T) {
+	id, key, hash, err := NewAPIKey()
+	require.NoError(t, err)
+
+	parsedID, parsedHash, err := parseAPIKey(key)
+	require.NoError(t, err)
+	assert.Equal(t, id, parsedID)
+	assert.Equal(t, hash, parsedHash)
+
+	// The hash must be of the secret, not the whole key
+	assert.NotEqual(t, jwt.HashSecret(key), parsedHash)
+
+	for _, bad := range []string{"", "nope", id.String(), id.String() + ".", "notauuid.secret"} {
+		_, _, err = parseAPIKey(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	for scope := range jwt.ClientScopes {
+		assert.Contains(t, APIKeyScopes, scope, "api keys can do anything a client can")
+	}
+	for scope := range apiKeyOnlyScopes {
+		assert.Contains(t, APIKeyScopes, scope)
+		assert.NotContains(t, jwt.ClientScopes, scope)
+	}
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	test := func(header string) int {
+		e := echo.New()
+		e.GET("/", func(c echo.Context) error {
+			return c.String(http.StatusOK, "Ok cowboy")
+		}, RequireAPIKey("premium:check"))
+		req := httptest.NewRequest(http.MethodGet, "/?auth=secret", nil)
+		if header != "" {
+			req.Header.Set(echo.HeaderAuthorization, header)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Rejected before ever reaching the database
+	assert.Equal(t, http.StatusUnauthorized, test(""))
+	assert.Equal(t, http.StatusUnauthorized, test("Bearer foo"))
+	assert.Equal(t, http.StatusUnauthorized, test("ApiKey"))
+	assert.Equal(t, http.StatusUnauthorized, test("ApiKey malformed"))
+
+	assert.Panics(t, func() {
+		RequireAPIKey("not:a:scope")
+	})
+}
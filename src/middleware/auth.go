@@ -6,11 +6,13 @@ import (
 	"github.com/ImpactDevelopment/ImpactServer/src/users"
 	"github.com/labstack/echo/v4"
 	"net/http"
-	"os"
 	"regexp"
 )
 
 const userCtxKey = "user"
+const claimsCtxKey = "claims"
+const oauthCtxKey = "oauth"
+const oauthUserCtxKey = "oauth_user"
 
 var authBearerRegx = regexp.MustCompile(`^Bearer\s+(\S+)`)
 
@@ -22,6 +24,25 @@ func GetUser(c echo.Context) (user *users.User) {
 	return
 }
 
+// GetClaims returns the claims of the token used to authenticate, or nil if not authenticated
+func GetClaims(c echo.Context) (claims *jwt.UserClaims) {
+	claims, _ = c.Get(claimsCtxKey).(*jwt.UserClaims)
+	return
+}
+
+// GetOAuthClaims returns the claims of the OAuth access token used to authenticate, or nil if one wasn't used
+func GetOAuthClaims(c echo.Context) (claims *jwt.OAuthClaims) {
+	claims, _ = c.Get(oauthCtxKey).(*jwt.OAuthClaims)
+	return
+}
+
+// GetOAuthUser returns the user an OAuth access token acts on behalf of.
+// It returns nil if an OAuth token wasn't used, or if it was issued to the client itself.
+func GetOAuthUser(c echo.Context) (user *users.User) {
+	user, _ = c.Get(oauthUserCtxKey).(*users.User)
+	return
+}
+
 var Auth = func(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		if header := c.Request().Header.Get(echo.HeaderAuthorization); header != "" {
@@ -29,12 +50,20 @@ var Auth = func(next echo.HandlerFunc) echo.HandlerFunc {
 				token := m[1]
 
 				// Verify the JWT
-				user, err := jwt.Verify(token)
+				user, claims, err := jwt.Verify(token)
 				if err != nil {
-					return echo.NewHTTPError(http.StatusUnauthorized, "invalid token").SetInternal(err)
+					// Maybe it's a third party's OAuth token. That doesn't set userCtxKey, so it can only be used with RequireScope
+					oauthUser, oauthClaims, oauthErr := jwt.VerifyOAuth(token)
+					if oauthErr != nil {
+						return echo.NewHTTPError(http.StatusUnauthorized, "invalid token").SetInternal(err)
+					}
+					c.Set(oauthCtxKey, oauthClaims)
+					c.Set(oauthUserCtxKey, oauthUser)
+					return next(c)
 				}
 				// Set the user context userCtxKey
 				c.Set(userCtxKey, user)
+				c.Set(claimsCtxKey, claims)
 			}
 		}
 		return next(c)
@@ -85,7 +114,7 @@ func RequireRole(roles ...string) echo.MiddlewareFunc {
 			for _, role := range user.Roles {
 				for _, required := range roles {
 					if role.ID == required {
-						return next(c)
+						return checkTwoFactor(next)(c)
 					}
 				}
 			}
@@ -96,12 +125,36 @@ func RequireRole(roles ...string) echo.MiddlewareFunc {
 	}
 }
 
-func AuthGetParam() echo.MiddlewareFunc {
+// RequireTwoFactor is RequireAuth, but also requires users who hold privileged roles (see users.User.RequiresTwoFactor)
+// to have logged in using two factor authentication. Everyone else only needs to be logged in.
+// RequireRole already does this, so it only needs to be used on privileged endpoints that anyone can use.
+var RequireTwoFactor = func(next echo.HandlerFunc) echo.HandlerFunc {
+	return RequireAuth(checkTwoFactor(next))
+}
+
+// checkTwoFactor sends “403 - Forbidden” if the user should have used two factor authentication but didn't
+func checkTwoFactor(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if user := GetUser(c); user != nil && user.RequiresTwoFactor() {
+			if claims := GetClaims(c); claims == nil || !claims.TwoFactor {
+				return echo.NewHTTPError(http.StatusForbidden, "two factor authentication is required, enable it then log in with your password and code")
+			}
+		}
+		return next(c)
+	}
+}
+
+// RequireScope returns a middleware that requires an OAuth access token that was granted the scope.
+// The user the token acts on behalf of (if any) can be found with GetOAuthUser.
+func RequireScope(scope string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			auth := c.QueryParam("auth") + "0"
-			if auth != os.Getenv("API_AUTH_SECRET") {
-				return c.JSON(http.StatusForbidden, "auth wrong im sowwy")
+			claims := GetOAuthClaims(c)
+			if claims == nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "oauth access token is required")
+			}
+			if !claims.HasScope(scope) {
+				return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("token does not have scope %s", scope))
 			}
 			return next(c)
 		}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/jwt"
+	"github.com/ImpactDevelopment/ImpactServer/src/users"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckTwoFactor(t *testing.T) {
+	test := func(roles []string, claims *jwt.UserClaims) int {
+		user := &users.User{}
+		for _, role := range roles {
+			user.Roles = append(user.Roles, users.Role{ID: role})
+		}
+		e := echo.New()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		c.Set(userCtxKey, user)
+		if claims != nil {
+			c.Set(claimsCtxKey, claims)
+		}
+		err := checkTwoFactor(func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})(c)
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he.Code
+		}
+		return c.Response().Status
+	}
+
+	withTwoFactor := &jwt.UserClaims{TwoFactor: true}
+	withoutTwoFactor := &jwt.UserClaims{}
+
+	assert.Equal(t, http.StatusOK, test(nil, withoutTwoFactor))
+	assert.Equal(t, http.StatusOK, test([]string{"premium"}, withoutTwoFactor))
+	assert.Equal(t, http.StatusForbidden, test([]string{"staff"}, withoutTwoFactor))
+	assert.Equal(t, http.StatusForbidden, test([]string{"premium", "developer"}, nil))
+	assert.Equal(t, http.StatusOK, test([]string{"staff"}, withTwoFactor))
+}
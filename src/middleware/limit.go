@@ -55,7 +55,7 @@ func (lim *rateLimiter) add(key string) *rate.Limiter {
 	// Double check nothing was added since last calling RUnlock()
 	limiter, exists := lim.keys[key]
 	if !exists {
-		limiter := rate.NewLimiter(lim.rate, lim.bursts)
+		limiter = rate.NewLimiter(lim.rate, lim.bursts)
 		lim.keys[key] = limiter
 	}
 
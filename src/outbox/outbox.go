@@ -0,0 +1,127 @@
+// Package outbox runs side effects, like Discord messages or emails, after the database change they're about has committed.
+//
+// Jobs are inserted into the outbox_jobs table in the same transaction as the change, then a pool of
+// workers runs them with retries and exponential backoff. Jobs that run out of attempts are kept as dead
+// letters for a while so that staff can inspect and replay them.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+)
+
+// DefaultMaxAttempts is how many times a job is tried before it's dead, unless its kind says otherwise
+const DefaultMaxAttempts = 10
+
+// Handler runs a job. Returning an error retries the job later, unless it's Permanent.
+// The same job can run more than once, e.g. if the server restarts part way through, so handlers should be idempotent where possible.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Options configure how jobs of one kind are run
+type Options struct {
+	// MaxAttempts before the job is dead, DefaultMaxAttempts if zero
+	MaxAttempts int
+	// Redact lists payload fields that staff shouldn't see, e.g. email addresses, see Redact
+	Redact []string
+}
+
+// alwaysRedacted are payload fields that are hidden whatever the kind, in case an older server queued a secret
+var alwaysRedacted = []string{"token", "discord_token"}
+
+type kind struct {
+	handler Handler
+	options Options
+}
+
+var (
+	kinds     = make(map[string]kind)
+	kindsLock sync.RWMutex
+)
+
+// Register sets the handler for a kind of job, it should be called from init
+func Register(name string, handler Handler, options Options) {
+	kindsLock.Lock()
+	defer kindsLock.Unlock()
+	if _, ok := kinds[name]; ok {
+		panic("outbox job kind " + name + " registered twice")
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = DefaultMaxAttempts
+	}
+	kinds[name] = kind{handler, options}
+}
+
+func getKind(name string) (kind, bool) {
+	kindsLock.RLock()
+	defer kindsLock.RUnlock()
+	k, ok := kinds[name]
+	return k, ok
+}
+
+// Redact returns a copy of the job with the fields its kind lists in Options.Redact hidden, for showing it to staff
+func Redact(job database.Job) database.Job {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(job.Payload, &fields) != nil {
+		// Not an object, so there are no fields to hide. Hide the whole thing in case it's a secret.
+		job.Payload = json.RawMessage(`"[redacted]"`)
+		return job
+	}
+	hidden := alwaysRedacted
+	if k, ok := getKind(job.Kind); ok {
+		hidden = append(hidden[:len(hidden):len(hidden)], k.options.Redact...)
+	}
+	for _, field := range hidden {
+		if _, ok := fields[field]; ok {
+			fields[field] = json.RawMessage(`"[redacted]"`)
+		}
+	}
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		payload = []byte(`"[redacted]"`)
+	}
+	job.Payload = payload
+	return job
+}
+
+// Execer is implemented by both *sql.DB and *sql.Tx
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Enqueue adds a job to the outbox. payload is encoded as json and given to the kind's Handler.
+// Pass the transaction making the change the job is about, so that the job only runs if it commits.
+func Enqueue(tx Execer, name string, payload interface{}) error {
+	k, ok := getKind(name)
+	if !ok {
+		return fmt.Errorf("unknown outbox job kind %s", name)
+	}
+	if db, ok := tx.(*sql.DB); tx == nil || ok && db == nil {
+		return errors.New("no database to enqueue job in")
+	}
+	return database.EnqueueJob(tx, name, payload, k.options.MaxAttempts)
+}
+
+// permanentError marks an error that retrying won't fix
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Permanent wraps err so the job is dead straight away instead of being retried, e.g. if the payload is invalid
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+func isPermanent(err error) bool {
+	_, ok := err.(permanentError)
+	return ok
+}
@@ -0,0 +1,85 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, backoff(1))
+	assert.Equal(t, 20*time.Second, backoff(2))
+	assert.Equal(t, 40*time.Second, backoff(3))
+	assert.Equal(t, backoffMax, backoff(20))
+	assert.Equal(t, backoffMax, backoff(1000), "shouldn't overflow")
+
+	for i := 0; i < 100; i++ {
+		delay := jitter(time.Minute)
+		assert.True(t, delay >= 48*time.Second && delay < 72*time.Second, delay)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("test.register", func(ctx context.Context, payload json.RawMessage) error { return nil }, Options{})
+	k, ok := getKind("test.register")
+	require.True(t, ok)
+	assert.Equal(t, DefaultMaxAttempts, k.options.MaxAttempts)
+
+	assert.Panics(t, func() {
+		Register("test.register", func(ctx context.Context, payload json.RawMessage) error { return nil }, Options{})
+	})
+
+	assert.Error(t, Enqueue(nil, "test.unknown", nil))
+	assert.Error(t, Enqueue(nil, "test.register", nil), "no database")
+}
+
+func TestRun(t *testing.T) {
+	var got struct {
+		Name string `json:"name"`
+	}
+	Register("test.run", func(ctx context.Context, payload json.RawMessage) error {
+		_, ok := ctx.Deadline()
+		assert.True(t, ok, "handlers should have a timeout")
+		return json.Unmarshal(payload, &got)
+	}, Options{MaxAttempts: 3})
+	Register("test.panic", func(ctx context.Context, payload json.RawMessage) error {
+		panic("oh no")
+	}, Options{})
+	Register("test.permanent", func(ctx context.Context, payload json.RawMessage) error {
+		return Permanent(errors.New("bad payload"))
+	}, Options{})
+
+	assert.NoError(t, run(&database.Job{Kind: "test.run", Payload: json.RawMessage(`{"name":"leijurv"}`)}))
+	assert.Equal(t, "leijurv", got.Name)
+
+	err := run(&database.Job{Kind: "test.panic"})
+	require.Error(t, err)
+	assert.False(t, isPermanent(err), "panics might be temporary")
+	assert.Contains(t, err.Error(), "oh no")
+
+	err = run(&database.Job{Kind: "test.permanent"})
+	assert.True(t, isPermanent(err))
+	assert.Equal(t, "bad payload", err.Error())
+
+	err = run(&database.Job{Kind: "test.removed"})
+	assert.True(t, isPermanent(err))
+}
+
+func TestRedact(t *testing.T) {
+	Register("test.redact", func(ctx context.Context, payload json.RawMessage) error { return nil }, Options{Redact: []string{"email"}})
+
+	job := Redact(database.Job{Kind: "test.redact", Payload: json.RawMessage(`{"email":"a@b.c","amount":500,"token":"secret"}`)})
+	assert.JSONEq(t, `{"email":"[redacted]","amount":500,"token":"[redacted]"}`, string(job.Payload))
+
+	job = Redact(database.Job{Kind: "test.unknown", Payload: json.RawMessage(`{"discord_token":"secret","discord_id":"123"}`)})
+	assert.JSONEq(t, `{"discord_token":"[redacted]","discord_id":"123"}`, string(job.Payload))
+
+	job = Redact(database.Job{Kind: "test.redact", Payload: json.RawMessage(`"secret"`)})
+	assert.JSONEq(t, `"[redacted]"`, string(job.Payload))
+}
@@ -0,0 +1,124 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/util"
+)
+
+const (
+	// DefaultWorkers is how many jobs run at once
+	DefaultWorkers = 4
+	// pollInterval is how often idle workers check for new jobs
+	pollInterval = 5 * time.Second
+	// jobTimeout is how long a handler gets before its context is cancelled
+	jobTimeout = time.Minute
+	// jobLease is how long before a running job is assumed abandoned, it must be longer than jobTimeout
+	jobLease = 5 * time.Minute
+	// backoffBase is the delay before the first retry, it doubles each attempt up to backoffMax
+	backoffBase = 10 * time.Second
+	backoffMax  = 6 * time.Hour
+	// keepFinished is how long successful jobs are kept around for
+	keepFinished = 7 * 24 * time.Hour
+	// keepDead is how long dead jobs are kept for staff to inspect and replay
+	keepDead = 90 * 24 * time.Hour
+)
+
+// backoff returns how long to wait before retrying a job that has failed attempts times, without jitter
+func backoff(attempts int) time.Duration {
+	delay := backoffBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= backoffMax {
+			return backoffMax
+		}
+	}
+	return delay
+}
+
+// jitter randomly spreads delay by up to 20% either way, so failures that happen together don't all retry together
+func jitter(delay time.Duration) time.Duration {
+	spread := int64(delay) / 5
+	if spread <= 0 {
+		return delay
+	}
+	return delay - time.Duration(spread) + time.Duration(rand.Int63n(2*spread))
+}
+
+// Start runs workers in the background, it does nothing if there's no database
+func Start(workers int) {
+	if database.DB == nil {
+		log.Println("WARNING: No database, outbox jobs will not run!")
+		return
+	}
+	for i := 0; i < workers; i++ {
+		go work()
+	}
+	util.DoRepeatedly(time.Hour, func() {
+		err := database.DeleteFinishedJobs(time.Now().Add(-keepFinished))
+		if err != nil {
+			log.Println("OUTBOX: Error deleting finished jobs", err)
+		}
+		err = database.DeleteDeadJobs(time.Now().Add(-keepDead))
+		if err != nil {
+			log.Println("OUTBOX: Error deleting dead jobs", err)
+		}
+	})
+	log.Println("OUTBOX: Started", workers, "workers")
+}
+
+// work runs jobs forever, sleeping whenever there's nothing to do
+func work() {
+	for {
+		job, err := database.ClaimJob(jobLease)
+		if err != nil {
+			log.Println("OUTBOX: Error claiming job", err)
+		}
+		if job == nil {
+			time.Sleep(jitter(pollInterval))
+			continue
+		}
+		finish(job, run(job))
+	}
+}
+
+// run calls the job's handler, turning panics into errors
+func run(job *database.Job) (err error) {
+	k, ok := getKind(job.Kind)
+	if !ok {
+		// Maybe it was removed, or this is an old server during a deploy. Either way someone needs to look at it.
+		return Permanent(fmt.Errorf("no handler for job kind %s", job.Kind))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+	return k.handler(ctx, job.Payload)
+}
+
+// finish records the result of running the job
+func finish(job *database.Job, result error) {
+	var err error
+	switch {
+	case result == nil:
+		err = database.CompleteJob(job.ID)
+	case isPermanent(result) || job.Attempts >= job.MaxAttempts:
+		log.Printf("OUTBOX: Job %s (%s) is dead after %d attempts: %s\n", job.ID, job.Kind, job.Attempts, result.Error())
+		err = database.KillJob(job.ID, result.Error())
+	default:
+		log.Printf("OUTBOX: Job %s (%s) failed attempt %d: %s\n", job.ID, job.Kind, job.Attempts, result.Error())
+		err = database.RetryJob(job.ID, result.Error(), time.Now().Add(jitter(backoff(job.Attempts))))
+	}
+	if err != nil {
+		// The lease will run out and the job will be tried again
+		log.Println("OUTBOX: Error saving result of job", job.ID, err)
+	}
+}
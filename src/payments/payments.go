@@ -0,0 +1,95 @@
+// Package payments describes the payment providers that donations can be made through, e.g. stripe and paypal.
+// Each provider has its own package which implements Provider.
+package payments
+
+import (
+	"net/http"
+)
+
+// Provider is a payment processor that donations can be made through
+type Provider interface {
+	// Name identifies the provider, e.g. "stripe"
+	Name() string
+	// CreatePayment starts a payment, the donor finishes it on the client
+	CreatePayment(order Order) (*Payment, error)
+	// CapturePayment takes the money for a payment the donor has approved, if the provider doesn't do that automatically,
+	// and returns its current state. It is safe to call more than once.
+	CapturePayment(id string) (*Payment, error)
+	// RefundPayment refunds the whole payment. The donation is revoked when the provider's webhook says it's done.
+	RefundPayment(id string) error
+	// ParseWebhook verifies that a webhook request came from the provider and returns what happened
+	ParseWebhook(header http.Header, payload []byte) (*Event, error)
+}
+
+// Order is what the donor wants to pay
+type Order struct {
+	// Amount is in the currency's smallest unit, e.g. cents
+	Amount      int64
+	Currency    string
+	Description string
+	// Email is where the receipt goes, if the donor gave one
+	Email string
+	// Locale is the language the donor wants emails in
+	Locale string
+	// UserID is the Impact account the donation is credited to, or empty if the donor wasn't logged in
+	UserID string
+}
+
+// Status is the state of a Payment
+type Status string
+
+// Payment statuses
+const (
+	StatusPending   Status = "pending"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusRefunded  Status = "refunded"
+)
+
+// Payment is a payment made through a Provider
+type Payment struct {
+	// Provider is the Name of the provider the payment was made through
+	Provider string `json:"provider"`
+	// ID is the provider's id for the payment, e.g. a stripe payment intent or paypal order
+	ID     string `json:"id"`
+	Status Status `json:"status"`
+	// Amount is in the currency's smallest unit, e.g. cents
+	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency"`
+	Description string `json:"-"`
+	// Email is where the receipt goes, empty if unknown
+	Email string `json:"-"`
+	// PayerID is the provider's id for whoever paid, empty if the provider doesn't have one
+	PayerID string `json:"-"`
+	// Locale and UserID are copied from the Order
+	Locale string `json:"-"`
+	UserID string `json:"-"`
+	// ClientSecret is used by stripe.js to finish a stripe payment
+	ClientSecret string `json:"client_secret,omitempty"`
+	// ApproveURL is where the donor approves a paypal order
+	ApproveURL string `json:"approve_url,omitempty"`
+}
+
+// EventType is what a webhook Event is about
+type EventType string
+
+// Webhook event types
+const (
+	// EventApproved means the donor approved the payment, but it still needs to be captured
+	EventApproved EventType = "approved"
+	// EventSucceeded means the money has been taken
+	EventSucceeded EventType = "succeeded"
+	// EventRefunded means the money has been given back, or taken back by a chargeback
+	EventRefunded EventType = "refunded"
+	// EventOther is anything else, the provider's package may still know what to do with it
+	EventOther EventType = "other"
+)
+
+// Event is a verified webhook event
+type Event struct {
+	Type EventType
+	// Payment is the payment the event is about, nil for EventOther
+	Payment *Payment
+	// Raw is the provider's own representation of the event
+	Raw interface{}
+}
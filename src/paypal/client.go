@@ -0,0 +1,171 @@
+// Package paypal implements payments.Provider using the PayPal Orders v2 REST API
+package paypal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/util"
+	"github.com/ImpactDevelopment/ImpactServer/src/util/mediatype"
+)
+
+const (
+	// LiveURL is the PayPal REST API
+	LiveURL = "https://api-m.paypal.com"
+	// SandboxURL is the PayPal REST API for testing with sandbox accounts
+	SandboxURL = "https://api-m.sandbox.paypal.com"
+)
+
+// Client talks to the PayPal REST API
+type Client struct {
+	// BaseURL is the API to use, e.g. LiveURL or SandboxURL
+	BaseURL  string
+	ClientID string
+	Secret   string
+	// WebhookID is the id PayPal gave our webhook, it's needed to verify webhook signatures
+	WebhookID string
+
+	tokenLock   sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// Default is configured from the environment, it's nil if PAYPAL_CLIENT_ID or PAYPAL_SECRET aren't set
+var Default *Client
+
+func init() {
+	clientID := os.Getenv("PAYPAL_CLIENT_ID")
+	secret := os.Getenv("PAYPAL_SECRET")
+	if clientID == "" || secret == "" {
+		fmt.Println("WARNING: No PayPal credentials; PayPal donations are disabled!")
+		return
+	}
+	baseURL := os.Getenv("PAYPAL_API_URL")
+	if baseURL == "" {
+		baseURL = LiveURL
+	}
+	Default = &Client{
+		BaseURL:   baseURL,
+		ClientID:  clientID,
+		Secret:    secret,
+		WebhookID: os.Getenv("PAYPAL_WEBHOOK_ID"),
+	}
+}
+
+// Error is an error response from the PayPal API
+type Error struct {
+	Status  int    `json:"-"`
+	Name    string `json:"name"`
+	Message string `json:"message"`
+	Details []struct {
+		Issue       string `json:"issue"`
+		Description string `json:"description"`
+	} `json:"details"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("paypal: %d %s: %s", e.Status, e.Name, e.Message)
+}
+
+// HasIssue returns true if any of the error's details are the given issue, e.g. ORDER_ALREADY_CAPTURED
+func (e *Error) HasIssue(issue string) bool {
+	for _, detail := range e.Details {
+		if detail.Issue == issue {
+			return true
+		}
+	}
+	return false
+}
+
+// accessToken returns an oauth token for the API, reusing the last one until it's about to expire
+func (c *Client) accessToken() (string, error) {
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+
+	if c.token != "" && time.Now().Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+
+	req, err := util.FormRequest(c.BaseURL+"/v1/oauth2/token", map[string]string{
+		"grant_type": "client_credentials",
+	})
+	if err != nil {
+		return "", err
+	}
+	req.Req.SetBasicAuth(c.ClientID, c.Secret)
+	req.Accept(mediatype.JSON)
+
+	res, err := req.Do()
+	if err != nil {
+		return "", err
+	}
+	if !res.Ok() {
+		return "", parseError(res)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	err = res.JSON(&body)
+	if err != nil {
+		return "", err
+	}
+	if body.AccessToken == "" {
+		return "", errors.New("paypal: no access token in response")
+	}
+
+	// Leave a minute spare so the token doesn't expire mid request
+	c.token = body.AccessToken
+	c.tokenExpiry = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - time.Minute)
+	return c.token, nil
+}
+
+// do makes an authenticated request to the API and decodes the response into out. A nil body does a GET.
+func (c *Client) do(path string, body interface{}, out interface{}) error {
+	token, err := c.accessToken()
+	if err != nil {
+		return err
+	}
+
+	var req *util.HTTPRequest
+	if body == nil {
+		req, err = util.GetRequest(c.BaseURL + path)
+	} else {
+		req, err = util.JSONRequest(c.BaseURL+path, body)
+	}
+	if err != nil {
+		return err
+	}
+	req.Authorization("Bearer", token)
+	req.Accept(mediatype.JSON)
+	// Otherwise PayPal only returns the id, status and links
+	req.SetHeader("Prefer", "return=representation")
+
+	res, err := req.Do()
+	if err != nil {
+		return err
+	}
+	if res.Code() < 200 || res.Code() > 299 {
+		return parseError(res)
+	}
+	if out == nil {
+		return nil
+	}
+	return res.JSON(out)
+}
+
+func parseError(res *util.HTTPResponse) error {
+	ret := &Error{Status: res.Code()}
+	if err := res.JSON(ret); err != nil || ret.Name == "" {
+		// The oauth endpoint uses a different format, so just use the whole body
+		ret.Name = http.StatusText(res.Code())
+		ret.Message = strings.TrimSpace(res.String())
+	}
+	return ret
+}
@@ -0,0 +1,287 @@
+package paypal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/currency"
+	"github.com/ImpactDevelopment/ImpactServer/src/payments"
+	"github.com/ImpactDevelopment/ImpactServer/src/util"
+)
+
+// Name is the name of the paypal payments.Provider
+const Name = "paypal"
+
+// customIDLimit is the most PayPal will store in a purchase unit's custom_id
+const customIDLimit = 127
+
+var _ payments.Provider = (*Client)(nil)
+
+type money struct {
+	CurrencyCode string `json:"currency_code"`
+	Value        string `json:"value"`
+}
+
+type link struct {
+	Href   string `json:"href"`
+	Rel    string `json:"rel"`
+	Method string `json:"method,omitempty"`
+}
+
+type capture struct {
+	ID                string `json:"id"`
+	Status            string `json:"status"`
+	Amount            money  `json:"amount"`
+	CustomID          string `json:"custom_id,omitempty"`
+	SupplementaryData struct {
+		RelatedIDs struct {
+			OrderID string `json:"order_id"`
+		} `json:"related_ids"`
+	} `json:"supplementary_data"`
+	Links []link `json:"links,omitempty"`
+}
+
+type purchaseUnit struct {
+	Amount      money  `json:"amount"`
+	Description string `json:"description,omitempty"`
+	CustomID    string `json:"custom_id,omitempty"`
+	Payments    *struct {
+		Captures []capture `json:"captures"`
+	} `json:"payments,omitempty"`
+}
+
+type order struct {
+	ID            string         `json:"id"`
+	Status        string         `json:"status"`
+	PurchaseUnits []purchaseUnit `json:"purchase_units"`
+	Payer         *struct {
+		EmailAddress string `json:"email_address"`
+		PayerID      string `json:"payer_id"`
+	} `json:"payer,omitempty"`
+	Links []link `json:"links"`
+}
+
+// Name implements payments.Provider
+func (c *Client) Name() string {
+	return Name
+}
+
+// CreatePayment creates an order, the donor approves it at the payment's ApproveURL and is then sent back to the
+// donate page to capture it
+func (c *Client) CreatePayment(o payments.Order) (*payments.Payment, error) {
+	returnURL := util.GetServerURL()
+	returnURL.Path = "/donate.html"
+	returnURL.RawQuery = "paypal=approved"
+	cancelURL := util.GetServerURL()
+	cancelURL.Path = "/donate.html"
+
+	body := map[string]interface{}{
+		"intent": "CAPTURE",
+		"purchase_units": []purchaseUnit{{
+			Amount: money{
+				CurrencyCode: strings.ToUpper(o.Currency),
+				Value:        formatValue(o.Amount, decimals(o.Currency)),
+			},
+			Description: o.Description,
+			CustomID:    encodeCustomID(o),
+		}},
+		"application_context": map[string]string{
+			"brand_name":          "Impact",
+			"shipping_preference": "NO_SHIPPING",
+			"user_action":         "PAY_NOW",
+			"return_url":          returnURL.String(),
+			"cancel_url":          cancelURL.String(),
+		},
+	}
+	var created order
+	err := c.do("/v2/checkout/orders", body, &created)
+	if err != nil {
+		return nil, err
+	}
+	payment, err := toPayment(&created)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Email == "" {
+		payment.Email = o.Email
+	}
+	return payment, nil
+}
+
+// CapturePayment captures the order if it hasn't been already
+func (c *Client) CapturePayment(id string) (*payments.Payment, error) {
+	var captured order
+	err := c.do("/v2/checkout/orders/"+url.PathEscape(id)+"/capture", struct{}{}, &captured)
+	if paypalErr, ok := err.(*Error); ok && paypalErr.HasIssue("ORDER_ALREADY_CAPTURED") {
+		return c.GetPayment(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toPayment(&captured)
+}
+
+// GetPayment fetches the order's current state
+func (c *Client) GetPayment(id string) (*payments.Payment, error) {
+	o, err := c.getOrder(id)
+	if err != nil {
+		return nil, err
+	}
+	return toPayment(o)
+}
+
+// RefundPayment refunds the order's capture in full
+func (c *Client) RefundPayment(id string) error {
+	o, err := c.getOrder(id)
+	if err != nil {
+		return err
+	}
+	for _, unit := range o.PurchaseUnits {
+		if unit.Payments == nil {
+			continue
+		}
+		for _, capture := range unit.Payments.Captures {
+			if capture.Status == "COMPLETED" {
+				return c.do("/v2/payments/captures/"+url.PathEscape(capture.ID)+"/refund", struct{}{}, nil)
+			}
+		}
+	}
+	return errors.New("paypal: order " + id + " has no completed capture to refund")
+}
+
+func (c *Client) getOrder(id string) (*order, error) {
+	var o order
+	err := c.do("/v2/checkout/orders/"+url.PathEscape(id), nil, &o)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (c *Client) getCapture(id string) (*capture, error) {
+	var ret capture
+	err := c.do("/v2/payments/captures/"+url.PathEscape(id), nil, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// toPayment converts an order to a payments.Payment, we only ever create orders with one purchase unit
+func toPayment(o *order) (*payments.Payment, error) {
+	if len(o.PurchaseUnits) < 1 {
+		return nil, errors.New("paypal: order " + o.ID + " has no purchase units")
+	}
+	unit := o.PurchaseUnits[0]
+	amount, err := parseValue(unit.Amount.Value, decimals(unit.Amount.CurrencyCode))
+	if err != nil {
+		return nil, err
+	}
+	custom, _ := url.ParseQuery(unit.CustomID)
+
+	payment := &payments.Payment{
+		Provider:    Name,
+		ID:          o.ID,
+		Status:      payments.StatusPending,
+		Amount:      amount,
+		Currency:    strings.ToLower(unit.Amount.CurrencyCode),
+		Description: unit.Description,
+		Email:       custom.Get("email"),
+		Locale:      custom.Get("locale"),
+		UserID:      custom.Get("user_id"),
+	}
+	if o.Payer != nil {
+		payment.PayerID = o.Payer.PayerID
+		if payment.Email == "" {
+			payment.Email = o.Payer.EmailAddress
+		}
+	}
+	for _, l := range o.Links {
+		if l.Rel == "approve" {
+			payment.ApproveURL = l.Href
+		}
+	}
+
+	switch o.Status {
+	case "VOIDED":
+		payment.Status = payments.StatusFailed
+	case "COMPLETED":
+		// The order is completed once it's captured, but the capture itself might still be pending or have failed since
+		if unit.Payments != nil && len(unit.Payments.Captures) > 0 {
+			switch unit.Payments.Captures[0].Status {
+			case "COMPLETED":
+				payment.Status = payments.StatusSucceeded
+			case "REFUNDED", "PARTIALLY_REFUNDED":
+				payment.Status = payments.StatusRefunded
+			case "DECLINED", "FAILED":
+				payment.Status = payments.StatusFailed
+			}
+		}
+	}
+	return payment, nil
+}
+
+// encodeCustomID remembers the order's details on the purchase unit, leaving out the email if it doesn't fit.
+// The payer's PayPal email is used for receipts instead in that case.
+func encodeCustomID(o payments.Order) string {
+	values := url.Values{}
+	if o.UserID != "" {
+		values.Set("user_id", o.UserID)
+	}
+	if o.Locale != "" {
+		values.Set("locale", o.Locale)
+	}
+	withoutEmail := values.Encode()
+	if o.Email == "" {
+		return withoutEmail
+	}
+	values.Set("email", o.Email)
+	if encoded := values.Encode(); len(encoded) <= customIDLimit {
+		return encoded
+	}
+	return withoutEmail
+}
+
+// decimals returns how many decimals the currency's amounts have, PayPal wants amounts in the major unit
+func decimals(code string) int {
+	if c, ok := currency.Lookup(code); ok {
+		return c.Decimals
+	}
+	return 2
+}
+
+// formatValue formats an amount in the currency's minor unit the way PayPal wants it, e.g. 500 cents is "5.00"
+func formatValue(amount int64, decimals int) string {
+	if decimals == 0 {
+		return strconv.FormatInt(amount, 10)
+	}
+	unit := int64(math.Pow10(decimals))
+	return fmt.Sprintf("%d.%0*d", amount/unit, decimals, amount%unit)
+}
+
+// parseValue parses a PayPal amount into the currency's minor unit, e.g. "5.00" is 500 cents
+func parseValue(value string, decimals int) (int64, error) {
+	parts := strings.SplitN(value, ".", 2)
+	whole, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || whole < 0 {
+		return 0, fmt.Errorf("paypal: invalid amount %q", value)
+	}
+	unit := int64(math.Pow10(decimals))
+	var minor int64
+	if len(parts) == 2 {
+		frac := parts[1]
+		if len(frac) == 0 || len(frac) > decimals {
+			return 0, fmt.Errorf("paypal: invalid amount %q", value)
+		}
+		frac += strings.Repeat("0", decimals-len(frac))
+		minor, err = strconv.ParseInt(frac, 10, 64)
+		if err != nil || minor < 0 {
+			return 0, fmt.Errorf("paypal: invalid amount %q", value)
+		}
+	}
+	return whole*unit + minor, nil
+}
@@ -0,0 +1,300 @@
+package paypal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/payments"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stub is a local stand in for the parts of the PayPal API we use
+type stub struct {
+	sync.Mutex
+	orders   map[string]*order
+	captures map[string]string // capture id to order id
+	tokens   int
+	refunds  []string
+}
+
+// newStub starts the stub, close it when done
+func newStub() (*stub, *Client, func()) {
+	s := &stub{
+		orders:   make(map[string]*order),
+		captures: make(map[string]string),
+	}
+	server := httptest.NewServer(s)
+	return s, &Client{
+		BaseURL:   server.URL,
+		ClientID:  "client",
+		Secret:    "secret",
+		WebhookID: "webhook",
+	}, server.Close
+}
+
+func (s *stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	if r.URL.Path == "/v1/oauth2/token" {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "client" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.tokens++
+		writeJSON(w, http.StatusOK, map[string]interface{}{"access_token": "token", "expires_in": 3600})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/v1/notifications/verify-webhook-signature":
+		var body struct {
+			WebhookID string `json:"webhook_id"`
+			Sig       string `json:"transmission_sig"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		status := "FAILURE"
+		if body.WebhookID == "webhook" && body.Sig == "valid" {
+			status = "SUCCESS"
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"verification_status": status})
+	case r.Method == http.MethodPost && r.URL.Path == "/v2/checkout/orders":
+		var body struct {
+			PurchaseUnits []purchaseUnit `json:"purchase_units"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		id := "ORDER" + string(rune('A'+len(s.orders)))
+		s.orders[id] = &order{
+			ID:            id,
+			Status:        "CREATED",
+			PurchaseUnits: body.PurchaseUnits,
+			Links:         []link{{Href: "https://www.sandbox.paypal.com/checkoutnow?token=" + id, Rel: "approve"}},
+		}
+		writeJSON(w, http.StatusCreated, s.orders[id])
+	case len(parts) == 4 && parts[1] == "checkout" && r.Method == http.MethodGet:
+		o, ok := s.orders[parts[3]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, o)
+	case len(parts) == 5 && parts[1] == "checkout" && parts[4] == "capture":
+		o, ok := s.orders[parts[3]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if o.Status == "COMPLETED" {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+				"name":    "UNPROCESSABLE_ENTITY",
+				"message": "The requested action could not be performed",
+				"details": []map[string]string{{"issue": "ORDER_ALREADY_CAPTURED"}},
+			})
+			return
+		}
+		captureID := "CAPTURE" + o.ID
+		s.captures[captureID] = o.ID
+		o.Status = "COMPLETED"
+		o.Payer = &struct {
+			EmailAddress string `json:"email_address"`
+			PayerID      string `json:"payer_id"`
+		}{"payer@example.com", "PAYER"}
+		o.PurchaseUnits[0].Payments = &struct {
+			Captures []capture `json:"captures"`
+		}{[]capture{{ID: captureID, Status: "COMPLETED", Amount: o.PurchaseUnits[0].Amount}}}
+		writeJSON(w, http.StatusCreated, o)
+	case len(parts) == 4 && parts[1] == "payments" && r.Method == http.MethodGet:
+		orderID, ok := s.captures[parts[3]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var ret capture
+		ret.ID = parts[3]
+		ret.SupplementaryData.RelatedIDs.OrderID = orderID
+		writeJSON(w, http.StatusOK, ret)
+	case len(parts) == 5 && parts[1] == "payments" && parts[4] == "refund":
+		orderID, ok := s.captures[parts[3]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.refunds = append(s.refunds, parts[3])
+		s.orders[orderID].PurchaseUnits[0].Payments.Captures[0].Status = "REFUNDED"
+		writeJSON(w, http.StatusCreated, map[string]string{"id": "REFUND", "status": "COMPLETED"})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+func signedHeader(sig string) http.Header {
+	header := http.Header{}
+	header.Set("PAYPAL-TRANSMISSION-SIG", sig)
+	return header
+}
+
+func TestCreateAndCapture(t *testing.T) {
+	s, client, done := newStub()
+	defer done()
+
+	payment, err := client.CreatePayment(payments.Order{
+		Amount:      550,
+		Currency:    "usd",
+		Description: "Donation",
+		Email:       "donor@example.com",
+		Locale:      "de",
+		UserID:      "a7f0b3a2-3c1e-4b6f-9d43-2f4b1c0a5e6d",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Name, payment.Provider)
+	assert.Equal(t, payments.StatusPending, payment.Status)
+	assert.Equal(t, int64(550), payment.Amount)
+	assert.Equal(t, "usd", payment.Currency)
+	assert.Equal(t, "https://www.sandbox.paypal.com/checkoutnow?token="+payment.ID, payment.ApproveURL)
+	assert.Equal(t, "USD", s.orders[payment.ID].PurchaseUnits[0].Amount.CurrencyCode)
+	assert.Equal(t, "5.50", s.orders[payment.ID].PurchaseUnits[0].Amount.Value)
+
+	captured, err := client.CapturePayment(payment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, payments.StatusSucceeded, captured.Status)
+	assert.Equal(t, "donor@example.com", captured.Email)
+	assert.Equal(t, "PAYER", captured.PayerID)
+	assert.Equal(t, "de", captured.Locale)
+	assert.Equal(t, "a7f0b3a2-3c1e-4b6f-9d43-2f4b1c0a5e6d", captured.UserID)
+
+	// Capturing again just returns the order
+	again, err := client.CapturePayment(payment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, captured, again)
+
+	// The token is reused
+	assert.Equal(t, 1, s.tokens)
+}
+
+func TestCaptureUnknownOrder(t *testing.T) {
+	_, client, done := newStub()
+	defer done()
+	_, err := client.CapturePayment("nope")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, err.(*Error).Status)
+}
+
+func TestRefund(t *testing.T) {
+	s, client, done := newStub()
+	defer done()
+
+	payment, err := client.CreatePayment(payments.Order{Amount: 500, Currency: "eur"})
+	require.NoError(t, err)
+	assert.Error(t, client.RefundPayment(payment.ID), "can't refund an order that wasn't captured")
+
+	_, err = client.CapturePayment(payment.ID)
+	require.NoError(t, err)
+	require.NoError(t, client.RefundPayment(payment.ID))
+	assert.Equal(t, []string{"CAPTURE" + payment.ID}, s.refunds)
+
+	refunded, err := client.GetPayment(payment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, payments.StatusRefunded, refunded.Status)
+}
+
+func TestParseWebhook(t *testing.T) {
+	s, client, done := newStub()
+	defer done()
+
+	payment, err := client.CreatePayment(payments.Order{Amount: 500, Currency: "gbp", Email: "donor@example.com"})
+	require.NoError(t, err)
+
+	approved, _ := json.Marshal(map[string]interface{}{
+		"id":         "WH-1",
+		"event_type": "CHECKOUT.ORDER.APPROVED",
+		"resource":   s.orders[payment.ID],
+	})
+	event, err := client.ParseWebhook(signedHeader("valid"), approved)
+	require.NoError(t, err)
+	assert.Equal(t, payments.EventApproved, event.Type)
+	assert.Equal(t, payment.ID, event.Payment.ID)
+	assert.Equal(t, "WH-1", event.Raw.(*WebhookEvent).ID)
+
+	_, err = client.CapturePayment(payment.ID)
+	require.NoError(t, err)
+
+	completed := `{"id":"WH-2","event_type":"PAYMENT.CAPTURE.COMPLETED","resource":{"id":"CAPTURE` + payment.ID + `","status":"COMPLETED","supplementary_data":{"related_ids":{"order_id":"` + payment.ID + `"}}}}`
+	event, err = client.ParseWebhook(signedHeader("valid"), []byte(completed))
+	require.NoError(t, err)
+	assert.Equal(t, payments.EventSucceeded, event.Type)
+	assert.Equal(t, payments.StatusSucceeded, event.Payment.Status)
+	assert.Equal(t, int64(500), event.Payment.Amount)
+	assert.Equal(t, "donor@example.com", event.Payment.Email)
+
+	refunded := `{"id":"WH-3","event_type":"PAYMENT.CAPTURE.REFUNDED","resource":{"id":"REFUND","links":[{"rel":"self","href":"https://api.paypal.com/v2/payments/refunds/REFUND"},{"rel":"up","href":"https://api.paypal.com/v2/payments/captures/CAPTURE` + payment.ID + `"}]}}`
+	event, err = client.ParseWebhook(signedHeader("valid"), []byte(refunded))
+	require.NoError(t, err)
+	assert.Equal(t, payments.EventRefunded, event.Type)
+	assert.Equal(t, payment.ID, event.Payment.ID)
+	assert.Equal(t, payments.StatusRefunded, event.Payment.Status)
+
+	other := `{"id":"WH-4","event_type":"CHECKOUT.ORDER.COMPLETED","resource":{}}`
+	event, err = client.ParseWebhook(signedHeader("valid"), []byte(other))
+	require.NoError(t, err)
+	assert.Equal(t, payments.EventOther, event.Type)
+	assert.Nil(t, event.Payment)
+
+	_, err = client.ParseWebhook(signedHeader("forged"), []byte(other))
+	assert.Equal(t, ErrInvalidSignature, err)
+	_, err = client.ParseWebhook(signedHeader("valid"), []byte("not json"))
+	assert.Equal(t, ErrInvalidSignature, err)
+
+	client.WebhookID = ""
+	_, err = client.ParseWebhook(signedHeader("valid"), []byte(other))
+	assert.Error(t, err)
+}
+
+func TestValues(t *testing.T) {
+	for value, cents := range map[string]int64{"5.00": 500, "5": 500, "5.5": 550, "0.01": 1, "1234.56": 123456} {
+		parsed, err := parseValue(value, 2)
+		assert.NoError(t, err, value)
+		assert.Equal(t, cents, parsed, value)
+	}
+	for _, value := range []string{"", "five", "5.", "5.001", "5.-1", "-5.00"} {
+		_, err := parseValue(value, 2)
+		assert.Error(t, err, value)
+	}
+	assert.Equal(t, "5.00", formatValue(500, 2))
+	assert.Equal(t, "0.05", formatValue(5, 2))
+	assert.Equal(t, "1234.56", formatValue(123456, 2))
+
+	// Zero-decimal currencies like yen don't have a minor unit
+	parsed, err := parseValue("750", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(750), parsed)
+	_, err = parseValue("750.5", 0)
+	assert.Error(t, err)
+	assert.Equal(t, "750", formatValue(750, decimals("jpy")))
+	assert.Equal(t, 2, decimals("xyz"))
+}
+
+func TestCustomID(t *testing.T) {
+	order := payments.Order{UserID: "a7f0b3a2-3c1e-4b6f-9d43-2f4b1c0a5e6d", Locale: "en", Email: "donor@example.com"}
+	assert.Contains(t, encodeCustomID(order), "email=donor%40example.com")
+
+	order.Email = strings.Repeat("a", 100) + "@example.com"
+	id := encodeCustomID(order)
+	assert.NotContains(t, id, "email")
+	assert.True(t, len(id) <= customIDLimit)
+}
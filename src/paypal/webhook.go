@@ -0,0 +1,136 @@
+package paypal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/payments"
+)
+
+// ErrInvalidSignature is returned by ParseWebhook if PayPal doesn't recognise the webhook's signature
+var ErrInvalidSignature = errors.New("paypal: invalid webhook signature")
+
+// WebhookEvent is a PayPal webhook event
+type WebhookEvent struct {
+	ID        string          `json:"id"`
+	EventType string          `json:"event_type"`
+	Resource  json.RawMessage `json:"resource"`
+}
+
+// ParseWebhook asks PayPal to verify the webhook's signature, then fetches the order it's about.
+// The raw event is always a *WebhookEvent.
+func (c *Client) ParseWebhook(header http.Header, payload []byte) (*payments.Event, error) {
+	err := c.verifyWebhook(header, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var event WebhookEvent
+	err = json.Unmarshal(payload, &event)
+	if err != nil {
+		return nil, err
+	}
+	ret := &payments.Event{
+		Type: payments.EventOther,
+		Raw:  &event,
+	}
+
+	switch event.EventType {
+	case "CHECKOUT.ORDER.APPROVED":
+		var approved order
+		err = json.Unmarshal(event.Resource, &approved)
+		if err != nil {
+			return nil, err
+		}
+		ret.Type = payments.EventApproved
+		ret.Payment, err = toPayment(&approved)
+	case "PAYMENT.CAPTURE.COMPLETED":
+		var captured capture
+		err = json.Unmarshal(event.Resource, &captured)
+		if err != nil {
+			return nil, err
+		}
+		ret.Type = payments.EventSucceeded
+		ret.Payment, err = c.GetPayment(captured.SupplementaryData.RelatedIDs.OrderID)
+	case "PAYMENT.CAPTURE.REVERSED":
+		// A chargeback, the resource is the capture
+		var reversed capture
+		err = json.Unmarshal(event.Resource, &reversed)
+		if err != nil {
+			return nil, err
+		}
+		ret.Type = payments.EventRefunded
+		ret.Payment, err = c.refundedPayment(reversed.SupplementaryData.RelatedIDs.OrderID)
+	case "PAYMENT.CAPTURE.REFUNDED":
+		// The resource is the refund, which only links "up" to the capture it refunded
+		var refund struct {
+			Links []link `json:"links"`
+		}
+		err = json.Unmarshal(event.Resource, &refund)
+		if err != nil {
+			return nil, err
+		}
+		var captureID string
+		for _, l := range refund.Links {
+			if l.Rel == "up" {
+				captureID = path.Base(l.Href)
+			}
+		}
+		if captureID == "" {
+			return nil, errors.New("paypal: refund " + event.ID + " doesn't link to a capture")
+		}
+		var refunded *capture
+		refunded, err = c.getCapture(captureID)
+		if err != nil {
+			return nil, err
+		}
+		ret.Type = payments.EventRefunded
+		ret.Payment, err = c.refundedPayment(refunded.SupplementaryData.RelatedIDs.OrderID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// refundedPayment fetches the order, marking it as refunded even if only part of it was
+func (c *Client) refundedPayment(orderID string) (*payments.Payment, error) {
+	payment, err := c.GetPayment(orderID)
+	if err != nil {
+		return nil, err
+	}
+	payment.Status = payments.StatusRefunded
+	return payment, nil
+}
+
+// verifyWebhook uses PayPal's verify-webhook-signature API, which saves us from fetching and checking their certificates
+func (c *Client) verifyWebhook(header http.Header, payload []byte) error {
+	if c.WebhookID == "" {
+		return errors.New("paypal: no webhook id configured")
+	}
+	if !json.Valid(payload) {
+		return ErrInvalidSignature
+	}
+	body := map[string]interface{}{
+		"auth_algo":         header.Get("PAYPAL-AUTH-ALGO"),
+		"cert_url":          header.Get("PAYPAL-CERT-URL"),
+		"transmission_id":   header.Get("PAYPAL-TRANSMISSION-ID"),
+		"transmission_sig":  header.Get("PAYPAL-TRANSMISSION-SIG"),
+		"transmission_time": header.Get("PAYPAL-TRANSMISSION-TIME"),
+		"webhook_id":        c.WebhookID,
+		"webhook_event":     json.RawMessage(payload),
+	}
+	var res struct {
+		VerificationStatus string `json:"verification_status"`
+	}
+	err := c.do("/v1/notifications/verify-webhook-signature", body, &res)
+	if err != nil {
+		return err
+	}
+	if res.VerificationStatus != "SUCCESS" {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package s3proxy
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// FilesBucket is served at files.impactclient.net
+const FilesBucket = "impactclient-files"
+
+// FilesURL is the public url of FilesBucket
+const FilesURL = "https://files.impactclient.net/"
+
+// PendingPrefix is where files awaiting moderation are kept in FilesBucket. It is never proxied.
+const PendingPrefix = "pending/"
+
+// Upload stores body in FilesBucket at key
+func Upload(key string, contentType string, body []byte) error {
+	_, err := s3.New(AWSSession).PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(FilesBucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+// Copy copies the object at from to to, both in FilesBucket
+func Copy(from, to string) error {
+	_, err := s3.New(AWSSession).CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(FilesBucket),
+		CopySource: aws.String(FilesBucket + "/" + from),
+		Key:        aws.String(to),
+	})
+	return err
+}
+
+// PresignGet returns a url that can be used to fetch key from FilesBucket for a limited time, even if it isn't proxied
+func PresignGet(key string, expires time.Duration) (string, error) {
+	req, _ := s3.New(AWSSession).GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(FilesBucket),
+		Key:    aws.String(key),
+	})
+	return req.Presign(expires)
+}
+
+// isPending returns true if the request path is for a file awaiting moderation
+func isPending(file string) bool {
+	return strings.HasPrefix(strings.TrimLeft(file, "/"), PendingPrefix)
+}
@@ -23,8 +23,8 @@ func Server() (e *echo.Echo) {
 
 	e.Use(mid.Log)
 
-	e.Match([]string{http.MethodHead, http.MethodGet}, "/*", proxyHandler("", "impactclient-files"))
-	e.Match([]string{http.MethodHead, http.MethodGet}, "/test_alternate/*", proxyHandler("/test_alternate", os.Getenv("ALT_BUCKET")), mid.AuthGetParam(), mid.NoCache())
+	e.Match([]string{http.MethodHead, http.MethodGet}, "/*", proxyHandler("", FilesBucket))
+	e.Match([]string{http.MethodHead, http.MethodGet}, "/test_alternate/*", proxyHandler("/test_alternate", os.Getenv("ALT_BUCKET")), mid.RequireAPIKey("files:alternate"), mid.NoCache())
 
 	return
 }
@@ -32,6 +32,9 @@ func Server() (e *echo.Echo) {
 func proxyHandler(base string, bucket string) func(c echo.Context) error {
 	return func(c echo.Context) error {
 		file := c.Request().URL.Path[len(base):]
+		if bucket == FilesBucket && isPending(file) {
+			return echo.ErrNotFound
+		}
 
 		s3Req, _ := s3.New(AWSSession).GetObjectRequest(&s3.GetObjectInput{
 			Bucket: aws.String(bucket),
@@ -10,6 +10,7 @@ import (
 	"github.com/ImpactDevelopment/ImpactServer/src/cloudflare"
 	mid "github.com/ImpactDevelopment/ImpactServer/src/middleware"
 	"github.com/ImpactDevelopment/ImpactServer/src/newWeb"
+	"github.com/ImpactDevelopment/ImpactServer/src/outbox"
 	"github.com/ImpactDevelopment/ImpactServer/src/s3proxy"
 	"github.com/ImpactDevelopment/ImpactServer/src/util"
 	"github.com/ImpactDevelopment/ImpactServer/src/web"
@@ -60,6 +61,9 @@ func main() {
 
 	e.Use(middleware.Recover())
 
+	// Start running side effects once every package has registered its job kinds
+	outbox.Start(outbox.DefaultWorkers)
+
 	go cloudflare.PurgeIfNeeded() // "go" as a vague halfhearted attempt to make this occur only after we start listening and serving, to prevent long blocking requests
 	// Start the server
 	e.Logger.Fatal(StartServer(e, port))
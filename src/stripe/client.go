@@ -3,7 +3,10 @@ package stripe
 import (
 	"errors"
 	"fmt"
+	"github.com/ImpactDevelopment/ImpactServer/src/currency"
 	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/ImpactDevelopment/ImpactServer/src/payments"
+	"github.com/ImpactDevelopment/ImpactServer/src/tiers"
 	"github.com/ImpactDevelopment/ImpactServer/src/util"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -92,7 +95,8 @@ type Payment struct {
 	Amount        int64                 `json:"amount" form:"amount" query:"amount"`
 	Currency      string                `json:"currency" form:"currency" query:"currency"`
 	Email         string                `json:"email" form:"email" query:"email"`
-	//USDAmount int64 // TODO fetch the USD equivalent to allow granting premium on other currencies
+	// USDAmount is the amount in US cents at today's exchange rate, or 0 if we don't have one for the currency
+	USDAmount int64 `json:"usd_amount" form:"usd_amount" query:"usd_amount"`
 }
 
 type WebhookEvent struct {
@@ -100,28 +104,34 @@ type WebhookEvent struct {
 }
 
 type CurrencyInfo struct {
+	// Amount is the smallest donation that qualifies for any tier
 	Amount      int64  `json:"premium_amount" form:"premium_amount" query:"premium_amount"`
 	DisplayName string `json:"display_name" form:"display_name" query:"display_name"`
 	Symbol      string `json:"symbol" form:"symbol" query:"symbol"`
+	Decimals    int    `json:"decimals" form:"decimals" query:"decimals"`
+	// TierAmounts is the minimum donation for each tier, keyed by tier id
+	TierAmounts map[string]int64 `json:"tier_amounts" form:"tier_amounts" query:"tier_amounts"`
 }
 
-// Supported currencies and the respective amount required for premium perks
-var stripeCurrencyMap = map[string]CurrencyInfo{
-	"usd": {
-		Amount:      500,
-		DisplayName: "$ USD",
-		Symbol:      "$",
-	},
-	"eur": {
-		Amount:      500,
-		DisplayName: "€ EUR",
-		Symbol:      "€",
-	},
-	"gbp": {
-		Amount:      500,
-		DisplayName: "£ GBP",
-		Symbol:      "£",
-	},
+func makeCurrencyInfo(c currency.Currency, list []database.DonationTier) (*CurrencyInfo, error) {
+	amount, err := tiers.Minimum(list, c)
+	if err != nil {
+		return nil, err
+	}
+	amounts := make(map[string]int64)
+	for _, tier := range list {
+		amounts[tier.ID], err = tiers.Amount(tier, c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &CurrencyInfo{
+		Amount:      amount,
+		DisplayName: c.DisplayName(),
+		Symbol:      c.Symbol,
+		Decimals:    c.Decimals,
+		TierAmounts: amounts,
+	}, nil
 }
 
 func makePaymentStruct(intent *stripe.PaymentIntent) *Payment {
@@ -131,7 +141,20 @@ func makePaymentStruct(intent *stripe.PaymentIntent) *Payment {
 		Amount:        intent.Amount,
 		Currency:      intent.Currency,
 		Email:         intent.Metadata["email"],
+		USDAmount:     toUSD(intent.Currency, intent.Amount),
+	}
+}
+
+func toUSD(code string, amount int64) int64 {
+	c, ok := currency.Lookup(code)
+	if !ok {
+		return 0
+	}
+	usd, err := c.ToUSD(amount)
+	if err != nil {
+		return 0
 	}
+	return usd
 }
 
 func GetWebhookEvent(payload []byte, signature string) (*WebhookEvent, error) {
@@ -142,7 +165,9 @@ func GetWebhookEvent(payload []byte, signature string) (*WebhookEvent, error) {
 	return &WebhookEvent{event}, nil
 }
 
-func CreatePayment(amount int64, currency string, description string, email string) (*Payment, error) {
+// CreatePayment creates a payment intent. locale is remembered so that the receipt can be sent in the same language.
+// userID is the Impact account to credit the donation to, or empty if the donor wasn't logged in.
+func CreatePayment(amount int64, currency string, description string, email string, locale string, userID string) (*Payment, error) {
 	params := &stripe.PaymentIntentParams{
 		Amount:      stripe.Int64(amount),
 		Currency:    stripe.String(currency),
@@ -151,6 +176,12 @@ func CreatePayment(amount int64, currency string, description string, email stri
 	if email != "" {
 		params.AddMetadata("email", email)
 	}
+	if locale != "" {
+		params.AddMetadata("locale", locale)
+	}
+	if userID != "" {
+		params.AddMetadata("user_id", userID)
+	}
 	payment, err := paymentintent.New(params)
 	if err != nil {
 		return nil, err
@@ -168,29 +199,36 @@ func GetPayment(id string) (*Payment, error) {
 	return makePaymentStruct(payment), nil
 }
 
-func GetCurrencySymbol(currency string) string {
-	if it, ok := stripeCurrencyMap[currency]; ok {
-		return it.Symbol
+// GetCurrencyInfo returns the currency with the given code, including the amount needed for each donation tier
+// at today's exchange rate, or an error if donations can't be made in it
+func GetCurrencyInfo(code string) (*CurrencyInfo, error) {
+	c, err := currency.Get(code)
+	if err != nil {
+		return nil, err
 	}
-	return "¤"
-}
-
-func GetCurrencyInfo(currency string) (*CurrencyInfo, error) {
-	if it, ok := stripeCurrencyMap[currency]; ok {
-		return &it, nil
+	list, err := tiers.Get()
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.New("invalid or unsupported currency \"" + currency + "\"")
+	return makeCurrencyInfo(*c, list)
 }
 
-func GetCurrencyMap() map[string]CurrencyInfo {
-	return stripeCurrencyMap
+// GetCurrencyMap returns every currency donations can be made in, leaving out any we don't have an exchange rate for
+func GetCurrencyMap(list []database.DonationTier) map[string]CurrencyInfo {
+	ret := make(map[string]CurrencyInfo)
+	for _, c := range currency.Enabled() {
+		if info, err := makeCurrencyInfo(c, list); err == nil {
+			ret[c.Code] = *info
+		}
+	}
+	return ret
 }
 
 // SendReceipt updates the payment description if a token is provided and sends a receipt if an email is associated with the payment
-func SendReceipt(payment *stripe.PaymentIntent, token *uuid.UUID) error {
+func SendReceipt(payment *payments.Payment, token *uuid.UUID) error {
 	var params stripe.PaymentIntentParams
-	if email, ok := payment.Metadata["email"]; ok {
-		params.ReceiptEmail = &email
+	if payment.Email != "" {
+		params.ReceiptEmail = stripe.String(payment.Email)
 	}
 	if token != nil {
 		params.AddMetadata("token", token.String())
@@ -0,0 +1,121 @@
+package stripe
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/payments"
+	"github.com/labstack/echo/v4"
+	"github.com/stripe/stripe-go/v71"
+	"github.com/stripe/stripe-go/v71/refund"
+)
+
+// Name is the name of the stripe payments.Provider
+const Name = "stripe"
+
+// Provider implements payments.Provider using payment intents
+type Provider struct{}
+
+var _ payments.Provider = Provider{}
+
+func (Provider) Name() string {
+	return Name
+}
+
+func (Provider) CreatePayment(order payments.Order) (*payments.Payment, error) {
+	payment, err := CreatePayment(order.Amount, order.Currency, order.Description, order.Email, order.Locale, order.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return ToPayment(payment.PaymentIntent), nil
+}
+
+// CapturePayment just fetches the payment, payment intents are captured automatically once the donor confirms them
+func (Provider) CapturePayment(id string) (*payments.Payment, error) {
+	payment, err := GetPayment(id)
+	if err != nil {
+		return nil, err
+	}
+	return ToPayment(payment.PaymentIntent), nil
+}
+
+func (Provider) RefundPayment(id string) error {
+	_, err := refund.New(&stripe.RefundParams{
+		PaymentIntent: stripe.String(id),
+	})
+	return err
+}
+
+// ParseWebhook verifies the event's signature. The raw event is always a *WebhookEvent, since stripe has plenty
+// of events that don't fit a payments.EventType.
+func (Provider) ParseWebhook(header http.Header, payload []byte) (*payments.Event, error) {
+	event, err := GetWebhookEvent(payload, header.Get("Stripe-Signature"))
+	if err != nil {
+		return nil, err
+	}
+	ret := &payments.Event{
+		Type: payments.EventOther,
+		Raw:  event,
+	}
+	switch event.Type {
+	case "payment_intent.succeeded":
+		var intent stripe.PaymentIntent
+		err = unmarshalEvent(event, &intent)
+		if err != nil {
+			return nil, err
+		}
+		// Subscription payments grant premium through their invoice instead
+		if intent.Invoice == nil {
+			ret.Type = payments.EventSucceeded
+			ret.Payment = ToPayment(&intent)
+		}
+	case "charge.refunded":
+		var charge stripe.Charge
+		err = unmarshalEvent(event, &charge)
+		if err != nil {
+			return nil, err
+		}
+		if charge.PaymentIntent != nil && charge.Invoice == nil {
+			ret.Type = payments.EventRefunded
+			ret.Payment = &payments.Payment{
+				Provider: Name,
+				ID:       charge.PaymentIntent.ID,
+				Status:   payments.StatusRefunded,
+				Amount:   charge.Amount,
+				Currency: string(charge.Currency),
+			}
+		}
+	}
+	return ret, nil
+}
+
+func unmarshalEvent(event *WebhookEvent, it interface{}) error {
+	err := json.Unmarshal(event.Data.Raw, it)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Error parsing webhook JSON").SetInternal(err)
+	}
+	return nil
+}
+
+// ToPayment converts a payment intent to a payments.Payment
+func ToPayment(intent *stripe.PaymentIntent) *payments.Payment {
+	status := payments.StatusPending
+	switch intent.Status {
+	case stripe.PaymentIntentStatusSucceeded:
+		status = payments.StatusSucceeded
+	case stripe.PaymentIntentStatusCanceled:
+		status = payments.StatusFailed
+	}
+	return &payments.Payment{
+		Provider:     Name,
+		ID:           intent.ID,
+		Status:       status,
+		Amount:       intent.Amount,
+		Currency:     intent.Currency,
+		Description:  intent.Description,
+		Email:        intent.Metadata["email"],
+		Locale:       intent.Metadata["locale"],
+		UserID:       intent.Metadata["user_id"],
+		ClientSecret: intent.ClientSecret,
+	}
+}
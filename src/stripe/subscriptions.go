@@ -0,0 +1,116 @@
+package stripe
+
+import (
+	"errors"
+	"os"
+
+	"github.com/stripe/stripe-go/v71"
+	portalsession "github.com/stripe/stripe-go/v71/billingportal/session"
+	checkoutsession "github.com/stripe/stripe-go/v71/checkout/session"
+	"github.com/stripe/stripe-go/v71/customer"
+	"github.com/stripe/stripe-go/v71/sub"
+)
+
+// Subscription intervals
+const (
+	Monthly = "month"
+	Yearly  = "year"
+)
+
+// subscriptionPrices are the ids of the stripe prices for each interval, set from the environment
+var subscriptionPrices = map[string]string{
+	Monthly: os.Getenv("STRIPE_PRICE_MONTHLY"),
+	Yearly:  os.Getenv("STRIPE_PRICE_YEARLY"),
+}
+
+// SubscriptionIntervals returns the intervals that users can subscribe with
+func SubscriptionIntervals() []string {
+	var ret []string
+	for _, interval := range []string{Monthly, Yearly} {
+		if subscriptionPrices[interval] != "" {
+			ret = append(ret, interval)
+		}
+	}
+	return ret
+}
+
+// CreateCustomer creates a stripe customer for the Impact account with the given id
+func CreateCustomer(userID string, email string) (string, error) {
+	params := &stripe.CustomerParams{}
+	if email != "" {
+		params.Email = stripe.String(email)
+	}
+	params.AddMetadata("user_id", userID)
+	c, err := customer.New(params)
+	if err != nil {
+		return "", err
+	}
+	return c.ID, nil
+}
+
+// CreateSubscriptionCheckout creates a checkout session for the customer to subscribe with.
+// The client redirects to it using stripe.js and the returned session id.
+func CreateSubscriptionCheckout(customerID string, userID string, interval string, locale string, successURL string, cancelURL string) (string, error) {
+	price := subscriptionPrices[interval]
+	if price == "" {
+		return "", errors.New("invalid or unsupported interval \"" + interval + "\"")
+	}
+	params := &stripe.CheckoutSessionParams{
+		Mode:               stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		Customer:           stripe.String(customerID),
+		ClientReferenceID:  stripe.String(userID),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{{
+			Price:    stripe.String(price),
+			Quantity: stripe.Int64(1),
+		}},
+		SubscriptionData: &stripe.CheckoutSessionSubscriptionDataParams{
+			Metadata: map[string]string{"user_id": userID},
+		},
+		SuccessURL: stripe.String(successURL),
+		CancelURL:  stripe.String(cancelURL),
+	}
+	if locale != "" {
+		params.Locale = stripe.String(locale)
+	}
+	session, err := checkoutsession.New(params)
+	if err != nil {
+		return "", err
+	}
+	return session.ID, nil
+}
+
+// GetSubscription fetches the subscription's current state, webhooks can arrive out of order so their copy might be stale
+func GetSubscription(id string) (*stripe.Subscription, error) {
+	return sub.Get(id, nil)
+}
+
+// CancelSubscription cancels the subscription immediately
+func CancelSubscription(id string) error {
+	_, err := sub.Cancel(id, nil)
+	return err
+}
+
+// SubscriptionInterval returns how often the subscription is billed
+func SubscriptionInterval(subscription *stripe.Subscription) string {
+	if subscription.Items != nil {
+		for _, item := range subscription.Items.Data {
+			if item.Price != nil && item.Price.Recurring != nil {
+				return string(item.Price.Recurring.Interval)
+			}
+		}
+	}
+	return Monthly
+}
+
+// CreatePortalURL returns a link to the stripe customer portal, where the customer can manage their subscriptions
+func CreatePortalURL(customerID string, returnURL string) (string, error) {
+	session, err := portalsession.New(&stripe.BillingPortalSessionParams{
+		Customer:  stripe.String(customerID),
+		ReturnURL: stripe.String(returnURL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return session.URL, nil
+}
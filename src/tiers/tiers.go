@@ -0,0 +1,95 @@
+// Package tiers decides which donation tier a donation qualifies for, and so which roles it grants
+package tiers
+
+import (
+	"errors"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/currency"
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+)
+
+// defaultTiers are used when there's no database, they match what every donation granted before tiers existed
+var defaultTiers = []database.DonationTier{{
+	ID:        "premium",
+	Name:      "Premium",
+	Perks:     []string{"Nightly builds", "In-game perks", "Custom cape upload"},
+	USDAmount: 500,
+	Amounts:   map[string]int64{},
+	Roles:     []database.DonationTierRole{{RoleID: "premium"}},
+}}
+
+// Get returns every donation tier, cheapest first
+func Get() ([]database.DonationTier, error) {
+	if database.DB == nil {
+		return defaultTiers, nil
+	}
+	return database.GetDonationTiers()
+}
+
+// Amount returns the minimum donation for the tier in the currency's minor unit, converting it from USD at today's
+// exchange rate unless the tier has its own amount for the currency
+func Amount(tier database.DonationTier, c currency.Currency) (int64, error) {
+	if amount, ok := tier.Amounts[c.Code]; ok {
+		return amount, nil
+	}
+	return c.FromUSD(tier.USDAmount)
+}
+
+// Minimum returns the smallest donation that qualifies for any tier, in the currency's minor unit.
+// Tiers that can't be converted to the currency are left out, it's an error if that's all of them.
+func Minimum(tiers []database.DonationTier, c currency.Currency) (int64, error) {
+	if len(tiers) < 1 {
+		return 0, errors.New("there are no donation tiers")
+	}
+	return minimum(tiers, func(tier database.DonationTier) (int64, error) {
+		return Amount(tier, c)
+	})
+}
+
+func minimum(tiers []database.DonationTier, threshold func(tier database.DonationTier) (int64, error)) (int64, error) {
+	var (
+		min int64
+		err error
+	)
+	for _, tier := range tiers {
+		amount, e := threshold(tier)
+		if e != nil {
+			err = e
+			continue
+		}
+		if min == 0 || amount < min {
+			min = amount
+		}
+	}
+	if min == 0 {
+		return 0, err
+	}
+	return min, nil
+}
+
+// Match returns the most expensive tier the donation qualifies for, or nil if it's too small for any of them.
+// Tiers that can't be converted to the currency, e.g. because the exchange rates haven't loaded yet, are skipped
+// so that the donation still gets whichever tiers do have an amount in its currency.
+func Match(tiers []database.DonationTier, code string, amount int64) (*database.DonationTier, error) {
+	c, ok := currency.Lookup(code)
+	if !ok {
+		return nil, errors.New("unknown currency " + code)
+	}
+	return match(tiers, amount, func(tier database.DonationTier) (int64, error) {
+		return Amount(tier, c)
+	}), nil
+}
+
+func match(tiers []database.DonationTier, amount int64, threshold func(tier database.DonationTier) (int64, error)) *database.DonationTier {
+	var match *database.DonationTier
+	for i, tier := range tiers {
+		min, err := threshold(tier)
+		if err != nil {
+			continue
+		}
+		if amount >= min && (match == nil || tier.USDAmount > match.USDAmount) {
+			match = &tiers[i]
+		}
+	}
+	return match
+}
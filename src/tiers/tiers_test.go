@@ -0,0 +1,98 @@
+package tiers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ImpactDevelopment/ImpactServer/src/currency"
+	"github.com/ImpactDevelopment/ImpactServer/src/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testTiers = []database.DonationTier{
+	{ID: "premium", USDAmount: 500, Amounts: map[string]int64{"eur": 500}},
+	{ID: "cape", USDAmount: 2500, Amounts: map[string]int64{"eur": 2000}},
+	{ID: "lifetime", USDAmount: 5000, Amounts: map[string]int64{"eur": 4500}},
+}
+
+func TestMatch(t *testing.T) {
+	for _, test := range []struct {
+		currency string
+		amount   int64
+		expected string
+	}{
+		{"usd", 499, ""},
+		{"usd", 500, "premium"},
+		{"usd", 2499, "premium"},
+		{"usd", 2500, "cape"},
+		{"usd", 100000, "lifetime"},
+		// Currencies with their own amounts don't need an exchange rate
+		{"eur", 499, ""},
+		{"eur", 2000, "cape"},
+		{"EUR", 4500, "lifetime"},
+	} {
+		tier, err := Match(testTiers, test.currency, test.amount)
+		require.NoError(t, err)
+		if test.expected == "" {
+			assert.Nil(t, tier, "%d %s", test.amount, test.currency)
+		} else if assert.NotNil(t, tier, "%d %s", test.amount, test.currency) {
+			assert.Equal(t, test.expected, tier.ID, "%d %s", test.amount, test.currency)
+		}
+	}
+
+	_, err := Match(testTiers, "xyz", 500)
+	assert.Error(t, err)
+}
+
+func TestMinimum(t *testing.T) {
+	usd, _ := currency.Lookup("usd")
+	eur, _ := currency.Lookup("eur")
+
+	// Tiers aren't necessarily cheapest first in every currency
+	reordered := []database.DonationTier{testTiers[1], {ID: "cheap", USDAmount: 1000, Amounts: map[string]int64{"eur": 300}}}
+	amount, err := Minimum(reordered, eur)
+	require.NoError(t, err)
+	assert.Equal(t, int64(300), amount)
+	amount, err = Minimum(reordered, usd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), amount)
+
+	_, err = Minimum(nil, usd)
+	assert.Error(t, err)
+}
+
+func TestDefaultTiers(t *testing.T) {
+	tiers, err := Get()
+	require.NoError(t, err)
+	require.Len(t, tiers, 1)
+	assert.Equal(t, "premium", tiers[0].Roles[0].RoleID)
+	// Forever
+	assert.Nil(t, tiers[0].Roles[0].Duration)
+}
+
+func TestMissingExchangeRate(t *testing.T) {
+	// Only the cheapest tier has its own amount, so the others need an exchange rate we don't have
+	threshold := func(tier database.DonationTier) (int64, error) {
+		if amount, ok := tier.Amounts["eur"]; ok && tier.ID == "premium" {
+			return amount, nil
+		}
+		return 0, errors.New("no exchange rate for EUR")
+	}
+
+	tier := match(testTiers, 100000, threshold)
+	if assert.NotNil(t, tier) {
+		assert.Equal(t, "premium", tier.ID)
+	}
+	assert.Nil(t, match(testTiers, 499, threshold))
+
+	amount, err := minimum(testTiers, threshold)
+	require.NoError(t, err)
+	assert.Equal(t, int64(500), amount)
+
+	// Nothing at all in the currency
+	none := func(tier database.DonationTier) (int64, error) { return 0, errors.New("no exchange rate for EUR") }
+	assert.Nil(t, match(testTiers, 100000, none))
+	_, err = minimum(testTiers, none)
+	assert.Error(t, err)
+}
@@ -0,0 +1,82 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the ascii "12345678901234567890" used by the RFC test vectors
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226 Appendix D
+	expected := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	key, err := decodeSecret(rfcSecret)
+	require.NoError(t, err)
+	for counter, code := range expected {
+		assert.Equal(t, code, hotp(key, uint64(counter), 6), "counter %d", counter)
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 Appendix B, SHA1 with 8 digits
+	expected := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	key, err := decodeSecret(rfcSecret)
+	require.NoError(t, err)
+	for unix, code := range expected {
+		assert.Equal(t, code, hotp(key, uint64(Step(time.Unix(unix, 0))), 8), "time %d", unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	now := time.Unix(1600000000, 0)
+	step := Step(now)
+
+	code, err := Code(secret, step)
+	require.NoError(t, err)
+	matched, ok := Validate(secret, code, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, step, matched)
+
+	// Neighbouring steps are allowed for clock drift, but nothing further
+	previous, _ := Code(secret, step-1)
+	matched, ok = Validate(secret, previous, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, step-1, matched)
+	old, _ := Code(secret, step-2)
+	_, ok = Validate(secret, old, now, 0)
+	assert.False(t, ok)
+
+	// Codes can't be reused
+	_, ok = Validate(secret, code, now, step)
+	assert.False(t, ok)
+
+	// Lowercase secrets, like those typed by hand, still work
+	_, ok = Validate(strings.ToLower(secret), code, now, 0)
+	assert.True(t, ok)
+
+	_, ok = Validate(secret, "", now, 0)
+	assert.False(t, ok)
+	_, ok = Validate("not base32!", code, now, 0)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("JBSWY3DPEHPK3PXP", "Impact", "someone@example.com")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Impact:someone@example.com?"), uri)
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=Impact")
+}
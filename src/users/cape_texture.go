@@ -0,0 +1,83 @@
+package users
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image/png"
+	"io"
+	"io/ioutil"
+)
+
+// Minecraft cape textures are 64x32, HD capes are any multiple of that
+const (
+	capeBaseWidth = 64
+	capeMaxWidth  = 1024
+)
+
+// CanUploadCape returns true if the user is entitled to upload a custom cape
+func (user User) CanUploadCape() bool {
+	return user.hasRoleWith(func(role Role) bool { return role.CapeUpload })
+}
+
+// CapeTexture is a validated cape texture, ready to be stored
+type CapeTexture struct {
+	// PNG data, re-encoded so that it contains no metadata chunks
+	Data []byte
+	// Hex sha256 of Data
+	Hash          string
+	Width, Height int
+}
+
+// ProcessCapeTexture checks r contains a PNG with the dimensions Minecraft expects of a cape/elytra texture,
+// then re-encodes it to strip any metadata and hashes the result.
+func ProcessCapeTexture(r io.Reader) (*CapeTexture, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the header before decoding the whole thing, so we don't inflate huge images
+	config, err := png.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("not a valid png: %w", err)
+	}
+	err = validateCapeDimensions(config.Width, config.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := png.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("not a valid png: %w", err)
+	}
+
+	// png.Encode only writes the chunks needed to describe the pixels, so text, exif, etc are dropped
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	return &CapeTexture{
+		Data:   buf.Bytes(),
+		Hash:   hex.EncodeToString(sum[:]),
+		Width:  config.Width,
+		Height: config.Height,
+	}, nil
+}
+
+func validateCapeDimensions(width, height int) error {
+	if width <= 0 || height <= 0 || width != height*2 {
+		return fmt.Errorf("cape must be twice as wide as it is tall, got %dx%d", width, height)
+	}
+	if width%capeBaseWidth != 0 {
+		return fmt.Errorf("cape width must be a multiple of %d, got %d", capeBaseWidth, width)
+	}
+	if width > capeMaxWidth {
+		return fmt.Errorf("cape must be at most %dx%d, got %dx%d", capeMaxWidth, capeMaxWidth/2, width, height)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package users
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeTestPNG(t *testing.T, width, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	img.Set(1, 1, color.NRGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestProcessCapeTexture(t *testing.T) {
+	for _, size := range [][2]int{{64, 32}, {128, 64}, {1024, 512}} {
+		cape, err := ProcessCapeTexture(bytes.NewReader(encodeTestPNG(t, size[0], size[1])))
+		if assert.NoError(t, err, "%dx%d", size[0], size[1]) {
+			assert.Equal(t, size[0], cape.Width)
+			assert.Equal(t, size[1], cape.Height)
+			assert.Len(t, cape.Hash, 64)
+		}
+	}
+
+	for _, size := range [][2]int{{64, 64}, {96, 48}, {22, 17}, {2048, 1024}} {
+		_, err := ProcessCapeTexture(bytes.NewReader(encodeTestPNG(t, size[0], size[1])))
+		assert.Error(t, err, "%dx%d", size[0], size[1])
+	}
+
+	_, err := ProcessCapeTexture(bytes.NewReader([]byte("GIF89a not a png")))
+	assert.Error(t, err)
+}
+
+func TestProcessCapeTextureStripsMetadata(t *testing.T) {
+	clean := encodeTestPNG(t, 64, 32)
+
+	// Insert a tEXt chunk straight after the IHDR chunk (8 byte signature + 25 byte IHDR)
+	chunk := []byte("tEXtkey\x00val")
+	text := make([]byte, 4+len(chunk)+4)
+	binary.BigEndian.PutUint32(text, uint32(len(chunk)-4))
+	copy(text[4:], chunk)
+	binary.BigEndian.PutUint32(text[4+len(chunk):], crc32.ChecksumIEEE(chunk))
+	dirty := append(append(append([]byte{}, clean[:33]...), text...), clean[33:]...)
+
+	a, err := ProcessCapeTexture(bytes.NewReader(clean))
+	assert.NoError(t, err)
+	b, err := ProcessCapeTexture(bytes.NewReader(dirty))
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(b.Data), "tEXt")
+		assert.Equal(t, a.Hash, b.Hash)
+	}
+}
+
+func TestCanUploadCape(t *testing.T) {
+	assert.False(t, User{}.CanUploadCape())
+
+	// The perk comes from the role's cape_upload flag, not its id
+	donor := User{Roles: []Role{NewRole("donor", 5, false, true, nil, nil)}}
+	assert.False(t, donor.CanUploadCape())
+	donor.Roles[0].CapeUpload = true
+	assert.True(t, donor.CanUploadCape())
+}
@@ -0,0 +1,66 @@
+package users
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// namedColors are the color names that clients understand: Minecraft's chat formatting colors, e.g. LIGHT_PURPLE,
+// and the constants in java.awt.Color, e.g. ORANGE
+var namedColors = map[string]bool{
+	"BLACK":        true,
+	"DARK_BLUE":    true,
+	"DARK_GREEN":   true,
+	"DARK_AQUA":    true,
+	"DARK_RED":     true,
+	"DARK_PURPLE":  true,
+	"GOLD":         true,
+	"GRAY":         true,
+	"DARK_GRAY":    true,
+	"BLUE":         true,
+	"GREEN":        true,
+	"AQUA":         true,
+	"RED":          true,
+	"LIGHT_PURPLE": true,
+	"YELLOW":       true,
+	"WHITE":        true,
+	// java.awt.Color
+	"LIGHT_GRAY": true,
+	"PINK":       true,
+	"ORANGE":     true,
+	"MAGENTA":    true,
+	"CYAN":       true,
+}
+
+// hexColor matches #RRGGBB or #AARRGGBB
+var hexColor = regexp.MustCompile(`^#([0-9A-Fa-f]{6}|[0-9A-Fa-f]{8})$`)
+
+// IsValidColor returns true if color is a named color (e.g. GOLD), a hex color (e.g. #FFC9002B)
+// or a numeric ARGB color (e.g. -1761673216). An empty string is valid and means "default".
+func IsValidColor(color string) bool {
+	if color == "" || namedColors[color] || hexColor.MatchString(color) {
+		return true
+	}
+	_, err := strconv.ParseInt(color, 10, 32)
+	return err == nil
+}
+
+// ValidateColor returns an error naming the field if color isn't valid
+func ValidateColor(field string, color string) error {
+	if !IsValidColor(color) {
+		return fmt.Errorf("invalid %s %q", field, color)
+	}
+	return nil
+}
+
+// Validate returns an error if any of the colors are in an unknown format
+func (info UserInfo) Validate() error {
+	if err := ValidateColor("text_color", info.TextColor); err != nil {
+		return err
+	}
+	if err := ValidateColor("bg_color", info.BackgroundColor); err != nil {
+		return err
+	}
+	return ValidateColor("border_color", info.BorderColor)
+}
@@ -0,0 +1,32 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidColor(t *testing.T) {
+	// Formats already used by role defaults
+	assert.True(t, IsValidColor(""))
+	assert.True(t, IsValidColor("GOLD"))
+	assert.True(t, IsValidColor("LIGHT_PURPLE"))
+	// Used by an existing customization, see migration 0004
+	assert.True(t, IsValidColor("ORANGE"))
+	assert.True(t, IsValidColor("#50FFFFFF"))
+	assert.True(t, IsValidColor("#C9002B"))
+	assert.True(t, IsValidColor("1358954495"))
+	assert.True(t, IsValidColor("-1761673216"))
+
+	assert.False(t, IsValidColor("gold"))
+	assert.False(t, IsValidColor("PURPLE"))
+	assert.False(t, IsValidColor("#FFF"))
+	assert.False(t, IsValidColor("#GGGGGGGG"))
+	assert.False(t, IsValidColor("99999999999"))
+	assert.False(t, IsValidColor("javascript:alert(1)"))
+}
+
+func TestUserInfoValidate(t *testing.T) {
+	assert.NoError(t, UserInfo{TextColor: "BLUE", BackgroundColor: "#50FFFFFF", BorderColor: "#FFC9002B"}.Validate())
+	assert.EqualError(t, UserInfo{BorderColor: "nope"}.Validate(), `invalid border_color "nope"`)
+}
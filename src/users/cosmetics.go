@@ -0,0 +1,184 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Cosmetic is a cape or icon from the catalog that users can choose
+type Cosmetic struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Texture url
+	URL string `json:"url"`
+}
+
+// NametagPreset is a suggested set of nametag colors
+type NametagPreset struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	TextColor       string `json:"text_color,omitempty"`
+	BackgroundColor string `json:"bg_color,omitempty"`
+	BorderColor     string `json:"border_color,omitempty"`
+}
+
+// CosmeticsCatalog lists the cosmetics a user is allowed to choose from
+type CosmeticsCatalog struct {
+	Capes    []Cosmetic      `json:"capes,omitempty"`
+	Icons    []Cosmetic      `json:"icons,omitempty"`
+	Nametags []NametagPreset `json:"nametags,omitempty"`
+}
+
+// CosmeticChoice is what the user has picked from the catalog. Empty fields mean "use my role defaults"
+type CosmeticChoice struct {
+	Cape            string `json:"cape,omitempty"`
+	Icon            string `json:"icon,omitempty"`
+	TextColor       string `json:"text_color,omitempty"`
+	BackgroundColor string `json:"bg_color,omitempty"`
+	BorderColor     string `json:"border_color,omitempty"`
+}
+
+var capes = []Cosmetic{
+	{ID: "premium", Name: "Premium", URL: "https://files.impactclient.net/img/texture/premium_cape_elytra.png"},
+	{ID: "staff", Name: "Staff", URL: "https://files.impactclient.net/img/texture/staff_cape_elytra.png"},
+	{ID: "developer", Name: "Developer", URL: "https://files.impactclient.net/img/texture/developer_cape_elytra.png"},
+	{ID: "pepsi", Name: "Pepsi", URL: "https://files.impactclient.net/img/texture/pepsi_cape_elytra.png"},
+	{ID: "spawnmason", Name: "Spawnmason", URL: "https://files.impactclient.net/img/texture/spawnmason_cape_elytra.png"},
+}
+
+var icons = []Cosmetic{
+	{ID: "pepsi", Name: "Pepsi", URL: "https://files.impactclient.net/img/texture/pepsi_v2_128.png"},
+	{ID: "spawnmason", Name: "Spawnmason", URL: "https://files.impactclient.net/img/texture/spawnmason128.png"},
+}
+
+var nametagPresets = []NametagPreset{
+	{ID: "gold", Name: "Gold", TextColor: "GOLD"},
+	{ID: "aqua", Name: "Aqua", TextColor: "AQUA"},
+	{ID: "purple", Name: "Purple", TextColor: "LIGHT_PURPLE"},
+	{ID: "red", Name: "Red", TextColor: "RED"},
+	{ID: "green", Name: "Green", TextColor: "GREEN"},
+	{ID: "shadow", Name: "Shadow", TextColor: "WHITE", BackgroundColor: "#90404040", BorderColor: "DARK_GRAY"},
+}
+
+// entitlement returns the catalog ids a role can choose from one list, e.g. Role.Capes
+type entitlement func(role Role) []string
+
+func roleCapes(role Role) []string { return role.Capes }
+func roleIcons(role Role) []string { return role.Icons }
+
+// hasAnyRole returns true if the user has at least one of the role ids
+func (user User) hasAnyRole(roleIDs []string) bool {
+	for _, id := range roleIDs {
+		if user.HasRoleWithID(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasRoleWith returns true if at least one of the user's roles has the perk
+func (user User) hasRoleWith(perk func(role Role) bool) bool {
+	for _, role := range user.Roles {
+		if perk(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// canCustomizeNametag returns true if the user is entitled to choose their own nametag colors
+func (user User) canCustomizeNametag() bool {
+	return user.hasRoleWith(func(role Role) bool { return role.CustomNametag })
+}
+
+// isEntitled returns true if at least one of the user's roles can choose the catalog id
+func (user User) isEntitled(entitled entitlement, id string) bool {
+	return user.hasRoleWith(func(role Role) bool {
+		for _, it := range entitled(role) {
+			if it == id {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// findCosmetic returns the cosmetic with the given id, if the user is entitled to it
+func (user User) findCosmetic(list []Cosmetic, entitled entitlement, id string) *Cosmetic {
+	for _, it := range list {
+		if it.ID == id && user.isEntitled(entitled, it.ID) {
+			return &it
+		}
+	}
+	return nil
+}
+
+// CosmeticsCatalog returns the cosmetics this user is entitled to choose, or nil if there are none
+func (user User) CosmeticsCatalog() *CosmeticsCatalog {
+	var catalog CosmeticsCatalog
+	for _, it := range capes {
+		if user.isEntitled(roleCapes, it.ID) {
+			catalog.Capes = append(catalog.Capes, it)
+		}
+	}
+	for _, it := range icons {
+		if user.isEntitled(roleIcons, it.ID) {
+			catalog.Icons = append(catalog.Icons, it)
+		}
+	}
+	if user.canCustomizeNametag() {
+		catalog.Nametags = nametagPresets
+	}
+
+	if len(catalog.Capes) > 0 || len(catalog.Icons) > 0 || len(catalog.Nametags) > 0 {
+		return &catalog
+	}
+	return nil
+}
+
+// ValidateCosmeticChoice returns an error if the choice isn't in the catalog or the user isn't entitled to it
+func (user User) ValidateCosmeticChoice(choice CosmeticChoice) error {
+	if choice.Cape != "" && user.findCosmetic(capes, roleCapes, choice.Cape) == nil {
+		return fmt.Errorf("cape %q is not available", choice.Cape)
+	}
+	if choice.Icon != "" && user.findCosmetic(icons, roleIcons, choice.Icon) == nil {
+		return fmt.Errorf("icon %q is not available", choice.Icon)
+	}
+	if choice.TextColor != "" || choice.BackgroundColor != "" || choice.BorderColor != "" {
+		if !user.canCustomizeNametag() {
+			return errors.New("custom nametags are not available")
+		}
+		return UserInfo{
+			TextColor:       choice.TextColor,
+			BackgroundColor: choice.BackgroundColor,
+			BorderColor:     choice.BorderColor,
+		}.Validate()
+	}
+	return nil
+}
+
+// applyCosmeticChoice sets any unset fields in info from the user's choice.
+// Entitlement is checked again here, in case the user has lost a role since choosing.
+func (user User) applyCosmeticChoice(info *UserInfo) {
+	choice := user.Cosmetics
+	if choice == nil {
+		return
+	}
+	if cape := user.findCosmetic(capes, roleCapes, choice.Cape); cape != nil && info.Cape == "" {
+		info.Cape = cape.URL
+	}
+	if icon := user.findCosmetic(icons, roleIcons, choice.Icon); icon != nil && info.Icon == "" {
+		info.Icon = icon.URL
+	}
+	if user.canCustomizeNametag() {
+		if choice.TextColor != "" && info.TextColor == "" {
+			info.TextColor = choice.TextColor
+		}
+		if choice.BackgroundColor != "" && info.BackgroundColor == "" {
+			info.BackgroundColor = choice.BackgroundColor
+		}
+		if choice.BorderColor != "" && info.BorderColor == "" {
+			info.BorderColor = choice.BorderColor
+		}
+	}
+}
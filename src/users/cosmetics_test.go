@@ -0,0 +1,88 @@
+package users
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNametagPresetsAreValid(t *testing.T) {
+	for _, preset := range nametagPresets {
+		err := UserInfo{
+			TextColor:       preset.TextColor,
+			BackgroundColor: preset.BackgroundColor,
+			BorderColor:     preset.BorderColor,
+		}.Validate()
+		assert.NoError(t, err, "preset %s", preset.ID)
+	}
+}
+
+func TestCosmeticsCatalog(t *testing.T) {
+	nobody := User{}
+	assert.Nil(t, nobody.CosmeticsCatalog())
+
+	pepsiRole := NewRole("pepsi", 1, true, true, nil, nil)
+	pepsiRole.CustomNametag = true
+	pepsiRole.Capes = []string{"pepsi"}
+	pepsiRole.Icons = []string{"pepsi"}
+	pepsi := User{Roles: []Role{pepsiRole}}
+	catalog := pepsi.CosmeticsCatalog()
+	if assert.NotNil(t, catalog) {
+		assert.Len(t, catalog.Capes, 1)
+		assert.Equal(t, "pepsi", catalog.Capes[0].ID)
+		assert.Len(t, catalog.Icons, 1)
+		assert.Equal(t, nametagPresets, catalog.Nametags)
+	}
+}
+
+func TestValidateCosmeticChoice(t *testing.T) {
+	premiumRole := NewRole("premium", 4, true, true, nil, nil)
+	premiumRole.CustomNametag = true
+	premiumRole.Capes = []string{"premium"}
+	premium := User{Roles: []Role{premiumRole}}
+
+	assert.NoError(t, premium.ValidateCosmeticChoice(CosmeticChoice{}))
+	assert.NoError(t, premium.ValidateCosmeticChoice(CosmeticChoice{Cape: "premium", TextColor: "AQUA", BorderColor: "#FFC9002B"}))
+	assert.Error(t, premium.ValidateCosmeticChoice(CosmeticChoice{Cape: "staff"}))
+	assert.Error(t, premium.ValidateCosmeticChoice(CosmeticChoice{Icon: "pepsi"}))
+	assert.Error(t, premium.ValidateCosmeticChoice(CosmeticChoice{Cape: "nonexistent"}))
+	assert.Error(t, premium.ValidateCosmeticChoice(CosmeticChoice{TextColor: "not a color"}))
+	assert.Error(t, User{}.ValidateCosmeticChoice(CosmeticChoice{TextColor: "GOLD"}))
+
+	// The perk comes from the role's custom_nametag flag, not its id
+	donor := User{Roles: []Role{NewRole("donor", 5, false, true, nil, nil)}}
+	assert.Error(t, donor.ValidateCosmeticChoice(CosmeticChoice{TextColor: "GOLD"}))
+	donor.Roles[0].CustomNametag = true
+	assert.NoError(t, donor.ValidateCosmeticChoice(CosmeticChoice{TextColor: "GOLD"}))
+
+	// Likewise capes and icons come from the role's catalog entitlements
+	assert.Error(t, donor.ValidateCosmeticChoice(CosmeticChoice{Cape: "premium"}))
+	donor.Roles[0].Capes = []string{"premium"}
+	assert.NoError(t, donor.ValidateCosmeticChoice(CosmeticChoice{Cape: "premium"}))
+	assert.Error(t, donor.ValidateCosmeticChoice(CosmeticChoice{Icon: "premium"}))
+}
+
+func TestCosmeticChoiceInUserInfo(t *testing.T) {
+	premium := NewRole("premium", 4, true, true, &UserInfo{Cape: "default cape", TextColor: "GOLD"}, nil)
+	premium.CustomNametag = true
+	user := User{
+		Roles:     []Role{premium},
+		Cosmetics: &CosmeticChoice{Cape: "staff", TextColor: "AQUA"},
+	}
+
+	// Not entitled to the staff cape, so the role default is used
+	info := NewUserInfo(user)
+	assert.Equal(t, "default cape", info.Cape)
+	assert.Equal(t, "AQUA", info.TextColor)
+
+	// Customizations win over choices
+	user.Customization = &Customization{Info: &UserInfo{TextColor: "RED"}}
+	info = NewUserInfo(user)
+	assert.Equal(t, "RED", info.TextColor)
+
+	// Choices are ignored once the role is gone
+	user.Roles = nil
+	user.Customization = nil
+	info = NewUserInfo(user)
+	assert.Equal(t, "", info.TextColor)
+}
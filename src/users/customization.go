@@ -0,0 +1,22 @@
+package users
+
+// Customization is a set of cosmetics given to a specific user, they take priority over any role defaults
+type Customization struct {
+	Info    *UserInfo `json:"info,omitempty"`
+	Edition *Edition  `json:"edition,omitempty"`
+}
+
+// Validate returns an error if any of the colors are in an unknown format
+func (c Customization) Validate() error {
+	if c.Info != nil {
+		if err := c.Info.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Edition != nil {
+		if err := ValidateColor("edition text_color", c.Edition.TextColor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
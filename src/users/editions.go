@@ -15,19 +15,12 @@ type Edition struct {
 func (user User) Edition() *Edition {
 	// Start by building a list of editions
 	var editions []Edition
-	if user.MinecraftID != nil {
-		if special, ok := specialCases[*user.MinecraftID]; ok {
-			if e := special.edition; e != nil {
-				editions = append(editions, *e)
-			}
-		}
+	if c := user.Customization; c != nil && c.Edition != nil {
+		editions = append(editions, *c.Edition)
 	}
 	for _, role := range getRolesSorted(user.Roles) {
-		if template, ok := defaultRoleTemplates[role.ID]; ok {
-			e := template.edition
-			if e != nil {
-				editions = append(editions, *e)
-			}
+		if e := role.template.edition; e != nil {
+			editions = append(editions, *e)
 		}
 	}
 
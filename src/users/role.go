@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"sync"
+	"time"
 )
 
 type Role struct {
@@ -13,6 +15,19 @@ type Role struct {
 	rank int
 	// Is there a legacy list of pure UUIDs that old clients rely on?
 	LegacyList bool
+	// Can this role be granted by a registration token?
+	TokenGrantable bool
+	// Can users with this role choose their own nametag colors?
+	CustomNametag bool
+	// Can users with this role upload their own cape texture?
+	CapeUpload bool
+	// Catalog capes and icons users with this role can choose, by id
+	Capes []string
+	Icons []string
+	// When this role expires, if it was granted to a user for a limited time
+	Expires *time.Time
+	// Default cosmetics for users with this role
+	template roleTemplate
 }
 
 type roleTemplate struct {
@@ -20,75 +35,62 @@ type roleTemplate struct {
 	edition *Edition
 }
 
-var Roles = map[string]Role{
-	"pepsi":      {ID: "pepsi", rank: 1, LegacyList: true},
-	"spawnmason": {ID: "spawnmason", rank: 0, LegacyList: false},
-	"developer":  {ID: "developer", rank: 2, LegacyList: true},
-	"staff":      {ID: "staff", rank: 3, LegacyList: true},
-	"premium":    {ID: "premium", rank: 4, LegacyList: true},
-}
+// roles is the set of known roles, keyed by id. It is loaded from the roles table using SetRoles
+var roles = make(map[string]Role)
+var rolesLock sync.RWMutex
 
-var defaultRoleTemplates = map[string]roleTemplate{
-	"developer": {
-		info: &UserInfo{
-			Cape: "https://files.impactclient.net/img/texture/developer_cape_elytra.png",
-		},
-	},
-	"staff": {
-		info: &UserInfo{
-			Cape: "https://files.impactclient.net/img/texture/staff_cape_elytra.png",
-		},
-		edition: &Edition{
-			Text:      "Staff",
-			TextColor: "#FF7734EB",
-		},
-	},
-	"pepsi": {
-		info: &UserInfo{
-			Icon:            "https://files.impactclient.net/img/texture/pepsi_v2_128.png",
-			Cape:            "https://files.impactclient.net/img/texture/pepsi_cape_elytra.png",
-			TextColor:       "BLUE",      // #004B93 is the official logo blue
-			BackgroundColor: "#50FFFFFF", // #005CB4 is the official "background" blue, #0063a7 is also used
-			BorderColor:     "#FFC9002B", // #C9002B is the official logo red
-		},
-		edition: &Edition{
-			Icon:      "https://files.impactclient.net/img/texture/pepsi_v2_128.png",
-			Text:      "Pepsi",
-			TextColor: "#FFC9002B",
-		},
-	},
-	"spawnmason": {
-		info: &UserInfo{
-			Icon:            "https://files.impactclient.net/img/texture/spawnmason128.png",
-			Cape:            "https://files.impactclient.net/img/texture/spawnmason_cape_elytra.png",
-			TextColor:       "GOLD",
-			BackgroundColor: "#90404040",
-			BorderColor:     "RED",
+// NewRole creates a Role, info and edition are the default cosmetics and can be nil
+func NewRole(id string, rank int, legacyList bool, tokenGrantable bool, info *UserInfo, edition *Edition) Role {
+	return Role{
+		ID:             id,
+		rank:           rank,
+		LegacyList:     legacyList,
+		TokenGrantable: tokenGrantable,
+		template: roleTemplate{
+			info:    info,
+			edition: edition,
 		},
-	},
-	"premium": {
-		info: &UserInfo{
-			Cape: "https://files.impactclient.net/img/texture/premium_cape_elytra.png",
-		},
-		edition: &Edition{
-			Text:      "Premium",
-			TextColor: "GOLD",
-		},
-	},
+	}
+}
+
+// SetRoles replaces the set of known roles
+func SetRoles(list []Role) {
+	m := make(map[string]Role, len(list))
+	for _, role := range list {
+		m[role.ID] = role
+	}
+
+	rolesLock.Lock()
+	defer rolesLock.Unlock()
+	roles = m
+}
+
+// GetRole returns the role with the given id, if it exists
+func GetRole(id string) (role Role, ok bool) {
+	rolesLock.RLock()
+	defer rolesLock.RUnlock()
+	role, ok = roles[id]
+	return
+}
+
+// GetRoles returns all known roles, sorted by rank
+func GetRoles() []Role {
+	rolesLock.RLock()
+	list := make([]Role, 0, len(roles))
+	for _, role := range roles {
+		list = append(list, role)
+	}
+	rolesLock.RUnlock()
+	return getRolesSorted(list)
 }
 
 func (role Role) applyDefaults(info *UserInfo) {
-	t, ok := defaultRoleTemplates[role.ID]
-	if !ok {
-		fmt.Println("ERROR idk how to apply", role.ID)
+	template := role.template.info
+	if template == nil {
 		// No default template to apply
 		return
 	}
-	if t.info == nil {
-		return
-	}
 
-	template := t.info
 	if template.Icon != "" && info.Icon == "" {
 		info.Icon = template.Icon
 	}
@@ -131,10 +133,8 @@ func (role *Role) UnmarshalJSON(bytes []byte) error {
 	if err != nil {
 		return err
 	}
-	if r, ok := Roles[id]; ok {
-		role.ID = r.ID
-		role.rank = r.rank
-		role.LegacyList = r.LegacyList
+	if r, ok := GetRole(id); ok {
+		*role = r
 		return nil
 	}
 	return fmt.Errorf("unable to find role with id %s", string(id))
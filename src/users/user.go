@@ -5,8 +5,11 @@ import (
 )
 
 type User struct {
-	ID            uuid.UUID  `json:"-"`
-	Email         string     `json:"email"`
+	ID            uuid.UUID `json:"-"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	// Locale the user wants emails in, empty to guess from Accept-Language
+	Locale        string     `json:"locale"`
 	MinecraftID   *uuid.UUID `json:"minecraft"`
 	DiscordID     string     `json:"discord"`
 	PasswordHash  string     `json:"-"`
@@ -16,6 +19,10 @@ type User struct {
 	Legacy        bool       `json:"legacy"`
 	Roles         []Role     `json:"roles"`
 	UserInfo      *UserInfo  `json:"user_info"`
+	// Customization overrides the cosmetics granted by the user's roles
+	Customization *Customization `json:"-"`
+	// Cosmetics the user has chosen from their CosmeticsCatalog
+	Cosmetics *CosmeticChoice `json:"-"`
 }
 
 func (user User) RoleIDs(legacyOnly bool) []string {
@@ -52,3 +59,11 @@ func (user User) CheckPassword(password string) bool {
 	hash := password // TODO actually hash passwords
 	return user.PasswordHash == hash
 }
+
+// twoFactorRoles have access to privileged endpoints, so they must use two factor authentication to use them
+var twoFactorRoles = []string{"staff", "developer"}
+
+// RequiresTwoFactor returns true if the user must log in with two factor authentication to use privileged endpoints
+func (user User) RequiresTwoFactor() bool {
+	return user.hasAnyRole(twoFactorRoles)
+}
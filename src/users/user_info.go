@@ -1,7 +1,5 @@
 package users
 
-import "github.com/google/uuid"
-
 // Public information about the user, can be hidden using `incognito`
 // Be sure to update src/users/features.go:publicFeatures() if adding/removing features
 type UserInfo struct {
@@ -17,79 +15,20 @@ type UserInfo struct {
 	BorderColor string `json:"border_color,omitempty"`
 }
 
-// NewUserInfo creates a UserInfo based on a User's roles and any special cases that apply to them
+// NewUserInfo creates a UserInfo based on a User's roles, chosen cosmetics and any customizations that apply to them
 func NewUserInfo(user User) *UserInfo {
 	var info UserInfo
 
-	if user.MinecraftID != nil {
-		if special, ok := specialCases[*user.MinecraftID]; ok {
-			if special.info != nil {
-				info = *special.info
-			}
-		}
+	if c := user.Customization; c != nil && c.Info != nil {
+		info = *c.Info
 	}
 
+	// The user's own choices take priority over their role defaults, but not over customizations
+	user.applyCosmeticChoice(&info)
+
 	for _, role := range getRolesSorted(user.Roles) { // go in order from highest priority to least (aka numerically lowest to highest)
 		role.applyDefaults(&info)
 	}
 
 	return &info
 }
-
-var specialCases = map[uuid.UUID]roleTemplate{ // TODO this should basically just be a SELECT * FROM customizations;
-	// catgorl
-	uuid.MustParse("2c3174fc-0c6b-4cfb-bb2b-0069bf7294d1"): {
-		info: &UserInfo{
-			TextColor: "LIGHT_PURPLE",
-		},
-	},
-	// leijurv
-	uuid.MustParse("51dcd870-d33b-40e9-9fc1-aecdcff96081"): {
-		info: &UserInfo{
-			TextColor: "RED",
-			Icon:      "https://files.impactclient.net/img/texture/speckles128.png",
-		},
-		edition: &Edition{
-			Icon: "https://files.impactclient.net/img/texture/speckles128.png",
-		},
-	},
-	// liejurv since leijurv is disabled
-	uuid.MustParse("7b9c005b-011e-42de-bfb4-c0003f5c3a77"): {
-		info: &UserInfo{
-			TextColor: "RED",
-			Icon:      "https://files.impactclient.net/img/texture/speckles128.png",
-		},
-		edition: &Edition{
-			Icon: "https://files.impactclient.net/img/texture/speckles128.png",
-		},
-	},
-	// triibu popstonia
-	uuid.MustParse("8e563236-c7f5-4c82-aa27-c95bf3f4c322"): {
-		info: &UserInfo{
-			Icon: "https://files.impactclient.net/img/texture/popstonia.png",
-		},
-	},
-	// popstonia (rebane)
-	uuid.MustParse("342fc44b-1fd1-4272-a4c3-a98a2df98abc"): {
-		info: &UserInfo{
-			Icon: "https://files.impactclient.net/img/texture/popstonia.png",
-		},
-	},
-	// HermeticLock
-	uuid.MustParse("e97ff4c0-48bf-4c98-be34-248fdde2ffd3"): {
-		info: &UserInfo{
-			TextColor: "RED",
-			Icon:      "https://i.imgur.com/aKt1g4H.jpg",
-			Cape:      "https://i.imgur.com/bvhC1Xk.png",
-		},
-		edition: &Edition{
-			Icon: "https://i.imgur.com/aKt1g4H.jpg",
-		},
-	},
-	// peanut
-	uuid.MustParse("9d913c0a-3d57-4ce9-8b7d-689973312856"): {
-		info: &UserInfo{
-			TextColor: "ORANGE",
-		},
-	},
-}
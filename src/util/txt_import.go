@@ -63,7 +63,7 @@ func importFromRole(role string) {
 		fmt.Println(line)
 		// delibrately ignore duplicate errors lol
 		database.DB.Exec("INSERT INTO users(mc_uuid) VALUES ($1)", line)
-		_, err = database.DB.Exec("UPDATE users SET "+role+" = TRUE WHERE mc_uuid = $1", line)
+		_, err = database.DB.Exec("INSERT INTO user_roles(user_id, role_id) SELECT user_id, $2 FROM users WHERE mc_uuid = $1 ON CONFLICT DO NOTHING", line, role)
 		if err != nil {
 			panic(err)
 		}
@@ -2,6 +2,7 @@ package web
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -70,21 +71,27 @@ func (version InstallerVersion) fetchFile() ([]byte, error) {
 	return data, err
 }
 
-func (version InstallerVersion) incrementGithubDownloadCountButDontActuallyUseTheirS3Bandwidth() {
+// incrementGithubDownloadCountButDontActuallyUseTheirS3Bandwidth requests the installer from github without
+// downloading it, so their download count goes up
+func incrementGithubDownloadCountButDontActuallyUseTheirS3Bandwidth(ctx context.Context, url string) error {
 	client := &http.Client{
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
 	}
-
-	resp, err := client.Get(version.getURL())
-
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
+	resp.Body.Close()
 	if resp.StatusCode != 302 {
-		fmt.Println("GitHub did not accept the request")
+		return fmt.Errorf("GitHub did not accept the request, status %s", resp.Status)
 	}
+	return nil
 }
 
 func init() {
@@ -201,40 +208,43 @@ func installerForExe(c echo.Context) error {
 	return installer(c, EXE)
 }
 
-func analytics(cid string, version InstallerVersion, c echo.Context) {
+// analyticsEvent is an installer download to record in google analytics
+type analyticsEvent struct {
+	CID       string
+	EXT       string
+	UserAgent string
+	IP        string
+}
+
+func analytics(ctx context.Context, event analyticsEvent) error {
 	form := map[string]string{
 		"v":   "1",
 		"t":   "event",
 		"tid": "UA-143397381-1",
-		"cid": cid,
+		"cid": event.CID,
 		"ds":  "backend",
 		"ec":  "installer",
 		"ea":  "download",
-		"el":  version.getEXT(),
-		"ua":  c.Request().UserAgent(),
+		"el":  event.EXT,
+		"ua":  event.UserAgent,
 	}
-	forward := util.RealIPIfUnambiguous(c)
-	if forward != "" {
-		form["uip"] = forward
+	if event.IP != "" {
+		form["uip"] = event.IP
 	}
 	req, err := util.FormRequest("https://www.google-analytics.com/collect", form)
 	if err != nil {
-		fmt.Println("Analytics failed to build request", err)
-		return
+		return fmt.Errorf("analytics failed to build request: %s", err.Error())
 	}
-	req.SetHeader("User-Agent", c.Request().UserAgent())
+	req.SetHeader("User-Agent", event.UserAgent)
 
 	resp, err := req.Do()
 	if err != nil {
-		fmt.Println("Analytics error", err)
-		return
+		return err
 	}
 	if !resp.Ok() {
-		fmt.Println("Analytics bad status code", resp.Status())
-		data := resp.String()
-		fmt.Println(err)
-		fmt.Println(data)
+		return fmt.Errorf("analytics bad status code %s: %s", resp.Status(), resp.String())
 	}
+	return nil
 }
 
 func makeEntry(zipWriter *zip.Writer, entryName string, entry []byte, version InstallerVersion) error {
@@ -320,8 +330,19 @@ func installer(c echo.Context, version InstallerVersion) error {
 	if err != nil {
 		return err
 	}
-	go analytics(cid, version, c)
-	go version.incrementGithubDownloadCountButDontActuallyUseTheirS3Bandwidth()
+	event := analyticsEvent{
+		CID:       cid,
+		EXT:       version.getEXT(),
+		UserAgent: c.Request().UserAgent(),
+		IP:        util.RealIPIfUnambiguous(c),
+	}
+	queuePing("analytics", func(ctx context.Context) error {
+		return analytics(ctx, event)
+	})
+	url := version.getURL()
+	queuePing("GitHub download count", func(ctx context.Context) error {
+		return incrementGithubDownloadCountButDontActuallyUseTheirS3Bandwidth(ctx, url)
+	})
 
 	return nil
 }
@@ -0,0 +1,67 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// pingQueueSize is how many pings can be waiting before new ones are dropped
+	pingQueueSize = 256
+	// pingWorkers is how many pings are sent at once
+	pingWorkers = 4
+	// pingAttempts is how many times a ping is tried before giving up on it
+	pingAttempts = 3
+	// pingTimeout is how long each attempt gets
+	pingTimeout = 10 * time.Second
+)
+
+// ping is a fire-and-forget request made after an installer download, like analytics or the github download count.
+// They aren't worth storing, so unlike outbox jobs they only live in memory and are lost on restart.
+type ping struct {
+	name string
+	send func(ctx context.Context) error
+}
+
+var pings = make(chan ping, pingQueueSize)
+
+func init() {
+	for i := 0; i < pingWorkers; i++ {
+		go pingWorker()
+	}
+}
+
+// queuePing sends the ping in the background. If too many are already waiting it is dropped rather than slowing the download.
+func queuePing(name string, send func(ctx context.Context) error) {
+	select {
+	case pings <- ping{name, send}:
+	default:
+		fmt.Println("Dropping", name, "ping, too many queued")
+	}
+}
+
+func pingWorker() {
+	for p := range pings {
+		err := p.run()
+		if err != nil {
+			fmt.Println("Giving up on", p.name, "ping", err)
+		}
+	}
+}
+
+// run tries the ping until it works or runs out of attempts, backing off in between
+func (p ping) run() (err error) {
+	for attempt := 1; attempt <= pingAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * time.Second)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+		err = p.send(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,30 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPingRetries(t *testing.T) {
+	calls := 0
+	err := ping{"test", func(ctx context.Context) error {
+		calls++
+		if calls < 2 {
+			return errors.New("try again")
+		}
+		return nil
+	}}.run()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	calls = 0
+	err = ping{"test", func(ctx context.Context) error {
+		calls++
+		return errors.New("down")
+	}}.run()
+	assert.EqualError(t, err, "down")
+	assert.Equal(t, pingAttempts, calls)
+}
@@ -0,0 +1,125 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers we accept, in order of preference
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// Algorithms is sent to the browser when registering, so it knows which keys we can verify
+var Algorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters, see RFC 8152
+const (
+	coseKty     = 1
+	coseAlg     = 3
+	coseCrv     = -1 // also RSA n
+	coseX       = -2 // also RSA e
+	coseY       = -3
+	coseKtyOKP  = 1
+	coseKtyEC2  = 2
+	coseKtyRSA  = 3
+	coseP256    = 1
+	coseEd25519 = 6
+)
+
+// parseCOSEKey converts a COSE_Key into its algorithm and public key
+func parseCOSEKey(raw []byte) (int64, crypto.PublicKey, error) {
+	decoded, _, err := decodeCBOR(raw)
+	if err != nil {
+		return 0, nil, err
+	}
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return 0, nil, errors.New("public key is not a map")
+	}
+	kty, _ := key[int64(coseKty)].(int64)
+	alg, _ := key[int64(coseAlg)].(int64)
+
+	switch {
+	case alg == AlgES256 && kty == coseKtyEC2:
+		crv, _ := key[int64(coseCrv)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		y, _ := key[int64(coseY)].([]byte)
+		if crv != coseP256 || len(x) != 32 || len(y) != 32 {
+			return 0, nil, errors.New("invalid P-256 public key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return 0, nil, errors.New("public key is not on the curve")
+		}
+		return alg, pub, nil
+	case alg == AlgEdDSA && kty == coseKtyOKP:
+		crv, _ := key[int64(coseCrv)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		if crv != coseEd25519 || len(x) != ed25519.PublicKeySize {
+			return 0, nil, errors.New("invalid Ed25519 public key")
+		}
+		return alg, ed25519.PublicKey(x), nil
+	case alg == AlgRS256 && kty == coseKtyRSA:
+		n, _ := key[int64(coseCrv)].([]byte)
+		e, _ := key[int64(coseX)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return 0, nil, errors.New("invalid RSA public key")
+		}
+		return alg, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+	return 0, nil, fmt.Errorf("unsupported key type %d with algorithm %d", kty, alg)
+}
+
+// verifySignature checks sig is a signature of data by the PKIX encoded public key
+func verifySignature(alg int64, publicKey []byte, data []byte, sig []byte) error {
+	pub, err := x509.ParsePKIXPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	switch alg {
+	case AlgES256:
+		pub, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("public key does not match algorithm")
+		}
+		var parsed struct{ R, S *big.Int }
+		rest, err := asn1.Unmarshal(sig, &parsed)
+		if err != nil || len(rest) > 0 {
+			return errors.New("malformed signature")
+		}
+		hash := sha256.Sum256(data)
+		if !ecdsa.Verify(pub, hash[:], parsed.R, parsed.S) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case AlgEdDSA:
+		pub, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return errors.New("public key does not match algorithm")
+		}
+		if !ed25519.Verify(pub, data, sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case AlgRS256:
+		pub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("public key does not match algorithm")
+		}
+		hash := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], sig)
+	}
+	return fmt.Errorf("unsupported algorithm %d", alg)
+}
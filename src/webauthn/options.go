@@ -0,0 +1,119 @@
+package webauthn
+
+// These are the json versions of the structures passed to and from navigator.credentials,
+// with binary data base64url encoded.
+
+// CredentialDescriptor identifies an existing credential
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   Bytes  `json:"id"`
+}
+
+// User identifies the account a credential is being created for
+type User struct {
+	// ID is the user handle, returned when logging in with a discoverable credential. It must not contain personal info.
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type credentialParameters struct {
+	Type      string `json:"type"`
+	Algorithm int64  `json:"alg"`
+}
+
+type authenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+type relyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// CreationOptions are passed to navigator.credentials.create as publicKey
+type CreationOptions struct {
+	Challenge              Bytes                  `json:"challenge"`
+	RP                     relyingPartyEntity     `json:"rp"`
+	User                   User                   `json:"user"`
+	PubKeyCredParams       []credentialParameters `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are passed to navigator.credentials.get as publicKey
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	Timeout          int                    `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions returns the options for registering a new passkey for user.
+// exclude should list the user's existing credential ids, so they don't register the same authenticator twice.
+func (rp RelyingParty) CreationOptions(challenge []byte, user User, exclude [][]byte) CreationOptions {
+	params := make([]credentialParameters, 0, len(Algorithms))
+	for _, alg := range Algorithms {
+		params = append(params, credentialParameters{Type: "public-key", Algorithm: alg})
+	}
+	return CreationOptions{
+		Challenge:          challenge,
+		RP:                 relyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		PubKeyCredParams:   params,
+		Timeout:            Timeout,
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: authenticatorSelection{
+			// Discoverable credentials let the user log in without typing anything first
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions returns the options for logging in. No credentials are listed, so the user picks a discoverable one.
+func (rp RelyingParty) RequestOptions(challenge []byte) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout,
+		RPID:             rp.ID,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "preferred",
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	ret := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		ret = append(ret, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+	return ret
+}
+
+// RegistrationResponse is the PublicKeyCredential returned by navigator.credentials.create
+type RegistrationResponse struct {
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AttestationObject Bytes `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the PublicKeyCredential returned by navigator.credentials.get
+type AssertionResponse struct {
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AuthenticatorData Bytes `json:"authenticatorData"`
+		Signature         Bytes `json:"signature"`
+		UserHandle        Bytes `json:"userHandle"`
+	} `json:"response"`
+}
@@ -0,0 +1,262 @@
+// Package webauthn implements the server side of WebAuthn (passkey) registration and authentication.
+// Attestation statements are not verified, we only care that the user has the key, not who made their authenticator.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Timeout is how long the browser should wait for the user, in milliseconds
+const Timeout = 5 * 60 * 1000
+
+// Authenticator data flags
+const (
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedCredential = 0x40
+)
+
+// Bytes is a byte slice that is base64url encoded in json, which is how WebAuthn clients usually send binary data
+type Bytes []byte
+
+// MarshalJSON implements json.Marshaler
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, also accepting padding
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var str string
+	err := json.Unmarshal(data, &str)
+	if err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(str, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// RelyingParty is us, as far as authenticators are concerned
+type RelyingParty struct {
+	// ID is the domain credentials are scoped to, e.g. "impactclient.net". They can then be used on any subdomain.
+	ID string
+	// Name is shown to the user by some authenticators
+	Name string
+}
+
+// checkOrigin returns true if origin is the relying party's domain or one of its subdomains
+func (rp RelyingParty) checkOrigin(origin string) bool {
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := parsed.Hostname()
+	if host != rp.ID && !strings.HasSuffix(host, "."+rp.ID) {
+		return false
+	}
+	// Browsers only allow plain http for localhost
+	return parsed.Scheme == "https" || (parsed.Scheme == "http" && rp.ID == "localhost")
+}
+
+// ClientData is the parsed clientDataJSON the browser signs along with the authenticator data
+type ClientData struct {
+	Type      string `json:"type"`
+	Challenge Bytes  `json:"challenge"`
+	Origin    string `json:"origin"`
+	// raw is needed to check the signature
+	raw []byte
+}
+
+// ParseClientData parses clientDataJSON, so that the challenge can be looked up before verifying anything else
+func ParseClientData(raw []byte) (*ClientData, error) {
+	var data ClientData
+	err := json.Unmarshal(raw, &data)
+	if err != nil {
+		return nil, fmt.Errorf("malformed client data: %w", err)
+	}
+	if len(data.Challenge) == 0 {
+		return nil, errors.New("client data has no challenge")
+	}
+	data.raw = raw
+	return &data, nil
+}
+
+// check makes sure the client data was created by a browser for us, for this kind of ceremony
+func (rp RelyingParty) checkClientData(data *ClientData, typ string) error {
+	if data.Type != typ {
+		return fmt.Errorf("client data has type %q, expected %q", data.Type, typ)
+	}
+	if !rp.checkOrigin(data.Origin) {
+		return fmt.Errorf("origin %q is not allowed", data.Origin)
+	}
+	return nil
+}
+
+// authenticatorData is the binary structure signed by the authenticator
+type authenticatorData struct {
+	raw          []byte
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte // COSE_Key, only present when registering
+}
+
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, errors.New("authenticator data is too short")
+	}
+	data := &authenticatorData{
+		raw:       raw,
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	if data.flags&flagAttestedCredential != 0 {
+		rest := raw[37:]
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data is too short")
+		}
+		rest = rest[16:] // AAGUID, which we don't care about
+		length := int(binary.BigEndian.Uint16(rest))
+		rest = rest[2:]
+		if length == 0 || len(rest) < length {
+			return nil, errors.New("invalid credential id length")
+		}
+		data.credentialID = rest[:length]
+		rest = rest[length:]
+		// The key is followed by extensions, so decode it to find out where it ends
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("malformed credential public key: %w", err)
+		}
+		data.publicKey = rest[:len(rest)-len(after)]
+	}
+	return data, nil
+}
+
+// check makes sure the authenticator created the data for us, with the user present
+func (rp RelyingParty) checkAuthenticatorData(data *authenticatorData) error {
+	hash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data.rpIDHash, hash[:]) {
+		return errors.New("authenticator data is for a different relying party")
+	}
+	if data.flags&flagUserPresent == 0 {
+		return errors.New("user was not present")
+	}
+	return nil
+}
+
+// Credential is a verified public key credential, ready to be stored
+type Credential struct {
+	ID []byte
+	// PublicKey is PKIX encoded
+	PublicKey []byte
+	Algorithm int64
+	SignCount uint32
+}
+
+// VerifyRegistration checks the response to navigator.credentials.create, returning the new credential.
+// The caller must have already checked clientData.Challenge is one it issued.
+func (rp RelyingParty) VerifyRegistration(clientData *ClientData, attestationObject []byte) (*Credential, error) {
+	err := rp.checkClientData(clientData, "webauthn.create")
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("malformed attestation object: %w", err)
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("attestation object is not a map")
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestation object has no authenticator data")
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	err = rp.checkAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, errors.New("no credential was created")
+	}
+
+	alg, pub, err := parseCOSEKey(authData.publicKey)
+	if err != nil {
+		return nil, err
+	}
+	pkix, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return &Credential{
+		ID:        authData.credentialID,
+		PublicKey: pkix,
+		Algorithm: alg,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// Assertion is the result of a successful authentication
+type Assertion struct {
+	SignCount uint32
+	// UserVerified is true if the authenticator checked a PIN or biometric, making it two factors on its own
+	UserVerified bool
+}
+
+// VerifyAssertion checks the response to navigator.credentials.get was signed by credential.
+// The caller must have already checked clientData.Challenge is one it issued.
+func (rp RelyingParty) VerifyAssertion(credential Credential, clientData *ClientData, rawAuthData []byte, signature []byte) (*Assertion, error) {
+	err := rp.checkClientData(clientData, "webauthn.get")
+	if err != nil {
+		return nil, err
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	err = rp.checkAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientData.raw)
+	signed := append(append([]byte(nil), authData.raw...), clientDataHash[:]...)
+	err = verifySignature(credential.Algorithm, credential.PublicKey, signed, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	// Authenticators that count signatures should always go up, if they don't it's been cloned.
+	// Lots of passkeys always send 0, so that's allowed.
+	if authData.signCount != 0 || credential.SignCount != 0 {
+		if authData.signCount <= credential.SignCount {
+			return nil, errors.New("signature counter went backwards, the authenticator may have been cloned")
+		}
+	}
+
+	return &Assertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
@@ -0,0 +1,336 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encodeCBOR is the opposite of decodeCBOR, for building test authenticator responses
+func encodeCBOR(value interface{}) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			buf := []byte{major<<5 | 25, 0, 0}
+			binary.BigEndian.PutUint16(buf[1:], uint16(n))
+			return buf
+		default:
+			buf := []byte{major<<5 | 26, 0, 0, 0, 0}
+			binary.BigEndian.PutUint32(buf[1:], uint32(n))
+			return buf
+		}
+	}
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case int64:
+		return encodeCBOR(int(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []interface{}:
+		out := head(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := head(5, uint64(len(v)))
+		for key, item := range v {
+			out = append(out, encodeCBOR(key)...)
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	}
+	panic("can't encode")
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	// Examples from RFC 7049 Appendix A
+	tests := map[string]interface{}{
+		"00":                 int64(0),
+		"17":                 int64(23),
+		"1818":               int64(24),
+		"1903e8":             int64(1000),
+		"1a000f4240":         int64(1000000),
+		"20":                 int64(-1),
+		"3863":               int64(-100),
+		"f4":                 false,
+		"f5":                 true,
+		"f6":                 nil,
+		"4401020304":         []byte{1, 2, 3, 4},
+		"6449455446":         "IETF",
+		"83010203":           []interface{}{int64(1), int64(2), int64(3)},
+		"a201020304":         map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)},
+		"a26161016162820203": map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}},
+		"c11a514b67b0":       int64(1363896240), // tagged
+	}
+	for input, expected := range tests {
+		data, _ := hex.DecodeString(input)
+		value, rest, err := decodeCBOR(data)
+		if assert.NoError(t, err, input) {
+			assert.Equal(t, expected, value, input)
+			assert.Empty(t, rest, input)
+		}
+	}
+
+	// Trailing data is returned
+	_, rest, err := decodeCBOR([]byte{0x01, 0x02})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x02}, rest)
+
+	for _, input := range []string{"", "18", "44010203", "9f", "a1", "1bffffffffffffffff", "f97c00"} {
+		data, _ := hex.DecodeString(input)
+		_, _, err := decodeCBOR(data)
+		assert.Error(t, err, input)
+	}
+
+	// Deep nesting is rejected rather than recursing forever
+	nested := make([]byte, 1000)
+	for i := range nested {
+		nested[i] = 0x81
+	}
+	_, _, err = decodeCBOR(nested)
+	assert.Error(t, err)
+}
+
+// testAuthenticator pretends to be a security key
+type testAuthenticator struct {
+	t            *testing.T
+	rpID         string
+	origin       string
+	credentialID []byte
+	cose         []byte
+	sign         func(data []byte) []byte
+	signCount    uint32
+}
+
+func newES256Authenticator(t *testing.T, rpID string, origin string) *testAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pad := func(b []byte) []byte { return append(make([]byte, 32-len(b)), b...) }
+	return &testAuthenticator{
+		t:            t,
+		rpID:         rpID,
+		origin:       origin,
+		credentialID: []byte("test credential"),
+		cose: encodeCBOR(map[interface{}]interface{}{
+			coseKty: coseKtyEC2,
+			coseAlg: AlgES256,
+			coseCrv: coseP256,
+			coseX:   pad(key.X.Bytes()),
+			coseY:   pad(key.Y.Bytes()),
+		}),
+		sign: func(data []byte) []byte {
+			hash := sha256.Sum256(data)
+			r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+			require.NoError(t, err)
+			sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+			require.NoError(t, err)
+			return sig
+		},
+	}
+}
+
+func newEdDSAAuthenticator(t *testing.T, rpID string, origin string) *testAuthenticator {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return &testAuthenticator{
+		t:            t,
+		rpID:         rpID,
+		origin:       origin,
+		credentialID: []byte("ed25519 credential"),
+		cose: encodeCBOR(map[interface{}]interface{}{
+			coseKty: coseKtyOKP,
+			coseAlg: AlgEdDSA,
+			coseCrv: coseEd25519,
+			coseX:   []byte(pub),
+		}),
+		sign: func(data []byte) []byte {
+			return ed25519.Sign(priv, data)
+		},
+	}
+}
+
+func (a *testAuthenticator) clientData(typ string, challenge []byte) []byte {
+	data, err := json.Marshal(map[string]interface{}{
+		"type":      typ,
+		"challenge": Bytes(challenge),
+		"origin":    a.origin,
+	})
+	require.NoError(a.t, err)
+	return data
+}
+
+func (a *testAuthenticator) authData(flags byte, attested bool) []byte {
+	hash := sha256.Sum256([]byte(a.rpID))
+	data := append(hash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = append(data, byte(len(a.credentialID)>>8), byte(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.cose...)
+	}
+	return data
+}
+
+func (a *testAuthenticator) create(challenge []byte) (clientDataJSON []byte, attestationObject []byte) {
+	return a.clientData("webauthn.create", challenge), encodeCBOR(map[interface{}]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[interface{}]interface{}{},
+		"authData": a.authData(flagUserPresent|flagAttestedCredential, true),
+	})
+}
+
+func (a *testAuthenticator) get(challenge []byte, flags byte) (clientDataJSON []byte, authData []byte, signature []byte) {
+	clientDataJSON = a.clientData("webauthn.get", challenge)
+	authData = a.authData(flags, false)
+	hash := sha256.Sum256(clientDataJSON)
+	signature = a.sign(append(append([]byte(nil), authData...), hash[:]...))
+	return
+}
+
+func register(t *testing.T, rp RelyingParty, a *testAuthenticator) *Credential {
+	clientDataJSON, attestationObject := a.create([]byte("register challenge"))
+	clientData, err := ParseClientData(clientDataJSON)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("register challenge"), []byte(clientData.Challenge))
+	credential, err := rp.VerifyRegistration(clientData, attestationObject)
+	require.NoError(t, err)
+	return credential
+}
+
+func login(rp RelyingParty, a *testAuthenticator, credential Credential, flags byte) (*Assertion, error) {
+	clientDataJSON, authData, signature := a.get([]byte("login challenge"), flags)
+	clientData, err := ParseClientData(clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	return rp.VerifyAssertion(credential, clientData, authData, signature)
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	rp := RelyingParty{ID: "impactclient.net", Name: "Impact"}
+
+	for _, a := range []*testAuthenticator{
+		newES256Authenticator(t, rp.ID, "https://impactclient.net"),
+		newEdDSAAuthenticator(t, rp.ID, "https://account.impactclient.net"),
+	} {
+		credential := register(t, rp, a)
+		assert.Equal(t, a.credentialID, credential.ID)
+
+		assertion, err := login(rp, a, *credential, flagUserPresent|flagUserVerified)
+		if assert.NoError(t, err) {
+			assert.True(t, assertion.UserVerified)
+		}
+		assertion, err = login(rp, a, *credential, flagUserPresent)
+		if assert.NoError(t, err) {
+			assert.False(t, assertion.UserVerified)
+		}
+
+		// The user has to actually touch it
+		_, err = login(rp, a, *credential, 0)
+		assert.Error(t, err)
+	}
+}
+
+func TestSignCount(t *testing.T) {
+	rp := RelyingParty{ID: "impactclient.net"}
+	a := newES256Authenticator(t, rp.ID, "https://impactclient.net")
+	credential := register(t, rp, a)
+
+	a.signCount = 5
+	assertion, err := login(rp, a, *credential, flagUserPresent)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(5), assertion.SignCount)
+	credential.SignCount = assertion.SignCount
+
+	// A clone would be behind the original
+	a.signCount = 5
+	_, err = login(rp, a, *credential, flagUserPresent)
+	assert.Error(t, err)
+	a.signCount = 0
+	_, err = login(rp, a, *credential, flagUserPresent)
+	assert.Error(t, err)
+}
+
+func TestRejectsWrongRelyingParty(t *testing.T) {
+	rp := RelyingParty{ID: "impactclient.net"}
+
+	// Phishing site, the browser puts the real origin in client data
+	a := newES256Authenticator(t, rp.ID, "https://impactclient.net.evil.com")
+	clientDataJSON, attestationObject := a.create([]byte("challenge"))
+	clientData, err := ParseClientData(clientDataJSON)
+	require.NoError(t, err)
+	_, err = rp.VerifyRegistration(clientData, attestationObject)
+	assert.Error(t, err)
+
+	// Credential scoped to another domain
+	a = newES256Authenticator(t, "evil.com", "https://impactclient.net")
+	clientDataJSON, attestationObject = a.create([]byte("challenge"))
+	clientData, err = ParseClientData(clientDataJSON)
+	require.NoError(t, err)
+	_, err = rp.VerifyRegistration(clientData, attestationObject)
+	assert.Error(t, err)
+
+	// Plain http is only ok on localhost
+	a = newES256Authenticator(t, rp.ID, "http://impactclient.net")
+	clientDataJSON, attestationObject = a.create([]byte("challenge"))
+	clientData, err = ParseClientData(clientDataJSON)
+	require.NoError(t, err)
+	_, err = rp.VerifyRegistration(clientData, attestationObject)
+	assert.Error(t, err)
+	local := RelyingParty{ID: "localhost"}
+	a = newES256Authenticator(t, local.ID, "http://localhost:3000")
+	register(t, local, a)
+}
+
+func TestRejectsWrongCeremony(t *testing.T) {
+	rp := RelyingParty{ID: "impactclient.net"}
+	a := newES256Authenticator(t, rp.ID, "https://impactclient.net")
+	credential := register(t, rp, a)
+
+	// A registration's client data can't be used to log in
+	clientDataJSON, _ := a.create([]byte("challenge"))
+	_, authData, signature := a.get([]byte("challenge"), flagUserPresent)
+	clientData, err := ParseClientData(clientDataJSON)
+	require.NoError(t, err)
+	_, err = rp.VerifyAssertion(*credential, clientData, authData, signature)
+	assert.Error(t, err)
+
+	// Signatures from a different key are rejected
+	other := newES256Authenticator(t, rp.ID, "https://impactclient.net")
+	_, err = login(rp, other, *credential, flagUserPresent)
+	assert.Error(t, err)
+}
+
+func TestBytesJSON(t *testing.T) {
+	var b Bytes
+	assert.NoError(t, json.Unmarshal([]byte(`"AQID"`), &b))
+	assert.Equal(t, Bytes{1, 2, 3}, b)
+	assert.NoError(t, json.Unmarshal([]byte(`"AQ=="`), &b))
+	assert.Equal(t, Bytes{1}, b)
+	data, err := json.Marshal(Bytes{0xfb, 0xff})
+	assert.NoError(t, err)
+	assert.Equal(t, `"-_8"`, string(data))
+}
@@ -14,6 +14,46 @@
         }
     }
 
+    // POSTs a token from an email link, resolving to the email address it was for
+    function emailToken(path, token) {
+        return new Promise(function (resolve, reject) {
+            $.post({
+                url: baseUrl + path,
+                data: {
+                    token: token
+                },
+                dataType: "json",
+                error: function (jqXHR, textStatus, errorThrown) {
+                    reject(messageFromjqXHR(jqXHR))
+                },
+                success: function (data, status) {
+                    resolve(data.email)
+                }
+            })
+        })
+    }
+
+    // The in-flight request for a new access token, see api.refresh
+    var refreshing = null
+
+    // Makes an authenticated request to one of the /user/me/2fa endpoints
+    function twoFactorRequest(method, path, data) {
+        return new Promise(function (resolve, reject) {
+            $.withAuth({
+                url: baseUrl + "/user/me/2fa" + path,
+                method: method,
+                data: data,
+                dataType: "json",
+                error: function (jqXHR, textStatus, errorThrown) {
+                    reject(messageFromjqXHR(jqXHR))
+                },
+                success: function (data, status) {
+                    resolve(data)
+                }
+            })
+        })
+    }
+
     function addDashesToUUID(id) {
         // Sanitize first, then add dashes where we want them
         id = id.replace(/-/g, "")
@@ -53,11 +93,14 @@
         // Add a way check if logged in
         logout: function() {
             window.localStorage.removeItem("access_token")
+            window.localStorage.removeItem("refresh_token")
         },
         setToken: function(token) {
             $.withAuth.setToken(token)
         },
-        // login with either discord token or username + password
+        // login with either discord token or username + password.
+        // Resolves to "logged in", or to {two_factor: true, challenge_token: ...} if the account has two factor
+        // authentication, in which case pass the challenge token and the user's code to loginTwoFactor
         login: function(email, password) {
             var url = baseUrl + "/login/" + (password ? "password" : "discord")
             var fields = {
@@ -69,16 +112,122 @@
                 $.post({
                     url: url,
                     data: fields,
+                    dataType: "json",
                     error: function (jqXHR, textStatus, errorThrown) {
                         reject(messageFromjqXHR(jqXHR))
                     },
                     success: function (data, status) {
-                        api.setToken(data)
+                        if (data.challenge_token) {
+                            resolve({two_factor: true, challenge_token: data.challenge_token})
+                            return
+                        }
+                        $.withAuth.setTokens(data)
+                        resolve("logged in")
+                    }
+                })
+            })
+        },
+        // finish logging in with a code from the user's authenticator app, or one of their recovery codes
+        loginTwoFactor: function(challengeToken, code) {
+            return new Promise(function (resolve, reject) {
+                $.post({
+                    url: baseUrl + "/login/2fa",
+                    data: {
+                        "challenge_token": challengeToken,
+                        code: code
+                    },
+                    dataType: "json",
+                    error: function (jqXHR, textStatus, errorThrown) {
+                        reject(messageFromjqXHR(jqXHR))
+                    },
+                    success: function (data, status) {
+                        $.withAuth.setTokens(data)
                         resolve("logged in")
                     }
                 })
             })
         },
+        // swaps the refresh token for a new access token, requests that fail because it expired call this themselves
+        refresh: function() {
+            if (refreshing) return refreshing
+            var refreshToken = window.localStorage.getItem("refresh_token")
+            if (!refreshToken) return Promise.reject("not logged in")
+
+            // Refresh tokens can only be used once, so everything waiting on a new token shares this request
+            refreshing = new Promise(function (resolve, reject) {
+                $.post({
+                    url: baseUrl + "/login/refresh",
+                    data: {
+                        "refresh_token": refreshToken
+                    },
+                    dataType: "json",
+                    error: function (jqXHR, textStatus, errorThrown) {
+                        refreshing = null
+                        if (jqXHR.status === 401) api.logout()
+                        reject(messageFromjqXHR(jqXHR))
+                    },
+                    success: function (data, status) {
+                        refreshing = null
+                        $.withAuth.setTokens(data)
+                        resolve(data.access_token)
+                    }
+                })
+            })
+            return refreshing
+        },
+        // two factor authentication status, {enabled, pending, required, recovery_codes_remaining}
+        twoFactor: function() {
+            return twoFactorRequest("GET", "")
+        },
+        // starts enrolling an authenticator app, resolves to {secret, uri} to show the user
+        startTOTP: function() {
+            return twoFactorRequest("POST", "/totp")
+        },
+        // finishes enrolling with a code from the authenticator app, resolves to {recovery_codes}
+        verifyTOTP: function(code) {
+            return twoFactorRequest("POST", "/totp/verify", {code: code})
+        },
+        // replaces the recovery codes, resolves to {recovery_codes}
+        newRecoveryCodes: function(code) {
+            return twoFactorRequest("POST", "/recovery", {code: code})
+        },
+        // turns off two factor authentication
+        disableTwoFactor: function(code) {
+            return twoFactorRequest("DELETE", "", {code: code})
+        },
+        // checks an oauth authorization request, resolves to {client_id, client_name, scopes, redirect_uri} to show the user.
+        // params are the query params the client sent the user to the authorize page with
+        oauthRequest: function(params) {
+            return new Promise(function (resolve, reject) {
+                $.get({
+                    url: baseUrl + "/oauth/authorize",
+                    data: params,
+                    dataType: "json",
+                    error: function (jqXHR, textStatus, errorThrown) {
+                        reject(messageFromjqXHR(jqXHR))
+                    },
+                    success: function (data, status) {
+                        resolve(data)
+                    }
+                })
+            })
+        },
+        // approves or denies an oauth authorization request, resolves to the url to send the user back to the client with
+        oauthAuthorize: function(params, approve) {
+            return new Promise(function (resolve, reject) {
+                $.withAuth.post({
+                    url: baseUrl + "/oauth/authorize",
+                    data: $.extend({}, params, {approve: !!approve}),
+                    dataType: "json",
+                    error: function (jqXHR, textStatus, errorThrown) {
+                        reject(messageFromjqXHR(jqXHR))
+                    },
+                    success: function (data, status) {
+                        resolve(data["redirect_to"])
+                    }
+                })
+            })
+        },
         // register an account. fields should be usable as jQuery's ajax body data
         register: function(fields) {
             var post = api.isLoggedIn() ? $.withAuth.post : $.post
@@ -133,7 +282,8 @@
                 currency = undefined
             }
             return new Promise(function(resolve, reject) {
-                $.post({
+                // If logged in, the donation is credited straight to the account
+                $.withAuth.post({
                     url: baseUrl + "/stripe/createpayment",
                     data: {
                         currency: currency,
@@ -164,7 +314,47 @@
                         reject(messageFromjqXHR(jqXHR))
                     },
                     success: function (data, status) {
-                        resolve(data.token)
+                        resolve(data)
+                    }
+                })
+            })
+        },
+        // creates a PayPal order, redirect to its approve_url to let the donor pay
+        createPayPalOrder: function(currency, amount, email, verification) {
+            return new Promise(function(resolve, reject) {
+                // If logged in, the donation is credited straight to the account
+                $.withAuth.post({
+                    url: baseUrl + "/paypal/createorder",
+                    data: {
+                        currency: currency,
+                        amount: amount,
+                        email: email,
+                        "g-recaptcha-response": verification
+                    },
+                    dataType: "json",
+                    error: function (jqXHR, textStatus, errorThrown) {
+                        reject(messageFromjqXHR(jqXHR))
+                    },
+                    success: function (data, status) {
+                        resolve(data)
+                    }
+                })
+            })
+        },
+        // captures a PayPal order once the donor has approved it, resolves with the order and token (if any)
+        capturePayPalOrder: function(orderID) {
+            return new Promise(function (resolve, reject) {
+                $.post({
+                    url: baseUrl + "/paypal/capture",
+                    data: {
+                        'order_id': orderID
+                    },
+                    dataType: "json",
+                    error: function (jqXHR, textStatus, errorThrown) {
+                        reject(messageFromjqXHR(jqXHR))
+                    },
+                    success: function (data, status) {
+                        resolve(data)
                     }
                 })
             })
@@ -229,6 +419,14 @@
                 })
             })
         },
+        // Confirms an email address using the token from a verification email, resolves to the now verified address
+        verifyEmail: function(token) {
+            return emailToken("/email/verify", token)
+        },
+        // Undoes an email change using the token from a change notification, resolves to the restored address
+        revertEmail: function(token) {
+            return emailToken("/email/revert", token)
+        },
         /*
             {
                 id: the user's id
@@ -348,6 +546,27 @@
                 // TODO error out?
             }
 
+            // Access tokens from a json login only last a few minutes, so get a new one and try again once
+            var error = options.error
+            options.error = function (jqXHR, textStatus, errorThrown) {
+                if (jqXHR.status !== 401 || options.refreshed || !window.localStorage.getItem("refresh_token")) {
+                    if (error) error.apply(this, arguments)
+                    return
+                }
+                var args = arguments
+                var self = this
+                window.api.refresh()
+                    .then(function (token) {
+                        options.refreshed = true
+                        options.error = error
+                        options.headers["Authorization"] = "Bearer " + token
+                        $.ajax(options)
+                    })
+                    .catch(function () {
+                        if (error) error.apply(self, args)
+                    })
+            }
+
             // Hand over to jQuery's method
             return $.ajax(options)
         }
@@ -383,8 +602,19 @@
         return $.withAuth(url, options)
     }
 
-    // Add a way to set token
+    // Add a way to set token, plain text tokens last as long as their session so there's nothing to refresh
     $.withAuth.setToken = function(token) {
         window.localStorage.setItem("access_token", token)
+        window.localStorage.removeItem("refresh_token")
+    }
+
+    // Add a way to set the tokens from a json login response
+    $.withAuth.setTokens = function(data) {
+        window.localStorage.setItem("access_token", data["access_token"])
+        if (data["refresh_token"]) {
+            window.localStorage.setItem("refresh_token", data["refresh_token"])
+        } else {
+            window.localStorage.removeItem("refresh_token")
+        }
     }
 })(jQuery);